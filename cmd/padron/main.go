@@ -0,0 +1,116 @@
+// Command padron importa los padrones que publica SUNAT: el padrón reducido de
+// RUC (padron_reducido_ruc.zip o padron_reducido_ruc.txt) en la tabla de
+// contribuyentes y los padrones de agentes de retención, agentes de percepción
+// y buenos contribuyentes en padron_inscripciones. Está pensado para
+// ejecutarse periódicamente.
+package main
+
+import (
+	"facturacion_sunat_api_go/internal/config"
+	"facturacion_sunat_api_go/internal/models"
+	"facturacion_sunat_api_go/internal/repository"
+	"facturacion_sunat_api_go/internal/services"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// urlPadron es la dirección pública del padrón reducido de RUC
+const urlPadron = "http://www2.sunat.gob.pe/padron_reducido_ruc.zip"
+
+// padrones relaciona el valor de -padron con el padrón que se importa
+var padrones = map[string]string{
+	"ruc":        models.PadronRUC,
+	"retencion":  models.PadronAgentesRetencion,
+	"percepcion": models.PadronAgentesPercepcion,
+	"buenos":     models.PadronBuenosContribuyentes,
+}
+
+func main() {
+	tipo := flag.String("padron", "ruc", "padrón a importar: ruc, retencion, percepcion o buenos")
+	archivo := flag.String("archivo", "", "ruta o URL del padrón (.zip o .txt); por defecto, la URL del padrón de RUC")
+	lote := flag.Int("lote", 1000, "registros por sentencia de inserción")
+	flag.Parse()
+
+	padron, ok := padrones[*tipo]
+	if !ok {
+		log.Fatalf("Padrón desconocido: %s", *tipo)
+	}
+	if *archivo == "" {
+		if padron != models.PadronRUC {
+			log.Fatalf("Indique con -archivo el padrón de %s descargado de SUNAT", *tipo)
+		}
+		*archivo = urlPadron
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Error cargando configuración: %v", err)
+	}
+
+	db, err := repository.InitDatabase(cfg.Database)
+	if err != nil {
+		log.Fatalf("Error inicializando base de datos: %v", err)
+	}
+	defer db.Close()
+
+	ruta := *archivo
+	if strings.HasPrefix(ruta, "http://") || strings.HasPrefix(ruta, "https://") {
+		descargado, err := descargar(ruta)
+		if err != nil {
+			log.Fatalf("Error descargando el padrón: %v", err)
+		}
+		defer os.RemoveAll(filepath.Dir(descargado))
+		ruta = descargado
+	}
+
+	padronService := services.NewPadronService(repository.NewContribuyenteRepository(db))
+	padronService.TamanoLote = *lote
+
+	log.Printf("Importando padrón %s desde %s", padron, *archivo)
+	inicio := time.Now()
+	importacion, err := padronService.Importar(padron, ruta)
+	if err != nil {
+		log.Fatalf("Error importando el padrón: %v", err)
+	}
+
+	log.Printf("Padrón importado en %s: %d leídos, %d nuevos, %d actualizados, %d eliminados, %d rechazados",
+		time.Since(inicio).Round(time.Second), importacion.Leidos, importacion.Insertados,
+		importacion.Actualizados, importacion.Eliminados, importacion.Rechazados)
+}
+
+// descargar guarda el padrón en un directorio temporal; el .zip debe estar en
+// disco para poder leer su índice
+func descargar(url string) (string, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("respuesta HTTP %d", resp.StatusCode)
+	}
+
+	directorio, err := os.MkdirTemp("", "padron")
+	if err != nil {
+		return "", err
+	}
+	destino := filepath.Join(directorio, path.Base(resp.Request.URL.Path))
+	f, err := os.Create(destino)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		return "", err
+	}
+	return destino, f.Close()
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"errors"
 	"facturacion_sunat_api_go/internal/config"
 	"facturacion_sunat_api_go/internal/handlers"
 	"facturacion_sunat_api_go/internal/middleware"
 	"facturacion_sunat_api_go/internal/repository"
 	"facturacion_sunat_api_go/internal/services"
+	"facturacion_sunat_api_go/pkg/catalogos"
 	"facturacion_sunat_api_go/pkg/certificate"
+	"facturacion_sunat_api_go/pkg/xsd"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -30,27 +34,57 @@ func main() {
 
 	// Inicializar repositorios
 	comprobanteRepo := repository.NewComprobanteRepository(db)
+	tasaRepo := repository.NewTasaRepository(db)
+	contribuyenteRepo := repository.NewContribuyenteRepository(db)
+	tipoCambioRepo := repository.NewTipoCambioRepository(db)
+	establecimientoRepo := repository.NewEstablecimientoRepository(db)
 
 	// Inicializar servicios
 	certManager := certificate.NewManager()
 	ublService := services.NewUBLService()
 	conversionService := services.NewConversionService(ublService)
+	conversionService.TasaService = services.NewTasaService(tasaRepo)
+	if err := conversionService.TasaService.Cargar(); err != nil {
+		log.Fatalf("Error cargando tasas de impuestos: %v", err)
+	}
+	if err := cargarCatalogo(cfg.SUNAT.CatalogoProductos, catalogos.CargarProductos, "sunat.catalogo_productos"); err != nil {
+		log.Fatalf("Error cargando el catálogo 25: %v", err)
+	}
+	if err := cargarCatalogo(cfg.SUNAT.CatalogoUbigeo, catalogos.CargarUbigeos, "sunat.catalogo_ubigeo"); err != nil {
+		log.Fatalf("Error cargando el ubigeo INEI: %v", err)
+	}
+	if _, err := xsd.UBL21(); errors.Is(err, xsd.ErrEsquemasNoInstalados) {
+		log.Fatalf("Error cargando los esquemas UBL 2.1: %v (ver pkg/xsd/esquemas/LEEME.md)", err)
+	} else if err != nil {
+		log.Fatalf("Error compilando los esquemas UBL 2.1: %v", err)
+	}
 	signingService := services.NewSigningService(certManager, ublService)
 	encodingService := services.NewEncodingService()
 	sunatService := services.NewSUNATService(&cfg.SUNAT, encodingService)
+	tipoCambioService := services.NewTipoCambioService(tipoCambioRepo)
+	conversionService.TipoCambioService = tipoCambioService
+	detraccionService := services.NewDetraccionService(tipoCambioService)
+	establecimientoService := services.NewEstablecimientoService(establecimientoRepo)
 
 	// Inicializar handlers
 	healthHandler := handlers.NewHealthHandler(db, sunatService.Client)
+	catalogoHandler := handlers.NewCatalogoHandler()
 	comprobanteHandler := handlers.NewComprobanteHandler(
 		comprobanteRepo,
 		conversionService,
 		signingService,
 		encodingService,
 		sunatService,
+		services.NewValidationService(),
+		services.NewPadronService(contribuyenteRepo),
+		tipoCambioService,
+		detraccionService,
+		establecimientoService,
 	)
+	establecimientoHandler := handlers.NewEstablecimientoHandler(establecimientoService)
 
 	// Configurar router
-	router := setupRouter(healthHandler, comprobanteHandler)
+	router := setupRouter(healthHandler, comprobanteHandler, catalogoHandler, establecimientoHandler)
 
 	// Configurar servidor
 	server := &http.Server{
@@ -68,7 +102,7 @@ func main() {
 	}
 }
 
-func setupRouter(healthHandler *handlers.HealthHandler, comprobanteHandler *handlers.ComprobanteHandler) *gin.Engine {
+func setupRouter(healthHandler *handlers.HealthHandler, comprobanteHandler *handlers.ComprobanteHandler, catalogoHandler *handlers.CatalogoHandler, establecimientoHandler *handlers.EstablecimientoHandler) *gin.Engine {
 	// Configurar modo Gin
 	if getEnvironment() == "production" {
 		gin.SetMode(gin.ReleaseMode)
@@ -96,6 +130,7 @@ func setupRouter(healthHandler *handlers.HealthHandler, comprobanteHandler *hand
 		v1.POST("/invoices", comprobanteHandler.CreateFactura)
 		v1.POST("/credit-notes", comprobanteHandler.CreateNotaCredito)
 		v1.POST("/debit-notes", comprobanteHandler.CreateNotaDebito)
+		v1.POST("/purchase-settlements", comprobanteHandler.CreateLiquidacionCompra)
 		v1.GET("/documents/:id/status", comprobanteHandler.GetComprobanteResult)
 		v1.GET("/documents/:id/xml", comprobanteHandler.DownloadXML)
 		v1.GET("/documents/:id/pdf", comprobanteHandler.DownloadPDF)
@@ -115,8 +150,26 @@ func setupRouter(healthHandler *handlers.HealthHandler, comprobanteHandler *hand
 		utils := v1.Group("/utils")
 		{
 			utils.POST("/convert-ubl", comprobanteHandler.ConvertToUBL)
+			utils.POST("/validate", comprobanteHandler.ValidateComprobante)
 			utils.POST("/calculate-totals", comprobanteHandler.CalculateTotals)
+			utils.GET("/tax-codes", comprobanteHandler.GetTaxCodes)
+			utils.GET("/document-types", comprobanteHandler.GetDocumentTypes)
+		}
+
+		// Catálogos SUNAT
+		catalogs := v1.Group("/catalogs")
+		{
+			catalogs.GET("", catalogoHandler.ListCatalogos)
+			catalogs.GET("/:num", catalogoHandler.GetCatalogo)
+			catalogs.GET("/:num/:code", catalogoHandler.GetCodigo)
 		}
+		v1.GET("/ubigeos", catalogoHandler.BuscarUbigeos)
+		v1.GET("/ubigeos/:code", catalogoHandler.GetUbigeo)
+		v1.GET("/padrones/:ruc", comprobanteHandler.GetPadronesRUC)
+
+		// Establecimientos y series de cada emisor
+		v1.GET("/emisores/:ruc/establecimientos", establecimientoHandler.ListEstablecimientos)
+		v1.PUT("/emisores/:ruc/establecimientos/:codigo", establecimientoHandler.SaveEstablecimiento)
 	}
 
 	// Endpoints requeridos por API FE Perú (fuera de /api/v1 para cumplir con el estándar del PDF)
@@ -138,4 +191,19 @@ func getEnvironment() string {
 		return "development"
 	}
 	return env
-}
\ No newline at end of file
+}
+
+// cargarCatalogo carga la versión completa de un catálogo desde el archivo
+// configurado; sin archivo se usa la selección embebida
+func cargarCatalogo(ruta string, cargar func(io.Reader) error, clave string) error {
+	if ruta == "" {
+		log.Printf("%s no configurado: se usa la selección embebida", clave)
+		return nil
+	}
+	archivo, err := os.Open(ruta)
+	if err != nil {
+		return err
+	}
+	defer archivo.Close()
+	return cargar(archivo)
+}
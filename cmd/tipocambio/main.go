@@ -0,0 +1,53 @@
+// Command tipocambio importa los tipos de cambio oficiales desde los archivos
+// CSV que exportan la SBS (tipo de cambio promedio ponderado) y SUNAT. Puede
+// ejecutarse con el histórico completo o a diario con el último archivo: una
+// fecha ya registrada se actualiza.
+package main
+
+import (
+	"facturacion_sunat_api_go/internal/config"
+	"facturacion_sunat_api_go/internal/models"
+	"facturacion_sunat_api_go/internal/repository"
+	"facturacion_sunat_api_go/internal/services"
+	"flag"
+	"log"
+	"os"
+	"strings"
+)
+
+func main() {
+	archivo := flag.String("archivo", "", "ruta del archivo CSV de tipos de cambio")
+	fuente := flag.String("fuente", models.FuenteTipoCambioSBS, "origen del archivo: SBS o SUNAT")
+	moneda := flag.String("moneda", "USD", "moneda de los archivos sin columna de moneda")
+	flag.Parse()
+
+	if *archivo == "" {
+		log.Fatal("Indique con -archivo el CSV de tipos de cambio")
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Error cargando configuración: %v", err)
+	}
+
+	db, err := repository.InitDatabase(cfg.Database)
+	if err != nil {
+		log.Fatalf("Error inicializando base de datos: %v", err)
+	}
+	defer db.Close()
+
+	f, err := os.Open(*archivo)
+	if err != nil {
+		log.Fatalf("Error abriendo %s: %v", *archivo, err)
+	}
+	defer f.Close()
+
+	tipoCambioService := services.NewTipoCambioService(repository.NewTipoCambioRepository(db))
+	importacion, err := tipoCambioService.ImportarCSV(f, strings.ToUpper(*fuente), *moneda)
+	if err != nil {
+		log.Fatalf("Error importando tipos de cambio: %v", err)
+	}
+
+	log.Printf("Tipos de cambio importados: %d leídos, %d guardados, %d rechazados",
+		importacion.Leidos, importacion.Guardados, importacion.Rechazados)
+}
@@ -50,6 +50,9 @@ type SUNATConfig struct {
 	GuiaProduccion     string `yaml:"guia_produccion"`
 	RetencionBeta      string `yaml:"retencion_beta"`
 	RetencionProduccion string `yaml:"retencion_produccion"`
+	PercepcionRegimen  string `yaml:"percepcion_regimen"`
+	CatalogoProductos  string `yaml:"catalogo_productos"`
+	CatalogoUbigeo     string `yaml:"catalogo_ubigeo"`
 }
 
 type SecurityConfig struct {
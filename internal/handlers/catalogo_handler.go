@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"facturacion_sunat_api_go/pkg/catalogos"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CatalogoHandler expone los catálogos SUNAT para que los clientes construyan
+// sus formularios con los mismos códigos que valida la API
+type CatalogoHandler struct{}
+
+func NewCatalogoHandler() *CatalogoHandler {
+	return &CatalogoHandler{}
+}
+
+// resumenCatalogo describe un catálogo sin sus códigos
+type resumenCatalogo struct {
+	Numero  string `json:"numero"`
+	Nombre  string `json:"nombre"`
+	Version string `json:"version"`
+	Vigente bool   `json:"vigente"`
+	URI     string `json:"uri"`
+	Formato string `json:"formato,omitempty"`
+	Total   int    `json:"total"`
+}
+
+func resumir(catalogo *catalogos.Catalogo) resumenCatalogo {
+	return resumenCatalogo{
+		Numero:  catalogo.Numero,
+		Nombre:  catalogo.Nombre,
+		Version: catalogo.Version,
+		Vigente: catalogo.Vigente,
+		URI:     catalogo.URI(),
+		Formato: catalogo.Formato,
+		Total:   len(catalogo.Codigos),
+	}
+}
+
+// ListCatalogos lista los catálogos disponibles
+func (h *CatalogoHandler) ListCatalogos(c *gin.Context) {
+	lista, err := catalogos.Listar()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Error cargando catálogos",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	resumenes := make([]resumenCatalogo, 0, len(lista))
+	for _, catalogo := range lista {
+		resumenes = append(resumenes, resumir(catalogo))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"catalogos": resumenes,
+	})
+}
+
+// GetCatalogo obtiene los códigos de un catálogo. El parámetro q filtra por
+// código o descripción.
+func (h *CatalogoHandler) GetCatalogo(c *gin.Context) {
+	catalogo, err := catalogos.Obtener(c.Param("num"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Catálogo no encontrado",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	codigos := catalogo.Filtrar(c.Query("q"))
+	if codigos == nil {
+		codigos = []catalogos.Codigo{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"catalogo": resumir(catalogo),
+		"codigos":  codigos,
+	})
+}
+
+// GetCodigo obtiene un código de un catálogo. En los catálogos que solo declaran
+// un formato (ubigeo, productos) se informa si el código es válido.
+func (h *CatalogoHandler) GetCodigo(c *gin.Context) {
+	catalogo, err := catalogos.Obtener(c.Param("num"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Catálogo no encontrado",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	codigo := c.Param("code")
+	if valor, ok := catalogo.Buscar(codigo); ok {
+		c.JSON(http.StatusOK, gin.H{
+			"catalogo": catalogo.Numero,
+			"codigo":   valor,
+			"valido":   true,
+		})
+		return
+	}
+	if catalogo.Valido(codigo) {
+		c.JSON(http.StatusOK, gin.H{
+			"catalogo": catalogo.Numero,
+			"codigo":   catalogos.Codigo{Codigo: codigo},
+			"valido":   true,
+		})
+		return
+	}
+
+	c.JSON(http.StatusNotFound, gin.H{
+		"error":   "Código no encontrado",
+		"details": "El código " + codigo + " no existe en el catálogo " + catalogo.Numero,
+	})
+}
+
+// BuscarUbigeos busca distritos por código o nombre (parámetro q)
+func (h *CatalogoHandler) BuscarUbigeos(c *gin.Context) {
+	ubicaciones, err := catalogos.FiltrarUbigeos(c.Query("q"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Error cargando ubigeos",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ubigeos": ubicaciones,
+	})
+}
+
+// GetUbigeo valida un código de ubigeo y retorna sus nombres oficiales
+func (h *CatalogoHandler) GetUbigeo(c *gin.Context) {
+	ubicacion, err := catalogos.BuscarUbigeo(c.Param("code"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Ubigeo no válido",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ubigeo": ubicacion,
+	})
+}
@@ -4,6 +4,8 @@ import (
 	"facturacion_sunat_api_go/internal/models"
 	"facturacion_sunat_api_go/internal/repository"
 	"facturacion_sunat_api_go/internal/services"
+	"facturacion_sunat_api_go/pkg/catalogos"
+	"facturacion_sunat_api_go/pkg/identidad"
 	"net/http"
 	"strconv"
 	"time"
@@ -14,24 +16,55 @@ import (
 	"path/filepath"
 	"strings"
 	"encoding/xml"
+	"errors"
 	"github.com/sirupsen/logrus"
 	"facturacion_sunat_api_go/internal/config"
 )
 
+// ComprobanteStore es el almacenamiento de comprobantes y lotes que usa el
+// handler; lo implementa repository.ComprobanteRepository
+type ComprobanteStore interface {
+	Create(comprobante *models.Comprobante) error
+	GetByID(id string) (*models.Comprobante, error)
+	List(page, limit int, filters map[string]interface{}) ([]*models.Comprobante, int, error)
+	Update(comprobante *models.Comprobante) error
+	Delete(id string) error
+	UpdateStatus(id string, status models.EstadoProceso) error
+	UpdateXML(id, xml string) error
+	UpdateSignedXML(id, xml string) error
+	UpdateSUNATInfo(id, ticket, estado string) error
+	UpdateCDR(id string, cdr []byte) error
+	UpdateArchivoZIP(id string, zip []byte) error
+	CreateBatch(batch *repository.Lote) error
+	GetBatch(id string) (*repository.Lote, error)
+	UpdateBatchProgress(id string, processed, successful, failed int) error
+	FinalizeBatch(id, estado string, fechaFin time.Time) error
+}
+
 type ComprobanteHandler struct {
-	repository        *repository.ComprobanteRepository
+	repository        ComprobanteStore
 	conversionService *services.ConversionService
 	signingService    *services.SigningService
 	encodingService   *services.EncodingService
 	sunatService      *services.SUNATService
+	validationService *services.ValidationService
+	padronService     *services.PadronService
+	tipoCambioService *services.TipoCambioService
+	detraccionService *services.DetraccionService
+	establecimientoService *services.EstablecimientoService
 }
 
 func NewComprobanteHandler(
-	repo *repository.ComprobanteRepository,
+	repo ComprobanteStore,
 	conversionService *services.ConversionService,
 	signingService *services.SigningService,
 	encodingService *services.EncodingService,
 	sunatService *services.SUNATService,
+	validationService *services.ValidationService,
+	padronService *services.PadronService,
+	tipoCambioService *services.TipoCambioService,
+	detraccionService *services.DetraccionService,
+	establecimientoService *services.EstablecimientoService,
 ) *ComprobanteHandler {
 	return &ComprobanteHandler{
 		repository:        repo,
@@ -39,7 +72,74 @@ func NewComprobanteHandler(
 		signingService:    signingService,
 		encodingService:   encodingService,
 		sunatService:      sunatService,
+		validationService: validationService,
+		padronService:     padronService,
+		tipoCambioService: tipoCambioService,
+		detraccionService: detraccionService,
+		establecimientoService: establecimientoService,
+	}
+}
+
+// completarReceptor llena desde el padrón de RUC los datos del receptor que el
+// cliente no envió. El padrón es opcional: si no se ha importado o el RUC no
+// figura en él, el comprobante se procesa con los datos recibidos.
+func (h *ComprobanteHandler) completarReceptor(receptor *models.Receptor) {
+	if h.padronService == nil {
+		return
+	}
+	if _, err := h.padronService.CompletarReceptor(receptor); err != nil && !errors.Is(err, repository.ErrContribuyenteNoEncontrado) {
+		logrus.WithError(err).Warn("No se pudo consultar el padrón de RUC")
+	}
+}
+
+// aplicarRegimenesIGV marca la retención o elige la tasa de percepción según
+// los padrones de agentes y de buenos contribuyentes. Igual que el padrón de
+// RUC, son opcionales: si no se pueden consultar la venta se procesa con lo
+// que indicó el cliente.
+func (h *ComprobanteHandler) aplicarRegimenesIGV(comprobante *models.Comprobante) {
+	if h.padronService == nil {
+		return
+	}
+	if err := h.padronService.AplicarRegimenesIGV(comprobante); err != nil {
+		logrus.WithError(err).Warn("No se pudo consultar los padrones de agentes del IGV")
+	}
+}
+
+// aplicarDetraccion valida la detracción contra el catálogo 54 y completa su
+// porcentaje y monto; en las facturas la propone a partir de los ítems. Debe
+// llamarse con los totales ya calculados.
+func (h *ComprobanteHandler) aplicarDetraccion(comprobante *models.Comprobante) error {
+	if h.detraccionService == nil {
+		return nil
 	}
+	if comprobante.Tipo != models.TipoFactura {
+		return h.detraccionService.Aplicar(comprobante)
+	}
+
+	factura := models.Factura{Comprobante: *comprobante}
+	if err := h.detraccionService.Proponer(&factura); err != nil {
+		return err
+	}
+	*comprobante = factura.Comprobante
+	return nil
+}
+
+// asignarEstablecimiento determina el establecimiento de la serie del
+// comprobante. Sin el servicio de establecimientos se emite con el código
+// informado o desde el domicilio fiscal.
+func (h *ComprobanteHandler) asignarEstablecimiento(c *gin.Context, comprobante *models.Comprobante) bool {
+	if h.establecimientoService == nil {
+		return true
+	}
+	if err := h.establecimientoService.Asignar(comprobante); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrEstablecimientoInvalido) {
+			status = http.StatusUnprocessableEntity
+		}
+		c.JSON(status, gin.H{"error": "Establecimiento inválido", "details": err.Error()})
+		return false
+	}
+	return true
 }
 
 func saveToXMLPruebas(fileName string, data []byte) error {
@@ -98,7 +198,8 @@ func (h *ComprobanteHandler) CreateComprobante(c *gin.Context) {
 		return
 	}
 
-	// Validar receptor según catálogo SUNAT
+	// Validar receptor según catálogo SUNAT, completando desde el padrón de RUC
+	h.completarReceptor(&comprobante.Receptor)
 	receptor := comprobante.Receptor
 	if receptor.TipoDocumento == "" || receptor.NumeroDocumento == "" || receptor.RazonSocial == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -107,17 +208,10 @@ func (h *ComprobanteHandler) CreateComprobante(c *gin.Context) {
 		})
 		return
 	}
-	if receptor.TipoDocumento == "6" && len(receptor.NumeroDocumento) != 11 {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "RUC receptor inválido",
-			"details": "El receptor es empresa y debe tener RUC de 11 dígitos.",
-		})
-		return
-	}
-	if receptor.TipoDocumento == "1" && len(receptor.NumeroDocumento) != 8 {
+	if hallazgos := h.validationService.ValidarReceptor(&comprobante); services.TieneErrores(hallazgos) {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "DNI receptor inválido",
-			"details": "El receptor es persona natural y debe tener DNI de 8 dígitos.",
+			"error":   "Documento del receptor inválido",
+			"details": hallazgos,
 		})
 		return
 	}
@@ -130,12 +224,19 @@ func (h *ComprobanteHandler) CreateComprobante(c *gin.Context) {
 		})
 		return
 	}
+	if hallazgos := h.validationService.ValidarFechaEmision(&comprobante); services.TieneErrores(hallazgos) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "Fecha de emisión inválida",
+			"details": hallazgos,
+		})
+		return
+	}
 
 	// Validar tipo de comprobante y moneda según catálogo SUNAT
-	if comprobante.Tipo.String() != "01" && comprobante.Tipo.String() != "03" && comprobante.Tipo.String() != "07" && comprobante.Tipo.String() != "08" {
+	if comprobante.Tipo.String() != "01" && comprobante.Tipo.String() != "03" && comprobante.Tipo.String() != "04" && comprobante.Tipo.String() != "07" && comprobante.Tipo.String() != "08" {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   "Tipo de comprobante inválido",
-			"details": "Tipo debe ser 01, 03, 07 u 08 según catálogo SUNAT.",
+			"details": "Tipo debe ser 01, 03, 04, 07 u 08 según catálogo SUNAT.",
 		})
 		return
 	}
@@ -156,11 +257,12 @@ func (h *ComprobanteHandler) CreateComprobante(c *gin.Context) {
 		return
 	}
 
-	// Validar totales (simple)
-	if comprobante.Totales.ImporteTotal <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Importe total inválido",
-			"details": "El importe total debe ser mayor a cero.",
+	// Validar unidades de medida y códigos de producto SUNAT de los ítems
+	observaciones := h.validationService.ValidarItems(&comprobante)
+	if services.TieneErrores(observaciones) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "Ítems con códigos fuera de catálogo",
+			"details": observaciones,
 		})
 		return
 	}
@@ -178,6 +280,14 @@ func (h *ComprobanteHandler) CreateComprobante(c *gin.Context) {
 	comprobante.FechaActualizacion = time.Now()
 	comprobante.EstadoProceso = models.EstadoPendiente
 
+	// Establecimiento de la serie
+	if !h.asignarEstablecimiento(c, &comprobante) {
+		return
+	}
+
+	// Retención y percepción según los padrones de SUNAT
+	h.aplicarRegimenesIGV(&comprobante)
+
 	// Calcular totales automáticamente
 	if err := h.conversionService.CalculateTotals(&comprobante); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -187,8 +297,42 @@ func (h *ComprobanteHandler) CreateComprobante(c *gin.Context) {
 		return
 	}
 
+	// Detracción según el catálogo 54
+	if err := h.aplicarDetraccion(&comprobante); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "Detracción inválida",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	// Forma de pago y cuotas contra el monto neto pendiente de pago
+	if hallazgos := h.validationService.ValidarFormaPago(&comprobante); services.TieneErrores(hallazgos) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "Forma de pago inválida",
+			"details": hallazgos,
+		})
+		return
+	}
+
+	// Validar totales: solo las transferencias gratuitas y las deducciones de anticipos admiten importe cero
+	if comprobante.Totales.ImporteTotal <= 0 && comprobante.Totales.TotalVentaGratuita == 0 && comprobante.Totales.TotalAnticipos == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Importe total inválido",
+			"details": "El importe total debe ser mayor a cero.",
+		})
+		return
+	}
+
 	// Guardar en base de datos (estado pendiente)
 	if err := h.repository.Create(&comprobante); err != nil {
+		if errors.Is(err, repository.ErrAnticipoInvalido) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":   "Anticipo no deducible",
+				"details": err.Error(),
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Error guardando comprobante",
 			"details": err.Error(),
@@ -225,6 +369,24 @@ func (h *ComprobanteHandler) CreateComprobante(c *gin.Context) {
 		})
 		return
 	}
+	// 2.2 Validar el XML contra los esquemas UBL 2.1 antes de firmar
+	hallazgosXSD, err := h.validationService.ValidarEsquema(xmlUBL)
+	if err != nil {
+		h.repository.UpdateStatus(comprobante.ID, models.EstadoError)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Error validando el esquema XSD",
+			"details": err.Error(),
+		})
+		return
+	}
+	if services.TieneErrores(hallazgosXSD) {
+		h.repository.UpdateStatus(comprobante.ID, models.EstadoError)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "El XML UBL generado no cumple el esquema UBL 2.1",
+			"details": hallazgosXSD,
+		})
+		return
+	}
 
 	// 3. Firmar el XML UBL
 	certPath := config.AppConfig.Security.CertificatePath
@@ -292,6 +454,7 @@ func (h *ComprobanteHandler) CreateComprobante(c *gin.Context) {
 		"zip_base64":  zipPkg.Base64Content,
 		"file_xml":    fileNameXML,
 		"file_zip":    fileNameZIP,
+		"observaciones": observaciones,
 	})
 }
 
@@ -324,6 +487,8 @@ func (h *ComprobanteHandler) ListComprobantes(c *gin.Context) {
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
 	estado := c.Query("estado")
 	tipo := c.Query("tipo")
+	emisorRUC := c.Query("emisor_ruc")
+	establecimiento := c.Query("establecimiento")
 
 	filters := map[string]interface{}{}
 	if estado != "" {
@@ -339,6 +504,13 @@ func (h *ComprobanteHandler) ListComprobantes(c *gin.Context) {
 		}
 	}
 
+	if emisorRUC != "" {
+		filters["emisor_ruc"] = emisorRUC
+	}
+	if establecimiento != "" {
+		filters["emisor_establecimiento"] = establecimiento
+	}
+
 	comprobantes, total, err := h.repository.List(page, limit, filters)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -392,6 +564,20 @@ func (h *ComprobanteHandler) UpdateComprobante(c *gin.Context) {
 	comprobante.ID = id
 	comprobante.FechaActualizacion = time.Now()
 
+	// Fecha de emisión contra el plazo de envío
+	if hallazgos := h.validationService.ValidarFechaEmision(&comprobante); services.TieneErrores(hallazgos) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "Fecha de emisión inválida",
+			"details": hallazgos,
+		})
+		return
+	}
+
+	// Establecimiento de la serie
+	if !h.asignarEstablecimiento(c, &comprobante) {
+		return
+	}
+
 	// Recalcular totales
 	if err := h.conversionService.CalculateTotals(&comprobante); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -401,6 +587,24 @@ func (h *ComprobanteHandler) UpdateComprobante(c *gin.Context) {
 		return
 	}
 
+	// Detracción según el catálogo 54
+	if err := h.aplicarDetraccion(&comprobante); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "Detracción inválida",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	// Forma de pago y cuotas contra el monto neto pendiente de pago
+	if hallazgos := h.validationService.ValidarFormaPago(&comprobante); services.TieneErrores(hallazgos) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "Forma de pago inválida",
+			"details": hallazgos,
+		})
+		return
+	}
+
 	if err := h.repository.Update(&comprobante); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Error actualizando comprobante",
@@ -500,6 +704,24 @@ func (h *ComprobanteHandler) ProcessComprobante(c *gin.Context) {
 		return
 	}
 
+	// Validar contra los esquemas UBL 2.1: el XML guardado es el que se firmará
+	hallazgosXSD, err := h.validationService.ValidarEsquema(xmlData)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Error validando el esquema XSD",
+			"details": err.Error(),
+		})
+		return
+	}
+	if services.TieneErrores(hallazgosXSD) {
+		h.repository.UpdateStatus(id, models.EstadoError)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "El XML UBL generado no cumple el esquema UBL 2.1",
+			"details": hallazgosXSD,
+		})
+		return
+	}
+
 	// Guardar XML generado
 	comprobante.EstadoProceso = models.EstadoFirmado
 	if err := h.repository.UpdateXML(id, string(xmlData)); err != nil {
@@ -719,28 +941,72 @@ func (h *ComprobanteHandler) SendToSUNAT(c *gin.Context) {
 		return
 	}
 
-	// Guardar el CDR en la base de datos
-	if err := h.repository.UpdateCDR(id, response.ApplicationResponse); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Error guardando CDR",
+	// Guardar CDR en archivo de prueba si existe
+	if len(response.ApplicationResponse) > 0 {
+		fileNameCDR := documentID + "-cdr.zip"
+		_ = saveToXMLPruebas(fileNameCDR, response.ApplicationResponse)
+	}
+
+	// Guardar el CDR y actualizar el estado según su código de respuesta
+	estado, err := h.registrarRespuestaSUNAT(id, response)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrExcepcionSUNAT) || errors.Is(err, errSinCDR) {
+			status = http.StatusBadGateway
+		}
+		c.JSON(status, gin.H{
+			"error":   "El comprobante queda pendiente de envío",
 			"details": err.Error(),
 		})
 		return
 	}
 
-	// Guardar CDR en archivo de prueba si existe
-	if response.ApplicationResponse != nil && len(response.ApplicationResponse) > 0 {
-		fileNameCDR := documentID + "-cdr.zip"
-		_ = saveToXMLPruebas(fileNameCDR, response.ApplicationResponse)
+	if estado == models.EstadoRechazado {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "Comprobante rechazado por SUNAT",
+			"details": response.Respuesta,
+			"cdr":     response.ApplicationResponse,
+			"status":  response.StatusCode,
+		})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Enviado a SUNAT exitosamente",
-		"cdr":     response.ApplicationResponse,
-		"status":  response.StatusCode,
+		"message":   "Comprobante aceptado por SUNAT",
+		"respuesta": response.Respuesta,
+		"cdr":       response.ApplicationResponse,
+		"status":    response.StatusCode,
 	})
 }
 
+// errSinCDR indica que SUNAT respondió al envío sin la constancia de recepción
+var errSinCDR = errors.New("SUNAT no devolvió el CDR")
+
+// registrarRespuestaSUNAT guarda el CDR y actualiza el estado del comprobante
+// según su código de respuesta: solo los aceptados, con o sin observaciones,
+// pueden deducirse como anticipo. Sin CDR o ante una excepción el comprobante
+// conserva su estado para reenviarlo.
+func (h *ComprobanteHandler) registrarRespuestaSUNAT(id string, response *services.SUNATSendResponse) (models.EstadoProceso, error) {
+	if response.Respuesta == nil {
+		return 0, errSinCDR
+	}
+	if err := h.repository.UpdateCDR(id, response.ApplicationResponse); err != nil {
+		return 0, err
+	}
+
+	estado, err := response.Respuesta.Estado()
+	if err != nil {
+		return 0, err
+	}
+	if err := h.repository.UpdateSUNATInfo(id, response.Ticket, response.Respuesta.Codigo); err != nil {
+		return 0, err
+	}
+	if err := h.repository.UpdateStatus(id, estado); err != nil {
+		return 0, err
+	}
+	return estado, nil
+}
+
 // GetSUNATStatus consulta el estado en SUNAT
 func (h *ComprobanteHandler) GetSUNATStatus(c *gin.Context) {
 	id := c.Param("id")
@@ -860,7 +1126,7 @@ func (h *ComprobanteHandler) DownloadXML(c *gin.Context) {
 
 // Métodos adicionales para utilidades y validaciones
 
-// ValidateRUC valida un RUC contra SUNAT y responde con información extendida
+// ValidateRUC valida un RUC y responde con su situación en el padrón de SUNAT
 func (h *ComprobanteHandler) ValidateRUC(c *gin.Context) {
 	ruc := c.Query("ruc")
 	if len(ruc) != 11 {
@@ -872,20 +1138,36 @@ func (h *ComprobanteHandler) ValidateRUC(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"valid": false, "error": err.Error()})
 		return
 	}
-	// Intentar validar contra SUNAT
-	resp, err := h.sunatService.ValidateRUC(ruc)
+	// Consultar el padrón reducido de RUC importado
+	if h.padronService == nil {
+		c.JSON(http.StatusOK, gin.H{"valid": true, "warning": "Padrón de RUC no disponible", "ruc": ruc})
+		return
+	}
+	contribuyente, err := h.padronService.Consultar(ruc)
+	if errors.Is(err, repository.ErrContribuyenteNoEncontrado) {
+		importacion, errImportacion := h.padronService.UltimaImportacion(models.PadronRUC)
+		if errImportacion != nil || importacion == nil {
+			// Sin padrón importado solo se puede responder la validación local
+			c.JSON(http.StatusOK, gin.H{"valid": true, "warning": "Padrón de RUC no importado", "ruc": ruc})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"valid": false, "ruc": ruc, "error": "El RUC no figura en el padrón de SUNAT", "padron_actualizado": importacion.FechaFin})
+		return
+	}
 	if err != nil {
-		// Si falla la consulta a SUNAT, responde solo validación local
-		c.JSON(http.StatusOK, gin.H{"valid": true, "warning": "Validación SUNAT no disponible", "ruc": ruc})
+		c.JSON(http.StatusOK, gin.H{"valid": true, "warning": "Padrón de RUC no disponible", "ruc": ruc})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
-		"valid":       resp.Valid,
-		"ruc":         ruc,
-		"razon_social": resp.RazonSocial,
-		"estado":       resp.Estado,
-		"direccion":    resp.Direccion,
-		"timestamp":    resp.Timestamp,
+		"valid":               true,
+		"ruc":                 ruc,
+		"razon_social":        contribuyente.RazonSocial,
+		"estado":              contribuyente.Estado,
+		"condicion_domicilio": contribuyente.CondicionDomicilio,
+		"activo":              contribuyente.Activo(),
+		"direccion":           contribuyente.Direccion(),
+		"ubigeo":              contribuyente.Ubigeo,
+		"timestamp":           contribuyente.FechaActualizacion,
 	})
 }
 
@@ -949,6 +1231,15 @@ func (h *ComprobanteHandler) ConvertToUBL(c *gin.Context) {
 		return
 	}
 
+	// Detracción según el catálogo 54
+	if err := h.aplicarDetraccion(&comprobante); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "Detracción inválida",
+			"details": err.Error(),
+		})
+		return
+	}
+
 	// Convertir a UBL
 	ublDocument, err := h.conversionService.ConvertToUBL(&comprobante)
 	if err != nil {
@@ -997,6 +1288,15 @@ func (h *ComprobanteHandler) GenerateXMLWithoutSignature(c *gin.Context) {
 		return
 	}
 
+	// Detracción según el catálogo 54
+	if err := h.aplicarDetraccion(&comprobante); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "Detracción inválida",
+			"details": err.Error(),
+		})
+		return
+	}
+
 	// 1. Generar estructura UBL
 	ublStruct, err := h.conversionService.ConvertToUBL(&comprobante)
 	if err != nil {
@@ -1065,48 +1365,103 @@ func (h *ComprobanteHandler) CalculateTotals(c *gin.Context) {
 		return
 	}
 
+	// Detracción según el catálogo 54
+	if err := h.aplicarDetraccion(&comprobante); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "Detracción inválida",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"totals":     comprobante.Totales,
+		"taxes":      comprobante.Impuestos,
+		"items":      comprobante.Items,
+		"detraccion": comprobante.Detraccion,
+	})
+}
+
+// ValidateComprobante ejecuta las reglas de validación SUNAT sobre un comprobante
+// sin guardarlo: contrasta los importes recibidos con los recalculados y valida
+// el UBL que se generaría
+func (h *ComprobanteHandler) ValidateComprobante(c *gin.Context) {
+	var comprobante models.Comprobante
+
+	if err := c.ShouldBindJSON(&comprobante); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Datos inválidos",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if !h.asignarEstablecimiento(c, &comprobante) {
+		return
+	}
+
+	// Los importes declarados se conservan para contrastarlos con los recalculados
+	declarados := services.DeclararImportes(&comprobante)
+	if err := h.conversionService.CalculateTotals(&comprobante); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Error calculando totales",
+			"details": err.Error(),
+		})
+		return
+	}
+	hallazgos := append(h.validationService.ValidarComprobante(&comprobante),
+		h.validationService.ValidarImportesDeclarados(declarados, &comprobante)...)
+
+	// Detracción según el catálogo 54
+	if err := h.aplicarDetraccion(&comprobante); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "Detracción inválida",
+			"details": err.Error(),
+		})
+		return
+	}
+	hallazgos = append(hallazgos, h.validationService.ValidarFormaPago(&comprobante)...)
+
+	ublDocument, err := h.conversionService.ConvertToUBL(&comprobante)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Error convirtiendo a UBL",
+			"details": err.Error(),
+		})
+		return
+	}
+	hallazgos = append(hallazgos, h.validationService.ValidarUBL(ublDocument)...)
+
+	xmlData, err := h.conversionService.UBLService.SerializeToXML(ublDocument)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Error serializando XML",
+			"details": err.Error(),
+		})
+		return
+	}
+	hallazgosXSD, err := h.validationService.ValidarEsquema(xmlData)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Error validando el esquema XSD",
+			"details": err.Error(),
+		})
+		return
+	}
+	hallazgos = append(hallazgos, hallazgosXSD...)
+
 	c.JSON(http.StatusOK, gin.H{
-		"totals":   comprobante.Totales,
-		"taxes":    comprobante.Impuestos,
-		"items":    comprobante.Items,
+		"valido":    !services.TieneErrores(hallazgos),
+		"hallazgos": hallazgos,
 	})
 }
 
 // GetTaxCodes obtiene códigos de impuestos disponibles
 func (h *ComprobanteHandler) GetTaxCodes(c *gin.Context) {
 	taxCodes := map[string]interface{}{
-		"afectacion_igv": map[string]string{
-			"10": "Gravado - Operación Onerosa",
-			"11": "Gravado - Retiro por premio",
-			"12": "Gravado - Retiro por donación",
-			"13": "Gravado - Retiro",
-			"14": "Gravado - Retiro por publicidad",
-			"15": "Gravado - Bonificaciones",
-			"16": "Gravado - Retiro por entrega a trabajadores",
-			"17": "Gravado - IVAP",
-			"20": "Exonerado - Operación Onerosa",
-			"21": "Exonerado - Transferencia Gratuita",
-			"30": "Inafecto - Operación Onerosa",
-			"31": "Inafecto - Retiro por Bonificación",
-			"32": "Inafecto - Retiro",
-			"33": "Inafecto - Retiro por Muestras Médicas",
-			"34": "Inafecto - Retiro por Convenio Colectivo",
-			"35": "Inafecto - Retiro por premio",
-			"36": "Inafecto - Retiro por publicidad",
-			"37": "Inafecto - Transferencia Gratuita",
-			"40": "Exportación",
-		},
-		"tipos_impuesto": map[string]string{
-			"1000": "IGV",
-			"2000": "ISC",
-			"9999": "OTROS",
-		},
-		"tipos_documento": map[string]string{
-			"01": "Factura",
-			"03": "Boleta de Venta",
-			"07": "Nota de Crédito",
-			"08": "Nota de Débito",
-		},
+		"afectacion_igv":  mapaCatalogo(catalogos.AfectacionIGV),
+		"tipos_impuesto":  mapaCatalogo(catalogos.Tributo),
+		"tipos_documento": mapaCatalogo(catalogos.TipoDocumento),
 	}
 
 	c.JSON(http.StatusOK, taxCodes)
@@ -1120,33 +1475,25 @@ func (h *ComprobanteHandler) GetDocumentTypes(c *gin.Context) {
 			"2": "Boleta",
 			"3": "Nota de Crédito",
 			"4": "Nota de Débito",
+			"5": "Liquidación de Compra",
 		},
-		"identidad": map[string]string{
-			"0": "DOC.TRIB.NO.DOM.SIN.RUC",
-			"1": "DNI",
-			"4": "CE",
-			"6": "RUC",
-			"7": "PASAPORTE",
-			"A": "CED.DIPLOMATICA DE IDENTIDAD",
-		},
-		"monedas": map[string]string{
-			"PEN": "Soles",
-			"USD": "Dólares Americanos",
-			"EUR": "Euros",
-		},
-		"unidades_medida": map[string]string{
-			"NIU": "Unidad",
-			"KGM": "Kilogramo",
-			"GRM": "Gramo",
-			"LTR": "Litro",
-			"MTR": "Metro",
-			"ZZ":  "Servicio",
-		},
+		"identidad":       mapaCatalogo(catalogos.DocumentoIdentidad),
+		"monedas":         mapaCatalogo(catalogos.Moneda),
+		"unidades_medida": mapaCatalogo(catalogos.UnidadMedida),
 	}
 
 	c.JSON(http.StatusOK, documentTypes)
 }
 
+// mapaCatalogo retorna los códigos de un catálogo SUNAT con su descripción
+func mapaCatalogo(numero string) map[string]string {
+	catalogo, err := catalogos.Obtener(numero)
+	if err != nil {
+		return map[string]string{}
+	}
+	return catalogo.Mapa()
+}
+
 // Métodos para manejo de lotes
 
 // SendBatch envía múltiples comprobantes en lote
@@ -1259,6 +1606,16 @@ func (h *ComprobanteHandler) processComprobanteForBatch(id, certPath, certPass s
 			return err
 		}
 
+		// Validar contra los esquemas UBL 2.1 antes de firmar
+		hallazgosXSD, err := h.validationService.ValidarEsquema(xmlData)
+		if err != nil {
+			return err
+		}
+		if services.TieneErrores(hallazgosXSD) {
+			return fmt.Errorf("el XML UBL no cumple el esquema UBL 2.1 (%d errores): %s: %s",
+				len(hallazgosXSD), hallazgosXSD[0].Ruta, hallazgosXSD[0].Mensaje)
+		}
+
 		// Guardar XML
 		if err := h.repository.UpdateXML(id, string(xmlData)); err != nil {
 			return err
@@ -1295,15 +1652,18 @@ func (h *ComprobanteHandler) processComprobanteForBatch(id, certPath, certPass s
 		if err != nil {
 			return err
 		}
-
-		// Actualizar información SUNAT
-		if err := h.repository.UpdateSUNATInfo(id, response.Ticket, "ENVIADO"); err != nil {
-			return err
+		if !response.Success {
+			return fmt.Errorf("error en respuesta de SUNAT (status %d): %s", response.StatusCode, response.Message)
 		}
 
-		if err := h.repository.UpdateStatus(id, models.EstadoEnviado); err != nil {
+		// Guardar el CDR y actualizar el estado según su código de respuesta
+		estado, err := h.registrarRespuestaSUNAT(id, response)
+		if err != nil {
 			return err
 		}
+		if estado == models.EstadoRechazado {
+			return fmt.Errorf("comprobante rechazado por SUNAT: %s - %s", response.Respuesta.Codigo, response.Respuesta.Descripcion)
+		}
 	}
 
 	return nil
@@ -1339,6 +1699,22 @@ func (h *ComprobanteHandler) FullProcessComprobante(c *gin.Context) {
 		})
 		return
 	}
+	// 2.1 Validar el XML contra los esquemas UBL 2.1 antes de firmar
+	hallazgosXSD, err := h.validationService.ValidarEsquema(xmlUBL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Error validando el esquema XSD",
+			"details": err.Error(),
+		})
+		return
+	}
+	if services.TieneErrores(hallazgosXSD) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "El XML UBL generado no cumple el esquema UBL 2.1",
+			"details": hallazgosXSD,
+		})
+		return
+	}
 	// 3. Firmar XML (usando certificado por defecto)
 	certPath := config.AppConfig.Security.CertificatePath
 	certPass := config.AppConfig.Security.CertificatePass
@@ -1396,53 +1772,172 @@ func (h *ComprobanteHandler) GetComprobanteResult(c *gin.Context) {
 	})
 }
 
-// Consulta de contribuyente por RUC
+// Consulta de contribuyente por RUC en el padrón reducido de SUNAT
 func (h *ComprobanteHandler) GetContribuyente(c *gin.Context) {
 	ruc := c.Query("ruc")
 	if ruc == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Parámetro ruc requerido"})
 		return
 	}
-	// Respuesta mock (puedes conectar a una BD real si lo deseas)
+	if h.padronService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Padrón de RUC no disponible"})
+		return
+	}
+	contribuyente, err := h.padronService.Consultar(ruc)
+	if errors.Is(err, repository.ErrContribuyenteNoEncontrado) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Contribuyente no encontrado", "details": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando el padrón de RUC", "details": err.Error()})
+		return
+	}
+
+	respuesta := gin.H{
+		"ruc":                 contribuyente.RUC,
+		"razon_social":        contribuyente.RazonSocial,
+		"estado":              contribuyente.Estado,
+		"condicion_domicilio": contribuyente.CondicionDomicilio,
+		"activo":              contribuyente.Activo(),
+		"direccion":           contribuyente.Direccion(),
+		"ubigeo":              contribuyente.Ubigeo,
+		"fecha_actualizacion": contribuyente.FechaActualizacion,
+	}
+	if ubicacion, err := catalogos.BuscarUbigeo(contribuyente.Ubigeo); err == nil {
+		respuesta["departamento"] = ubicacion.Departamento
+		respuesta["provincia"] = ubicacion.Provincia
+		respuesta["distrito"] = ubicacion.Distrito
+	}
+	if situacion, err := h.padronService.SituacionIGV(ruc); err == nil {
+		respuesta["agente_retencion"] = situacion.AgenteRetencion
+		respuesta["agente_percepcion"] = situacion.AgentePercepcion
+		respuesta["buen_contribuyente"] = situacion.BuenContribuyente
+	}
+	c.JSON(http.StatusOK, respuesta)
+}
+
+// GetPadronesRUC informa si un RUC es agente de retención, agente de percepción
+// o buen contribuyente, junto con la fecha de la última carga de cada padrón
+func (h *ComprobanteHandler) GetPadronesRUC(c *gin.Context) {
+	ruc := c.Param("ruc")
+	if err := identidad.ValidarRUC(ruc); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "RUC inválido", "details": err.Error()})
+		return
+	}
+	if h.padronService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Padrones de SUNAT no disponibles"})
+		return
+	}
+	situacion, err := h.padronService.SituacionIGV(ruc)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error consultando los padrones", "details": err.Error()})
+		return
+	}
+
+	actualizados := gin.H{}
+	for _, padron := range []string{models.PadronAgentesRetencion, models.PadronAgentesPercepcion, models.PadronBuenosContribuyentes} {
+		importacion, err := h.padronService.UltimaImportacion(padron)
+		if err != nil || importacion == nil {
+			actualizados[padron] = nil // padrón no importado: la situación no es concluyente
+			continue
+		}
+		actualizados[padron] = importacion.FechaFin
+	}
 	c.JSON(http.StatusOK, gin.H{
-		"ruc":          ruc,
-		"razon_social": "EMPRESA DEMO S.A.C.",
-		"estado":       "ACTIVO",
-		"direccion":    "AV. AREQUIPA 123, LIMA",
+		"ruc":                 situacion.RUC,
+		"agente_retencion":    situacion.AgenteRetencion,
+		"agente_percepcion":   situacion.AgentePercepcion,
+		"buen_contribuyente":  situacion.BuenContribuyente,
+		"inscripciones":       situacion.Inscripciones,
+		"padrones_importados": actualizados,
 	})
 }
 
+// parsearFechaConsulta lee la fecha de una consulta en formato dd-mm-aaaa o
+// aaaa-mm-dd; sin fecha se usa la del día
+func parsearFechaConsulta(valor string) (time.Time, error) {
+	if valor == "" {
+		return time.Now(), nil
+	}
+	for _, formato := range []string{"02-01-2006", "2006-01-02", "02/01/2006"} {
+		if fecha, err := time.Parse(formato, valor); err == nil {
+			return fecha, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("fecha inválida: %s (use dd-mm-aaaa)", valor)
+}
 
-// Consulta de tasa de cambio (mock)
+// GetTasaCambio consulta el tipo de cambio oficial de una moneda para una fecha,
+// o el del último día hábil anterior si ese día no hubo publicación
 func (h *ComprobanteHandler) GetTasaCambio(c *gin.Context) {
-	moneda := c.DefaultQuery("moneda", "USD")
-	fecha := c.DefaultQuery("fecha", time.Now().Format("02-01-2006"))
-	// Respuesta mock (puedes conectar a un servicio real si lo deseas)
+	moneda := strings.ToUpper(c.DefaultQuery("moneda", "USD"))
+	fecha, err := parsearFechaConsulta(c.Query("fecha"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Fecha inválida", "details": err.Error()})
+		return
+	}
+	if h.tipoCambioService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Tipos de cambio no disponibles"})
+		return
+	}
+
+	tipoCambio, err := h.tipoCambioService.Consultar(moneda, fecha)
+	if errors.Is(err, repository.ErrTipoCambioNoEncontrado) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tipo de cambio no publicado", "details": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error consultando el tipo de cambio", "details": err.Error()})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
-		"moneda": moneda,
-		"fecha":  fecha,
-		"tasa":   3.85,
+		"moneda":            tipoCambio.Moneda,
+		"fecha":             fecha.Format("02-01-2006"),
+		"fecha_publicacion": tipoCambio.Fecha.Format("02-01-2006"),
+		"compra":            tipoCambio.Compra,
+		"venta":             tipoCambio.Venta,
+		"tasa":              tipoCambio.Venta,
+		"fuente":            tipoCambio.Fuente,
 	})
 }
 
-// Calculadora de cambio (mock)
+// CalculadoraCambio convierte un importe con el tipo de cambio oficial de la
+// fecha; por defecto aplica la cotización de venta, como SUNAT
 func (h *ComprobanteHandler) CalculadoraCambio(c *gin.Context) {
-	valor, _ := strconv.ParseFloat(c.DefaultQuery("valor", "0"), 64)
-	de := c.DefaultQuery("de", "USD")
-	a := c.DefaultQuery("a", "PEN")
-	fecha := c.DefaultQuery("fecha", time.Now().Format("02-01-2006"))
-	tasa := 3.85 // valor mock
-	if de == "PEN" && a == "USD" {
-		tasa = 1 / tasa
-	}
-	resultado := valor * tasa
+	valor, err := strconv.ParseFloat(c.DefaultQuery("valor", "0"), 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Valor inválido", "details": err.Error()})
+		return
+	}
+	fecha, err := parsearFechaConsulta(c.Query("fecha"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Fecha inválida", "details": err.Error()})
+		return
+	}
+	if h.tipoCambioService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Tipos de cambio no disponibles"})
+		return
+	}
+
+	conversion, err := h.tipoCambioService.Convertir(valor, c.DefaultQuery("de", "USD"), c.DefaultQuery("a", "PEN"),
+		fecha, c.DefaultQuery("operacion", services.OperacionVenta))
+	if errors.Is(err, repository.ErrTipoCambioNoEncontrado) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tipo de cambio no publicado", "details": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error convirtiendo el importe", "details": err.Error()})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
-		"valor_inicial": valor,
-		"de":            de,
-		"a":             a,
-		"fecha":         fecha,
-		"tasa":          tasa,
-		"resultado":     resultado,
+		"valor_inicial": conversion.Valor,
+		"de":            conversion.De,
+		"a":             conversion.A,
+		"fecha":         fecha.Format("02-01-2006"),
+		"operacion":     conversion.Operacion,
+		"tasa":          conversion.Tasa,
+		"resultado":     conversion.Resultado,
+		"tipos_cambio":  conversion.TiposCambio,
 	})
 }
 
@@ -1464,6 +1959,12 @@ func (h *ComprobanteHandler) CreateNotaDebito(c *gin.Context) {
 	h.createComprobanteTipoValidado(c, 4) // 4 = Nota de Débito
 }
 
+// Handler RESTful para crear liquidación de compra
+func (h *ComprobanteHandler) CreateLiquidacionCompra(c *gin.Context) {
+	logrus.Info("[API] Creando liquidación de compra electrónica")
+	h.createComprobanteTipoValidado(c, 5) // 5 = Liquidación de Compra
+}
+
 // Lógica común para crear comprobante RESTful con validación reforzada
 func (h *ComprobanteHandler) createComprobanteTipoValidado(c *gin.Context, tipo int) {
 	var comprobante models.Comprobante
@@ -1474,9 +1975,9 @@ func (h *ComprobanteHandler) createComprobanteTipoValidado(c *gin.Context, tipo
 	}
 	comprobante.Tipo = models.TipoComprobante(tipo)
 
-	// Validar RUC emisor
-	if comprobante.Emisor.RUC == "" || len(comprobante.Emisor.RUC) != 11 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "RUC emisor vacío o inválido (debe tener 11 dígitos)"})
+	// Validar RUC emisor (longitud, tipo de contribuyente y dígito verificador)
+	if err := identidad.ValidarRUC(comprobante.Emisor.RUC); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "RUC emisor inválido", "details": err.Error()})
 		return
 	}
 	// Validar razón social emisor
@@ -1489,12 +1990,22 @@ func (h *ComprobanteHandler) createComprobanteTipoValidado(c *gin.Context, tipo
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Dirección del emisor es obligatoria"})
 		return
 	}
-	// Validar RUC receptor
-	if comprobante.Receptor.NumeroDocumento == "" || len(comprobante.Receptor.NumeroDocumento) != 11 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "RUC receptor vacío o inválido (debe tener 11 dígitos)"})
+	// Validar el documento del receptor según el tipo de comprobante (las
+	// exportaciones se emiten a clientes no domiciliados y en la liquidación de
+	// compra el receptor es el vendedor, identificado con DNI)
+	if comprobante.Receptor.NumeroDocumento == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Documento del receptor es obligatorio"})
+		return
+	}
+	if comprobante.Receptor.TipoDocumento == "" {
+		comprobante.Receptor.TipoDocumento = identidad.RUC // por defecto RUC, igual que en el UBL
+	}
+	if hallazgos := h.validationService.ValidarReceptor(&comprobante); services.TieneErrores(hallazgos) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Documento del receptor inválido", "details": hallazgos})
 		return
 	}
-	// Validar razón social receptor
+	// Validar razón social receptor, completándola desde el padrón de RUC
+	h.completarReceptor(&comprobante.Receptor)
 	if strings.TrimSpace(comprobante.Receptor.RazonSocial) == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Razón social del receptor es obligatoria"})
 		return
@@ -1505,30 +2016,57 @@ func (h *ComprobanteHandler) createComprobanteTipoValidado(c *gin.Context, tipo
 	comprobante.FechaCreacion = time.Now()
 	comprobante.FechaActualizacion = time.Now()
 	comprobante.EstadoProceso = models.EstadoPendiente
-	// Calcular totales automáticamente
+	// Establecimiento de la serie
+	if !h.asignarEstablecimiento(c, &comprobante) {
+		return
+	}
+	// Retención y percepción según los padrones de SUNAT
+	h.aplicarRegimenesIGV(&comprobante)
+	// Calcular totales automáticamente, conservando los importes declarados
+	declarados := services.DeclararImportes(&comprobante)
 	if err := h.conversionService.CalculateTotals(&comprobante); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Error calculando totales", "details": err.Error()})
 		return
 	}
-	// Guardar en base de datos (cabecera y detalle)
-	if err := h.repository.Create(&comprobante); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error guardando comprobante", "details": err.Error()})
+	// Detracción según el catálogo 54
+	if err := h.aplicarDetraccion(&comprobante); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Detracción inválida", "details": err.Error()})
 		return
 	}
-	// 1. Generar estructura UBL
+	// 1. Generar estructura UBL y serializarla a XML
 	ublStruct, err := h.conversionService.ConvertToUBL(&comprobante)
 	if err != nil {
-		h.repository.UpdateStatus(comprobante.ID, models.EstadoError)
 		c.JSON(500, gin.H{"error": "Error generando UBL", "details": err.Error()})
 		return
 	}
-	// 2. Serializar a XML
 	xmlUBL, err := h.conversionService.UBLService.SerializeToXML(ublStruct)
 	if err != nil {
-		h.repository.UpdateStatus(comprobante.ID, models.EstadoError)
 		c.JSON(500, gin.H{"error": "Error serializando UBL a XML", "details": err.Error()})
 		return
 	}
+	// 2. Aplicar las reglas de validación SUNAT y los esquemas UBL 2.1 antes de guardar
+	hallazgosXSD, err := h.validationService.ValidarEsquema(xmlUBL)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error validando el esquema XSD", "details": err.Error()})
+		return
+	}
+	hallazgos := append(h.validationService.ValidarComprobante(&comprobante), h.validationService.ValidarFormaPago(&comprobante)...)
+	hallazgos = append(hallazgos, h.validationService.ValidarImportesDeclarados(declarados, &comprobante)...)
+	hallazgos = append(hallazgos, h.validationService.ValidarUBL(ublStruct)...)
+	hallazgos = append(hallazgos, hallazgosXSD...)
+	if services.TieneErrores(hallazgos) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "El comprobante no cumple las reglas de validación SUNAT", "details": hallazgos})
+		return
+	}
+	// Guardar en base de datos (cabecera y detalle)
+	if err := h.repository.Create(&comprobante); err != nil {
+		if errors.Is(err, repository.ErrAnticipoInvalido) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Anticipo no deducible", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error guardando comprobante", "details": err.Error()})
+		return
+	}
 	// 3. Firmar XML usando el certificado configurado
 	certPath := config.AppConfig.Security.CertificatePath
 	certPass := config.AppConfig.Security.CertificatePass
@@ -1545,7 +2083,7 @@ func (h *ComprobanteHandler) createComprobanteTipoValidado(c *gin.Context, tipo
 		return
 	}
 	// 4. Empaquetar en ZIP (base64)
-	documentID := comprobante.Emisor.RUC + "-" + strconv.Itoa(int(comprobante.Tipo)) + "-" + comprobante.Serie + "-" + comprobante.Numero
+	documentID := comprobante.Emisor.RUC + "-" + comprobante.Tipo.String() + "-" + comprobante.Serie + "-" + comprobante.Numero
 	zipPkg, err := h.encodingService.ProcessForSUNAT(xmlFirmado, documentID)
 	if err != nil {
 		h.repository.UpdateStatus(comprobante.ID, models.EstadoError)
@@ -1570,6 +2108,7 @@ func (h *ComprobanteHandler) createComprobanteTipoValidado(c *gin.Context, tipo
 		"zip_base64":  zipPkg.Base64Content,
 		"file_xml":    fileNameXML,
 		"file_zip":    fileNameZIP,
+		"observaciones": hallazgos,
 	})
 }
 
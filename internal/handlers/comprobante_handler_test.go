@@ -3,10 +3,14 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"facturacion_sunat_api_go/internal/config"
 	"facturacion_sunat_api_go/internal/models"
 	"facturacion_sunat_api_go/internal/repository"
 	"facturacion_sunat_api_go/internal/services"
 	"facturacion_sunat_api_go/pkg/certificate"
+	"facturacion_sunat_api_go/pkg/xsd"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -15,6 +19,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // MockRepository es un mock del repositorio para pruebas
@@ -29,12 +34,24 @@ func (m *MockRepository) Create(comprobante *models.Comprobante) error {
 
 func (m *MockRepository) GetByID(id string) (*models.Comprobante, error) {
 	args := m.Called(id)
-	return args.Get(0).(*models.Comprobante), args.Error(1)
+	comprobante, _ := args.Get(0).(*models.Comprobante)
+	return comprobante, args.Error(1)
 }
 
-func (m *MockRepository) List() ([]models.Comprobante, error) {
-	args := m.Called()
-	return args.Get(0).([]models.Comprobante), args.Error(1)
+func (m *MockRepository) List(page, limit int, filters map[string]interface{}) ([]*models.Comprobante, int, error) {
+	args := m.Called(page, limit, filters)
+	comprobantes, _ := args.Get(0).([]*models.Comprobante)
+	return comprobantes, args.Int(1), args.Error(2)
+}
+
+func (m *MockRepository) Update(comprobante *models.Comprobante) error {
+	args := m.Called(comprobante)
+	return args.Error(0)
+}
+
+func (m *MockRepository) Delete(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
 }
 
 func (m *MockRepository) UpdateStatus(id string, status models.EstadoProceso) error {
@@ -67,110 +84,247 @@ func (m *MockRepository) UpdateCDR(id string, cdr []byte) error {
 	return args.Error(0)
 }
 
-func (m *MockRepository) UpdateError(id, error string) error {
-	args := m.Called(id, error)
+func (m *MockRepository) CreateBatch(batch *repository.Lote) error {
+	args := m.Called(batch)
 	return args.Error(0)
 }
 
-func (m *MockRepository) Close() error {
-	args := m.Called()
-	return args.Error(0)
+func (m *MockRepository) GetBatch(id string) (*repository.Lote, error) {
+	args := m.Called(id)
+	lote, _ := args.Get(0).(*repository.Lote)
+	return lote, args.Error(1)
 }
 
-// TestGenerateXMLWithoutSignature prueba la generación de XML sin firma
-func TestGenerateXMLWithoutSignature(t *testing.T) {
-	// Configurar Gin para pruebas
-	gin.SetMode(gin.TestMode)
+func (m *MockRepository) UpdateBatchProgress(id string, processed, successful, failed int) error {
+	args := m.Called(id, processed, successful, failed)
+	return args.Error(0)
+}
 
-	// Crear mock del repositorio
-	mockRepo := new(MockRepository)
+func (m *MockRepository) FinalizeBatch(id, estado string, fechaFin time.Time) error {
+	args := m.Called(id, estado, fechaFin)
+	return args.Error(0)
+}
 
-	// Crear servicios reales
+// handlerPrueba crea el handler con los servicios reales y el repositorio indicado
+func handlerPrueba(repo ComprobanteStore) *ComprobanteHandler {
 	certManager := certificate.NewManager()
 	ublService := services.NewUBLService()
 	conversionService := services.NewConversionService(ublService)
 	signingService := services.NewSigningService(certManager, ublService)
 	encodingService := services.NewEncodingService()
-	sunatService := services.NewSUNATService(&models.SUNATConfig{}, encodingService)
+	sunatService := services.NewSUNATService(&config.SUNATConfig{}, encodingService)
 
-	// Crear handler
-	handler := NewComprobanteHandler(
-		mockRepo,
+	return NewComprobanteHandler(
+		repo,
 		conversionService,
 		signingService,
 		encodingService,
 		sunatService,
+		services.NewValidationService(),
+		nil,
+		nil,
+		services.NewDetraccionService(nil),
+		nil,
 	)
+}
 
-	// Crear comprobante de prueba válido
-	comprobante := models.Comprobante{
-		Tipo:        models.TipoFactura,
-		Serie:       "F001",
-		Numero:      "00000001",
-		TipoMoneda:  "PEN",
+// comprobantePrueba arma un comprobante válido del tipo indicado
+func comprobantePrueba(tipo models.TipoComprobante) models.Comprobante {
+	return models.Comprobante{
+		Tipo:         tipo,
+		Serie:        "F001",
+		Numero:       "00000001",
+		TipoMoneda:   "PEN",
 		FechaEmision: time.Now(),
 		Emisor: models.Emisor{
-			RUC:     "20123456789",
-			RazonSocial: "EMPRESA DE PRUEBA SAC",
+			RUC:             "20123456786",
+			RazonSocial:     "EMPRESA DE PRUEBA SAC",
 			NombreComercial: "EMPRESA DE PRUEBA",
-			Direccion: "AV. AREQUIPA 123",
-			Distrito: "LIMA",
-			Provincia: "LIMA",
-			Departamento: "LIMA",
-			Pais: "PE",
+			TipoDocumento:   "6",
+			Direccion:       "AV. AREQUIPA 123",
+			Distrito:        "LIMA",
+			Provincia:       "LIMA",
+			Departamento:    "LIMA",
+			CodigoPais:      "PE",
 		},
 		Receptor: models.Receptor{
-			TipoDocumento:    "1", // DNI
-			NumeroDocumento:  "12345678",
-			RazonSocial:      "CLIENTE DE PRUEBA",
-			Direccion:        "AV. TEST 456",
-			Distrito:         "LIMA",
-			Provincia:        "LIMA",
-			Departamento:     "LIMA",
-			Pais:             "PE",
+			TipoDocumento:   "1", // DNI
+			NumeroDocumento: "12345678",
+			RazonSocial:     "CLIENTE DE PRUEBA",
+			Direccion:       "AV. TEST 456",
+			CodigoPais:      "PE",
 		},
 		Items: []models.Item{
 			{
-				Codigo:        "PROD001",
-				Descripcion:   "PRODUCTO DE PRUEBA",
-				Cantidad:      1,
-				PrecioUnitario: 100.00,
-				Impuestos: []models.ImpuestoItem{
-					{
-						Tipo:   "1000", // IGV
-						Porcentaje: 18.0,
-					},
-				},
+				NumeroItem:     1,
+				Codigo:         "PROD001",
+				Descripcion:    "PRODUCTO DE PRUEBA",
+				UnidadMedida:   "NIU",
+				Cantidad:       1,
+				ValorUnitario:  100.00,
+				PrecioUnitario: 118.00,
+				TipoAfectacion: models.GravadoOneroso,
 			},
 		},
 	}
+}
+
+// padronPrueba guarda en memoria el padrón de RUC y los padrones del IGV
+type padronPrueba struct {
+	contribuyentes map[string]models.Contribuyente
+	inscripciones  map[string][]models.InscripcionPadron
+	importaciones  map[string]*models.ImportacionPadron
+}
 
-	// Convertir a JSON
-	jsonData, err := json.Marshal(comprobante)
-	assert.NoError(t, err)
+func (p *padronPrueba) GetByRUC(ruc string) (*models.Contribuyente, error) {
+	contribuyente, ok := p.contribuyentes[ruc]
+	if !ok {
+		return nil, repository.ErrContribuyenteNoEncontrado
+	}
+	return &contribuyente, nil
+}
+
+func (p *padronPrueba) GuardarLote(contribuyentes []models.Contribuyente) (int64, int64, error) {
+	return 0, 0, errors.New("no soportado")
+}
+
+func (p *padronPrueba) GetInscripciones(ruc string) ([]models.InscripcionPadron, error) {
+	return p.inscripciones[ruc], nil
+}
 
-	// Crear request HTTP
-	req, err := http.NewRequest("POST", "/api/v1/utils/generate-xml", bytes.NewBuffer(jsonData))
-	assert.NoError(t, err)
+func (p *padronPrueba) GuardarInscripciones(importacionID int64, inscripciones []models.InscripcionPadron) (int64, int64, error) {
+	return 0, 0, errors.New("no soportado")
+}
+
+func (p *padronPrueba) DepurarPadron(padron string, importacionID int64) (int64, error) {
+	return 0, errors.New("no soportado")
+}
+
+func (p *padronPrueba) IniciarImportacion(padron, archivo string) (int64, error) {
+	return 0, errors.New("no soportado")
+}
+
+func (p *padronPrueba) FinalizarImportacion(importacion *models.ImportacionPadron) error {
+	return errors.New("no soportado")
+}
+
+func (p *padronPrueba) UltimaImportacion(padron string) (*models.ImportacionPadron, error) {
+	return p.importaciones[padron], nil
+}
+
+// nuevoPadronPrueba crea un padrón con un contribuyente activo y habido que es
+// agente de retención
+func nuevoPadronPrueba() *padronPrueba {
+	fin := time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)
+	return &padronPrueba{
+		contribuyentes: map[string]models.Contribuyente{
+			"20100066603": {
+				RUC:                "20100066603",
+				RazonSocial:        "CLIENTE DEL PADRON SAC",
+				Estado:             "ACTIVO",
+				CondicionDomicilio: "HABIDO",
+				Ubigeo:             "150101",
+				TipoVia:            "AV.",
+				NombreVia:          "AREQUIPA",
+				Numero:             "100",
+			},
+		},
+		inscripciones: map[string][]models.InscripcionPadron{
+			"20100066603": {{Padron: models.PadronAgentesRetencion, RUC: "20100066603", RazonSocial: "CLIENTE DEL PADRON SAC"}},
+		},
+		importaciones: map[string]*models.ImportacionPadron{
+			models.PadronRUC:              {Estado: "COMPLETADO", FechaFin: &fin},
+			models.PadronAgentesRetencion: {Estado: "COMPLETADO", FechaFin: &fin},
+		},
+	}
+}
+
+// tiposCambioPrueba guarda en memoria las cotizaciones publicadas
+type tiposCambioPrueba []models.TipoCambio
+
+func (p tiposCambioPrueba) Buscar(moneda string, desde, hasta time.Time) (*models.TipoCambio, error) {
+	var encontrado *models.TipoCambio
+	for i, tipoCambio := range p {
+		if tipoCambio.Moneda != moneda || tipoCambio.Fecha.Before(desde) || tipoCambio.Fecha.After(hasta) {
+			continue
+		}
+		if encontrado == nil || tipoCambio.Fecha.After(encontrado.Fecha) {
+			encontrado = &p[i]
+		}
+	}
+	if encontrado == nil {
+		return nil, repository.ErrTipoCambioNoEncontrado
+	}
+	return encontrado, nil
+}
+
+func (p tiposCambioPrueba) GuardarLote(tiposCambio []models.TipoCambio) (int64, error) {
+	return 0, errors.New("no soportado")
+}
+
+// nuevoTipoCambioPrueba crea el servicio con el dólar publicado el viernes 14-06-2024
+func nuevoTipoCambioPrueba() *services.TipoCambioService {
+	return services.NewTipoCambioService(tiposCambioPrueba{
+		{Moneda: "USD", Fecha: time.Date(2024, 6, 14, 0, 0, 0, 0, time.UTC), Compra: 3.765, Venta: 3.775, Fuente: "SBS"},
+	})
+}
+
+// ejecutar envía el cuerpo en JSON al handler y retorna la respuesta decodificada
+func ejecutar(t *testing.T, handler gin.HandlerFunc, cuerpo interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	jsonData, err := json.Marshal(cuerpo)
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBuffer(jsonData))
+	require.NoError(t, err)
 	req.Header.Set("Content-Type", "application/json")
+	return servir(t, handler, req)
+}
 
-	// Crear response recorder
-	w := httptest.NewRecorder()
+// consultar envía un GET con la consulta indicada al handler
+func consultar(t *testing.T, handler gin.HandlerFunc, consulta string) (int, map[string]interface{}) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, "/?"+consulta, nil)
+	require.NoError(t, err)
+	return servir(t, handler, req)
+}
 
-	// Configurar router de prueba
-	router := gin.New()
-	router.POST("/api/v1/utils/generate-xml", handler.GenerateXMLWithoutSignature)
+// consultarRuta envía un GET a la ruta indicada, atendida por el handler en el patrón dado
+func consultarRuta(t *testing.T, handler gin.HandlerFunc, patron, ruta string) (int, map[string]interface{}) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, ruta, nil)
+	require.NoError(t, err)
+	return servirEn(t, handler, patron, req)
+}
 
-	// Ejecutar request
-	router.ServeHTTP(w, req)
+// servir atiende la petición con el handler y decodifica la respuesta JSON
+func servir(t *testing.T, handler gin.HandlerFunc, req *http.Request) (int, map[string]interface{}) {
+	t.Helper()
+	return servirEn(t, handler, "/", req)
+}
+
+// servirEn atiende la petición con el handler registrado en el patrón indicado
+func servirEn(t *testing.T, handler gin.HandlerFunc, patron string, req *http.Request) (int, map[string]interface{}) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	// Los handlers guardan copias del XML en xml_pruebas, relativo al directorio actual
+	t.Chdir(t.TempDir())
 
-	// Verificar respuesta
-	assert.Equal(t, http.StatusOK, w.Code)
+	w := httptest.NewRecorder()
+	router := gin.New()
+	router.Handle(req.Method, patron, handler)
+	router.ServeHTTP(w, req)
 
-	// Parsear respuesta JSON
 	var response map[string]interface{}
-	err = json.Unmarshal(w.Body.Bytes(), &response)
-	assert.NoError(t, err)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response), w.Body.String())
+	return w.Code, response
+}
+
+// TestGenerateXMLWithoutSignature prueba la generación de XML sin firma
+func TestGenerateXMLWithoutSignature(t *testing.T) {
+	handler := handlerPrueba(new(MockRepository))
+
+	code, response := ejecutar(t, handler.GenerateXMLWithoutSignature, comprobantePrueba(models.TipoFactura))
+	require.Equal(t, http.StatusOK, code, response)
 
 	// Verificar campos de respuesta
 	assert.Equal(t, "XML generado sin firma exitosamente", response["message"])
@@ -190,193 +344,469 @@ func TestGenerateXMLWithoutSignature(t *testing.T) {
 
 	// Verificar que NO contiene elementos de firma
 	assert.NotContains(t, xmlContent, "<ds:Signature")
-	assert.NotContains(t, xmlContent, "<ext:UBLExtensions>")
 }
 
 // TestGenerateXMLWithoutSignatureInvalidData prueba con datos inválidos
 func TestGenerateXMLWithoutSignatureInvalidData(t *testing.T) {
-	// Configurar Gin para pruebas
-	gin.SetMode(gin.TestMode)
+	handler := handlerPrueba(new(MockRepository))
 
-	// Crear mock del repositorio
-	mockRepo := new(MockRepository)
+	// Comprobante inválido (sin RUC)
+	comprobante := comprobantePrueba(models.TipoFactura)
+	comprobante.Emisor.RUC = ""
 
-	// Crear servicios reales
-	certManager := certificate.NewManager()
-	ublService := services.NewUBLService()
-	conversionService := services.NewConversionService(ublService)
-	signingService := services.NewSigningService(certManager, ublService)
-	encodingService := services.NewEncodingService()
-	sunatService := services.NewSUNATService(&models.SUNATConfig{}, encodingService)
+	code, response := ejecutar(t, handler.GenerateXMLWithoutSignature, comprobante)
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Contains(t, response, "error")
+	assert.Contains(t, response["details"], "RUC emisor es obligatorio")
+}
 
-	// Crear handler
-	handler := NewComprobanteHandler(
-		mockRepo,
-		conversionService,
-		signingService,
-		encodingService,
-		sunatService,
-	)
+// TestGenerateXMLWithoutSignatureDifferentTypes prueba diferentes tipos de comprobantes
+func TestGenerateXMLWithoutSignatureDifferentTypes(t *testing.T) {
+	handler := handlerPrueba(new(MockRepository))
 
-	// Crear comprobante inválido (sin RUC)
-	comprobante := models.Comprobante{
-		Tipo:        models.TipoFactura,
-		Serie:       "F001",
-		Numero:      "00000001",
-		TipoMoneda:  "PEN",
-		FechaEmision: time.Now(),
-		Emisor: models.Emisor{
-			RUC:     "", // RUC vacío - inválido
-			RazonSocial: "EMPRESA DE PRUEBA SAC",
-		},
-		Receptor: models.Receptor{
-			TipoDocumento:    "1",
-			NumeroDocumento:  "12345678",
-			RazonSocial:      "CLIENTE DE PRUEBA",
-		},
-		Items: []models.Item{
-			{
-				Codigo:        "PROD001",
-				Descripcion:   "PRODUCTO DE PRUEBA",
-				Cantidad:      1,
-				PrecioUnitario: 100.00,
-			},
-		},
+	testCases := []struct {
+		name            string
+		tipo            models.TipoComprobante
+		expectedElement string
+	}{
+		{"Factura", models.TipoFactura, "<Invoice"},
+		{"Boleta", models.TipoBoleta, "<Invoice"},
+		{"Nota de Crédito", models.TipoNotaCredito, "<CreditNote"},
+		{"Nota de Débito", models.TipoNotaDebito, "<DebitNote"},
 	}
 
-	// Convertir a JSON
-	jsonData, err := json.Marshal(comprobante)
-	assert.NoError(t, err)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, response := ejecutar(t, handler.GenerateXMLWithoutSignature, comprobantePrueba(tc.tipo))
+			require.Equal(t, http.StatusOK, code, response)
+			assert.Contains(t, response["xml_content"], tc.expectedElement)
+		})
+	}
+}
 
-	// Crear request HTTP
-	req, err := http.NewRequest("POST", "/api/v1/comprobantes/generate-xml", bytes.NewBuffer(jsonData))
-	assert.NoError(t, err)
-	req.Header.Set("Content-Type", "application/json")
+// TestValidateComprobante prueba el validador de reglas SUNAT de /utils/validate
+// requiereEsquemas omite la prueba si el árbol no incluye los esquemas oficiales
+// UBL 2.1: sin ellos el servicio no valida ni firma comprobantes
+func requiereEsquemas(t *testing.T) {
+	t.Helper()
+	if _, err := xsd.UBL21(); errors.Is(err, xsd.ErrEsquemasNoInstalados) {
+		t.Skipf("%v (ver pkg/xsd/esquemas/LEEME.md)", err)
+	}
+}
 
-	// Crear response recorder
-	w := httptest.NewRecorder()
+func TestValidateComprobante(t *testing.T) {
+	requiereEsquemas(t)
+	handler := handlerPrueba(new(MockRepository))
 
-	// Configurar router de prueba
-	router := gin.New()
-	router.POST("/api/v1/comprobantes/generate-xml", handler.GenerateXMLWithoutSignature)
+	testCases := []struct {
+		name    string
+		ajustar func(comprobante *models.Comprobante)
+		valido  bool
+		codigo  string
+	}{
+		{"factura válida", func(comprobante *models.Comprobante) {}, true, ""},
+		{"factura a un receptor con DNI", func(comprobante *models.Comprobante) {
+			comprobante.Receptor.TipoDocumento = "1"
+			comprobante.Receptor.NumeroDocumento = "12345678"
+		}, false, "2800"},
+	}
 
-	// Ejecutar request
-	router.ServeHTTP(w, req)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			comprobante := comprobantePrueba(models.TipoFactura)
+			comprobante.Receptor.TipoDocumento = "6"
+			comprobante.Receptor.NumeroDocumento = "20100066603"
+			tc.ajustar(&comprobante)
+
+			code, response := ejecutar(t, handler.ValidateComprobante, comprobante)
+			require.Equal(t, http.StatusOK, code, response)
+			assert.Equal(t, tc.valido, response["valido"], response["hallazgos"])
+			if tc.codigo != "" {
+				assert.Contains(t, codigosHallazgos(response), tc.codigo)
+			}
+		})
+	}
+}
 
-	// Verificar que devuelve error
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
+// TestValidateComprobanteSinEsquemas prueba que sin los esquemas oficiales el
+// comprobante no se da por válido
+func TestValidateComprobanteSinEsquemas(t *testing.T) {
+	if _, err := xsd.UBL21(); !errors.Is(err, xsd.ErrEsquemasNoInstalados) {
+		t.Skip("los esquemas oficiales están instalados")
+	}
 
-	// Parsear respuesta JSON
-	var response map[string]interface{}
-	err = json.Unmarshal(w.Body.Bytes(), &response)
-	assert.NoError(t, err)
+	comprobante := comprobantePrueba(models.TipoFactura)
+	comprobante.Receptor.TipoDocumento = "6"
+	comprobante.Receptor.NumeroDocumento = "20100066603"
 
-	// Verificar que contiene mensaje de error
-	assert.Contains(t, response, "error")
-	assert.Contains(t, response["error"], "RUC emisor es obligatorio")
+	code, response := ejecutar(t, handlerPrueba(new(MockRepository)).ValidateComprobante, comprobante)
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Equal(t, "Error validando el esquema XSD", response["error"])
+	assert.Contains(t, response["details"], "no están instalados")
 }
 
-// TestGenerateXMLWithoutSignatureDifferentTypes prueba diferentes tipos de comprobantes
-func TestGenerateXMLWithoutSignatureDifferentTypes(t *testing.T) {
-	// Configurar Gin para pruebas
-	gin.SetMode(gin.TestMode)
+// codigosHallazgos extrae los códigos de los hallazgos de una respuesta
+func codigosHallazgos(response map[string]interface{}) []string {
+	var codigos []string
+	hallazgos, _ := response["hallazgos"].([]interface{})
+	for _, h := range hallazgos {
+		if hallazgo, ok := h.(map[string]interface{}); ok {
+			codigos = append(codigos, hallazgo["codigo"].(string))
+		}
+	}
+	return codigos
+}
 
-	// Crear mock del repositorio
-	mockRepo := new(MockRepository)
+// TestGetContribuyente prueba la consulta de contribuyentes en el padrón de RUC
+func TestGetContribuyente(t *testing.T) {
+	handler := handlerPrueba(new(MockRepository))
+	handler.padronService = services.NewPadronService(nuevoPadronPrueba())
 
-	// Crear servicios reales
-	certManager := certificate.NewManager()
-	ublService := services.NewUBLService()
-	conversionService := services.NewConversionService(ublService)
-	signingService := services.NewSigningService(certManager, ublService)
-	encodingService := services.NewEncodingService()
-	sunatService := services.NewSUNATService(&models.SUNATConfig{}, encodingService)
+	code, response := consultar(t, handler.GetContribuyente, "ruc=20100066603")
+	require.Equal(t, http.StatusOK, code, response)
+	assert.Equal(t, "CLIENTE DEL PADRON SAC", response["razon_social"])
+	assert.Equal(t, true, response["activo"])
+	assert.Equal(t, "150101", response["ubigeo"])
 
-	// Crear handler
-	handler := NewComprobanteHandler(
-		mockRepo,
-		conversionService,
-		signingService,
-		encodingService,
-		sunatService,
-	)
+	code, response = consultar(t, handler.GetContribuyente, "ruc=20123456786")
+	assert.Equal(t, http.StatusNotFound, code, response)
+
+	code, _ = consultar(t, handler.GetContribuyente, "")
+	assert.Equal(t, http.StatusBadRequest, code)
 
-	// Casos de prueba para diferentes tipos
+	// Sin padrón configurado el servicio no está disponible
+	code, _ = consultar(t, handlerPrueba(new(MockRepository)).GetContribuyente, "ruc=20100066603")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+}
+
+// TestValidateRUCPadron prueba la validación de RUC contra el padrón importado
+func TestValidateRUCPadron(t *testing.T) {
+	padron := nuevoPadronPrueba()
+	handler := handlerPrueba(new(MockRepository))
+	handler.padronService = services.NewPadronService(padron)
+
+	code, response := consultar(t, handler.ValidateRUC, "ruc=20100066603")
+	require.Equal(t, http.StatusOK, code, response)
+	assert.Equal(t, true, response["valid"])
+	assert.Equal(t, "CLIENTE DEL PADRON SAC", response["razon_social"])
+
+	// Un RUC válido que no figura en el padrón importado es rechazado
+	_, response = consultar(t, handler.ValidateRUC, "ruc=20123456786")
+	assert.Equal(t, false, response["valid"])
+	assert.Contains(t, response["error"], "no figura en el padrón")
+
+	// Sin importaciones solo se responde la validación local
+	delete(padron.importaciones, models.PadronRUC)
+	_, response = consultar(t, handler.ValidateRUC, "ruc=20123456786")
+	assert.Equal(t, true, response["valid"])
+	assert.Equal(t, "Padrón de RUC no importado", response["warning"])
+}
+
+// TestCreateComprobanteCompletaReceptor prueba que el receptor se completa desde el padrón
+func TestCreateComprobanteCompletaReceptor(t *testing.T) {
+	repo := new(MockRepository)
+	var guardado *models.Comprobante
+	repo.On("Create", mock.Anything).Run(func(args mock.Arguments) {
+		guardado = args.Get(0).(*models.Comprobante)
+	}).Return(errors.New("sin base de datos"))
+
+	handler := handlerPrueba(repo)
+	handler.padronService = services.NewPadronService(nuevoPadronPrueba())
+
+	comprobante := comprobantePrueba(models.TipoFactura)
+	comprobante.Receptor = models.Receptor{TipoDocumento: "6", NumeroDocumento: "20100066603"}
+
+	code, response := ejecutar(t, handler.CreateComprobante, comprobante)
+	assert.Equal(t, http.StatusInternalServerError, code, response)
+	require.NotNil(t, guardado)
+	assert.Equal(t, "CLIENTE DEL PADRON SAC", guardado.Receptor.RazonSocial)
+	assert.Contains(t, guardado.Receptor.Direccion, "AREQUIPA")
+	assert.Equal(t, "150101", guardado.Receptor.Ubigeo)
+}
+
+// TestCreateComprobanteDocumentoReceptor prueba la validación del documento del receptor
+func TestCreateComprobanteDocumentoReceptor(t *testing.T) {
+	handler := handlerPrueba(nil)
 	testCases := []struct {
 		name      string
+		crear     gin.HandlerFunc
 		tipo      models.TipoComprobante
-		expectedElement string
+		operacion string
+		documento string
+		numero    string
+		mensaje   string // Vacío si el documento es válido para el tipo de comprobante
 	}{
-		{"Factura", models.TipoFactura, "<Invoice"},
-		{"Boleta", models.TipoBoleta, "<Invoice"},
-		{"Nota de Crédito", models.TipoNotaCredito, "<CreditNote"},
-		{"Nota de Débito", models.TipoNotaDebito, "<DebitNote"},
+		{"factura con RUC", handler.CreateComprobante, models.TipoFactura, "", "6", "20100066603", ""},
+		{"RUC con dígito verificador incorrecto", handler.CreateComprobante, models.TipoFactura, "", "6", "20100066604", "dígito verificador"},
+		{"factura con DNI", handler.CreateComprobante, models.TipoFactura, "", "1", "12345678", "debe identificarse con RUC"},
+		{"boleta con DNI", handler.CreateComprobante, models.TipoBoleta, "", "1", "12345678", ""},
+		{"DNI incompleto", handler.CreateComprobante, models.TipoBoleta, "", "1", "1234567", "8 dígitos"},
+		{"boleta con carné de extranjería", handler.CreateComprobante, models.TipoBoleta, "", "4", "001234567", ""},
+		{"boleta con pasaporte", handler.CreateComprobante, models.TipoBoleta, "", "7", "AB1234567", ""},
+		{"boleta sin identificación", handler.CreateComprobante, models.TipoBoleta, "", "-", "-", ""},
+		{"tipo fuera del catálogo 06", handler.CreateComprobante, models.TipoBoleta, "", "9", "123", "catálogo 06"},
+		{"ruta de facturas con RUC", handler.CreateFactura, models.TipoFactura, "", "6", "20100066603", ""},
+		{"ruta de facturas con DNI", handler.CreateFactura, models.TipoFactura, "", "1", "12345678", "debe identificarse con RUC"},
+		{"ruta de facturas, exportación a un no domiciliado", handler.CreateFactura, models.TipoFactura, "0200", "0", "US123456789", ""},
+		{"ruta de notas de crédito con DNI", handler.CreateNotaCredito, models.TipoNotaCredito, "", "1", "12345678", ""},
+		{"ruta de notas de crédito con pasaporte", handler.CreateNotaCredito, models.TipoNotaCredito, "", "7", "AB1234567", ""},
+		{"ruta de notas de crédito sin identificación", handler.CreateNotaCredito, models.TipoNotaCredito, "", "-", "-", ""},
+		{"ruta de notas de débito sin número de documento", handler.CreateNotaDebito, models.TipoNotaDebito, "", "4", "", "obligatorio"},
+		{"ruta de liquidaciones de compra con RUC", handler.CreateLiquidacionCompra, models.TipoLiquidacionCompra, "", "6", "20100066603", "debe identificarse con DNI"},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			// Crear comprobante con el tipo específico
-			comprobante := models.Comprobante{
-				Tipo:        tc.tipo,
-				Serie:       "F001",
-				Numero:      "00000001",
-				TipoMoneda:  "PEN",
-				FechaEmision: time.Now(),
-				Emisor: models.Emisor{
-					RUC:     "20123456789",
-					RazonSocial: "EMPRESA DE PRUEBA SAC",
-				},
-				Receptor: models.Receptor{
-					TipoDocumento:    "1",
-					NumeroDocumento:  "12345678",
-					RazonSocial:      "CLIENTE DE PRUEBA",
-				},
-				Items: []models.Item{
-					{
-						Codigo:        "PROD001",
-						Descripcion:   "PRODUCTO DE PRUEBA",
-						Cantidad:      1,
-						PrecioUnitario: 100.00,
-						Impuestos: []models.ImpuestoItem{
-							{
-								Tipo:   "1000",
-								Porcentaje: 18.0,
-							},
-						},
-					},
-				},
+			// Los documentos válidos continúan hasta el cálculo o el guardado
+			repo := new(MockRepository)
+			repo.On("Create", mock.Anything).Return(errors.New("sin base de datos"))
+			handler.repository = repo
+
+			comprobante := comprobantePrueba(tc.tipo)
+			comprobante.TipoOperacion = tc.operacion
+			comprobante.Receptor.TipoDocumento = tc.documento
+			comprobante.Receptor.NumeroDocumento = tc.numero
+
+			code, response := ejecutar(t, tc.crear, comprobante)
+			if tc.mensaje == "" {
+				assert.NotEqual(t, "Documento del receptor inválido", response["error"], response)
+				return
 			}
+			require.Equal(t, http.StatusBadRequest, code, response)
+			assert.Contains(t, fmt.Sprint(response["error"], response["details"]), tc.mensaje)
+		})
+	}
+}
 
-			// Convertir a JSON
-			jsonData, err := json.Marshal(comprobante)
-			assert.NoError(t, err)
+// TestGetPadronesRUC prueba la consulta de los padrones del IGV de un RUC
+func TestGetPadronesRUC(t *testing.T) {
+	handler := handlerPrueba(new(MockRepository))
+	handler.padronService = services.NewPadronService(nuevoPadronPrueba())
 
-			// Crear request HTTP
-			req, err := http.NewRequest("POST", "/api/v1/utils/generate-xml", bytes.NewBuffer(jsonData))
-			assert.NoError(t, err)
-			req.Header.Set("Content-Type", "application/json")
+	code, response := consultarRuta(t, handler.GetPadronesRUC, "/:ruc", "/20100066603")
+	require.Equal(t, http.StatusOK, code, response)
+	assert.Equal(t, true, response["agente_retencion"])
+	assert.Equal(t, false, response["agente_percepcion"])
+	assert.Equal(t, false, response["buen_contribuyente"])
 
-			// Crear response recorder
-			w := httptest.NewRecorder()
+	// Los padrones no importados se informan sin fecha
+	importados := response["padrones_importados"].(map[string]interface{})
+	assert.NotNil(t, importados[models.PadronAgentesRetencion])
+	assert.Nil(t, importados[models.PadronBuenosContribuyentes])
 
-			// Configurar router de prueba
-			router := gin.New()
-			router.POST("/api/v1/utils/generate-xml", handler.GenerateXMLWithoutSignature)
+	code, _ = consultarRuta(t, handler.GetPadronesRUC, "/:ruc", "/20100066604")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
 
-			// Ejecutar request
-			router.ServeHTTP(w, req)
+// TestCreateComprobanteRetencion prueba que la venta a un agente de retención se marca con retención
+func TestCreateComprobanteRetencion(t *testing.T) {
+	ayer := time.Now().UTC().AddDate(0, 0, -1)
+	testCases := []struct {
+		name      string
+		moneda    string
+		cantidad  float64
+		retencion *models.Retencion
+	}{
+		{"en soles sobre el mínimo", "PEN", 10, &models.Retencion{BaseImponible: 1180, Porcentaje: 3, Monto: 35.4, MontoNeto: 1144.6}},
+		{"en soles bajo el mínimo", "PEN", 2, nil},
+		// US$ 236.00 equivalen a S/ 885.00, sobre el mínimo de S/ 700
+		{"en dólares sobre el mínimo en soles", "USD", 2, &models.Retencion{BaseImponible: 885, Porcentaje: 3, Monto: 26.55, MontoNeto: 228.92, TipoCambio: 3.75}},
+	}
 
-			// Verificar respuesta exitosa
-			assert.Equal(t, http.StatusOK, w.Code)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := new(MockRepository)
+			var guardado *models.Comprobante
+			repo.On("Create", mock.Anything).Run(func(args mock.Arguments) {
+				guardado = args.Get(0).(*models.Comprobante)
+			}).Return(errors.New("sin base de datos"))
+
+			handler := handlerPrueba(repo)
+			handler.padronService = services.NewPadronService(nuevoPadronPrueba())
+			handler.conversionService.TipoCambioService = services.NewTipoCambioService(tiposCambioPrueba{
+				{Moneda: "USD", Fecha: time.Date(ayer.Year(), ayer.Month(), ayer.Day(), 0, 0, 0, 0, time.UTC), Compra: 3.74, Venta: 3.75, Fuente: "SBS"},
+			})
+
+			comprobante := comprobantePrueba(models.TipoFactura)
+			comprobante.TipoMoneda = tc.moneda
+			comprobante.Receptor.TipoDocumento = "6"
+			comprobante.Receptor.NumeroDocumento = "20100066603"
+			comprobante.Items[0].Cantidad = tc.cantidad
+
+			code, response := ejecutar(t, handler.CreateComprobante, comprobante)
+			assert.Equal(t, http.StatusInternalServerError, code, response)
+			require.NotNil(t, guardado)
+			assert.Equal(t, tc.retencion, guardado.Retencion)
+		})
+	}
+}
+
+// TestGetTasaCambio prueba la consulta del tipo de cambio oficial en /api/soles
+func TestGetTasaCambio(t *testing.T) {
+	handler := handlerPrueba(new(MockRepository))
+	handler.tipoCambioService = nuevoTipoCambioPrueba()
+
+	testCases := []struct {
+		name        string
+		consulta    string
+		codigo      int
+		publicacion string
+	}{
+		{"día publicado", "moneda=USD&fecha=14-06-2024", http.StatusOK, "14-06-2024"},
+		{"fin de semana usa el último día hábil", "moneda=usd&fecha=2024-06-16", http.StatusOK, "14-06-2024"},
+		{"sin publicación", "moneda=USD&fecha=01-01-2024", http.StatusNotFound, ""},
+		{"fecha inválida", "moneda=USD&fecha=31-02-2024", http.StatusBadRequest, ""},
+		{"moneda fuera del catálogo", "moneda=XXX&fecha=14-06-2024", http.StatusBadRequest, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, response := consultar(t, handler.GetTasaCambio, tc.consulta)
+			require.Equal(t, tc.codigo, code, response)
+			if tc.publicacion != "" {
+				assert.Equal(t, tc.publicacion, response["fecha_publicacion"])
+				assert.Equal(t, 3.765, response["compra"])
+				assert.Equal(t, 3.775, response["venta"])
+				assert.Equal(t, "SBS", response["fuente"])
+			}
+		})
+	}
+
+	// Sin tipos de cambio cargados no se inventa una cotización
+	code, _ := consultar(t, handlerPrueba(new(MockRepository)).GetTasaCambio, "moneda=USD")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+}
+
+// TestCalculadoraCambio prueba la conversión de importes en /api/calculadora
+func TestCalculadoraCambio(t *testing.T) {
+	handler := handlerPrueba(new(MockRepository))
+	handler.tipoCambioService = nuevoTipoCambioPrueba()
+
+	testCases := []struct {
+		name      string
+		consulta  string
+		resultado float64
+	}{
+		{"dólares a soles", "valor=100&de=USD&a=PEN&fecha=14-06-2024", 377.5},
+		{"soles a dólares", "valor=377.5&de=PEN&a=USD&fecha=14-06-2024", 100},
+		{"cotización de compra", "valor=100&de=USD&a=PEN&fecha=14-06-2024&operacion=compra", 376.5},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, response := consultar(t, handler.CalculadoraCambio, tc.consulta)
+			require.Equal(t, http.StatusOK, code, response)
+			assert.Equal(t, tc.resultado, response["resultado"])
+		})
+	}
+
+	code, _ := consultar(t, handler.CalculadoraCambio, "valor=abc")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+// TestCreateComprobanteDetraccion prueba la detracción según el catálogo 54 al crear una factura
+func TestCreateComprobanteDetraccion(t *testing.T) {
+	cuenta := func(codigo string) *models.Detraccion {
+		return &models.Detraccion{Codigo: codigo, NumeroCuenta: "00-123-456789"}
+	}
+
+	testCases := []struct {
+		name        string
+		detraccion  *models.Detraccion
+		codigoSUNAT string
+		cantidad    float64
+		codigo      int
+		mensaje     string
+		want        *models.Detraccion
+		operacion   string
+	}{
+		// S/ 1,180.00 al 12% son S/ 142 redondeados a soles
+		{"servicio sobre el monto mínimo", cuenta("037"), "", 10, http.StatusInternalServerError, "",
+			&models.Detraccion{Codigo: "037", NumeroCuenta: "00-123-456789", MedioPago: "001", Porcentaje: 12, MontoBase: 1180, Monto: 142}, "1001"},
+		// El transporte de carga por carretera corresponde al código 027 (4%)
+		{"código deducido del producto", cuenta(""), "78101802", 10, http.StatusInternalServerError, "",
+			&models.Detraccion{Codigo: "027", NumeroCuenta: "00-123-456789", MedioPago: "001", Porcentaje: 4, MontoBase: 1180, Monto: 47}, "1004"},
+		{"servicio bajo el monto mínimo", cuenta("037"), "", 5, http.StatusInternalServerError, "", nil, ""},
+		{"producto sujeto sin los datos de la detracción", nil, "78101802", 10, http.StatusUnprocessableEntity, "indique la cuenta de detracciones", nil, ""},
+		{"código distinto al del producto", cuenta("037"), "78101802", 10, http.StatusUnprocessableEntity, "no corresponde al de los ítems", nil, ""},
+		{"porcentaje distinto al del código", &models.Detraccion{Codigo: "037", NumeroCuenta: "00-123-456789", Porcentaje: 10}, "", 10, http.StatusUnprocessableEntity, "es 12%", nil, ""},
+		{"sin cuenta del Banco de la Nación", &models.Detraccion{Codigo: "037"}, "", 10, http.StatusUnprocessableEntity, "número de cuenta", nil, ""},
+		{"código fuera del catálogo", cuenta("999"), "", 10, http.StatusUnprocessableEntity, "catálogo 54", nil, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := new(MockRepository)
+			var guardado *models.Comprobante
+			repo.On("Create", mock.Anything).Run(func(args mock.Arguments) {
+				guardado = args.Get(0).(*models.Comprobante)
+			}).Return(errors.New("sin base de datos"))
+			handler := handlerPrueba(repo)
+
+			comprobante := comprobantePrueba(models.TipoFactura)
+			comprobante.Receptor.TipoDocumento = "6"
+			comprobante.Receptor.NumeroDocumento = "20100066603"
+			comprobante.Items[0].Cantidad = tc.cantidad
+			comprobante.Items[0].CodigoSUNAT = tc.codigoSUNAT
+			comprobante.Detraccion = tc.detraccion
+
+			code, response := ejecutar(t, handler.CreateComprobante, comprobante)
+			require.Equal(t, tc.codigo, code, response)
+			if tc.mensaje != "" {
+				assert.Equal(t, "Detracción inválida", response["error"])
+				assert.Contains(t, response["details"], tc.mensaje)
+				return
+			}
 
-			// Parsear respuesta JSON
-			var response map[string]interface{}
-			err = json.Unmarshal(w.Body.Bytes(), &response)
-			assert.NoError(t, err)
+			require.NotNil(t, guardado)
+			assert.Equal(t, tc.want, guardado.Detraccion)
+			if tc.operacion != "" {
+				assert.Equal(t, tc.operacion, guardado.TipoOperacion)
+			} else {
+				assert.False(t, models.EsOperacionDetraccion(guardado.TipoOperacion))
+			}
+		})
+	}
+}
 
-			// Verificar que el XML contiene el elemento esperado
-			xmlContent := response["xml_content"].(string)
-			assert.Contains(t, xmlContent, tc.expectedElement)
+// TestCreateComprobanteEstablecimiento prueba que la serie determina el establecimiento emisor
+func TestCreateComprobanteEstablecimiento(t *testing.T) {
+	testCases := []struct {
+		name            string
+		serie           string
+		codigo          string
+		status          int
+		establecimiento string
+	}{
+		{"serie del anexo", "F001", "", http.StatusInternalServerError, "0001"},
+		{"serie sin establecimiento", "F002", "", http.StatusUnprocessableEntity, ""},
+		{"código distinto al de la serie", "F001", "0000", http.StatusUnprocessableEntity, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := new(MockRepository)
+			var guardado *models.Comprobante
+			repo.On("Create", mock.Anything).Run(func(args mock.Arguments) {
+				guardado = args.Get(0).(*models.Comprobante)
+			}).Return(errors.New("sin base de datos"))
+			handler := handlerPrueba(repo)
+			handler.establecimientoService = services.NewEstablecimientoService(nuevosEstablecimientosPrueba())
+
+			comprobante := comprobantePrueba(models.TipoFactura)
+			comprobante.Receptor.TipoDocumento = "6"
+			comprobante.Receptor.NumeroDocumento = "20100066603"
+			comprobante.Serie = tc.serie
+			comprobante.Emisor.CodigoEstablecimiento = tc.codigo
+
+			code, response := ejecutar(t, handler.CreateComprobante, comprobante)
+			require.Equal(t, tc.status, code, response)
+			if tc.establecimiento == "" {
+				assert.Equal(t, "Establecimiento inválido", response["error"])
+				return
+			}
+			require.NotNil(t, guardado)
+			assert.Equal(t, tc.establecimiento, guardado.Emisor.CodigoEstablecimiento)
 		})
 	}
-} 
\ No newline at end of file
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"errors"
+	"facturacion_sunat_api_go/internal/models"
+	"facturacion_sunat_api_go/internal/repository"
+	"facturacion_sunat_api_go/internal/services"
+	"facturacion_sunat_api_go/pkg/identidad"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EstablecimientoHandler administra el domicilio fiscal y los establecimientos
+// anexos de cada emisor con las series que emiten
+type EstablecimientoHandler struct {
+	service *services.EstablecimientoService
+}
+
+func NewEstablecimientoHandler(service *services.EstablecimientoService) *EstablecimientoHandler {
+	return &EstablecimientoHandler{
+		service: service,
+	}
+}
+
+// ListEstablecimientos lista los establecimientos registrados de un RUC
+func (h *EstablecimientoHandler) ListEstablecimientos(c *gin.Context) {
+	ruc := c.Param("ruc")
+	if err := identidad.ValidarRUC(ruc); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "RUC inválido", "details": err.Error()})
+		return
+	}
+
+	establecimientos, err := h.service.Listar(ruc)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Error obteniendo establecimientos",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ruc":              ruc,
+		"establecimientos": establecimientos,
+	})
+}
+
+// SaveEstablecimiento registra o actualiza un establecimiento del RUC con sus
+// series. Un establecimiento se da de baja enviándolo con "activo": false.
+func (h *EstablecimientoHandler) SaveEstablecimiento(c *gin.Context) {
+	establecimiento := models.Establecimiento{Activo: true}
+	if err := c.ShouldBindJSON(&establecimiento); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Datos inválidos",
+			"details": err.Error(),
+		})
+		return
+	}
+	establecimiento.RUC = c.Param("ruc")
+	establecimiento.Codigo = c.Param("codigo")
+
+	if err := h.service.Guardar(&establecimiento); err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrEstablecimientoInvalido):
+			status = http.StatusBadRequest
+		case errors.Is(err, repository.ErrSerieAsignada):
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"error":   "Error guardando establecimiento",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Establecimiento guardado exitosamente",
+		"establecimiento": establecimiento,
+	})
+}
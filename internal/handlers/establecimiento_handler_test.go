@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"facturacion_sunat_api_go/internal/models"
+	"facturacion_sunat_api_go/internal/repository"
+	"facturacion_sunat_api_go/internal/services"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// establecimientosPrueba guarda en memoria los establecimientos de cada RUC
+type establecimientosPrueba map[string][]models.Establecimiento
+
+func (p establecimientosPrueba) Guardar(establecimiento *models.Establecimiento) error {
+	actuales := p[establecimiento.RUC]
+	for _, actual := range actuales {
+		if actual.Codigo == establecimiento.Codigo {
+			continue
+		}
+		for _, serie := range actual.Series {
+			for _, nueva := range establecimiento.Series {
+				if serie == nueva {
+					return fmt.Errorf("%w: la serie %s pertenece al establecimiento %s", repository.ErrSerieAsignada, serie, actual.Codigo)
+				}
+			}
+		}
+	}
+	for i, actual := range actuales {
+		if actual.Codigo == establecimiento.Codigo {
+			actuales[i] = *establecimiento
+			return nil
+		}
+	}
+	p[establecimiento.RUC] = append(actuales, *establecimiento)
+	return nil
+}
+
+func (p establecimientosPrueba) Listar(ruc string) ([]models.Establecimiento, error) {
+	return append([]models.Establecimiento(nil), p[ruc]...), nil
+}
+
+// nuevosEstablecimientosPrueba registra para el emisor de prueba un anexo que emite la serie F001
+func nuevosEstablecimientosPrueba() establecimientosPrueba {
+	return establecimientosPrueba{
+		"20123456786": {
+			{RUC: "20123456786", Codigo: "0001", Direccion: "AV. LARCO 345", Ubigeo: "150122", Activo: true, Series: []string{"F001", "B001"}},
+		},
+	}
+}
+
+// guardarEstablecimiento envía el establecimiento a SaveEstablecimiento
+func guardarEstablecimiento(t *testing.T, handler *EstablecimientoHandler, ruc, codigo string, cuerpo interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	jsonData, err := json.Marshal(cuerpo)
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPut, "/"+ruc+"/"+codigo, bytes.NewBuffer(jsonData))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	return servirEn(t, handler.SaveEstablecimiento, "/:ruc/:codigo", req)
+}
+
+func TestSaveEstablecimiento(t *testing.T) {
+	testCases := []struct {
+		name    string
+		ruc     string
+		codigo  string
+		cuerpo  map[string]interface{}
+		status  int
+		mensaje string
+	}{
+		{"anexo nuevo", "20123456786", "0002",
+			map[string]interface{}{"direccion": "JR. DE LA UNION 500", "departamento": "LIMA", "provincia": "LIMA", "distrito": "LIMA", "series": []string{"f002"}},
+			http.StatusOK, ""},
+		{"serie de otro establecimiento", "20123456786", "0002",
+			map[string]interface{}{"direccion": "JR. DE LA UNION 500", "ubigeo": "150101", "series": []string{"F001"}},
+			http.StatusConflict, "pertenece al establecimiento 0001"},
+		{"RUC con dígito verificador incorrecto", "20123456787", "0002",
+			map[string]interface{}{"direccion": "JR. DE LA UNION 500", "ubigeo": "150101"},
+			http.StatusBadRequest, "RUC del emisor"},
+		{"código de establecimiento inválido", "20123456786", "12",
+			map[string]interface{}{"direccion": "JR. DE LA UNION 500", "ubigeo": "150101"},
+			http.StatusBadRequest, "4 dígitos"},
+		{"serie con formato inválido", "20123456786", "0002",
+			map[string]interface{}{"direccion": "JR. DE LA UNION 500", "ubigeo": "150101", "series": []string{"X001"}},
+			http.StatusBadRequest, "serie X001"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := NewEstablecimientoHandler(services.NewEstablecimientoService(nuevosEstablecimientosPrueba()))
+
+			code, response := guardarEstablecimiento(t, handler, tc.ruc, tc.codigo, tc.cuerpo)
+			require.Equal(t, tc.status, code, response)
+			if tc.mensaje != "" {
+				assert.Contains(t, response["details"], tc.mensaje)
+				return
+			}
+
+			// El ubigeo se resuelve desde los nombres y la serie se normaliza
+			establecimiento := response["establecimiento"].(map[string]interface{})
+			assert.Equal(t, "150101", establecimiento["ubigeo"])
+			assert.Equal(t, true, establecimiento["activo"])
+			assert.Equal(t, []interface{}{"F002"}, establecimiento["series"])
+		})
+	}
+}
+
+func TestListEstablecimientos(t *testing.T) {
+	handler := NewEstablecimientoHandler(services.NewEstablecimientoService(nuevosEstablecimientosPrueba()))
+
+	code, response := consultarRuta(t, handler.ListEstablecimientos, "/:ruc", "/20123456786")
+	require.Equal(t, http.StatusOK, code, response)
+	establecimientos := response["establecimientos"].([]interface{})
+	require.Len(t, establecimientos, 1)
+	assert.Equal(t, "0001", establecimientos[0].(map[string]interface{})["codigo"])
+
+	code, _ = consultarRuta(t, handler.ListEstablecimientos, "/:ruc", "/2012345678")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
@@ -1,7 +1,13 @@
 package models
 
 import (
+	"facturacion_sunat_api_go/pkg/catalogos"
+	"facturacion_sunat_api_go/pkg/identidad"
 	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -14,12 +20,24 @@ type Comprobante struct {
 	FechaEmision      time.Time              `json:"fecha_emision" db:"fecha_emision"`
 	FechaVencimiento  *time.Time             `json:"fecha_vencimiento,omitempty" db:"fecha_vencimiento"`
 	TipoMoneda        string                 `json:"tipo_moneda" db:"tipo_moneda"`
+	TipoOperacion     string                 `json:"tipo_operacion,omitempty" db:"tipo_operacion"`
 	Emisor            Emisor                 `json:"emisor"`
 	Receptor          Receptor               `json:"receptor"`
 	Items             []Item                 `json:"items"`
 	Totales           Totales                `json:"totales"`
 	Impuestos         []Impuesto             `json:"impuestos"`
+	CargosDescuentos  []CargoDescuento       `json:"cargos_descuentos,omitempty"`
+	EsAnticipo        bool                   `json:"es_anticipo,omitempty" db:"es_anticipo"`
+	Anticipos         []Anticipo             `json:"anticipos,omitempty"`
 	FormaPago         *FormaPago             `json:"forma_pago,omitempty"`
+	CondicionesEntrega *CondicionesEntrega   `json:"condiciones_entrega,omitempty"`
+	Percepcion        *Percepcion            `json:"percepcion,omitempty"`
+	Retencion         *Retencion             `json:"retencion,omitempty"`
+	Detraccion        *Detraccion            `json:"detraccion,omitempty"`
+	Liquidacion       *LiquidacionCompra     `json:"liquidacion,omitempty"`
+	OrdenCompra       string                 `json:"orden_compra,omitempty" db:"orden_compra"`
+	Guias             []DocumentoRelacionado `json:"guias,omitempty"`
+	DocumentosRelacionados []DocumentoRelacionado `json:"documentos_relacionados,omitempty"`
 	Observaciones     string                 `json:"observaciones,omitempty" db:"observaciones"`
 	EstadoProceso     EstadoProceso          `json:"estado_proceso" db:"estado_proceso"`
 	XMLGenerado       string                 `json:"xml_generado,omitempty" db:"xml_generado"`
@@ -40,6 +58,7 @@ const (
 	TipoBoleta
 	TipoNotaCredito
 	TipoNotaDebito
+	TipoLiquidacionCompra
 )
 
 func (t TipoComprobante) String() string {
@@ -52,6 +71,8 @@ func (t TipoComprobante) String() string {
 		return "07"
 	case TipoNotaDebito:
 		return "08"
+	case TipoLiquidacionCompra:
+		return "04"
 	default:
 		return "01"
 	}
@@ -78,10 +99,64 @@ type Emisor struct {
 	Distrito           string `json:"distrito" validate:"required"`
 	Provincia          string `json:"provincia" validate:"required"`
 	Departamento       string `json:"departamento" validate:"required"`
+	Ubigeo             string `json:"ubigeo,omitempty"` // Catálogo 13 (INEI); se resuelve desde los nombres si se omite
 	CodigoPostal       string `json:"codigo_postal,omitempty"`
 	CodigoPais         string `json:"codigo_pais" validate:"required"`
 	Telefono           string `json:"telefono,omitempty"`
 	Email              string `json:"email,omitempty"`
+	Regimen            string `json:"regimen,omitempty"` // GENERAL o RESTAURANTE_MYPE (Ley 31556)
+	CodigoEstablecimiento string `json:"codigo_establecimiento,omitempty"` // 0000 domicilio fiscal o código del anexo
+	Establecimiento    *Establecimiento `json:"-"` // Establecimiento de la serie, si el RUC los tiene registrados
+}
+
+// Código con que SUNAT identifica el domicilio fiscal; los establecimientos
+// anexos usan el código que les asigna al registrarlos en el RUC
+const EstablecimientoDomicilioFiscal = "0000"
+
+// Establecimiento es el domicilio fiscal o un establecimiento anexo del
+// emisor, con las series que se emiten desde él. Una serie pertenece a un solo
+// establecimiento del RUC.
+type Establecimiento struct {
+	RUC                string    `json:"ruc"`
+	Codigo             string    `json:"codigo" validate:"required,len=4"`
+	Nombre             string    `json:"nombre,omitempty"`
+	Direccion          string    `json:"direccion" validate:"required"`
+	Distrito           string    `json:"distrito,omitempty"`
+	Provincia          string    `json:"provincia,omitempty"`
+	Departamento       string    `json:"departamento,omitempty"`
+	Ubigeo             string    `json:"ubigeo,omitempty"`
+	CodigoPais         string    `json:"codigo_pais,omitempty"`
+	Activo             bool      `json:"activo"`
+	Series             []string  `json:"series,omitempty"`
+	FechaActualizacion time.Time `json:"fecha_actualizacion"`
+}
+
+// ValidarCodigoEstablecimiento verifica que el código de establecimiento tenga
+// los 4 dígitos con que SUNAT lo registra en el RUC
+func ValidarCodigoEstablecimiento(codigo string) error {
+	if len(codigo) != 4 {
+		return fmt.Errorf("el código de establecimiento %q debe tener 4 dígitos", codigo)
+	}
+	for _, c := range codigo {
+		if c < '0' || c > '9' {
+			return fmt.Errorf("el código de establecimiento %q debe tener 4 dígitos", codigo)
+		}
+	}
+	return nil
+}
+
+// CodigoUbigeo retorna el ubigeo del domicilio fiscal. Por compatibilidad se
+// acepta el ubigeo informado en CodigoPostal cuando no se envía Ubigeo.
+func (e Emisor) CodigoUbigeo() string {
+	if e.Ubigeo != "" {
+		return e.Ubigeo
+	}
+	if len(e.CodigoPostal) == 6 {
+		if _, err := strconv.Atoi(e.CodigoPostal); err == nil {
+			return e.CodigoPostal
+		}
+	}
+	return ""
 }
 
 type Receptor struct {
@@ -89,6 +164,11 @@ type Receptor struct {
 	NumeroDocumento string `json:"numero_documento" validate:"required"`
 	RazonSocial     string `json:"razon_social" validate:"required"`
 	Direccion       string `json:"direccion,omitempty"`
+	Distrito        string `json:"distrito,omitempty"`
+	Provincia       string `json:"provincia,omitempty"`
+	Departamento    string `json:"departamento,omitempty"`
+	Ubigeo          string `json:"ubigeo,omitempty"` // Catálogo 13 (INEI), solo para direcciones en Perú
+	CodigoPais      string `json:"codigo_pais,omitempty"`
 	Email           string `json:"email,omitempty"`
 }
 
@@ -105,76 +185,130 @@ type Item struct {
 	DescuentoUnitario   float64             `json:"descuento_unitario,omitempty"`
 	TipoAfectacion      TipoAfectacionIGV   `json:"tipo_afectacion" validate:"required"`
 	ImpuestoItem        []ImpuestoItem      `json:"impuesto_item,omitempty"`
+	CargosDescuentos    []CargoDescuento    `json:"cargos_descuentos,omitempty"`
+	Propiedades         []PropiedadItem     `json:"propiedades,omitempty"`
 	ValorVenta          float64             `json:"valor_venta"`
 	ValorTotal          float64             `json:"valor_total"`
 }
 
+// PropiedadItem es una propiedad adicional del ítem (catálogo 55): la placa del
+// vehículo en la venta de combustible, los datos del huésped no domiciliado, del
+// pasajero o de la descarga de recursos hidrobiológicos. El atributo "tipo" del
+// catálogo indica qué campo lleva el dato, de modo que un código nuevo solo
+// requiere actualizar catalogo55.json.
+type PropiedadItem struct {
+	Codigo       string     `json:"codigo" validate:"required"`
+	Nombre       string     `json:"nombre,omitempty"`        // Por defecto, la descripción del catálogo
+	Valor        string     `json:"valor,omitempty"`         // Textos, placas, países, ubigeos y documentos
+	Fecha        *time.Time `json:"fecha,omitempty"`         // Propiedades de tipo fecha y fecha_fin
+	Hora         string     `json:"hora,omitempty"`          // HH:MM:SS
+	Cantidad     float64    `json:"cantidad,omitempty"`      // Días de permanencia o cantidad vendida
+	UnidadMedida string     `json:"unidad_medida,omitempty"` // Catálogo 03, para la cantidad vendida
+}
+
+// Tipos de dato de las propiedades del catálogo 55 (atributo "tipo")
+const (
+	TipoPropiedadTexto              = "texto"
+	TipoPropiedadPlaca              = "placa"
+	TipoPropiedadFecha              = "fecha"
+	TipoPropiedadFechaFin           = "fecha_fin"
+	TipoPropiedadHora               = "hora"
+	TipoPropiedadDias               = "dias"
+	TipoPropiedadCantidad           = "cantidad"
+	TipoPropiedadPais               = "pais"
+	TipoPropiedadUbigeo             = "ubigeo"
+	TipoPropiedadDocumentoIdentidad = "documento_identidad"
+)
+
+const (
+	// PropiedadPlacaVehiculo es el número de placa del vehículo (catálogo 55)
+	PropiedadPlacaVehiculo = "7000"
+	// LongitudValorPropiedad es la longitud máxima del valor y del nombre de una propiedad
+	LongitudValorPropiedad = 100
+)
+
+// formatoPlaca admite placas con o sin guion, p. ej. ABC-123, A1B-234 o 1234-AB
+var formatoPlaca = regexp.MustCompile(`^[A-Z0-9]{2,4}-?[A-Z0-9]{2,4}$`)
+
+// Tipo retorna el tipo de dato de la propiedad según el catálogo 55
+func (p PropiedadItem) Tipo() string {
+	if tipo := catalogos.Atributo(catalogos.PropiedadItem, p.Codigo, "tipo"); tipo != "" {
+		return tipo
+	}
+	return TipoPropiedadTexto
+}
+
 // TipoAfectacionIGV según especificaciones SUNAT
 type TipoAfectacionIGV int
 
+// Los valores corresponden a los códigos del catálogo 07. Los códigos 11 a 16
+// (gravados), 21 (exonerado) y 31 a 36 (inafectos) son operaciones gratuitas:
+// retiros, premios, donaciones, muestras y bonificaciones.
 const (
-	GravadoOneroso TipoAfectacionIGV = iota + 10
-	GravadoGratuito
-	Exonerado
-	Inafecto
-	ExportacionOperacionGratuita
-	GravadoIVAP
-	ExoneradoIVAP
-	InafectoIVAP
+	GravadoOneroso       TipoAfectacionIGV = 10
+	GravadoGratuito      TipoAfectacionIGV = 11
+	GravadoBonificacion  TipoAfectacionIGV = 15
+	GravadoIVAP          TipoAfectacionIGV = 17
+	Exonerado            TipoAfectacionIGV = 20
+	ExoneradoGratuito    TipoAfectacionIGV = 21
+	ExoneradoIVAP        TipoAfectacionIGV = 27
+	Inafecto             TipoAfectacionIGV = 30
+	InafectoBonificacion TipoAfectacionIGV = 31
+	InafectoIVAP         TipoAfectacionIGV = 37
+	Exportacion          TipoAfectacionIGV = 40
 )
 
 func (t TipoAfectacionIGV) String() string {
-	switch t {
-	case GravadoOneroso:
-		return "10" // Gravado - Operación Onerosa
-	case GravadoGratuito:
-		return "11" // Gravado - Operación Gratuita
-	case Exonerado:
-		return "20" // Exonerado - Operación Onerosa
-	case Inafecto:
-		return "30" // Inafecto - Operación Onerosa
-	case ExportacionOperacionGratuita:
-		return "40" // Exportación - Operación Gratuita
-	case GravadoIVAP:
-		return "17" // Gravado IVAP
-	case ExoneradoIVAP:
-		return "27" // Exonerado IVAP
-	case InafectoIVAP:
-		return "37" // Inafecto IVAP
+	switch {
+	case t >= GravadoOneroso && t <= GravadoIVAP: // Gravados
+		return strconv.Itoa(int(t))
+	case t == Exonerado || t == ExoneradoGratuito || t == ExoneradoIVAP: // Exonerados
+		return strconv.Itoa(int(t))
+	case t >= Inafecto && t <= InafectoIVAP: // Inafectos
+		return strconv.Itoa(int(t))
+	case t == Exportacion: // Exportación de bienes o servicios
+		return "40"
 	default:
 		return "10"
 	}
 }
 
-// ValidarRUC valida formato de RUC según especificaciones SUNAT
-func ValidarRUC(ruc string) error {
-	if len(ruc) != 11 {
-		return fmt.Errorf("RUC debe tener 11 dígitos")
-	}
-	
-	// Validar que sean solo números
-	for _, char := range ruc {
-		if char < '0' || char > '9' {
-			return fmt.Errorf("RUC debe contener solo números")
-		}
-	}
-	
-	// Validar tipo de contribuyente (primeros 2 dígitos)
-	tipoContribuyente := ruc[:2]
-	tiposValidos := []string{"10", "15", "17", "20"}
-	valido := false
-	for _, tipo := range tiposValidos {
-		if tipoContribuyente == tipo {
-			valido = true
-			break
-		}
-	}
-	
-	if !valido {
-		return fmt.Errorf("tipo de contribuyente inválido: %s", tipoContribuyente)
+// EsGratuita indica si la afectación corresponde a una operación no onerosa
+func (t TipoAfectacionIGV) EsGratuita() bool {
+	return (t > GravadoOneroso && t < GravadoIVAP) || t == ExoneradoGratuito || (t > Inafecto && t < InafectoIVAP)
+}
+
+// EsGravada indica si la afectación está gravada con IGV (onerosa o gratuita)
+func (t TipoAfectacionIGV) EsGravada() bool {
+	return t >= GravadoOneroso && t < GravadoIVAP
+}
+
+// EsIVAP indica si la afectación corresponde al Impuesto a la Venta del Arroz Pilado
+func (t TipoAfectacionIGV) EsIVAP() bool {
+	return t == GravadoIVAP || t == ExoneradoIVAP || t == InafectoIVAP
+}
+
+// Tributo retorna el código del catálogo 05 con el que se informa la afectación
+func (t TipoAfectacionIGV) Tributo() string {
+	switch {
+	case t.EsGratuita():
+		return "9996" // GRA
+	case t == GravadoIVAP:
+		return "1016" // IVAP
+	case t == Exonerado || t == ExoneradoIVAP:
+		return "9997" // EXO
+	case t == Inafecto || t == InafectoIVAP:
+		return "9998" // INA
+	case t == Exportacion:
+		return "9995" // EXP
+	default:
+		return "1000" // IGV
 	}
-	
-	return nil
+}
+
+// ValidarRUC valida formato y dígito verificador de RUC según especificaciones SUNAT
+func ValidarRUC(ruc string) error {
+	return identidad.ValidarRUC(ruc)
 }
 
 type ImpuestoItem struct {
@@ -190,7 +324,12 @@ type Totales struct {
 	TotalVentaExonerada    float64 `json:"total_venta_exonerada"`
 	TotalVentaInafecta     float64 `json:"total_venta_inafecta"`
 	TotalVentaGratuita     float64 `json:"total_venta_gratuita"`
+	TotalVentaExportacion  float64 `json:"total_venta_exportacion"`
+	TotalVentaIVAP         float64 `json:"total_venta_ivap"`
 	TotalDescuentos        float64 `json:"total_descuentos"`
+	TotalCargos            float64 `json:"total_cargos"`
+	TotalDescuentosBase    float64 `json:"total_descuentos_base"`
+	TotalCargosBase        float64 `json:"total_cargos_base"`
 	TotalAnticipos         float64 `json:"total_anticipos"`
 	TotalImpuestos         float64 `json:"total_impuestos"`
 	TotalValorVenta        float64 `json:"total_valor_venta"`
@@ -199,6 +338,834 @@ type Totales struct {
 	ImporteTotal           float64 `json:"importe_total"`
 }
 
+// CargoDescuento representa un cargo o descuento (cac:AllowanceCharge) a nivel
+// de ítem o de comprobante, identificado por su código del catálogo 53
+type CargoDescuento struct {
+	EsCargo   bool    `json:"es_cargo"`
+	Codigo    string  `json:"codigo" validate:"required"`
+	Factor    float64 `json:"factor,omitempty"`
+	Monto     float64 `json:"monto"`
+	MontoBase float64 `json:"monto_base"`
+}
+
+// MotivoCargoDescuento describe un código del catálogo 53
+type MotivoCargoDescuento struct {
+	Descripcion string
+	EsCargo     bool
+	Global      bool
+	AfectaBase  bool
+}
+
+// BuscarMotivoCargoDescuento obtiene un código del catálogo 53 con los
+// atributos que determinan su tratamiento: cargo, nivel (ítem o global) y si
+// afecta la base imponible
+func BuscarMotivoCargoDescuento(codigo string) (MotivoCargoDescuento, error) {
+	catalogo, err := catalogos.Obtener(catalogos.CargoDescuento)
+	if err != nil {
+		return MotivoCargoDescuento{}, err
+	}
+	valor, ok := catalogo.Buscar(codigo)
+	if !ok {
+		return MotivoCargoDescuento{}, fmt.Errorf("código de cargo/descuento inválido: %s", codigo)
+	}
+	return MotivoCargoDescuento{
+		Descripcion: valor.Descripcion,
+		EsCargo:     valor.Atributos["cargo"] == "true",
+		Global:      valor.Atributos["nivel"] == "global",
+		AfectaBase:  valor.Atributos["afecta_base"] == "true",
+	}, nil
+}
+
+// ValidarCargoDescuento verifica que el código exista en el catálogo 53 y que
+// corresponda al nivel (ítem o global) y al indicador de cargo del registro
+func ValidarCargoDescuento(cd CargoDescuento, global bool) error {
+	motivo, err := BuscarMotivoCargoDescuento(cd.Codigo)
+	if err != nil {
+		return err
+	}
+	if esRegimenPercepcion(cd.Codigo) {
+		return fmt.Errorf("el código %s se informa en los datos de percepción del comprobante", cd.Codigo)
+	}
+	if cd.Codigo == CodigoRetencion {
+		return fmt.Errorf("el código %s se informa en los datos de retención del comprobante", cd.Codigo)
+	}
+	if motivo.Global != global {
+		if global {
+			return fmt.Errorf("el código %s no corresponde a un cargo/descuento global", cd.Codigo)
+		}
+		return fmt.Errorf("el código %s no corresponde a un cargo/descuento por ítem", cd.Codigo)
+	}
+	if motivo.EsCargo != cd.EsCargo {
+		return fmt.Errorf("el código %s no coincide con el indicador de cargo", cd.Codigo)
+	}
+	if cd.Monto < 0 || cd.MontoBase < 0 || cd.Factor < 0 {
+		return fmt.Errorf("los montos del cargo/descuento %s no pueden ser negativos", cd.Codigo)
+	}
+	return nil
+}
+
+// Anticipo referencia un comprobante de anticipo que se deduce en la factura
+// final (cac:PrepaidPayment y cac:AdditionalDocumentReference)
+type Anticipo struct {
+	TipoDocumento   string     `json:"tipo_documento" validate:"required"` // Catálogo 12: 02 factura, 03 boleta
+	Serie           string     `json:"serie" validate:"required"`
+	Numero          string     `json:"numero" validate:"required"`
+	EmisorRUC       string     `json:"emisor_ruc,omitempty"`
+	Monto           float64    `json:"monto" validate:"required,gt=0"` // Importe pagado, incluye IGV
+	CodigoDescuento string     `json:"codigo_descuento,omitempty"`    // Catálogo 53: 04, 05 o 06
+	FechaPago       *time.Time `json:"fecha_pago,omitempty"`
+}
+
+// EsDescuentoAnticipo indica si el código del catálogo 53 corresponde a la
+// deducción de un anticipo
+func EsDescuentoAnticipo(codigo string) bool {
+	return codigo == "04" || codigo == "05" || codigo == "06"
+}
+
+// ValidarAnticipo verifica los datos de un anticipo a deducir
+func ValidarAnticipo(anticipo Anticipo) error {
+	if anticipo.TipoDocumento != "02" && anticipo.TipoDocumento != "03" {
+		return fmt.Errorf("tipo de documento de anticipo inválido: %s (debe ser 02 o 03)", anticipo.TipoDocumento)
+	}
+	if anticipo.Serie == "" || anticipo.Numero == "" {
+		return fmt.Errorf("serie y número del anticipo son obligatorios")
+	}
+	if anticipo.Monto <= 0 {
+		return fmt.Errorf("el monto del anticipo %s-%s debe ser mayor a cero", anticipo.Serie, anticipo.Numero)
+	}
+	if anticipo.CodigoDescuento != "" && !EsDescuentoAnticipo(anticipo.CodigoDescuento) {
+		return fmt.Errorf("código de descuento de anticipo inválido: %s", anticipo.CodigoDescuento)
+	}
+	return nil
+}
+
+// Guías de remisión que se informan en cac:DespatchDocumentReference (catálogo 01)
+const (
+	GuiaRemisionRemitente     = "09"
+	GuiaRemisionTransportista = "31"
+)
+
+// Longitudes máximas del número de orden de compra (cac:OrderReference) y del
+// número de un documento relacionado
+const (
+	LongitudOrdenCompra          = 20
+	LongitudDocumentoRelacionado = 30
+)
+
+// DocumentoRelacionado referencia una guía de remisión (catálogo 01: 09 o 31)
+// o, en la lista de documentos relacionados, otro documento del catálogo 12
+type DocumentoRelacionado struct {
+	TipoDocumento string `json:"tipo_documento" validate:"required"`
+	Numero        string `json:"numero" validate:"required"` // Serie y número, p. ej. T001-123
+}
+
+// ValidarDocumentosRelacionados verifica la orden de compra, las guías de
+// remisión y los documentos relacionados del comprobante. Los anticipos (02 y
+// 03 del catálogo 12) se informan en Anticipos.
+func ValidarDocumentosRelacionados(comprobante *Comprobante) error {
+	if len(comprobante.OrdenCompra) > LongitudOrdenCompra {
+		return fmt.Errorf("el número de orden de compra admite hasta %d caracteres", LongitudOrdenCompra)
+	}
+
+	guias := make(map[DocumentoRelacionado]bool)
+	for _, guia := range comprobante.Guias {
+		if guia.TipoDocumento != GuiaRemisionRemitente && guia.TipoDocumento != GuiaRemisionTransportista {
+			return fmt.Errorf("tipo de guía de remisión inválido: %s (debe ser %s o %s)",
+				guia.TipoDocumento, GuiaRemisionRemitente, GuiaRemisionTransportista)
+		}
+		if err := validarNumeroRelacionado(guia); err != nil {
+			return err
+		}
+		if guias[guia] {
+			return fmt.Errorf("la guía de remisión %s está repetida", guia.Numero)
+		}
+		guias[guia] = true
+	}
+
+	documentos := make(map[DocumentoRelacionado]bool)
+	for _, documento := range comprobante.DocumentosRelacionados {
+		if documento.TipoDocumento == "02" || documento.TipoDocumento == "03" {
+			return fmt.Errorf("los comprobantes de anticipo %s se informan en anticipos", documento.Numero)
+		}
+		if !catalogos.Existe(catalogos.DocumentoRelacionado, documento.TipoDocumento) {
+			return fmt.Errorf("el tipo de documento relacionado %q no existe en el catálogo 12", documento.TipoDocumento)
+		}
+		if err := validarNumeroRelacionado(documento); err != nil {
+			return err
+		}
+		if documentos[documento] {
+			return fmt.Errorf("el documento relacionado %s está repetido", documento.Numero)
+		}
+		documentos[documento] = true
+	}
+	return nil
+}
+
+func validarNumeroRelacionado(documento DocumentoRelacionado) error {
+	if strings.TrimSpace(documento.Numero) == "" {
+		return fmt.Errorf("el número del documento relacionado de tipo %s es obligatorio", documento.TipoDocumento)
+	}
+	if len(documento.Numero) > LongitudDocumentoRelacionado {
+		return fmt.Errorf("el número del documento relacionado %s excede %d caracteres", documento.Numero, LongitudDocumentoRelacionado)
+	}
+	return nil
+}
+
+// ValidarPropiedadesItem verifica las propiedades adicionales de los ítems
+// contra el catálogo 55, completa su nombre y exige las que el catálogo marca
+// como obligatorias para el tipo de operación (atributo "operaciones") o para
+// los productos SUNAT de la línea (atributo "productos", p. ej. la placa en la
+// venta de combustibles).
+func ValidarPropiedadesItem(comprobante *Comprobante) error {
+	catalogo, err := catalogos.Obtener(catalogos.PropiedadItem)
+	if err != nil {
+		return err
+	}
+
+	for i := range comprobante.Items {
+		item := &comprobante.Items[i]
+		informadas := make(map[string]bool)
+		for j := range item.Propiedades {
+			if err := normalizarPropiedad(&item.Propiedades[j]); err != nil {
+				return fmt.Errorf("ítem %d: %v", item.NumeroItem, err)
+			}
+			informadas[item.Propiedades[j].Codigo] = true
+		}
+
+		for _, codigo := range catalogo.Codigos {
+			if informadas[codigo.Codigo] {
+				continue
+			}
+			if contieneCodigo(codigo.Atributos["operaciones"], comprobante.TipoOperacion) {
+				return fmt.Errorf("ítem %d: el tipo de operación %s requiere la propiedad %s (%s)",
+					item.NumeroItem, comprobante.TipoOperacion, codigo.Codigo, codigo.Descripcion)
+			}
+			if item.CodigoSUNAT != "" && tienePrefijo(codigo.Atributos["productos"], item.CodigoSUNAT) {
+				return fmt.Errorf("ítem %d: el producto %s requiere la propiedad %s (%s)",
+					item.NumeroItem, item.CodigoSUNAT, codigo.Codigo, codigo.Descripcion)
+			}
+		}
+	}
+	return nil
+}
+
+// normalizarPropiedad valida el dato de la propiedad según su tipo y completa
+// el nombre con la descripción del catálogo
+func normalizarPropiedad(propiedad *PropiedadItem) error {
+	propiedad.Codigo = strings.TrimSpace(propiedad.Codigo)
+	propiedad.Valor = strings.TrimSpace(propiedad.Valor)
+	if !catalogos.Existe(catalogos.PropiedadItem, propiedad.Codigo) {
+		return fmt.Errorf("la propiedad %q no existe en el catálogo 55", propiedad.Codigo)
+	}
+	if propiedad.Nombre == "" {
+		propiedad.Nombre = catalogos.Descripcion(catalogos.PropiedadItem, propiedad.Codigo)
+	}
+	if len([]rune(propiedad.Nombre)) > LongitudValorPropiedad || len([]rune(propiedad.Valor)) > LongitudValorPropiedad {
+		return fmt.Errorf("el nombre y el valor de la propiedad %s admiten hasta %d caracteres", propiedad.Codigo, LongitudValorPropiedad)
+	}
+
+	switch tipo := propiedad.Tipo(); tipo {
+	case TipoPropiedadFecha, TipoPropiedadFechaFin:
+		if propiedad.Fecha == nil {
+			return fmt.Errorf("la propiedad %s requiere la fecha", propiedad.Codigo)
+		}
+	case TipoPropiedadHora:
+		hora, err := parsearHora(propiedad.Hora)
+		if err != nil {
+			return fmt.Errorf("la propiedad %s requiere la hora en formato HH:MM:SS", propiedad.Codigo)
+		}
+		propiedad.Hora = hora
+	case TipoPropiedadDias:
+		if propiedad.Cantidad <= 0 || propiedad.Cantidad != math.Trunc(propiedad.Cantidad) {
+			return fmt.Errorf("la propiedad %s requiere un número entero de días mayor a cero", propiedad.Codigo)
+		}
+	case TipoPropiedadCantidad:
+		if propiedad.Valor == "" || propiedad.Cantidad <= 0 {
+			return fmt.Errorf("la propiedad %s requiere la descripción y una cantidad mayor a cero", propiedad.Codigo)
+		}
+		if !catalogos.Existe(catalogos.UnidadMedida, propiedad.UnidadMedida) {
+			return fmt.Errorf("la unidad de medida %q de la propiedad %s no existe en el catálogo 03", propiedad.UnidadMedida, propiedad.Codigo)
+		}
+	case TipoPropiedadPlaca:
+		propiedad.Valor = strings.ToUpper(strings.ReplaceAll(propiedad.Valor, " ", ""))
+		if !formatoPlaca.MatchString(propiedad.Valor) {
+			return fmt.Errorf("el número de placa %q no es válido", propiedad.Valor)
+		}
+	case TipoPropiedadPais:
+		propiedad.Valor = strings.ToUpper(propiedad.Valor)
+		if !catalogos.Existe(catalogos.Pais, propiedad.Valor) {
+			return fmt.Errorf("el país %q de la propiedad %s no existe en el catálogo 04", propiedad.Valor, propiedad.Codigo)
+		}
+	case TipoPropiedadUbigeo:
+		if !catalogos.Existe(catalogos.Ubigeo, propiedad.Valor) {
+			return fmt.Errorf("el ubigeo %q de la propiedad %s no existe en el catálogo 13", propiedad.Valor, propiedad.Codigo)
+		}
+	case TipoPropiedadDocumentoIdentidad:
+		if !catalogos.Existe(catalogos.DocumentoIdentidad, propiedad.Valor) {
+			return fmt.Errorf("el tipo de documento %q de la propiedad %s no existe en el catálogo 06", propiedad.Valor, propiedad.Codigo)
+		}
+	case TipoPropiedadTexto:
+		if propiedad.Valor == "" {
+			return fmt.Errorf("la propiedad %s requiere el valor", propiedad.Codigo)
+		}
+	default:
+		return fmt.Errorf("la propiedad %s tiene un tipo desconocido en el catálogo 55: %s", propiedad.Codigo, tipo)
+	}
+	return nil
+}
+
+// parsearHora acepta horas HH:MM o HH:MM:SS y las retorna como HH:MM:SS
+func parsearHora(valor string) (string, error) {
+	for _, formato := range []string{"15:04:05", "15:04"} {
+		if hora, err := time.Parse(formato, strings.TrimSpace(valor)); err == nil {
+			return hora.Format("15:04:05"), nil
+		}
+	}
+	return "", fmt.Errorf("hora inválida: %s", valor)
+}
+
+// contieneCodigo indica si el código está en una lista separada por comas
+func contieneCodigo(lista, codigo string) bool {
+	for _, valor := range strings.Split(lista, ",") {
+		if valor != "" && strings.TrimSpace(valor) == codigo {
+			return true
+		}
+	}
+	return false
+}
+
+// tienePrefijo indica si el código empieza con alguno de los prefijos de una
+// lista separada por comas
+func tienePrefijo(lista, codigo string) bool {
+	for _, prefijo := range strings.Split(lista, ",") {
+		if prefijo = strings.TrimSpace(prefijo); prefijo != "" && strings.HasPrefix(codigo, prefijo) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tipo de operación con que se emiten las facturas y boletas que no indican otro
+const OperacionVentaInterna = "0101"
+
+// Tipos de operación de exportación según catálogo 51. Todo el grupo 02
+// (0200 a 0208) corresponde a exportaciones de bienes o servicios.
+const (
+	OperacionExportacionBienes             = "0200"
+	OperacionExportacionServicios          = "0201"
+	OperacionExportacionServiciosHospedaje = "0202"
+)
+
+// ValidarTipoOperacion verifica que el tipo de operación exista en el catálogo
+// 51, que el sistema lo emita y, en facturas y boletas, que el catálogo lo
+// admita para el tipo de comprobante
+func ValidarTipoOperacion(comprobante *Comprobante) error {
+	tipoOperacion := comprobante.TipoOperacion
+	if tipoOperacion == "" {
+		return nil
+	}
+
+	catalogo, err := catalogos.Obtener(catalogos.TipoOperacion)
+	if err != nil {
+		return err
+	}
+	codigo, ok := catalogo.Buscar(tipoOperacion)
+	if !ok {
+		return fmt.Errorf("el tipo de operación %s no existe en el catálogo 51", tipoOperacion)
+	}
+	if codigo.Atributos["emision"] == "no_soportada" {
+		return fmt.Errorf("el tipo de operación %s (%s) no está soportado", tipoOperacion, codigo.Descripcion)
+	}
+	if comprobante.Tipo != TipoFactura && comprobante.Tipo != TipoBoleta && comprobante.Tipo != TipoLiquidacionCompra {
+		return nil
+	}
+	for _, documento := range strings.Split(codigo.Atributos["documentos"], ",") {
+		if documento == comprobante.Tipo.String() {
+			return nil
+		}
+	}
+	return fmt.Errorf("el tipo de operación %s no corresponde al tipo de comprobante %s", tipoOperacion, comprobante.Tipo)
+}
+
+// DomiciliadoEnPeru indica si la dirección del receptor está en Perú y debe
+// informarse con ubigeo
+func (r Receptor) DomiciliadoEnPeru() bool {
+	return r.CodigoPais == "" || r.CodigoPais == "PE"
+}
+
+// CondicionesEntrega describe los términos de entrega de una exportación (cac:DeliveryTerms)
+type CondicionesEntrega struct {
+	Incoterm     string `json:"incoterm" validate:"required"`
+	LugarEntrega string `json:"lugar_entrega,omitempty"`
+	Ubigeo       string `json:"ubigeo,omitempty"` // Lugar de entrega en Perú (catálogo 13)
+	CodigoPais   string `json:"codigo_pais,omitempty"`
+}
+
+// Incoterms admitidos en las condiciones de entrega
+var Incoterms = map[string]string{
+	"EXW": "En fábrica",
+	"FCA": "Franco transportista",
+	"FAS": "Franco al costado del buque",
+	"FOB": "Franco a bordo",
+	"CFR": "Costo y flete",
+	"CIF": "Costo, seguro y flete",
+	"CPT": "Transporte pagado hasta",
+	"CIP": "Transporte y seguro pagados hasta",
+	"DAP": "Entregada en lugar",
+	"DPU": "Entregada en lugar descargada",
+	"DDP": "Entregada derechos pagados",
+}
+
+// EsOperacionExportacion indica si el tipo de operación corresponde a una exportación
+func EsOperacionExportacion(tipoOperacion string) bool {
+	return len(tipoOperacion) == 4 && strings.HasPrefix(tipoOperacion, "02")
+}
+
+// EsDocumentoNoDomiciliado indica si el tipo de documento (catálogo 06) identifica
+// a un cliente no domiciliado
+func EsDocumentoNoDomiciliado(tipoDocumento string) bool {
+	return tipoDocumento == "0" || tipoDocumento == "A" || tipoDocumento == "B"
+}
+
+// ValidarExportacion verifica la consistencia de una operación de exportación:
+// ítems con afectación 40, receptor no domiciliado e Incoterm válido
+func ValidarExportacion(comprobante *Comprobante) error {
+	exportacion := EsOperacionExportacion(comprobante.TipoOperacion)
+
+	for _, item := range comprobante.Items {
+		if (item.TipoAfectacion == Exportacion) != exportacion {
+			if exportacion {
+				return fmt.Errorf("ítem %d: en una exportación todos los ítems deben tener afectación 40", item.NumeroItem)
+			}
+			return fmt.Errorf("ítem %d: la afectación 40 requiere un tipo de operación de exportación (0200 a 0208)", item.NumeroItem)
+		}
+	}
+	if !exportacion {
+		return nil
+	}
+
+	if comprobante.Tipo != TipoFactura && comprobante.Tipo != TipoNotaCredito && comprobante.Tipo != TipoNotaDebito {
+		return fmt.Errorf("las exportaciones deben emitirse con factura o sus notas de crédito/débito")
+	}
+	if !EsDocumentoNoDomiciliado(comprobante.Receptor.TipoDocumento) {
+		return fmt.Errorf("el receptor de una exportación debe ser no domiciliado (tipo de documento 0, A o B)")
+	}
+	if comprobante.Receptor.CodigoPais == "PE" {
+		return fmt.Errorf("el receptor de una exportación no puede tener domicilio en Perú")
+	}
+	if comprobante.CondicionesEntrega != nil {
+		if _, ok := Incoterms[comprobante.CondicionesEntrega.Incoterm]; !ok {
+			return fmt.Errorf("Incoterm inválido: %s", comprobante.CondicionesEntrega.Incoterm)
+		}
+	}
+
+	return nil
+}
+
+// Tipo de operación sujeta a percepción según catálogo 51
+const OperacionSujetaPercepcion = "2001"
+
+// Percepcion contiene el régimen y los montos de la percepción del IGV cobrada
+// al cliente (cac:AllowanceCharge con códigos 51, 52 o 53 del catálogo 53)
+type Percepcion struct {
+	CodigoRegimen string  `json:"codigo_regimen,omitempty"` // Catálogo 53: 51, 52 o 53
+	BaseImponible float64 `json:"base_imponible"`           // Importe total de la venta en soles, incluye IGV
+	Porcentaje    float64 `json:"porcentaje"`
+	Monto         float64 `json:"monto"`
+	MontoTotal    float64 `json:"monto_total"`           // Importe total más la percepción, en soles
+	TipoCambio    float64 `json:"tipo_cambio,omitempty"` // Venta SBS usada si la factura no está en soles
+}
+
+// RegimenesPercepcion son los códigos de percepción del catálogo 53; su
+// porcentaje es el atributo "tasa" del catálogo
+var RegimenesPercepcion = []string{"51", "52", "53"}
+
+// esRegimenPercepcion indica si el código del catálogo 53 es un régimen de percepción
+func esRegimenPercepcion(codigo string) bool {
+	for _, regimen := range RegimenesPercepcion {
+		if regimen == codigo {
+			return true
+		}
+	}
+	return false
+}
+
+// TasaPercepcion retorna el porcentaje del régimen de percepción según el catálogo 53
+func TasaPercepcion(codigo string) (float64, bool) {
+	if !esRegimenPercepcion(codigo) {
+		return 0, false
+	}
+	tasa, err := strconv.ParseFloat(catalogos.Atributo(catalogos.CargoDescuento, codigo, "tasa"), 64)
+	if err != nil {
+		return 0, false
+	}
+	return tasa, true
+}
+
+// SeleccionarRegimenPercepcion determina el régimen y la tasa de la percepción.
+// Si no se indica el régimen se deduce del porcentaje y, en su defecto, se usa
+// el régimen por defecto del emisor.
+func SeleccionarRegimenPercepcion(percepcion *Percepcion, regimenDefecto string) (string, float64, error) {
+	codigo := percepcion.CodigoRegimen
+	if codigo == "" && percepcion.Porcentaje > 0 {
+		for _, regimen := range RegimenesPercepcion {
+			if tasa, ok := TasaPercepcion(regimen); ok && tasa == percepcion.Porcentaje {
+				codigo = regimen
+				break
+			}
+		}
+		if codigo == "" {
+			return "", 0, fmt.Errorf("porcentaje de percepción inválido: %v", percepcion.Porcentaje)
+		}
+	}
+	if codigo == "" {
+		codigo = regimenDefecto
+	}
+
+	tasa, ok := TasaPercepcion(codigo)
+	if !ok {
+		return "", 0, fmt.Errorf("régimen de percepción inválido: %s", codigo)
+	}
+	if percepcion.Porcentaje > 0 && percepcion.Porcentaje != tasa {
+		return "", 0, fmt.Errorf("el porcentaje %v no corresponde al régimen de percepción %s (%v%%)", percepcion.Porcentaje, codigo, tasa)
+	}
+	return codigo, tasa, nil
+}
+
+// ValidarPercepcion verifica que la percepción se informe en una factura o
+// boleta con el tipo de operación 2001. En moneda extranjera los montos de la
+// percepción se convierten a soles con el tipo de cambio de la fecha de emisión.
+func ValidarPercepcion(comprobante *Comprobante) error {
+	if comprobante.Percepcion == nil {
+		if comprobante.TipoOperacion == OperacionSujetaPercepcion {
+			return fmt.Errorf("el tipo de operación 2001 requiere los datos de percepción")
+		}
+		return nil
+	}
+
+	if comprobante.TipoOperacion != "" && comprobante.TipoOperacion != OperacionSujetaPercepcion {
+		return fmt.Errorf("la percepción requiere el tipo de operación 2001, no %s", comprobante.TipoOperacion)
+	}
+	if comprobante.Tipo != TipoFactura && comprobante.Tipo != TipoBoleta {
+		return fmt.Errorf("la percepción solo se informa en facturas y boletas")
+	}
+	if comprobante.Percepcion.TipoCambio < 0 {
+		return fmt.Errorf("el tipo de cambio de la percepción no puede ser negativo")
+	}
+	for _, item := range comprobante.Items {
+		if !item.TipoAfectacion.EsGravada() {
+			return fmt.Errorf("ítem %d: la percepción solo aplica a operaciones gravadas con el IGV", item.NumeroItem)
+		}
+	}
+	return nil
+}
+
+// Retención del IGV: la practica el cliente designado agente de retención sobre
+// el importe total de la factura (cargo/descuento 62 del catálogo 53)
+const (
+	CodigoRetencion      = "62"
+	TasaRetencion        = 3.0
+	MontoMinimoRetencion = 700.0
+)
+
+// Retencion contiene los montos de la retención del IGV que el cliente
+// descontará del pago
+type Retencion struct {
+	BaseImponible float64 `json:"base_imponible"` // Importe total de la venta en soles, incluye IGV
+	Porcentaje    float64 `json:"porcentaje"`
+	Monto         float64 `json:"monto"`                 // En soles
+	MontoNeto     float64 `json:"monto_neto"`            // Importe total menos la retención, en la moneda del comprobante
+	TipoCambio    float64 `json:"tipo_cambio,omitempty"` // Venta SBS usada si la factura no está en soles
+}
+
+// ValidarRetencion verifica que la retención se informe en una factura que no
+// esté sujeta a percepción. En moneda extranjera los montos de la retención se
+// convierten a soles con el tipo de cambio de la fecha de emisión.
+func ValidarRetencion(comprobante *Comprobante) error {
+	if comprobante.Retencion == nil {
+		return nil
+	}
+	if comprobante.Tipo != TipoFactura {
+		return fmt.Errorf("la retención del IGV solo se informa en facturas")
+	}
+	if comprobante.Retencion.TipoCambio < 0 {
+		return fmt.Errorf("el tipo de cambio de la retención no puede ser negativo")
+	}
+	if comprobante.Percepcion != nil {
+		return fmt.Errorf("una operación sujeta a percepción no está sujeta a retención")
+	}
+	if comprobante.Detraccion != nil {
+		return fmt.Errorf("una operación sujeta a detracción no está sujeta a retención")
+	}
+	if comprobante.Retencion.Porcentaje != 0 && comprobante.Retencion.Porcentaje != TasaRetencion {
+		return fmt.Errorf("el porcentaje de retención debe ser %v%%", TasaRetencion)
+	}
+	return nil
+}
+
+// Tipo de operación con que se emiten las liquidaciones de compra que no indican otro
+const OperacionCompraInterna = "0501"
+
+// Retenciones de la liquidación de compra: el comprador retiene al vendedor sin
+// RUC todo el IGV de la operación, que declara y paga por cuenta de este, y el
+// Impuesto a la Renta sobre el valor de venta
+const (
+	TributoRenta       = "3000" // Impuesto a la Renta, catálogo 05
+	TasaRetencionRenta = 1.5
+)
+
+// LiquidacionCompra contiene las retenciones de la liquidación de compra y el
+// importe neto que se paga al vendedor
+type LiquidacionCompra struct {
+	IGVRetenido     float64 `json:"igv_retenido"`
+	BaseRenta       float64 `json:"base_renta"` // Valor de venta, sin IGV
+	PorcentajeRenta float64 `json:"porcentaje_renta"`
+	RentaRetenida   float64 `json:"renta_retenida"`
+	MontoNeto       float64 `json:"monto_neto"` // Importe total menos el IGV y la renta retenidos
+}
+
+// ValidarLiquidacionCompra verifica que las retenciones se informen solo en
+// liquidaciones de compra y que estas se emitan a un vendedor identificado con
+// DNI, sin los regímenes propios de las ventas (percepción, retención del IGV,
+// detracción y anticipos)
+func ValidarLiquidacionCompra(comprobante *Comprobante) error {
+	if comprobante.Tipo != TipoLiquidacionCompra {
+		if comprobante.Liquidacion != nil {
+			return fmt.Errorf("las retenciones de la liquidación de compra solo se informan en liquidaciones de compra")
+		}
+		return nil
+	}
+
+	if comprobante.Receptor.TipoDocumento != identidad.DNI {
+		return fmt.Errorf("el vendedor de una liquidación de compra debe identificarse con DNI")
+	}
+	if err := identidad.Validar(identidad.DNI, comprobante.Receptor.NumeroDocumento); err != nil {
+		return fmt.Errorf("el DNI del vendedor no es válido: %v", err)
+	}
+	if strings.TrimSpace(comprobante.Receptor.Direccion) == "" {
+		return fmt.Errorf("la dirección del vendedor es obligatoria en la liquidación de compra")
+	}
+	if comprobante.Percepcion != nil || comprobante.Retencion != nil || comprobante.Detraccion != nil {
+		return fmt.Errorf("la liquidación de compra no está sujeta a percepción, retención del IGV ni detracción")
+	}
+	if comprobante.EsAnticipo || len(comprobante.Anticipos) > 0 {
+		return fmt.Errorf("las liquidaciones de compra por anticipos no están soportadas")
+	}
+	if liquidacion := comprobante.Liquidacion; liquidacion != nil &&
+		liquidacion.PorcentajeRenta != 0 && liquidacion.PorcentajeRenta != TasaRetencionRenta {
+		return fmt.Errorf("el porcentaje de retención del Impuesto a la Renta debe ser %v%%", TasaRetencionRenta)
+	}
+	return nil
+}
+
+// Tipos de operación sujetos a detracción según catálogo 51 y medio de pago
+// (catálogo 59) con el que se informa el depósito si no se indica otro
+const (
+	OperacionDetraccion                    = "1001"
+	OperacionDetraccionHidrobiologicos     = "1002"
+	OperacionDetraccionTransportePasajeros = "1003"
+	OperacionDetraccionTransporteCarga     = "1004"
+	MedioPagoDetraccionDefecto             = "001"
+)
+
+// EsOperacionDetraccion indica si el tipo de operación corresponde al SPOT
+func EsOperacionDetraccion(tipoOperacion string) bool {
+	switch tipoOperacion {
+	case OperacionDetraccion, OperacionDetraccionHidrobiologicos,
+		OperacionDetraccionTransportePasajeros, OperacionDetraccionTransporteCarga:
+		return true
+	}
+	return false
+}
+
+// Detraccion contiene el bien o servicio sujeto al SPOT (catálogo 54) y el
+// monto que el cliente depositará en la cuenta del emisor en el Banco de la
+// Nación. La base y el monto se expresan en soles aunque la factura se emita
+// en otra moneda.
+type Detraccion struct {
+	Codigo           string  `json:"codigo"`               // Catálogo 54
+	NumeroCuenta     string  `json:"numero_cuenta"`        // Cuenta de detracciones del Banco de la Nación
+	MedioPago        string  `json:"medio_pago,omitempty"` // Catálogo 59
+	Porcentaje       float64 `json:"porcentaje,omitempty"`
+	ValorReferencial float64 `json:"valor_referencial,omitempty"` // Transporte de carga: valor referencial del servicio en soles
+	TipoCambio       float64 `json:"tipo_cambio,omitempty"`       // Venta SBS usada si la factura no está en soles
+	MontoBase        float64 `json:"monto_base,omitempty"`
+	Monto            float64 `json:"monto,omitempty"` // Redondeado a soles sin decimales
+}
+
+// Propiedad del ítem (catálogo 55) con el código del catálogo 54 del bien o
+// servicio sujeto a detracción
+const PropiedadCodigoDetraccion = "3000"
+
+// CodigoDetraccionItems deduce el código del catálogo 54 de los ítems: de la
+// propiedad 3000 o, si no se informa, del producto SUNAT de la línea según los
+// prefijos UNSPSC del atributo "productos" del catálogo 54. Retorna vacío si
+// ningún ítem está sujeto a detracción y rechaza los ítems con códigos
+// distintos, porque la factura informa un solo código.
+func CodigoDetraccionItems(items []Item) (string, error) {
+	catalogo, err := catalogos.Obtener(catalogos.Detraccion)
+	if err != nil {
+		return "", err
+	}
+
+	codigo, numeroItem := "", 0
+	for _, item := range items {
+		codigoItem := ""
+		for _, propiedad := range item.Propiedades {
+			if strings.TrimSpace(propiedad.Codigo) == PropiedadCodigoDetraccion {
+				codigoItem = strings.TrimSpace(propiedad.Valor)
+			}
+		}
+		if codigoItem != "" {
+			if _, ok := catalogo.Buscar(codigoItem); !ok {
+				return "", fmt.Errorf("ítem %d: el código de detracción %q no existe en el catálogo 54", item.NumeroItem, codigoItem)
+			}
+		} else if item.CodigoSUNAT != "" {
+			for _, valor := range catalogo.Codigos {
+				if tienePrefijo(valor.Atributos["productos"], item.CodigoSUNAT) {
+					codigoItem = valor.Codigo
+					break
+				}
+			}
+		}
+
+		switch {
+		case codigoItem == "":
+		case codigo == "":
+			codigo, numeroItem = codigoItem, item.NumeroItem
+		case codigoItem != codigo:
+			return "", fmt.Errorf("los ítems %d y %d corresponden a distintos códigos de detracción (%s y %s)",
+				numeroItem, item.NumeroItem, codigo, codigoItem)
+		}
+	}
+	return codigo, nil
+}
+
+// Tipo de operación sujeta al IVAP según catálogo 51 y tasa del impuesto
+const (
+	OperacionIVAP = "2100"
+	TasaIVAP      = 4.0
+)
+
+// ValidarIVAP verifica que las afectaciones del IVAP (17, 27 y 37) se usen
+// solo en operaciones 2100 y que estas no mezclen ítems con IGV
+func ValidarIVAP(comprobante *Comprobante) error {
+	ivap := comprobante.TipoOperacion == OperacionIVAP
+
+	for _, item := range comprobante.Items {
+		if item.TipoAfectacion.EsIVAP() != ivap {
+			if ivap {
+				return fmt.Errorf("ítem %d: en una operación sujeta al IVAP todos los ítems deben tener afectación 17, 27 o 37", item.NumeroItem)
+			}
+			return fmt.Errorf("ítem %d: la afectación %s requiere el tipo de operación 2100 (IVAP)", item.NumeroItem, item.TipoAfectacion.String())
+		}
+	}
+	if !ivap {
+		return nil
+	}
+
+	if comprobante.Tipo < TipoFactura || comprobante.Tipo > TipoNotaDebito {
+		return fmt.Errorf("tipo de comprobante inválido para una operación sujeta al IVAP")
+	}
+	return nil
+}
+
+// Regímenes del emisor que determinan las tasas aplicables
+const (
+	RegimenGeneral         = "GENERAL"
+	RegimenRestauranteMYPE = "RESTAURANTE_MYPE" // Ley 31556: restaurantes, hoteles y alojamientos MYPE
+)
+
+// Tributos de la tabla de tasas. La tasa del IGV informada en el comprobante es
+// la suma del IGV y el Impuesto de Promoción Municipal (IPM).
+const (
+	TributoIGV    = "IGV"
+	TributoIPM    = "IPM"
+	TributoICBPER = "ICBPER"
+	TributoISC    = "ISC"
+)
+
+// TasaImpuesto es la tasa de un tributo para un régimen durante un periodo.
+// Para el ICBPER la tasa es el monto por bolsa plástica.
+type TasaImpuesto struct {
+	Tributo      string     `json:"tributo"`
+	Regimen      string     `json:"regimen"`
+	Tasa         float64    `json:"tasa"`
+	VigenteDesde time.Time  `json:"vigente_desde"`
+	VigenteHasta *time.Time `json:"vigente_hasta,omitempty"` // Inclusive
+	Descripcion  string     `json:"descripcion,omitempty"`
+}
+
+// Vigente indica si la tasa está vigente en la fecha indicada
+func (t TasaImpuesto) Vigente(fecha time.Time) bool {
+	// La vigencia se compara por día calendario de la fecha recibida
+	fecha = time.Date(fecha.Year(), fecha.Month(), fecha.Day(), 0, 0, 0, 0, time.UTC)
+	if fecha.Before(t.VigenteDesde) {
+		return false
+	}
+	return t.VigenteHasta == nil || fecha.Before(t.VigenteHasta.AddDate(0, 0, 1))
+}
+
+// TablaTasas agrupa las tasas con vigencia
+type TablaTasas []TasaImpuesto
+
+// Buscar retorna la tasa vigente del tributo para el régimen en la fecha indicada.
+// Si el régimen no tiene una tasa propia se usa la del régimen general.
+func (t TablaTasas) Buscar(tributo, regimen string, fecha time.Time) (TasaImpuesto, bool) {
+	if regimen == "" {
+		regimen = RegimenGeneral
+	}
+
+	var encontrada TasaImpuesto
+	ok := false
+	for _, tasa := range t {
+		if tasa.Tributo != tributo || tasa.Regimen != regimen || !tasa.Vigente(fecha) {
+			continue
+		}
+		if !ok || tasa.VigenteDesde.After(encontrada.VigenteDesde) {
+			encontrada, ok = tasa, true
+		}
+	}
+	if !ok && regimen != RegimenGeneral {
+		return t.Buscar(tributo, RegimenGeneral, fecha)
+	}
+	return encontrada, ok
+}
+
+// TieneRegimen indica si la tabla registra tasas para el régimen
+func (t TablaTasas) TieneRegimen(regimen string) bool {
+	for _, tasa := range t {
+		if tasa.Regimen == regimen {
+			return true
+		}
+	}
+	return false
+}
+
+func fechaTasa(anio int, mes time.Month, dia int) time.Time {
+	return time.Date(anio, mes, dia, 0, 0, 0, 0, time.UTC)
+}
+
+func fechaTasaHasta(anio int, mes time.Month, dia int) *time.Time {
+	fecha := fechaTasa(anio, mes, dia)
+	return &fecha
+}
+
+// TasasPorDefecto contiene las tasas vigentes conocidas. Se cargan en la tabla
+// tasas_impuestos al inicializar la base de datos, donde pueden actualizarse.
+var TasasPorDefecto = TablaTasas{
+	{TributoIGV, RegimenGeneral, 16, fechaTasa(2011, time.March, 1), nil, "IGV"},
+	{TributoIPM, RegimenGeneral, 2, fechaTasa(1994, time.January, 1), nil, "Impuesto de Promoción Municipal"},
+	{TributoIGV, RegimenRestauranteMYPE, 8, fechaTasa(2022, time.September, 1), fechaTasaHasta(2026, time.December, 31), "IGV reducido Ley 31556"},
+	{TributoIGV, RegimenRestauranteMYPE, 10, fechaTasa(2027, time.January, 1), fechaTasaHasta(2027, time.December, 31), "IGV reducido Ley 31556"},
+	{TributoIGV, RegimenRestauranteMYPE, 13, fechaTasa(2028, time.January, 1), fechaTasaHasta(2028, time.December, 31), "IGV reducido Ley 31556"},
+	{TributoICBPER, RegimenGeneral, 0.10, fechaTasa(2019, time.August, 1), fechaTasaHasta(2019, time.December, 31), "ICBPER por bolsa"},
+	{TributoICBPER, RegimenGeneral, 0.20, fechaTasa(2020, time.January, 1), fechaTasaHasta(2020, time.December, 31), "ICBPER por bolsa"},
+	{TributoICBPER, RegimenGeneral, 0.30, fechaTasa(2021, time.January, 1), fechaTasaHasta(2021, time.December, 31), "ICBPER por bolsa"},
+	{TributoICBPER, RegimenGeneral, 0.40, fechaTasa(2022, time.January, 1), fechaTasaHasta(2022, time.December, 31), "ICBPER por bolsa"},
+	{TributoICBPER, RegimenGeneral, 0.50, fechaTasa(2023, time.January, 1), nil, "ICBPER por bolsa"},
+}
+
 type Impuesto struct {
 	TipoImpuesto      string  `json:"tipo_impuesto" validate:"required"`
 	CodigoImpuesto    string  `json:"codigo_impuesto" validate:"required"`
@@ -211,6 +1178,45 @@ type FormaPago struct {
 	TipoPago     string      `json:"tipo_pago" validate:"required"`
 	MontoContado float64     `json:"monto_contado,omitempty"`
 	Cuotas       []Cuota     `json:"cuotas,omitempty"`
+	MedioPago    string      `json:"medio_pago,omitempty"` // Catálogo 59
+}
+
+// Formas de pago que se informan en cac:PaymentTerms con ID FormaPago
+const (
+	FormaPagoContado = "Contado"
+	FormaPagoCredito = "Credito"
+)
+
+// NormalizarTipoPago retorna la forma de pago con la grafía que exige SUNAT
+// ("Contado" o "Credito") o una cadena vacía si no es ninguna de las dos
+func NormalizarTipoPago(tipoPago string) string {
+	switch strings.ToLower(strings.TrimSpace(tipoPago)) {
+	case "contado":
+		return FormaPagoContado
+	case "credito", "crédito":
+		return FormaPagoCredito
+	}
+	return ""
+}
+
+// MontoPendientePago retorna el importe que el cliente pagará al emisor: el
+// importe total menos la retención o, en la moneda del comprobante, la
+// detracción. Las cuotas de una venta al crédito deben sumar este monto.
+func (c *Comprobante) MontoPendientePago() float64 {
+	if c.Liquidacion != nil {
+		return c.Liquidacion.MontoNeto
+	}
+	if c.Retencion != nil {
+		return c.Retencion.MontoNeto
+	}
+	if detraccion := c.Detraccion; detraccion != nil {
+		monto := detraccion.Monto
+		if detraccion.TipoCambio > 0 {
+			monto = detraccion.Monto / detraccion.TipoCambio
+		}
+		return math.Round((c.Totales.ImporteTotal-monto)*100) / 100
+	}
+	return c.Totales.ImporteTotal
 }
 
 type Cuota struct {
@@ -225,8 +1231,6 @@ type Factura struct {
 	DetraccionAplicada bool    `json:"detraccion_aplicada"`
 	MontoDetraccion    float64 `json:"monto_detraccion,omitempty"`
 	PorcentajeDetraccion float64 `json:"porcentaje_detraccion,omitempty"`
-	OrdenCompra        string  `json:"orden_compra,omitempty"`
-	GuiaRemision       string  `json:"guia_remision,omitempty"`
 }
 
 // Boleta específica
@@ -249,4 +1253,144 @@ type Lote struct {
 	FechaCreacion        time.Time              `json:"fecha_creacion"`
 	FechaActualizacion   time.Time              `json:"fecha_actualizacion"`
 	UsuarioCreacion      string                 `json:"usuario_creacion"`
-}
\ No newline at end of file
+}
+// Estado y condición de domicilio con los que SUNAT publica a los
+// contribuyentes habilitados en el padrón reducido de RUC
+const (
+	EstadoContribuyenteActivo = "ACTIVO"
+	CondicionDomicilioHabido  = "HABIDO"
+)
+
+// Contribuyente es un registro del padrón reducido de RUC de SUNAT. Los
+// componentes de la dirección se guardan tal como los publica SUNAT.
+type Contribuyente struct {
+	RUC                string    `json:"ruc"`
+	RazonSocial        string    `json:"razon_social"`
+	Estado             string    `json:"estado"`
+	CondicionDomicilio string    `json:"condicion_domicilio"`
+	Ubigeo             string    `json:"ubigeo,omitempty"`
+	TipoVia            string    `json:"tipo_via,omitempty"`
+	NombreVia          string    `json:"nombre_via,omitempty"`
+	CodigoZona         string    `json:"codigo_zona,omitempty"`
+	TipoZona           string    `json:"tipo_zona,omitempty"`
+	Numero             string    `json:"numero,omitempty"`
+	Interior           string    `json:"interior,omitempty"`
+	Lote               string    `json:"lote,omitempty"`
+	Dpto               string    `json:"dpto,omitempty"`
+	Manzana            string    `json:"manzana,omitempty"`
+	Kilometro          string    `json:"kilometro,omitempty"`
+	Huella             string    `json:"-"` // Permite omitir los registros sin cambios al refrescar el padrón
+	FechaActualizacion time.Time `json:"fecha_actualizacion"`
+}
+
+// Activo indica si el contribuyente está activo y con domicilio habido
+func (c Contribuyente) Activo() bool {
+	return c.Estado == EstadoContribuyenteActivo && c.CondicionDomicilio == CondicionDomicilioHabido
+}
+
+// Direccion arma el domicilio fiscal en el formato de la consulta RUC de SUNAT
+func (c Contribuyente) Direccion() string {
+	var partes []string
+	agregar := func(prefijo, valor string) {
+		if valor != "" {
+			partes = append(partes, strings.TrimSpace(prefijo+" "+valor))
+		}
+	}
+	if c.TipoVia != "" && c.NombreVia != "" {
+		agregar(c.TipoVia, c.NombreVia)
+	} else {
+		agregar("", c.NombreVia)
+	}
+	agregar("NRO.", c.Numero)
+	agregar("INT.", c.Interior)
+	agregar("DPTO.", c.Dpto)
+	agregar("MZA.", c.Manzana)
+	agregar("LOTE.", c.Lote)
+	agregar("KM.", c.Kilometro)
+	if c.TipoZona != "" && c.CodigoZona != "" {
+		agregar(c.TipoZona, c.CodigoZona)
+	} else {
+		agregar("", c.CodigoZona)
+	}
+	return strings.Join(partes, " ")
+}
+
+// Padrones de SUNAT que se importan. Los de agentes y buenos contribuyentes
+// determinan si una venta está sujeta a retención o percepción del IGV.
+const (
+	PadronRUC                  = "RUC"
+	PadronAgentesRetencion     = "AGENTES_RETENCION"
+	PadronAgentesPercepcion    = "AGENTES_PERCEPCION"
+	PadronBuenosContribuyentes = "BUENOS_CONTRIBUYENTES"
+)
+
+// InscripcionPadron es un RUC incluido en un padrón de agentes o de buenos
+// contribuyentes
+type InscripcionPadron struct {
+	Padron      string     `json:"padron"`
+	RUC         string     `json:"ruc"`
+	RazonSocial string     `json:"razon_social"`
+	FechaInicio *time.Time `json:"a_partir_del,omitempty"`
+	Resolucion  string     `json:"resolucion,omitempty"`
+}
+
+// SituacionIGV indica en qué padrones del IGV figura un contribuyente
+type SituacionIGV struct {
+	RUC               string              `json:"ruc"`
+	AgenteRetencion   bool                `json:"agente_retencion"`
+	AgentePercepcion  bool                `json:"agente_percepcion"`
+	BuenContribuyente bool                `json:"buen_contribuyente"`
+	Inscripciones     []InscripcionPadron `json:"inscripciones"`
+}
+
+// NuevaSituacionIGV resume las inscripciones de un RUC
+func NuevaSituacionIGV(ruc string, inscripciones []InscripcionPadron) *SituacionIGV {
+	situacion := &SituacionIGV{RUC: ruc, Inscripciones: inscripciones}
+	for _, inscripcion := range inscripciones {
+		switch inscripcion.Padron {
+		case PadronAgentesRetencion:
+			situacion.AgenteRetencion = true
+		case PadronAgentesPercepcion:
+			situacion.AgentePercepcion = true
+		case PadronBuenosContribuyentes:
+			situacion.BuenContribuyente = true
+		}
+	}
+	if situacion.Inscripciones == nil {
+		situacion.Inscripciones = []InscripcionPadron{}
+	}
+	return situacion
+}
+
+// ImportacionPadron resume una carga de un padrón de SUNAT
+type ImportacionPadron struct {
+	ID           int64      `json:"id"`
+	Padron       string     `json:"padron"`
+	Archivo      string     `json:"archivo"`
+	Estado       string     `json:"estado"`
+	Leidos       int64      `json:"leidos"`
+	Insertados   int64      `json:"insertados"`
+	Actualizados int64      `json:"actualizados"`
+	Eliminados   int64      `json:"eliminados"`
+	Rechazados   int64      `json:"rechazados"`
+	Error        string     `json:"error,omitempty"`
+	FechaInicio  time.Time  `json:"fecha_inicio"`
+	FechaFin     *time.Time `json:"fecha_fin,omitempty"`
+}
+
+// Fuentes de los tipos de cambio importados
+const (
+	FuenteTipoCambioSBS   = "SBS"
+	FuenteTipoCambioSUNAT = "SUNAT"
+)
+
+// TipoCambio es la cotización oficial de una moneda en soles para una fecha de
+// publicación
+type TipoCambio struct {
+	Moneda             string    `json:"moneda"`
+	Fecha              time.Time `json:"fecha"`
+	Compra             float64   `json:"compra"`
+	Venta              float64   `json:"venta"`
+	Fuente             string    `json:"fuente"`
+	FechaActualizacion time.Time `json:"fecha_actualizacion"`
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"encoding/xml"
+	"strconv"
 	"time"
 )
 
@@ -16,20 +17,28 @@ type UBLInvoice struct {
 	UBLExtensions          *UBLExtensions          `xml:"ext:UBLExtensions"`
 	UBLVersionID           string                  `xml:"cbc:UBLVersionID"`
 	CustomizationID        string                  `xml:"cbc:CustomizationID"`
-	ProfileID              string                  `xml:"cbc:ProfileID,omitempty"`
+	ProfileID              *ProfileID              `xml:"cbc:ProfileID,omitempty"`
 	ID                     string                  `xml:"cbc:ID"`
 	IssueDate              string                  `xml:"cbc:IssueDate"`
 	IssueTime              string                  `xml:"cbc:IssueTime,omitempty"`
 	DueDate                string                  `xml:"cbc:DueDate,omitempty"`
-	InvoiceTypeCode        string                  `xml:"cbc:InvoiceTypeCode"`
+	InvoiceTypeCode        *InvoiceTypeCode        `xml:"cbc:InvoiceTypeCode"`
 	Note                   []Note                  `xml:"cbc:Note,omitempty"`
 	DocumentCurrencyCode   string                  `xml:"cbc:DocumentCurrencyCode"`
 	LineCountNumeric       int                     `xml:"cbc:LineCountNumeric"`
+	OrderReference         *OrderReference         `xml:"cac:OrderReference,omitempty"`
+	DespatchDocumentReference []AdditionalDocumentReference `xml:"cac:DespatchDocumentReference,omitempty"`
+	AdditionalDocumentReference []AdditionalDocumentReference `xml:"cac:AdditionalDocumentReference,omitempty"`
 	Signature              *Signature              `xml:"cac:Signature,omitempty"`
 	AccountingSupplierParty *AccountingSupplierParty `xml:"cac:AccountingSupplierParty"`
 	AccountingCustomerParty *AccountingCustomerParty `xml:"cac:AccountingCustomerParty"`
+	DeliveryTerms          *DeliveryTerms          `xml:"cac:DeliveryTerms,omitempty"`
+	PaymentMeans           []PaymentMeans          `xml:"cac:PaymentMeans,omitempty"`
 	PaymentTerms           []PaymentTerms          `xml:"cac:PaymentTerms,omitempty"`
+	PrepaidPayment         []PrepaidPayment        `xml:"cac:PrepaidPayment,omitempty"`
+	AllowanceCharge        []AllowanceCharge       `xml:"cac:AllowanceCharge,omitempty"`
 	TaxTotal               []TaxTotal              `xml:"cac:TaxTotal"`
+	WithholdingTaxTotal    []TaxTotal              `xml:"cac:WithholdingTaxTotal,omitempty"`
 	LegalMonetaryTotal     *LegalMonetaryTotal     `xml:"cac:LegalMonetaryTotal"`
 	InvoiceLines           []InvoiceLine           `xml:"cac:InvoiceLine"`
 }
@@ -47,9 +56,14 @@ type UBLCreditNote struct {
 	CustomizationID        string                  `xml:"cbc:CustomizationID"`
 	ID                     string                  `xml:"cbc:ID"`
 	IssueDate              string                  `xml:"cbc:IssueDate"`
+	IssueTime              string                  `xml:"cbc:IssueTime,omitempty"`
 	CreditNoteTypeCode     string                  `xml:"cbc:CreditNoteTypeCode"`
+	Note                   []Note                  `xml:"cbc:Note,omitempty"`
 	DocumentCurrencyCode   string                  `xml:"cbc:DocumentCurrencyCode"`
 	LineCountNumeric       int                     `xml:"cbc:LineCountNumeric"`
+	OrderReference         *OrderReference         `xml:"cac:OrderReference,omitempty"`
+	DespatchDocumentReference []AdditionalDocumentReference `xml:"cac:DespatchDocumentReference,omitempty"`
+	AdditionalDocumentReference []AdditionalDocumentReference `xml:"cac:AdditionalDocumentReference,omitempty"`
 	Signature              *Signature              `xml:"cac:Signature,omitempty"`
 	AccountingSupplierParty *AccountingSupplierParty `xml:"cac:AccountingSupplierParty"`
 	AccountingCustomerParty *AccountingCustomerParty `xml:"cac:AccountingCustomerParty"`
@@ -169,12 +183,20 @@ type AccountingCustomerParty struct {
 type Party struct {
 	PartyIdentification []PartyIdentification `xml:"cac:PartyIdentification"`
 	PartyName           *PartyName            `xml:"cac:PartyName,omitempty"`
+	PostalAddress       *PostalAddress        `xml:"cac:PostalAddress,omitempty"`
 	PartyTaxScheme      *PartyTaxScheme       `xml:"cac:PartyTaxScheme,omitempty"`
 	PartyLegalEntity    *PartyLegalEntity     `xml:"cac:PartyLegalEntity,omitempty"`
-	PostalAddress       *PostalAddress        `xml:"cac:PostalAddress,omitempty"`
 	Contact             *Contact              `xml:"cac:Contact,omitempty"`
 }
 
+// ProfileID repite el tipo de operación (catálogo 51) que se informa en InvoiceTypeCode@listID
+type ProfileID struct {
+	Value            string `xml:",chardata"`
+	SchemeName       string `xml:"schemeName,attr,omitempty"`
+	SchemeAgencyName string `xml:"schemeAgencyName,attr,omitempty"`
+	SchemeURI        string `xml:"schemeURI,attr,omitempty"`
+}
+
 type PartyIdentification struct {
 	ID *ID `xml:"cbc:ID"`
 }
@@ -218,7 +240,7 @@ type AddressLine struct {
 }
 
 type PostalAddress struct {
-	ID                 string `xml:"cbc:ID,omitempty"`
+	ID                 *ID    `xml:"cbc:ID,omitempty"`
 	StreetName         string `xml:"cbc:StreetName,omitempty"`
 	CitySubdivisionName string `xml:"cbc:CitySubdivisionName,omitempty"`
 	CityName           string `xml:"cbc:CityName,omitempty"`
@@ -274,22 +296,47 @@ type LegalMonetaryTotal struct {
 	LineExtensionAmount *Amount `xml:"cbc:LineExtensionAmount,omitempty"`
 	TaxExclusiveAmount  *Amount `xml:"cbc:TaxExclusiveAmount,omitempty"`
 	TaxInclusiveAmount  *Amount `xml:"cbc:TaxInclusiveAmount,omitempty"`
+	AllowanceTotalAmount *Amount `xml:"cbc:AllowanceTotalAmount,omitempty"`
 	ChargeTotalAmount   *Amount `xml:"cbc:ChargeTotalAmount,omitempty"`
 	PrepaidAmount       *Amount `xml:"cbc:PrepaidAmount,omitempty"`
 	PayableAmount       *Amount `xml:"cbc:PayableAmount"`
 }
 
+// AllowanceCharge para cargos y descuentos según catálogo 53
+type AllowanceCharge struct {
+	ChargeIndicator           bool                       `xml:"cbc:ChargeIndicator"`
+	AllowanceChargeReasonCode *AllowanceChargeReasonCode `xml:"cbc:AllowanceChargeReasonCode"`
+	MultiplierFactorNumeric   float64                    `xml:"cbc:MultiplierFactorNumeric,omitempty"`
+	Amount                    *Amount                    `xml:"cbc:Amount"`
+	BaseAmount                *Amount                    `xml:"cbc:BaseAmount,omitempty"`
+}
+
+type AllowanceChargeReasonCode struct {
+	Value          string `xml:",chardata"`
+	ListAgencyName string `xml:"listAgencyName,attr,omitempty"`
+	ListName       string `xml:"listName,attr,omitempty"`
+	ListURI        string `xml:"listURI,attr,omitempty"`
+}
+
 type Amount struct {
 	Value      float64 `xml:",chardata"`
 	CurrencyID string  `xml:"currencyID,attr"` // Siempre requerido por SUNAT
 }
 
+// MarshalXML escribe el monto como xsd:decimal; encoding/xml usa notación
+// exponencial (1e+06) desde el millón, que el esquema UBL no admite
+func (a Amount) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "currencyID"}, Value: a.CurrencyID})
+	return e.EncodeElement(FormatUBLDecimal(a.Value), start)
+}
+
 // InvoiceLine para líneas de factura
 type InvoiceLine struct {
 	ID                    string                 `xml:"cbc:ID"`
 	InvoicedQuantity      *Quantity              `xml:"cbc:InvoicedQuantity"`
 	LineExtensionAmount   *Amount                `xml:"cbc:LineExtensionAmount"`
 	PricingReference      *PricingReference      `xml:"cac:PricingReference,omitempty"`
+	AllowanceCharge       []AllowanceCharge      `xml:"cac:AllowanceCharge,omitempty"`
 	TaxTotal              []TaxTotal             `xml:"cac:TaxTotal,omitempty"`
 	Item                  *UBLItem               `xml:"cac:Item"`
 	Price                 *Price                 `xml:"cac:Price"`
@@ -307,7 +354,8 @@ type CreditNoteLine struct {
 }
 
 // UBLDebitNote representa una nota de débito en formato UBL 2.1
-// Estructura basada en los ejemplos oficiales SUNAT
+// Estructura basada en los ejemplos oficiales SUNAT. UBL 2.1 no define un código
+// de tipo para DebitNote y sus totales van en cac:RequestedMonetaryTotal
 // Referencia: guia+xml+nota de crédito+version 2-1+1+0_0_0 (2).pdf y guia+xml+boleta+version 2-1+1+0_0_0 (2).pdf
 // Puedes ajustar los campos según el PDF de nota de débito si tienes diferencias
 
@@ -323,14 +371,18 @@ type UBLDebitNote struct {
 	CustomizationID        string                  `xml:"cbc:CustomizationID"`
 	ID                     string                  `xml:"cbc:ID"`
 	IssueDate              string                  `xml:"cbc:IssueDate"`
-	DebitNoteTypeCode      string                  `xml:"cbc:DebitNoteTypeCode"`
+	IssueTime              string                  `xml:"cbc:IssueTime,omitempty"`
+	Note                   []Note                  `xml:"cbc:Note,omitempty"`
 	DocumentCurrencyCode   string                  `xml:"cbc:DocumentCurrencyCode"`
 	LineCountNumeric       int                     `xml:"cbc:LineCountNumeric"`
+	OrderReference         *OrderReference         `xml:"cac:OrderReference,omitempty"`
+	DespatchDocumentReference []AdditionalDocumentReference `xml:"cac:DespatchDocumentReference,omitempty"`
+	AdditionalDocumentReference []AdditionalDocumentReference `xml:"cac:AdditionalDocumentReference,omitempty"`
 	Signature              *Signature              `xml:"cac:Signature,omitempty"`
 	AccountingSupplierParty *AccountingSupplierParty `xml:"cac:AccountingSupplierParty"`
 	AccountingCustomerParty *AccountingCustomerParty `xml:"cac:AccountingCustomerParty"`
 	TaxTotal               []TaxTotal              `xml:"cac:TaxTotal"`
-	LegalMonetaryTotal     *LegalMonetaryTotal     `xml:"cac:LegalMonetaryTotal"`
+	RequestedMonetaryTotal *LegalMonetaryTotal     `xml:"cac:RequestedMonetaryTotal"`
 	DebitNoteLines         []DebitNoteLine         `xml:"cac:DebitNoteLine"`
 }
 
@@ -345,8 +397,22 @@ type DebitNoteLine struct {
 }
 
 type Quantity struct {
-	Value    float64 `xml:",chardata"`
-	UnitCode string  `xml:"unitCode,attr"` // Siempre requerido por SUNAT
+	Value                  float64 `xml:",chardata"`
+	UnitCode               string  `xml:"unitCode,attr"` // Siempre requerido por SUNAT
+	UnitCodeListID         string  `xml:"unitCodeListID,attr,omitempty"`
+	UnitCodeListAgencyName string  `xml:"unitCodeListAgencyName,attr,omitempty"`
+}
+
+// MarshalXML escribe la cantidad como xsd:decimal, igual que Amount
+func (q Quantity) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "unitCode"}, Value: q.UnitCode})
+	if q.UnitCodeListID != "" {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "unitCodeListID"}, Value: q.UnitCodeListID})
+	}
+	if q.UnitCodeListAgencyName != "" {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "unitCodeListAgencyName"}, Value: q.UnitCodeListAgencyName})
+	}
+	return e.EncodeElement(FormatUBLDecimal(q.Value), start)
 }
 
 type PricingReference struct {
@@ -363,6 +429,7 @@ type UBLItem struct {
 	SellersItemIdentification  *SellersItemIdentification  `xml:"cac:SellersItemIdentification,omitempty"`
 	CommodityClassification    []CommodityClassification   `xml:"cac:CommodityClassification,omitempty"`
 	ClassifiedTaxCategory      []ClassifiedTaxCategory     `xml:"cac:ClassifiedTaxCategory,omitempty"`
+	AdditionalItemProperty     []AdditionalItemProperty    `xml:"cac:AdditionalItemProperty,omitempty"`
 }
 
 type SellersItemIdentification struct {
@@ -377,6 +444,7 @@ type ItemClassificationCode struct {
 	Value         string `xml:",chardata"`
 	ListID        string `xml:"listID,attr,omitempty"`
 	ListAgencyName string `xml:"listAgencyName,attr,omitempty"`
+	ListName      string `xml:"listName,attr,omitempty"`
 }
 
 type ClassifiedTaxCategory struct {
@@ -387,12 +455,42 @@ type ClassifiedTaxCategory struct {
 	TaxScheme                 *TaxScheme `xml:"cac:TaxScheme"`
 }
 
+// AdditionalItemProperty para las propiedades adicionales del ítem (catálogo 55)
+type AdditionalItemProperty struct {
+	Name            string           `xml:"cbc:Name"`
+	NameCode        *NameCode        `xml:"cbc:NameCode"`
+	Value           string           `xml:"cbc:Value,omitempty"`
+	ValueQuantity   *Quantity        `xml:"cbc:ValueQuantity,omitempty"`
+	UsabilityPeriod *UsabilityPeriod `xml:"cac:UsabilityPeriod,omitempty"`
+}
+
+type NameCode struct {
+	Value          string `xml:",chardata"`
+	ListName       string `xml:"listName,attr,omitempty"`
+	ListAgencyName string `xml:"listAgencyName,attr,omitempty"`
+	ListURI        string `xml:"listURI,attr,omitempty"`
+}
+
+// UsabilityPeriod lleva las fechas, la hora y los días de permanencia de las
+// propiedades del ítem
+type UsabilityPeriod struct {
+	StartDate       string   `xml:"cbc:StartDate,omitempty"`
+	StartTime       string   `xml:"cbc:StartTime,omitempty"`
+	EndDate         string   `xml:"cbc:EndDate,omitempty"`
+	DurationMeasure *Measure `xml:"cbc:DurationMeasure,omitempty"`
+}
+
+type Measure struct {
+	Value    float64 `xml:",chardata"`
+	UnitCode string  `xml:"unitCode,attr"`
+}
+
 type Price struct {
 	PriceAmount *Amount `xml:"cbc:PriceAmount"`
 }
 
-// Note para monto en letras y otros usos
-// Permite atributos como languageLocaleID
+// Note contiene una leyenda del catálogo 52 (languageLocaleID) o, sin código,
+// una observación de texto libre
 type Note struct {
 	Value            string `xml:",chardata"`
 	LanguageLocaleID string `xml:"languageLocaleID,attr,omitempty"`
@@ -401,9 +499,104 @@ type Note struct {
 // PaymentTerms para cuotas de pago y condiciones de pago
 type PaymentTerms struct {
 	ID             string  `xml:"cbc:ID"`
-	PaymentMeansID string  `xml:"cbc:PaymentMeansID,omitempty"`
-	Amount         *Amount `xml:"cbc:Amount,omitempty"`
-	PaymentDueDate string  `xml:"cbc:PaymentDueDate,omitempty"`
+	PaymentMeansID *PaymentMeansID `xml:"cbc:PaymentMeansID,omitempty"`
+	PaymentPercent float64         `xml:"cbc:PaymentPercent,omitempty"`
+	Amount         *Amount         `xml:"cbc:Amount,omitempty"`
+	PaymentDueDate string          `xml:"cbc:PaymentDueDate,omitempty"`
+}
+
+// PaymentMeansID identifica la forma de pago o, en la detracción, el bien o
+// servicio sujeto al SPOT (catálogo 54)
+type PaymentMeansID struct {
+	Value            string `xml:",chardata"`
+	SchemeName       string `xml:"schemeName,attr,omitempty"`
+	SchemeAgencyName string `xml:"schemeAgencyName,attr,omitempty"`
+	SchemeURI        string `xml:"schemeURI,attr,omitempty"`
+}
+
+// PaymentMeans medio de pago (catálogo 59) y cuenta del Banco de la Nación de la detracción
+type PaymentMeans struct {
+	ID                    string                 `xml:"cbc:ID,omitempty"`
+	PaymentMeansCode      *PaymentMeansCode      `xml:"cbc:PaymentMeansCode"`
+	PayeeFinancialAccount *PayeeFinancialAccount `xml:"cac:PayeeFinancialAccount,omitempty"`
+}
+
+type PaymentMeansCode struct {
+	Value          string `xml:",chardata"`
+	ListName       string `xml:"listName,attr,omitempty"`
+	ListAgencyName string `xml:"listAgencyName,attr,omitempty"`
+	ListURI        string `xml:"listURI,attr,omitempty"`
+}
+
+type PayeeFinancialAccount struct {
+	ID string `xml:"cbc:ID"`
+}
+
+// InvoiceTypeCode tipo de documento (catálogo 01) con el tipo de operación (catálogo 51) en listID
+type InvoiceTypeCode struct {
+	Value          string `xml:",chardata"`
+	ListID         string `xml:"listID,attr,omitempty"`
+	ListAgencyName string `xml:"listAgencyName,attr,omitempty"`
+	ListName       string `xml:"listName,attr,omitempty"`
+	ListURI        string `xml:"listURI,attr,omitempty"`
+	Name           string `xml:"name,attr,omitempty"`
+	ListSchemeURI  string `xml:"listSchemeURI,attr,omitempty"`
+}
+
+// DeliveryTerms para las condiciones de entrega (Incoterms) de exportaciones
+type DeliveryTerms struct {
+	ID               string            `xml:"cbc:ID"`
+	DeliveryLocation *DeliveryLocation `xml:"cac:DeliveryLocation,omitempty"`
+}
+
+type DeliveryLocation struct {
+	Address *PostalAddress `xml:"cac:Address"`
+}
+
+// OrderReference para el número de orden de compra del adquirente
+type OrderReference struct {
+	ID string `xml:"cbc:ID"`
+}
+
+// AdditionalDocumentReference para documentos relacionados (catálogo 12). Se
+// usa también en cac:DespatchDocumentReference para las guías de remisión
+// (catálogo 01), que comparten el tipo DocumentReference de UBL.
+type AdditionalDocumentReference struct {
+	ID                 string              `xml:"cbc:ID"`
+	DocumentTypeCode   *DocumentTypeCode   `xml:"cbc:DocumentTypeCode,omitempty"`
+	DocumentStatusCode *DocumentStatusCode `xml:"cbc:DocumentStatusCode,omitempty"`
+	IssuerParty        *IssuerParty        `xml:"cac:IssuerParty,omitempty"`
+}
+
+type DocumentTypeCode struct {
+	Value          string `xml:",chardata"`
+	ListAgencyName string `xml:"listAgencyName,attr,omitempty"`
+	ListName       string `xml:"listName,attr,omitempty"`
+	ListURI        string `xml:"listURI,attr,omitempty"`
+}
+
+// DocumentStatusCode vincula el documento relacionado con su cac:PrepaidPayment
+type DocumentStatusCode struct {
+	Value          string `xml:",chardata"`
+	ListName       string `xml:"listName,attr,omitempty"`
+	ListAgencyName string `xml:"listAgencyName,attr,omitempty"`
+}
+
+type IssuerParty struct {
+	PartyIdentification *PartyIdentification `xml:"cac:PartyIdentification"`
+}
+
+// PrepaidPayment para anticipos deducidos en la factura final
+type PrepaidPayment struct {
+	ID         *PrepaidPaymentID `xml:"cbc:ID"`
+	PaidAmount *Amount           `xml:"cbc:PaidAmount"`
+	PaidDate   string            `xml:"cbc:PaidDate,omitempty"`
+}
+
+type PrepaidPaymentID struct {
+	Value            string `xml:",chardata"`
+	SchemeName       string `xml:"schemeName,attr,omitempty"`
+	SchemeAgencyName string `xml:"schemeAgencyName,attr,omitempty"`
 }
 
 // UBLConstants contiene las constantes para UBL 2.1 según guías oficiales SUNAT
@@ -411,6 +604,8 @@ type UBLConstants struct {
 	Version                    string
 	CustomizationID           string
 	Xmlns                     string
+	XmlnsCreditNote           string
+	XmlnsDebitNote            string
 	XmlnsCac                  string
 	XmlnsCbc                  string
 	XmlnsDs                   string
@@ -424,6 +619,8 @@ var UBLConst = UBLConstants{
 	Version:                    "2.1",
 	CustomizationID:           "2.0", // SUNAT especifica 2.0 para Perú
 	Xmlns:                     "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2",
+	XmlnsCreditNote:           "urn:oasis:names:specification:ubl:schema:xsd:CreditNote-2",
+	XmlnsDebitNote:            "urn:oasis:names:specification:ubl:schema:xsd:DebitNote-2",
 	XmlnsCac:                  "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2",
 	XmlnsCbc:                  "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2",
 	XmlnsDs:                   "http://www.w3.org/2000/09/xmldsig#",
@@ -440,11 +637,15 @@ var SUNATConstants = struct {
 	CreditNoteTypeCode     string
 	DebitNoteTypeCode      string
 	BoletaTypeCode         string
+	LiquidacionCompraTypeCode string
 	
 	// Códigos de impuestos según catálogo 05
 	IGVCode                string
-	ICBCode                string
 	ISCCode                string
+	ICBCode                string
+	EXPCode                string
+	GRACode                string
+	IVAPCode               string
 	
 	// Monedas según catálogo 02
 	PENCurrency            string
@@ -464,10 +665,14 @@ var SUNATConstants = struct {
 	CreditNoteTypeCode: "07",
 	DebitNoteTypeCode:  "08",
 	BoletaTypeCode:     "03",
+	LiquidacionCompraTypeCode: "04",
 	
 	IGVCode: "1000",
-	ICBCode: "2000",
-	ISCCode: "9995",
+	ISCCode: "2000",
+	ICBCode: "7152",
+	EXPCode: "9995",
+	GRACode: "9996",
+	IVAPCode: "1016",
 	
 	PENCurrency: "PEN",
 	USDCurrency: "USD",
@@ -481,11 +686,45 @@ var SUNATConstants = struct {
 	PASDocumentType: "7",
 }
 
+// ZonaHorariaPeru es la zona horaria en que se fechan los comprobantes. Si el
+// sistema no tiene la base de datos de zonas horarias se usa UTC-5, que Perú
+// mantiene todo el año.
+var ZonaHorariaPeru = cargarZonaHorariaPeru()
+
+func cargarZonaHorariaPeru() *time.Location {
+	if zona, err := time.LoadLocation("America/Lima"); err == nil {
+		return zona
+	}
+	return time.FixedZone("PET", -5*60*60)
+}
+
+// HoraPeru expresa un instante en la hora de Lima, de modo que la fecha de
+// emisión no dependa de la zona horaria del servidor ni del cliente
+func HoraPeru(t time.Time) time.Time {
+	return t.In(ZonaHorariaPeru)
+}
+
 // Helper methods para conversión de tiempo
 func FormatUBLDate(t time.Time) string {
 	return t.Format("2006-01-02")
 }
 
+// FormatUBLTime formatea la hora de emisión (cbc:IssueTime)
+func FormatUBLTime(t time.Time) string {
+	return t.Format("15:04:05")
+}
+
 func FormatUBLDateTime(t time.Time) string {
 	return t.Format("2006-01-02T15:04:05")
+}
+
+// FormatUBLIssueDate retorna la fecha y la hora de emisión en la hora de Lima
+func FormatUBLIssueDate(t time.Time) (fecha, hora string) {
+	t = HoraPeru(t)
+	return FormatUBLDate(t), FormatUBLTime(t)
+}
+
+// FormatUBLDecimal formatea un número sin notación exponencial
+func FormatUBLDecimal(valor float64) string {
+	return strconv.FormatFloat(valor, 'f', -1, 64)
 }
\ No newline at end of file
@@ -3,14 +3,20 @@ package repository
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"facturacion_sunat_api_go/internal/models"
+	"facturacion_sunat_api_go/pkg/catalogos"
 	"fmt"
+	"math"
 	"time"
 
 	"github.com/google/uuid"
 	_ "github.com/lib/pq"
 )
 
+// ErrAnticipoInvalido indica que un anticipo referenciado no puede deducirse
+var ErrAnticipoInvalido = errors.New("anticipo inválido")
+
 type ComprobanteRepository struct {
 	db *sql.DB
 }
@@ -44,12 +50,63 @@ func (r *ComprobanteRepository) Create(comprobante *models.Comprobante) error {
 			receptor_tipo_documento, receptor_numero_documento, receptor_razon_social,
 			receptor_direccion, receptor_email,
 			total_valor_venta, total_impuestos, total_precio_venta, importe_total,
-			estado_proceso, observaciones, fecha_creacion, fecha_actualizacion, usuario_creacion
+			estado_proceso, observaciones, fecha_creacion, fecha_actualizacion, usuario_creacion,
+			es_anticipo, tipo_operacion, receptor_pais, incoterm, lugar_entrega, entrega_pais,
+			percepcion_regimen, percepcion_porcentaje, percepcion_base, percepcion_monto, percepcion_total,
+			emisor_regimen, emisor_ubigeo, receptor_distrito, receptor_provincia,
+			receptor_departamento, receptor_ubigeo, entrega_ubigeo,
+			retencion_porcentaje, retencion_base, retencion_monto,
+			detraccion_codigo, detraccion_cuenta, detraccion_medio_pago, detraccion_porcentaje,
+			detraccion_valor_referencial, detraccion_tipo_cambio, detraccion_base, detraccion_monto,
+			forma_pago, forma_pago_medio, orden_compra, emisor_establecimiento,
+			liquidacion_porcentaje_renta, liquidacion_igv, liquidacion_base_renta, liquidacion_renta
 		) VALUES (
 			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17,
-			$18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31
+			$18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32,
+			$33, $34, $35, $36, $37, $38, $39, $40, $41, $42, $43, $44, $45, $46,
+			$47, $48, $49, $50, $51, $52, $53, $54, $55, $56, $57, $58, $59, $60,
+			$61, $62, $63, $64, $65, $66, $67, $68
 		)`
 
+	var incoterm, lugarEntrega, entregaPais, entregaUbigeo string
+	if comprobante.CondicionesEntrega != nil {
+		incoterm = comprobante.CondicionesEntrega.Incoterm
+		lugarEntrega = comprobante.CondicionesEntrega.LugarEntrega
+		entregaPais = comprobante.CondicionesEntrega.CodigoPais
+		entregaUbigeo = comprobante.CondicionesEntrega.Ubigeo
+	}
+
+	percepcion := models.Percepcion{}
+	if comprobante.Percepcion != nil {
+		percepcion = *comprobante.Percepcion
+	}
+
+	// El porcentaje de retención queda en NULL cuando la venta no está sujeta a retención
+	var retencionPorcentaje sql.NullFloat64
+	retencion := models.Retencion{}
+	if comprobante.Retencion != nil {
+		retencion = *comprobante.Retencion
+		retencionPorcentaje = sql.NullFloat64{Float64: retencion.Porcentaje, Valid: true}
+	}
+
+	detraccion := models.Detraccion{}
+	if comprobante.Detraccion != nil {
+		detraccion = *comprobante.Detraccion
+	}
+
+	formaPago := models.FormaPago{}
+	if comprobante.FormaPago != nil {
+		formaPago = *comprobante.FormaPago
+	}
+
+	// Igual que en la retención, el porcentaje de renta en NULL indica que no es una liquidación de compra
+	var liquidacionPorcentaje sql.NullFloat64
+	liquidacion := models.LiquidacionCompra{}
+	if comprobante.Liquidacion != nil {
+		liquidacion = *comprobante.Liquidacion
+		liquidacionPorcentaje = sql.NullFloat64{Float64: liquidacion.PorcentajeRenta, Valid: true}
+	}
+
 	_, err = tx.Exec(query,
 		comprobante.ID, comprobante.Tipo, comprobante.Serie, comprobante.Numero,
 		comprobante.FechaEmision, comprobante.FechaVencimiento, comprobante.TipoMoneda,
@@ -62,6 +119,20 @@ func (r *ComprobanteRepository) Create(comprobante *models.Comprobante) error {
 		comprobante.Totales.TotalPrecioVenta, comprobante.Totales.ImporteTotal,
 		comprobante.EstadoProceso, comprobante.Observaciones, comprobante.FechaCreacion,
 		comprobante.FechaActualizacion, comprobante.UsuarioCreacion,
+		comprobante.EsAnticipo, nullString(comprobante.TipoOperacion), nullString(comprobante.Receptor.CodigoPais),
+		nullString(incoterm), nullString(lugarEntrega), nullString(entregaPais),
+		nullString(percepcion.CodigoRegimen), percepcion.Porcentaje, percepcion.BaseImponible,
+		percepcion.Monto, percepcion.MontoTotal, nullString(comprobante.Emisor.Regimen),
+		nullString(comprobante.Emisor.Ubigeo), nullString(comprobante.Receptor.Distrito),
+		nullString(comprobante.Receptor.Provincia), nullString(comprobante.Receptor.Departamento),
+		nullString(comprobante.Receptor.Ubigeo), nullString(entregaUbigeo),
+		retencionPorcentaje, retencion.BaseImponible, retencion.Monto,
+		nullString(detraccion.Codigo), nullString(detraccion.NumeroCuenta), nullString(detraccion.MedioPago),
+		detraccion.Porcentaje, detraccion.ValorReferencial, detraccion.TipoCambio,
+		detraccion.MontoBase, detraccion.Monto,
+		nullString(formaPago.TipoPago), nullString(formaPago.MedioPago), nullString(comprobante.OrdenCompra),
+		codigoEstablecimiento(comprobante.Emisor),
+		liquidacionPorcentaje, liquidacion.IGVRetenido, liquidacion.BaseRenta, liquidacion.RentaRetenida,
 	)
 	if err != nil {
 		return fmt.Errorf("error insertando comprobante: %v", err)
@@ -81,6 +152,43 @@ func (r *ComprobanteRepository) Create(comprobante *models.Comprobante) error {
 		}
 	}
 
+	// Insertar cargos y descuentos globales
+	for _, cd := range comprobante.CargosDescuentos {
+		if err := r.insertCargoDescuento(tx, &comprobante.ID, nil, cd); err != nil {
+			return fmt.Errorf("error insertando cargo/descuento: %v", err)
+		}
+	}
+
+	// Verificar e insertar los anticipos deducidos
+	for _, anticipo := range comprobante.Anticipos {
+		anticipoID, err := r.validarAnticipo(tx, comprobante, anticipo)
+		if err != nil {
+			return err
+		}
+		if err := r.insertAnticipo(tx, comprobante.ID, anticipoID, anticipo); err != nil {
+			return fmt.Errorf("error insertando anticipo: %v", err)
+		}
+	}
+
+	// Insertar cuotas de la venta al crédito
+	for _, cuota := range formaPago.Cuotas {
+		if err := r.insertCuota(tx, comprobante.ID, cuota); err != nil {
+			return fmt.Errorf("error insertando cuota: %v", err)
+		}
+	}
+
+	// Insertar guías de remisión y documentos relacionados
+	for _, guia := range comprobante.Guias {
+		if err := r.insertDocumentoRelacionado(tx, comprobante.ID, catalogos.TipoDocumento, guia); err != nil {
+			return fmt.Errorf("error insertando guía de remisión: %v", err)
+		}
+	}
+	for _, documento := range comprobante.DocumentosRelacionados {
+		if err := r.insertDocumentoRelacionado(tx, comprobante.ID, catalogos.DocumentoRelacionado, documento); err != nil {
+			return fmt.Errorf("error insertando documento relacionado: %v", err)
+		}
+	}
+
 	// Insertar totales
 	if err := r.insertTotales(tx, comprobante.ID, comprobante.Totales); err != nil {
 		return fmt.Errorf("error insertando totales: %v", err)
@@ -100,13 +208,33 @@ func (r *ComprobanteRepository) GetByID(id string) (*models.Comprobante, error)
 			receptor_direccion, receptor_email,
 			total_valor_venta, total_impuestos, total_precio_venta, importe_total,
 			estado_proceso, xml_generado, xml_firmado, ticket_sunat, estado_sunat,
-			observaciones, fecha_creacion, fecha_actualizacion, usuario_creacion
+			observaciones, fecha_creacion, fecha_actualizacion, usuario_creacion,
+			es_anticipo, tipo_operacion, receptor_pais, incoterm, lugar_entrega, entrega_pais,
+			percepcion_regimen, percepcion_porcentaje, percepcion_base, percepcion_monto, percepcion_total,
+			emisor_regimen, emisor_ubigeo, receptor_distrito, receptor_provincia,
+			receptor_departamento, receptor_ubigeo, entrega_ubigeo,
+			retencion_porcentaje, retencion_base, retencion_monto,
+			detraccion_codigo, detraccion_cuenta, detraccion_medio_pago, detraccion_porcentaje,
+			detraccion_valor_referencial, detraccion_tipo_cambio, detraccion_base, detraccion_monto,
+			forma_pago, forma_pago_medio, orden_compra, emisor_establecimiento,
+			liquidacion_porcentaje_renta, liquidacion_igv, liquidacion_base_renta, liquidacion_renta
 		FROM comprobantes WHERE id = $1`
 
 	var comprobante models.Comprobante
 	var xmlGenerado, xmlFirmado, ticketSunat, estadoSunat, usuarioCreacion sql.NullString
 	var fechaVencimiento sql.NullTime
 	var nombreComercial, telefono, email, direccionReceptor, emailReceptor sql.NullString
+	var tipoOperacion, receptorPais, incoterm, lugarEntrega, entregaPais sql.NullString
+	var percepcionRegimen, emisorRegimen sql.NullString
+	var emisorUbigeo, receptorDistrito, receptorProvincia, receptorDepartamento, receptorUbigeo, entregaUbigeo sql.NullString
+	var percepcion models.Percepcion
+	var retencionPorcentaje sql.NullFloat64
+	var retencion models.Retencion
+	var detraccionCodigo, detraccionCuenta, detraccionMedioPago sql.NullString
+	var detraccion models.Detraccion
+	var formaPago, formaPagoMedio, ordenCompra sql.NullString
+	var liquidacionPorcentaje sql.NullFloat64
+	var liquidacion models.LiquidacionCompra
 
 	err := r.db.QueryRow(query, id).Scan(
 		&comprobante.ID, &comprobante.Tipo, &comprobante.Serie, &comprobante.Numero,
@@ -120,7 +248,17 @@ func (r *ComprobanteRepository) GetByID(id string) (*models.Comprobante, error)
 		&comprobante.Totales.TotalPrecioVenta, &comprobante.Totales.ImporteTotal,
 		&comprobante.EstadoProceso, &xmlGenerado, &xmlFirmado, &ticketSunat, &estadoSunat,
 		&comprobante.Observaciones, &comprobante.FechaCreacion, &comprobante.FechaActualizacion,
-		&usuarioCreacion,
+		&usuarioCreacion, &comprobante.EsAnticipo, &tipoOperacion, &receptorPais,
+		&incoterm, &lugarEntrega, &entregaPais,
+		&percepcionRegimen, &percepcion.Porcentaje, &percepcion.BaseImponible,
+		&percepcion.Monto, &percepcion.MontoTotal, &emisorRegimen,
+		&emisorUbigeo, &receptorDistrito, &receptorProvincia,
+		&receptorDepartamento, &receptorUbigeo, &entregaUbigeo,
+		&retencionPorcentaje, &retencion.BaseImponible, &retencion.Monto,
+		&detraccionCodigo, &detraccionCuenta, &detraccionMedioPago, &detraccion.Porcentaje,
+		&detraccion.ValorReferencial, &detraccion.TipoCambio, &detraccion.MontoBase, &detraccion.Monto,
+		&formaPago, &formaPagoMedio, &ordenCompra, &comprobante.Emisor.CodigoEstablecimiento,
+		&liquidacionPorcentaje, &liquidacion.IGVRetenido, &liquidacion.BaseRenta, &liquidacion.RentaRetenida,
 	)
 
 	if err == sql.ErrNoRows {
@@ -131,6 +269,7 @@ func (r *ComprobanteRepository) GetByID(id string) (*models.Comprobante, error)
 	}
 
 	// Manejar campos nullable
+	comprobante.FechaEmision = models.HoraPeru(comprobante.FechaEmision)
 	if fechaVencimiento.Valid {
 		comprobante.FechaVencimiento = &fechaVencimiento.Time
 	}
@@ -164,6 +303,43 @@ func (r *ComprobanteRepository) GetByID(id string) (*models.Comprobante, error)
 	if usuarioCreacion.Valid {
 		comprobante.UsuarioCreacion = usuarioCreacion.String
 	}
+	comprobante.TipoOperacion = tipoOperacion.String
+	comprobante.Emisor.Regimen = emisorRegimen.String
+	comprobante.Receptor.CodigoPais = receptorPais.String
+	comprobante.Emisor.Ubigeo = emisorUbigeo.String
+	comprobante.Receptor.Distrito = receptorDistrito.String
+	comprobante.Receptor.Provincia = receptorProvincia.String
+	comprobante.Receptor.Departamento = receptorDepartamento.String
+	comprobante.Receptor.Ubigeo = receptorUbigeo.String
+	comprobante.OrdenCompra = ordenCompra.String
+	if incoterm.Valid {
+		comprobante.CondicionesEntrega = &models.CondicionesEntrega{
+			Incoterm:     incoterm.String,
+			LugarEntrega: lugarEntrega.String,
+			Ubigeo:       entregaUbigeo.String,
+			CodigoPais:   entregaPais.String,
+		}
+	}
+	if percepcionRegimen.Valid {
+		percepcion.CodigoRegimen = percepcionRegimen.String
+		comprobante.Percepcion = &percepcion
+	}
+	if retencionPorcentaje.Valid {
+		retencion.Porcentaje = retencionPorcentaje.Float64
+		retencion.MontoNeto = math.Round((comprobante.Totales.ImporteTotal-retencion.Monto)*100) / 100
+		comprobante.Retencion = &retencion
+	}
+	if liquidacionPorcentaje.Valid {
+		liquidacion.PorcentajeRenta = liquidacionPorcentaje.Float64
+		liquidacion.MontoNeto = math.Round((comprobante.Totales.ImporteTotal-liquidacion.IGVRetenido-liquidacion.RentaRetenida)*100) / 100
+		comprobante.Liquidacion = &liquidacion
+	}
+	if detraccionCodigo.Valid {
+		detraccion.Codigo = detraccionCodigo.String
+		detraccion.NumeroCuenta = detraccionCuenta.String
+		detraccion.MedioPago = detraccionMedioPago.String
+		comprobante.Detraccion = &detraccion
+	}
 
 	// Cargar items
 	items, err := r.getItems(comprobante.ID)
@@ -179,6 +355,41 @@ func (r *ComprobanteRepository) GetByID(id string) (*models.Comprobante, error)
 	}
 	comprobante.Impuestos = impuestos
 
+	// Cargar cargos y descuentos globales
+	cargosDescuentos, err := r.getCargosDescuentos("comprobante_id", comprobante.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error cargando cargos/descuentos: %v", err)
+	}
+	comprobante.CargosDescuentos = cargosDescuentos
+
+	// Cargar anticipos deducidos
+	anticipos, err := r.getAnticipos(comprobante.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error cargando anticipos: %v", err)
+	}
+	comprobante.Anticipos = anticipos
+
+	// Cargar guías de remisión y documentos relacionados
+	if comprobante.Guias, err = r.getDocumentosRelacionados(comprobante.ID, catalogos.TipoDocumento); err != nil {
+		return nil, fmt.Errorf("error cargando guías de remisión: %v", err)
+	}
+	if comprobante.DocumentosRelacionados, err = r.getDocumentosRelacionados(comprobante.ID, catalogos.DocumentoRelacionado); err != nil {
+		return nil, fmt.Errorf("error cargando documentos relacionados: %v", err)
+	}
+
+	// Cargar forma de pago y cuotas
+	if formaPago.Valid {
+		cuotas, err := r.getCuotas(comprobante.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error cargando cuotas: %v", err)
+		}
+		comprobante.FormaPago = &models.FormaPago{
+			TipoPago:  formaPago.String,
+			Cuotas:    cuotas,
+			MedioPago: formaPagoMedio.String,
+		}
+	}
+
 	// Cargar totales completos
 	totales, err := r.getTotales(comprobante.ID)
 	if err != nil {
@@ -216,6 +427,12 @@ func (r *ComprobanteRepository) List(page, limit int, filters map[string]interfa
 		argIndex++
 	}
 
+	if establecimiento, ok := filters["emisor_establecimiento"]; ok {
+		whereClause += fmt.Sprintf(" AND emisor_establecimiento = $%d", argIndex)
+		args = append(args, establecimiento)
+		argIndex++
+	}
+
 	if fechaDesde, ok := filters["fecha_desde"]; ok {
 		whereClause += fmt.Sprintf(" AND fecha_emision >= $%d", argIndex)
 		args = append(args, fechaDesde)
@@ -239,7 +456,7 @@ func (r *ComprobanteRepository) List(page, limit int, filters map[string]interfa
 	// Obtener datos
 	query := fmt.Sprintf(`
 		SELECT id, tipo, serie, numero, fecha_emision, fecha_vencimiento,
-			emisor_ruc, emisor_razon_social, receptor_razon_social,
+			emisor_ruc, emisor_razon_social, emisor_establecimiento, receptor_razon_social,
 			importe_total, estado_proceso, fecha_creacion
 		FROM comprobantes %s
 		ORDER BY fecha_creacion DESC
@@ -261,13 +478,15 @@ func (r *ComprobanteRepository) List(page, limit int, filters map[string]interfa
 		err := rows.Scan(
 			&comprobante.ID, &comprobante.Tipo, &comprobante.Serie, &comprobante.Numero,
 			&comprobante.FechaEmision, &fechaVencimiento,
-			&comprobante.Emisor.RUC, &comprobante.Emisor.RazonSocial, &comprobante.Receptor.RazonSocial,
+			&comprobante.Emisor.RUC, &comprobante.Emisor.RazonSocial, &comprobante.Emisor.CodigoEstablecimiento,
+			&comprobante.Receptor.RazonSocial,
 			&comprobante.Totales.ImporteTotal, &comprobante.EstadoProceso, &comprobante.FechaCreacion,
 		)
 		if err != nil {
 			return nil, 0, fmt.Errorf("error escaneando comprobante: %v", err)
 		}
 
+		comprobante.FechaEmision = models.HoraPeru(comprobante.FechaEmision)
 		if fechaVencimiento.Valid {
 			comprobante.FechaVencimiento = &fechaVencimiento.Time
 		}
@@ -565,9 +784,162 @@ func (r *ComprobanteRepository) insertItem(tx *sql.Tx, comprobanteID string, ite
 		}
 	}
 
+	// Insertar cargos y descuentos del item
+	for _, cd := range item.CargosDescuentos {
+		if err := r.insertCargoDescuento(tx, nil, &itemID, cd); err != nil {
+			return err
+		}
+	}
+
+	// Insertar propiedades adicionales del item (catálogo 55)
+	for _, propiedad := range item.Propiedades {
+		if err := r.insertPropiedadItem(tx, itemID, propiedad); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+func (r *ComprobanteRepository) insertPropiedadItem(tx *sql.Tx, itemID int64, propiedad models.PropiedadItem) error {
+	query := `
+		INSERT INTO item_propiedades (
+			item_id, codigo, nombre, valor, fecha, hora, cantidad, unidad_medida
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	var cantidad sql.NullFloat64
+	if propiedad.Cantidad != 0 {
+		cantidad = sql.NullFloat64{Float64: propiedad.Cantidad, Valid: true}
+	}
+
+	_, err := tx.Exec(query,
+		itemID, propiedad.Codigo, propiedad.Nombre, nullString(propiedad.Valor), propiedad.Fecha,
+		nullString(propiedad.Hora), cantidad, nullString(propiedad.UnidadMedida),
+	)
+
+	return err
+}
+
+func (r *ComprobanteRepository) insertCargoDescuento(tx *sql.Tx, comprobanteID *string, itemID *int64, cd models.CargoDescuento) error {
+	query := `
+		INSERT INTO cargos_descuentos (
+			comprobante_id, item_id, es_cargo, codigo, factor, monto, monto_base
+		) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	_, err := tx.Exec(query,
+		comprobanteID, itemID, cd.EsCargo, cd.Codigo, cd.Factor, cd.Monto, cd.MontoBase,
+	)
+
+	return err
+}
+
+// validarAnticipo verifica que el anticipo referenciado haya sido emitido como
+// anticipo, esté aceptado por SUNAT y que su saldo cubra el monto a deducir.
+// Bloquea el anticipo hasta el fin de la transacción y retorna su ID.
+func (r *ComprobanteRepository) validarAnticipo(tx *sql.Tx, comprobante *models.Comprobante, anticipo models.Anticipo) (string, error) {
+	tipo := models.TipoFactura
+	if anticipo.TipoDocumento == "03" {
+		tipo = models.TipoBoleta
+	}
+	rucEmisor := anticipo.EmisorRUC
+	if rucEmisor == "" {
+		rucEmisor = comprobante.Emisor.RUC
+	}
+	referencia := anticipo.Serie + "-" + anticipo.Numero
+
+	query := `
+		SELECT id, es_anticipo, estado_proceso, tipo_moneda, importe_total
+		FROM comprobantes
+		WHERE tipo = $1 AND serie = $2 AND numero = $3 AND emisor_ruc = $4
+		FOR UPDATE`
+
+	var anticipoID, moneda string
+	var esAnticipo bool
+	var estado models.EstadoProceso
+	var importeTotal float64
+	err := tx.QueryRow(query, tipo, anticipo.Serie, anticipo.Numero, rucEmisor).Scan(
+		&anticipoID, &esAnticipo, &estado, &moneda, &importeTotal,
+	)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("%w: %s no encontrado", ErrAnticipoInvalido, referencia)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error obteniendo anticipo %s: %v", referencia, err)
+	}
+
+	if !esAnticipo {
+		return "", fmt.Errorf("%w: %s no fue emitido como anticipo", ErrAnticipoInvalido, referencia)
+	}
+	if estado != models.EstadoAceptado {
+		return "", fmt.Errorf("%w: %s no ha sido aceptado por SUNAT", ErrAnticipoInvalido, referencia)
+	}
+	if moneda != comprobante.TipoMoneda {
+		return "", fmt.Errorf("%w: %s fue emitido en %s", ErrAnticipoInvalido, referencia, moneda)
+	}
+
+	// Monto ya deducido por otros comprobantes vigentes
+	var consumido float64
+	query = `
+		SELECT COALESCE(SUM(a.monto), 0)
+		FROM anticipos a
+		JOIN comprobantes c ON c.id = a.comprobante_id
+		WHERE a.anticipo_id = $1 AND c.estado_proceso NOT IN ($2, $3)`
+	if err := tx.QueryRow(query, anticipoID, models.EstadoRechazado, models.EstadoError).Scan(&consumido); err != nil {
+		return "", fmt.Errorf("error obteniendo saldo del anticipo %s: %v", referencia, err)
+	}
+
+	if consumido+anticipo.Monto > importeTotal+0.005 {
+		return "", fmt.Errorf("%w: %s tiene saldo %.2f y se intenta deducir %.2f",
+			ErrAnticipoInvalido, referencia, importeTotal-consumido, anticipo.Monto)
+	}
+
+	return anticipoID, nil
+}
+
+func (r *ComprobanteRepository) insertAnticipo(tx *sql.Tx, comprobanteID, anticipoID string, anticipo models.Anticipo) error {
+	query := `
+		INSERT INTO anticipos (
+			comprobante_id, anticipo_id, tipo_documento, serie, numero,
+			emisor_ruc, monto, codigo_descuento, fecha_pago
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	_, err := tx.Exec(query,
+		comprobanteID, anticipoID, anticipo.TipoDocumento, anticipo.Serie, anticipo.Numero,
+		nullString(anticipo.EmisorRUC), anticipo.Monto, nullString(anticipo.CodigoDescuento), anticipo.FechaPago,
+	)
+
+	return err
+}
+
+// codigoEstablecimiento retorna el establecimiento desde el que se emite el
+// comprobante; sin código se emite desde el domicilio fiscal
+func codigoEstablecimiento(emisor models.Emisor) string {
+	if emisor.CodigoEstablecimiento == "" {
+		return models.EstablecimientoDomicilioFiscal
+	}
+	return emisor.CodigoEstablecimiento
+}
+
+func (r *ComprobanteRepository) insertCuota(tx *sql.Tx, comprobanteID string, cuota models.Cuota) error {
+	query := `
+		INSERT INTO cuotas (comprobante_id, numero, fecha_vencimiento, monto)
+		VALUES ($1, $2, $3, $4)`
+
+	_, err := tx.Exec(query, comprobanteID, cuota.NumeroCuota, cuota.FechaVencimiento, cuota.Monto)
+	return err
+}
+
+// insertDocumentoRelacionado guarda una guía de remisión (catálogo 01) o un
+// documento relacionado (catálogo 12)
+func (r *ComprobanteRepository) insertDocumentoRelacionado(tx *sql.Tx, comprobanteID, catalogo string, documento models.DocumentoRelacionado) error {
+	query := `
+		INSERT INTO documentos_relacionados (comprobante_id, catalogo, tipo_documento, numero)
+		VALUES ($1, $2, $3, $4)`
+
+	_, err := tx.Exec(query, comprobanteID, catalogo, documento.TipoDocumento, documento.Numero)
+	return err
+}
+
 func (r *ComprobanteRepository) insertImpuesto(tx *sql.Tx, comprobanteID string, itemID *int64, impuesto models.Impuesto) error {
 	query := `
 		INSERT INTO impuestos (
@@ -603,15 +975,19 @@ func (r *ComprobanteRepository) insertTotales(tx *sql.Tx, comprobanteID string,
 		INSERT INTO totales (
 			comprobante_id, total_venta_gravada, total_venta_exonerada,
 			total_venta_inafecta, total_venta_gratuita, total_descuentos,
+			total_cargos, total_descuentos_base, total_cargos_base,
 			total_anticipos, total_impuestos, total_valor_venta,
-			total_precio_venta, redondeo, importe_total
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+			total_precio_venta, redondeo, importe_total, total_venta_exportacion,
+			total_venta_ivap
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)`
 
 	_, err := tx.Exec(query,
 		comprobanteID, totales.TotalVentaGravada, totales.TotalVentaExonerada,
 		totales.TotalVentaInafecta, totales.TotalVentaGratuita, totales.TotalDescuentos,
+		totales.TotalCargos, totales.TotalDescuentosBase, totales.TotalCargosBase,
 		totales.TotalAnticipos, totales.TotalImpuestos, totales.TotalValorVenta,
-		totales.TotalPrecioVenta, totales.Redondeo, totales.ImporteTotal,
+		totales.TotalPrecioVenta, totales.Redondeo, totales.ImporteTotal, totales.TotalVentaExportacion,
+		totales.TotalVentaIVAP,
 	)
 
 	return err
@@ -656,6 +1032,20 @@ func (r *ComprobanteRepository) getItems(comprobanteID string) ([]models.Item, e
 		}
 		item.ImpuestoItem = impuestosItem
 
+		// Cargar cargos y descuentos del item
+		cargosDescuentos, err := r.getCargosDescuentos("item_id", itemIDDB)
+		if err != nil {
+			return nil, err
+		}
+		item.CargosDescuentos = cargosDescuentos
+
+		// Cargar propiedades adicionales del item
+		propiedades, err := r.getPropiedadesItem(itemIDDB)
+		if err != nil {
+			return nil, err
+		}
+		item.Propiedades = propiedades
+
 		items = append(items, item)
 	}
 
@@ -717,20 +1107,158 @@ func (r *ComprobanteRepository) getImpuestosItem(itemID int64) ([]models.Impuest
 	return impuestos, nil
 }
 
+// getCargosDescuentos obtiene los cargos/descuentos de un comprobante o de un item
+func (r *ComprobanteRepository) getCargosDescuentos(columna string, id interface{}) ([]models.CargoDescuento, error) {
+	query := fmt.Sprintf(`
+		SELECT es_cargo, codigo, factor, monto, monto_base
+		FROM cargos_descuentos WHERE %s = $1 ORDER BY id`, columna)
+
+	rows, err := r.db.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cargosDescuentos []models.CargoDescuento
+	for rows.Next() {
+		var cd models.CargoDescuento
+		if err := rows.Scan(&cd.EsCargo, &cd.Codigo, &cd.Factor, &cd.Monto, &cd.MontoBase); err != nil {
+			return nil, err
+		}
+		cargosDescuentos = append(cargosDescuentos, cd)
+	}
+
+	return cargosDescuentos, nil
+}
+
+func (r *ComprobanteRepository) getPropiedadesItem(itemID int64) ([]models.PropiedadItem, error) {
+	query := `
+		SELECT codigo, nombre, valor, fecha, to_char(hora, 'HH24:MI:SS'), cantidad, unidad_medida
+		FROM item_propiedades WHERE item_id = $1 ORDER BY id`
+
+	rows, err := r.db.Query(query, itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var propiedades []models.PropiedadItem
+	for rows.Next() {
+		var propiedad models.PropiedadItem
+		var valor, hora, unidadMedida sql.NullString
+		var fecha sql.NullTime
+		var cantidad sql.NullFloat64
+		if err := rows.Scan(&propiedad.Codigo, &propiedad.Nombre, &valor, &fecha, &hora, &cantidad, &unidadMedida); err != nil {
+			return nil, err
+		}
+		propiedad.Valor = valor.String
+		propiedad.Hora = hora.String
+		propiedad.Cantidad = cantidad.Float64
+		propiedad.UnidadMedida = unidadMedida.String
+		if fecha.Valid {
+			propiedad.Fecha = &fecha.Time
+		}
+		propiedades = append(propiedades, propiedad)
+	}
+
+	return propiedades, nil
+}
+
+func (r *ComprobanteRepository) getCuotas(comprobanteID string) ([]models.Cuota, error) {
+	query := `
+		SELECT numero, fecha_vencimiento, monto
+		FROM cuotas WHERE comprobante_id = $1 ORDER BY numero`
+
+	rows, err := r.db.Query(query, comprobanteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cuotas []models.Cuota
+	for rows.Next() {
+		var cuota models.Cuota
+		if err := rows.Scan(&cuota.NumeroCuota, &cuota.FechaVencimiento, &cuota.Monto); err != nil {
+			return nil, err
+		}
+		cuotas = append(cuotas, cuota)
+	}
+
+	return cuotas, nil
+}
+
+func (r *ComprobanteRepository) getDocumentosRelacionados(comprobanteID, catalogo string) ([]models.DocumentoRelacionado, error) {
+	query := `
+		SELECT tipo_documento, numero
+		FROM documentos_relacionados WHERE comprobante_id = $1 AND catalogo = $2 ORDER BY id`
+
+	rows, err := r.db.Query(query, comprobanteID, catalogo)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var documentos []models.DocumentoRelacionado
+	for rows.Next() {
+		var documento models.DocumentoRelacionado
+		if err := rows.Scan(&documento.TipoDocumento, &documento.Numero); err != nil {
+			return nil, err
+		}
+		documentos = append(documentos, documento)
+	}
+
+	return documentos, nil
+}
+
+func (r *ComprobanteRepository) getAnticipos(comprobanteID string) ([]models.Anticipo, error) {
+	query := `
+		SELECT tipo_documento, serie, numero, emisor_ruc, monto, codigo_descuento, fecha_pago
+		FROM anticipos WHERE comprobante_id = $1 ORDER BY id`
+
+	rows, err := r.db.Query(query, comprobanteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var anticipos []models.Anticipo
+	for rows.Next() {
+		var anticipo models.Anticipo
+		var emisorRUC, codigoDescuento sql.NullString
+		var fechaPago sql.NullTime
+		if err := rows.Scan(&anticipo.TipoDocumento, &anticipo.Serie, &anticipo.Numero,
+			&emisorRUC, &anticipo.Monto, &codigoDescuento, &fechaPago); err != nil {
+			return nil, err
+		}
+		anticipo.EmisorRUC = emisorRUC.String
+		anticipo.CodigoDescuento = codigoDescuento.String
+		if fechaPago.Valid {
+			anticipo.FechaPago = &fechaPago.Time
+		}
+		anticipos = append(anticipos, anticipo)
+	}
+
+	return anticipos, nil
+}
+
 func (r *ComprobanteRepository) getTotales(comprobanteID string) (models.Totales, error) {
 	query := `
 		SELECT total_venta_gravada, total_venta_exonerada, total_venta_inafecta,
-			total_venta_gratuita, total_descuentos, total_anticipos,
+			total_venta_gratuita, total_descuentos, COALESCE(total_cargos, 0),
+			COALESCE(total_descuentos_base, 0), COALESCE(total_cargos_base, 0), total_anticipos,
 			total_impuestos, total_valor_venta, total_precio_venta,
-			redondeo, importe_total
+			redondeo, importe_total, COALESCE(total_venta_exportacion, 0),
+			COALESCE(total_venta_ivap, 0)
 		FROM totales WHERE comprobante_id = $1`
 
 	var totales models.Totales
 	err := r.db.QueryRow(query, comprobanteID).Scan(
 		&totales.TotalVentaGravada, &totales.TotalVentaExonerada, &totales.TotalVentaInafecta,
-		&totales.TotalVentaGratuita, &totales.TotalDescuentos, &totales.TotalAnticipos,
+		&totales.TotalVentaGratuita, &totales.TotalDescuentos, &totales.TotalCargos,
+		&totales.TotalDescuentosBase, &totales.TotalCargosBase, &totales.TotalAnticipos,
 		&totales.TotalImpuestos, &totales.TotalValorVenta, &totales.TotalPrecioVenta,
-		&totales.Redondeo, &totales.ImporteTotal,
+		&totales.Redondeo, &totales.ImporteTotal, &totales.TotalVentaExportacion,
+		&totales.TotalVentaIVAP,
 	)
 
 	if err == sql.ErrNoRows {
@@ -0,0 +1,265 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"facturacion_sunat_api_go/internal/models"
+	"fmt"
+	"strings"
+)
+
+// ErrContribuyenteNoEncontrado indica que el RUC no figura en el padrón importado
+var ErrContribuyenteNoEncontrado = errors.New("contribuyente no encontrado en el padrón")
+
+// columnasContribuyente son las columnas que se cargan desde el padrón, en el
+// orden en que GuardarLote envía los parámetros
+var columnasContribuyente = []string{
+	"ruc", "razon_social", "estado", "condicion_domicilio", "ubigeo",
+	"tipo_via", "nombre_via", "codigo_zona", "tipo_zona", "numero",
+	"interior", "lote", "dpto", "manzana", "kilometro", "huella",
+}
+
+type ContribuyenteRepository struct {
+	db *sql.DB
+}
+
+func NewContribuyenteRepository(db *sql.DB) *ContribuyenteRepository {
+	return &ContribuyenteRepository{
+		db: db,
+	}
+}
+
+// GetByRUC obtiene un contribuyente del padrón
+func (r *ContribuyenteRepository) GetByRUC(ruc string) (*models.Contribuyente, error) {
+	query := `
+		SELECT ruc, razon_social, estado, condicion_domicilio, COALESCE(ubigeo, ''),
+			COALESCE(tipo_via, ''), COALESCE(nombre_via, ''), COALESCE(codigo_zona, ''), COALESCE(tipo_zona, ''),
+			COALESCE(numero, ''), COALESCE(interior, ''), COALESCE(lote, ''), COALESCE(dpto, ''),
+			COALESCE(manzana, ''), COALESCE(kilometro, ''), huella, fecha_actualizacion
+		FROM contribuyentes
+		WHERE ruc = $1`
+
+	var c models.Contribuyente
+	err := r.db.QueryRow(query, ruc).Scan(
+		&c.RUC, &c.RazonSocial, &c.Estado, &c.CondicionDomicilio, &c.Ubigeo,
+		&c.TipoVia, &c.NombreVia, &c.CodigoZona, &c.TipoZona,
+		&c.Numero, &c.Interior, &c.Lote, &c.Dpto,
+		&c.Manzana, &c.Kilometro, &c.Huella, &c.FechaActualizacion,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrContribuyenteNoEncontrado, ruc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo contribuyente: %v", err)
+	}
+
+	return &c, nil
+}
+
+// GuardarLote inserta o actualiza un lote de contribuyentes en una sola
+// sentencia. Los registros cuya huella no cambió no se reescriben, de modo que
+// refrescar el padrón solo toca las filas modificadas.
+func (r *ContribuyenteRepository) GuardarLote(contribuyentes []models.Contribuyente) (insertados, actualizados int64, err error) {
+	if len(contribuyentes) == 0 {
+		return 0, 0, nil
+	}
+
+	var query strings.Builder
+	query.WriteString("INSERT INTO contribuyentes (" + strings.Join(columnasContribuyente, ", ") + ") VALUES ")
+	args := make([]interface{}, 0, len(contribuyentes)*len(columnasContribuyente))
+	for i, c := range contribuyentes {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString("(")
+		for j := range columnasContribuyente {
+			if j > 0 {
+				query.WriteString(", ")
+			}
+			fmt.Fprintf(&query, "$%d", len(args)+j+1)
+		}
+		query.WriteString(")")
+		args = append(args,
+			c.RUC, c.RazonSocial, c.Estado, c.CondicionDomicilio, nullString(c.Ubigeo),
+			nullString(c.TipoVia), nullString(c.NombreVia), nullString(c.CodigoZona), nullString(c.TipoZona), nullString(c.Numero),
+			nullString(c.Interior), nullString(c.Lote), nullString(c.Dpto), nullString(c.Manzana), nullString(c.Kilometro), c.Huella,
+		)
+	}
+
+	query.WriteString(" ON CONFLICT (ruc) DO UPDATE SET ")
+	for i, columna := range columnasContribuyente[1:] {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString(columna + " = EXCLUDED." + columna)
+	}
+	query.WriteString(", fecha_actualizacion = CURRENT_TIMESTAMP")
+	query.WriteString(" WHERE contribuyentes.huella <> EXCLUDED.huella")
+	// xmax es cero en las filas recién insertadas y distinto de cero en las actualizadas
+	query.WriteString(" RETURNING (xmax = 0)")
+
+	rows, err := r.db.Query(query.String(), args...)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error guardando lote de contribuyentes: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var insertado bool
+		if err := rows.Scan(&insertado); err != nil {
+			return 0, 0, fmt.Errorf("error escaneando resultado del lote: %v", err)
+		}
+		if insertado {
+			insertados++
+		} else {
+			actualizados++
+		}
+	}
+
+	return insertados, actualizados, rows.Err()
+}
+
+// IniciarImportacion registra el inicio de una carga de un padrón
+func (r *ContribuyenteRepository) IniciarImportacion(padron, archivo string) (int64, error) {
+	var id int64
+	err := r.db.QueryRow(`INSERT INTO padron_importaciones (padron, archivo) VALUES ($1, $2) RETURNING id`, padron, archivo).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error registrando importación del padrón: %v", err)
+	}
+	return id, nil
+}
+
+// FinalizarImportacion guarda el resultado de una carga de un padrón
+func (r *ContribuyenteRepository) FinalizarImportacion(importacion *models.ImportacionPadron) error {
+	query := `
+		UPDATE padron_importaciones
+		SET estado = $2, leidos = $3, insertados = $4, actualizados = $5, rechazados = $6,
+			error = $7, fecha_fin = $8, eliminados = $9
+		WHERE id = $1`
+
+	_, err := r.db.Exec(query, importacion.ID, importacion.Estado, importacion.Leidos, importacion.Insertados,
+		importacion.Actualizados, importacion.Rechazados, nullString(importacion.Error), importacion.FechaFin,
+		importacion.Eliminados)
+	if err != nil {
+		return fmt.Errorf("error finalizando importación del padrón: %v", err)
+	}
+	return nil
+}
+
+// UltimaImportacion obtiene la última carga completa de un padrón, o nil si
+// todavía no se ha importado
+func (r *ContribuyenteRepository) UltimaImportacion(padron string) (*models.ImportacionPadron, error) {
+	query := `
+		SELECT id, padron, archivo, estado, leidos, insertados, actualizados, eliminados, rechazados,
+			COALESCE(error, ''), fecha_inicio, fecha_fin
+		FROM padron_importaciones
+		WHERE padron = $1 AND estado = 'COMPLETADO'
+		ORDER BY fecha_fin DESC
+		LIMIT 1`
+
+	var importacion models.ImportacionPadron
+	var fechaFin sql.NullTime
+	err := r.db.QueryRow(query, padron).Scan(
+		&importacion.ID, &importacion.Padron, &importacion.Archivo, &importacion.Estado, &importacion.Leidos,
+		&importacion.Insertados, &importacion.Actualizados, &importacion.Eliminados, &importacion.Rechazados,
+		&importacion.Error, &importacion.FechaInicio, &fechaFin,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo la última importación del padrón: %v", err)
+	}
+	if fechaFin.Valid {
+		importacion.FechaFin = &fechaFin.Time
+	}
+
+	return &importacion, nil
+}
+
+// GetInscripciones obtiene los padrones de agentes y de buenos contribuyentes
+// en los que figura un RUC
+func (r *ContribuyenteRepository) GetInscripciones(ruc string) ([]models.InscripcionPadron, error) {
+	query := `
+		SELECT padron, ruc, razon_social, fecha_inicio, COALESCE(resolucion, '')
+		FROM padron_inscripciones
+		WHERE ruc = $1
+		ORDER BY padron`
+
+	rows, err := r.db.Query(query, ruc)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando padrones del RUC %s: %v", ruc, err)
+	}
+	defer rows.Close()
+
+	var inscripciones []models.InscripcionPadron
+	for rows.Next() {
+		var inscripcion models.InscripcionPadron
+		var fechaInicio sql.NullTime
+		if err := rows.Scan(&inscripcion.Padron, &inscripcion.RUC, &inscripcion.RazonSocial,
+			&fechaInicio, &inscripcion.Resolucion); err != nil {
+			return nil, fmt.Errorf("error escaneando inscripción: %v", err)
+		}
+		if fechaInicio.Valid {
+			inscripcion.FechaInicio = &fechaInicio.Time
+		}
+		inscripciones = append(inscripciones, inscripcion)
+	}
+
+	return inscripciones, rows.Err()
+}
+
+// GuardarInscripciones inserta o actualiza un lote de un padrón de agentes o de
+// buenos contribuyentes y marca cada registro con la carga que lo incluyó
+func (r *ContribuyenteRepository) GuardarInscripciones(importacionID int64, inscripciones []models.InscripcionPadron) (insertados, actualizados int64, err error) {
+	if len(inscripciones) == 0 {
+		return 0, 0, nil
+	}
+
+	var query strings.Builder
+	query.WriteString("INSERT INTO padron_inscripciones (padron, ruc, razon_social, fecha_inicio, resolucion, importacion_id) VALUES ")
+	args := make([]interface{}, 0, len(inscripciones)*6)
+	for i, inscripcion := range inscripciones {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		n := len(args)
+		fmt.Fprintf(&query, "($%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6)
+		args = append(args, inscripcion.Padron, inscripcion.RUC, inscripcion.RazonSocial,
+			inscripcion.FechaInicio, nullString(inscripcion.Resolucion), importacionID)
+	}
+	query.WriteString(` ON CONFLICT (padron, ruc) DO UPDATE SET
+		razon_social = EXCLUDED.razon_social, fecha_inicio = EXCLUDED.fecha_inicio,
+		resolucion = EXCLUDED.resolucion, importacion_id = EXCLUDED.importacion_id
+		RETURNING (xmax = 0)`)
+
+	rows, err := r.db.Query(query.String(), args...)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error guardando lote del padrón: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var insertado bool
+		if err := rows.Scan(&insertado); err != nil {
+			return 0, 0, fmt.Errorf("error escaneando resultado del lote: %v", err)
+		}
+		if insertado {
+			insertados++
+		} else {
+			actualizados++
+		}
+	}
+
+	return insertados, actualizados, rows.Err()
+}
+
+// DepurarPadron elimina los RUC que dejaron de figurar en un padrón, es decir,
+// los que no fueron incluidos por la carga indicada
+func (r *ContribuyenteRepository) DepurarPadron(padron string, importacionID int64) (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM padron_inscripciones WHERE padron = $1 AND importacion_id <> $2`, padron, importacionID)
+	if err != nil {
+		return 0, fmt.Errorf("error depurando el padrón %s: %v", padron, err)
+	}
+	return result.RowsAffected()
+}
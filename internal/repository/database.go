@@ -3,7 +3,9 @@ package repository
 import (
 	"database/sql"
 	"facturacion_sunat_api_go/internal/config"
+	"facturacion_sunat_api_go/internal/models"
 	"fmt"
+	"math"
 	"time"
 )
 
@@ -45,9 +47,11 @@ func InitDatabase(config config.DatabaseConfig) (*sql.DB, error) {
 	return db, nil
 }
 
-// buildPostgreSQLDSN construye la cadena de conexión para PostgreSQL
+// buildPostgreSQLDSN construye la cadena de conexión para PostgreSQL. La sesión
+// usa la zona horaria de Lima para que las conversiones a fecha en SQL
+// (fecha_emision::date, CURRENT_DATE) coincidan con el día de emisión.
 func buildPostgreSQLDSN(config config.DatabaseConfig) string {
-	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s timezone=America/Lima",
 		config.Host,
 		config.Port,
 		config.User,
@@ -88,6 +92,19 @@ func createTables(db *sql.DB) error {
 		createConfiguracionTable(),
 		createCertificadosTable(),
 		createLotesTable(),
+		createCargosDescuentosTable(),
+		alterTables(),
+		createAnticiposTable(),
+		createCuotasTable(),
+		createDocumentosRelacionadosTable(),
+		createItemPropiedadesTable(),
+		createTasasImpuestosTable(),
+		createContribuyentesTable(),
+		createPadronImportacionesTable(),
+		createPadronInscripcionesTable(),
+		createTiposCambioTable(),
+		createEstablecimientosTable(),
+		createEstablecimientoSeriesTable(),
 		createIndices(),
 	}
 
@@ -104,12 +121,13 @@ func createComprobantesTable() string {
 	return `
 	CREATE TABLE IF NOT EXISTS comprobantes (
 		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		tipo INTEGER NOT NULL CHECK (tipo IN (1, 2, 3, 4)),
+		tipo INTEGER NOT NULL CHECK (tipo IN (1, 2, 3, 4, 5)),
 		serie VARCHAR(10) NOT NULL,
 		numero VARCHAR(20) NOT NULL,
 		fecha_emision TIMESTAMP WITH TIME ZONE NOT NULL,
 		fecha_vencimiento TIMESTAMP WITH TIME ZONE,
 		tipo_moneda VARCHAR(3) NOT NULL DEFAULT 'PEN',
+		tipo_operacion VARCHAR(4),
 		
 		-- Emisor
 		emisor_ruc VARCHAR(11) NOT NULL,
@@ -122,6 +140,8 @@ func createComprobantesTable() string {
 		emisor_pais VARCHAR(3) NOT NULL DEFAULT 'PE',
 		emisor_telefono VARCHAR(20),
 		emisor_email VARCHAR(100),
+		emisor_regimen VARCHAR(30),
+		emisor_establecimiento VARCHAR(4) NOT NULL DEFAULT '0000',
 		
 		-- Receptor
 		receptor_tipo_documento VARCHAR(2) NOT NULL,
@@ -129,6 +149,47 @@ func createComprobantesTable() string {
 		receptor_razon_social VARCHAR(500) NOT NULL,
 		receptor_direccion VARCHAR(500),
 		receptor_email VARCHAR(100),
+		receptor_pais VARCHAR(2),
+		
+		-- Condiciones de entrega (exportación)
+		incoterm VARCHAR(3),
+		lugar_entrega VARCHAR(500),
+		entrega_pais VARCHAR(2),
+		
+		-- Percepción (catálogo 53: 51, 52, 53)
+		percepcion_regimen VARCHAR(2),
+		percepcion_porcentaje DECIMAL(5,2) NOT NULL DEFAULT 0,
+		percepcion_base DECIMAL(15,2) NOT NULL DEFAULT 0,
+		percepcion_monto DECIMAL(15,2) NOT NULL DEFAULT 0 CHECK (percepcion_monto >= 0),
+		percepcion_total DECIMAL(15,2) NOT NULL DEFAULT 0,
+		
+		-- Retención del IGV (catálogo 53: 62)
+		retencion_porcentaje DECIMAL(5,2),
+		retencion_base DECIMAL(15,2) NOT NULL DEFAULT 0,
+		retencion_monto DECIMAL(15,2) NOT NULL DEFAULT 0 CHECK (retencion_monto >= 0),
+		
+		-- Liquidación de compra: IGV y renta retenidos al vendedor
+		liquidacion_porcentaje_renta DECIMAL(5,2),
+		liquidacion_igv DECIMAL(15,2) NOT NULL DEFAULT 0,
+		liquidacion_base_renta DECIMAL(15,2) NOT NULL DEFAULT 0,
+		liquidacion_renta DECIMAL(15,2) NOT NULL DEFAULT 0 CHECK (liquidacion_renta >= 0),
+		
+		-- Detracción (catálogo 54), montos en soles
+		detraccion_codigo VARCHAR(3),
+		detraccion_cuenta VARCHAR(30),
+		detraccion_medio_pago VARCHAR(3),
+		detraccion_porcentaje DECIMAL(5,2) NOT NULL DEFAULT 0,
+		detraccion_valor_referencial DECIMAL(15,2) NOT NULL DEFAULT 0,
+		detraccion_tipo_cambio DECIMAL(10,4) NOT NULL DEFAULT 0,
+		detraccion_base DECIMAL(15,2) NOT NULL DEFAULT 0,
+		detraccion_monto DECIMAL(15,2) NOT NULL DEFAULT 0 CHECK (detraccion_monto >= 0),
+		
+		-- Forma de pago (Contado o Credito) y medio de pago (catálogo 59)
+		forma_pago VARCHAR(10),
+		forma_pago_medio VARCHAR(3),
+		
+		-- Orden de compra del adquirente (cac:OrderReference)
+		orden_compra VARCHAR(20),
 		
 		-- Totales calculados
 		total_valor_venta DECIMAL(15,2) DEFAULT 0 CHECK (total_valor_venta >= 0),
@@ -147,6 +208,7 @@ func createComprobantesTable() string {
 		cdr_sunat BYTEA,
 		estado_sunat VARCHAR(50),
 		observaciones TEXT,
+		es_anticipo BOOLEAN NOT NULL DEFAULT false,
 		
 		-- Auditoría
 		fecha_creacion TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
@@ -221,7 +283,12 @@ func createTotalesTable() string {
 		total_venta_exonerada DECIMAL(15,2) DEFAULT 0 CHECK (total_venta_exonerada >= 0),
 		total_venta_inafecta DECIMAL(15,2) DEFAULT 0 CHECK (total_venta_inafecta >= 0),
 		total_venta_gratuita DECIMAL(15,2) DEFAULT 0 CHECK (total_venta_gratuita >= 0),
+		total_venta_exportacion DECIMAL(15,2) DEFAULT 0 CHECK (total_venta_exportacion >= 0),
+		total_venta_ivap DECIMAL(15,2) DEFAULT 0 CHECK (total_venta_ivap >= 0),
 		total_descuentos DECIMAL(15,2) DEFAULT 0 CHECK (total_descuentos >= 0),
+		total_cargos DECIMAL(15,2) DEFAULT 0 CHECK (total_cargos >= 0),
+		total_descuentos_base DECIMAL(15,2) DEFAULT 0 CHECK (total_descuentos_base >= 0),
+		total_cargos_base DECIMAL(15,2) DEFAULT 0 CHECK (total_cargos_base >= 0),
 		total_anticipos DECIMAL(15,2) DEFAULT 0 CHECK (total_anticipos >= 0),
 		total_impuestos DECIMAL(15,2) DEFAULT 0 CHECK (total_impuestos >= 0),
 		total_valor_venta DECIMAL(15,2) DEFAULT 0 CHECK (total_valor_venta >= 0),
@@ -322,6 +389,301 @@ func createLotesTable() string {
 	);`
 }
 
+func createCargosDescuentosTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS cargos_descuentos (
+		id BIGSERIAL PRIMARY KEY,
+		comprobante_id UUID,
+		item_id BIGINT,
+		es_cargo BOOLEAN NOT NULL DEFAULT false,
+		codigo VARCHAR(2) NOT NULL,
+		factor DECIMAL(10,5) DEFAULT 0 CHECK (factor >= 0),
+		monto DECIMAL(15,2) NOT NULL CHECK (monto >= 0),
+		monto_base DECIMAL(15,2) DEFAULT 0 CHECK (monto_base >= 0),
+		
+		-- Auditoría
+		fecha_creacion TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		
+		CONSTRAINT fk_cargos_descuentos_comprobante FOREIGN KEY (comprobante_id) 
+			REFERENCES comprobantes(id) ON DELETE CASCADE,
+		CONSTRAINT fk_cargos_descuentos_item FOREIGN KEY (item_id) 
+			REFERENCES items(id) ON DELETE CASCADE,
+		CONSTRAINT chk_cargo_descuento_referencia CHECK (
+			(comprobante_id IS NOT NULL AND item_id IS NULL) OR
+			(comprobante_id IS NULL AND item_id IS NOT NULL)
+		)
+	);`
+}
+
+// createAnticiposTable registra los anticipos deducidos por cada comprobante;
+// anticipo_id apunta al comprobante de anticipo para controlar su saldo
+func createAnticiposTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS anticipos (
+		id BIGSERIAL PRIMARY KEY,
+		comprobante_id UUID NOT NULL,
+		anticipo_id UUID NOT NULL,
+		tipo_documento VARCHAR(2) NOT NULL CHECK (tipo_documento IN ('02', '03')),
+		serie VARCHAR(10) NOT NULL,
+		numero VARCHAR(20) NOT NULL,
+		emisor_ruc VARCHAR(11),
+		monto DECIMAL(15,2) NOT NULL CHECK (monto > 0),
+		codigo_descuento VARCHAR(2),
+		fecha_pago TIMESTAMP WITH TIME ZONE,
+		
+		-- Auditoría
+		fecha_creacion TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		
+		CONSTRAINT fk_anticipos_comprobante FOREIGN KEY (comprobante_id) 
+			REFERENCES comprobantes(id) ON DELETE CASCADE,
+		CONSTRAINT fk_anticipos_anticipo FOREIGN KEY (anticipo_id) 
+			REFERENCES comprobantes(id)
+	);`
+}
+
+// createCuotasTable registra las cuotas de los comprobantes emitidos al crédito
+func createCuotasTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS cuotas (
+		id BIGSERIAL PRIMARY KEY,
+		comprobante_id UUID NOT NULL,
+		numero INTEGER NOT NULL CHECK (numero > 0),
+		fecha_vencimiento DATE NOT NULL,
+		monto DECIMAL(15,2) NOT NULL CHECK (monto > 0),
+		
+		CONSTRAINT fk_cuotas_comprobante FOREIGN KEY (comprobante_id) 
+			REFERENCES comprobantes(id) ON DELETE CASCADE,
+		CONSTRAINT uk_cuotas_comprobante_numero UNIQUE (comprobante_id, numero)
+	);`
+}
+
+// createDocumentosRelacionadosTable registra las guías de remisión (catálogo 01)
+// y los demás documentos relacionados (catálogo 12) de cada comprobante
+func createDocumentosRelacionadosTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS documentos_relacionados (
+		id BIGSERIAL PRIMARY KEY,
+		comprobante_id UUID NOT NULL,
+		catalogo VARCHAR(2) NOT NULL CHECK (catalogo IN ('01', '12')),
+		tipo_documento VARCHAR(2) NOT NULL,
+		numero VARCHAR(30) NOT NULL,
+		
+		CONSTRAINT fk_documentos_relacionados_comprobante FOREIGN KEY (comprobante_id) 
+			REFERENCES comprobantes(id) ON DELETE CASCADE,
+		CONSTRAINT uk_documentos_relacionados UNIQUE (comprobante_id, catalogo, tipo_documento, numero)
+	);`
+}
+
+// createItemPropiedadesTable registra las propiedades adicionales de los ítems
+// (catálogo 55); cada fila guarda el dato en la columna que corresponde a su tipo
+func createItemPropiedadesTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS item_propiedades (
+		id BIGSERIAL PRIMARY KEY,
+		item_id BIGINT NOT NULL,
+		codigo VARCHAR(4) NOT NULL,
+		nombre VARCHAR(100) NOT NULL,
+		valor VARCHAR(100),
+		fecha DATE,
+		hora TIME,
+		cantidad DECIMAL(15,3),
+		unidad_medida VARCHAR(3),
+		
+		CONSTRAINT fk_item_propiedades_item FOREIGN KEY (item_id) 
+			REFERENCES items(id) ON DELETE CASCADE
+	);`
+}
+
+// createTasasImpuestosTable crea la tabla de tasas de impuestos con vigencia
+// por fecha y régimen del emisor (IGV, IPM, ICBPER, ISC)
+func createTasasImpuestosTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS tasas_impuestos (
+		id BIGSERIAL PRIMARY KEY,
+		tributo VARCHAR(10) NOT NULL,
+		regimen VARCHAR(30) NOT NULL DEFAULT 'GENERAL',
+		tasa DECIMAL(9,4) NOT NULL CHECK (tasa >= 0),
+		vigente_desde DATE NOT NULL,
+		vigente_hasta DATE,
+		descripcion VARCHAR(200),
+		
+		-- Auditoría
+		fecha_creacion TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		
+		CONSTRAINT uk_tasas_impuestos_vigencia UNIQUE(tributo, regimen, vigente_desde),
+		CONSTRAINT chk_tasas_impuestos_vigencia CHECK (vigente_hasta IS NULL OR vigente_hasta >= vigente_desde)
+	);`
+}
+
+// createContribuyentesTable crea la tabla con el padrón reducido de RUC de SUNAT
+func createContribuyentesTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS contribuyentes (
+		ruc VARCHAR(11) PRIMARY KEY,
+		razon_social VARCHAR(500) NOT NULL,
+		estado VARCHAR(50) NOT NULL,
+		condicion_domicilio VARCHAR(50) NOT NULL,
+		ubigeo VARCHAR(6),
+		
+		-- Domicilio fiscal
+		tipo_via TEXT,
+		nombre_via TEXT,
+		codigo_zona TEXT,
+		tipo_zona TEXT,
+		numero TEXT,
+		interior TEXT,
+		lote TEXT,
+		dpto TEXT,
+		manzana TEXT,
+		kilometro TEXT,
+		
+		-- Control de refresco incremental
+		huella VARCHAR(16) NOT NULL,
+		fecha_actualizacion TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);`
+}
+
+// createPadronImportacionesTable crea el registro de cargas de los padrones de SUNAT
+func createPadronImportacionesTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS padron_importaciones (
+		id BIGSERIAL PRIMARY KEY,
+		padron VARCHAR(30) NOT NULL DEFAULT 'RUC',
+		archivo VARCHAR(500) NOT NULL,
+		estado VARCHAR(20) NOT NULL DEFAULT 'EN_PROCESO' CHECK (estado IN ('EN_PROCESO', 'COMPLETADO', 'ERROR')),
+		leidos BIGINT NOT NULL DEFAULT 0,
+		insertados BIGINT NOT NULL DEFAULT 0,
+		actualizados BIGINT NOT NULL DEFAULT 0,
+		eliminados BIGINT NOT NULL DEFAULT 0,
+		rechazados BIGINT NOT NULL DEFAULT 0,
+		error TEXT,
+		fecha_inicio TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		fecha_fin TIMESTAMP WITH TIME ZONE
+	);
+	ALTER TABLE padron_importaciones ADD COLUMN IF NOT EXISTS padron VARCHAR(30) NOT NULL DEFAULT 'RUC';
+	ALTER TABLE padron_importaciones ADD COLUMN IF NOT EXISTS eliminados BIGINT NOT NULL DEFAULT 0;`
+}
+
+// createPadronInscripcionesTable crea la tabla con los padrones de agentes de
+// retención, agentes de percepción y buenos contribuyentes. Cada carga reemplaza
+// el padrón completo: los RUC que no figuran en la última carga se eliminan.
+func createPadronInscripcionesTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS padron_inscripciones (
+		padron VARCHAR(30) NOT NULL,
+		ruc VARCHAR(11) NOT NULL,
+		razon_social VARCHAR(500) NOT NULL,
+		fecha_inicio DATE,
+		resolucion VARCHAR(100),
+		importacion_id BIGINT NOT NULL REFERENCES padron_importaciones(id),
+		PRIMARY KEY (padron, ruc)
+	);`
+}
+
+// createEstablecimientosTable crea la tabla del domicilio fiscal (código 0000)
+// y los establecimientos anexos registrados en el RUC de cada emisor
+func createEstablecimientosTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS establecimientos (
+		ruc VARCHAR(11) NOT NULL,
+		codigo VARCHAR(4) NOT NULL CHECK (codigo ~ '^[0-9]{4}$'),
+		nombre VARCHAR(200),
+		direccion VARCHAR(500) NOT NULL,
+		distrito VARCHAR(100),
+		provincia VARCHAR(100),
+		departamento VARCHAR(100),
+		ubigeo VARCHAR(6),
+		codigo_pais VARCHAR(2) NOT NULL DEFAULT 'PE',
+		activo BOOLEAN NOT NULL DEFAULT true,
+		
+		-- Auditoría
+		fecha_creacion TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		fecha_actualizacion TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		
+		PRIMARY KEY (ruc, codigo)
+	);`
+}
+
+// createEstablecimientoSeriesTable asigna cada serie de un RUC a un único establecimiento
+func createEstablecimientoSeriesTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS establecimiento_series (
+		ruc VARCHAR(11) NOT NULL,
+		serie VARCHAR(4) NOT NULL,
+		codigo VARCHAR(4) NOT NULL,
+		
+		PRIMARY KEY (ruc, serie),
+		CONSTRAINT fk_establecimiento_series_establecimiento FOREIGN KEY (ruc, codigo) 
+			REFERENCES establecimientos(ruc, codigo) ON DELETE CASCADE
+	);`
+}
+
+// createTiposCambioTable crea la tabla de tipos de cambio oficiales por día de
+// publicación. Los días sin publicación (fines de semana y feriados) no tienen
+// fila: se usa la del último día hábil.
+func createTiposCambioTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS tipos_cambio (
+		moneda VARCHAR(3) NOT NULL,
+		fecha DATE NOT NULL,
+		compra DECIMAL(10,4) NOT NULL CHECK (compra > 0),
+		venta DECIMAL(10,4) NOT NULL CHECK (venta > 0),
+		fuente VARCHAR(10) NOT NULL,
+		fecha_actualizacion TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (moneda, fecha)
+	);`
+}
+
+// alterTables agrega las columnas nuevas a tablas creadas por versiones anteriores
+func alterTables() string {
+	return `
+	ALTER TABLE totales ADD COLUMN IF NOT EXISTS total_cargos DECIMAL(15,2) DEFAULT 0;
+	ALTER TABLE totales ADD COLUMN IF NOT EXISTS total_descuentos_base DECIMAL(15,2) DEFAULT 0;
+	ALTER TABLE totales ADD COLUMN IF NOT EXISTS total_cargos_base DECIMAL(15,2) DEFAULT 0;
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS es_anticipo BOOLEAN NOT NULL DEFAULT false;
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS tipo_operacion VARCHAR(4);
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS receptor_pais VARCHAR(2);
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS incoterm VARCHAR(3);
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS lugar_entrega VARCHAR(500);
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS entrega_pais VARCHAR(2);
+	ALTER TABLE totales ADD COLUMN IF NOT EXISTS total_venta_exportacion DECIMAL(15,2) DEFAULT 0;
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS percepcion_regimen VARCHAR(2);
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS percepcion_porcentaje DECIMAL(5,2) NOT NULL DEFAULT 0;
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS percepcion_base DECIMAL(15,2) NOT NULL DEFAULT 0;
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS percepcion_monto DECIMAL(15,2) NOT NULL DEFAULT 0;
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS percepcion_total DECIMAL(15,2) NOT NULL DEFAULT 0;
+	ALTER TABLE totales ADD COLUMN IF NOT EXISTS total_venta_ivap DECIMAL(15,2) DEFAULT 0;
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS emisor_regimen VARCHAR(30);
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS emisor_ubigeo VARCHAR(6);
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS emisor_establecimiento VARCHAR(4) NOT NULL DEFAULT '0000';
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS receptor_distrito VARCHAR(100);
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS receptor_provincia VARCHAR(100);
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS receptor_departamento VARCHAR(100);
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS receptor_ubigeo VARCHAR(6);
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS entrega_ubigeo VARCHAR(6);
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS retencion_porcentaje DECIMAL(5,2);
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS retencion_base DECIMAL(15,2) NOT NULL DEFAULT 0;
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS retencion_monto DECIMAL(15,2) NOT NULL DEFAULT 0;
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS detraccion_codigo VARCHAR(3);
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS detraccion_cuenta VARCHAR(30);
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS detraccion_medio_pago VARCHAR(3);
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS detraccion_porcentaje DECIMAL(5,2) NOT NULL DEFAULT 0;
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS detraccion_valor_referencial DECIMAL(15,2) NOT NULL DEFAULT 0;
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS detraccion_tipo_cambio DECIMAL(10,4) NOT NULL DEFAULT 0;
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS detraccion_base DECIMAL(15,2) NOT NULL DEFAULT 0;
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS detraccion_monto DECIMAL(15,2) NOT NULL DEFAULT 0;
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS forma_pago VARCHAR(10);
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS forma_pago_medio VARCHAR(3);
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS orden_compra VARCHAR(20);
+	ALTER TABLE comprobantes DROP CONSTRAINT IF EXISTS comprobantes_tipo_check;
+	ALTER TABLE comprobantes ADD CONSTRAINT comprobantes_tipo_check CHECK (tipo IN (1, 2, 3, 4, 5));
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS liquidacion_porcentaje_renta DECIMAL(5,2);
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS liquidacion_igv DECIMAL(15,2) NOT NULL DEFAULT 0;
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS liquidacion_base_renta DECIMAL(15,2) NOT NULL DEFAULT 0;
+	ALTER TABLE comprobantes ADD COLUMN IF NOT EXISTS liquidacion_renta DECIMAL(15,2) NOT NULL DEFAULT 0;
+	`
+}
+
 func createIndices() string {
 	return `
 	-- Índices para optimizar consultas
@@ -331,6 +693,8 @@ func createIndices() string {
 	CREATE INDEX IF NOT EXISTS idx_comprobantes_receptor_documento ON comprobantes(receptor_numero_documento);
 	CREATE INDEX IF NOT EXISTS idx_comprobantes_ticket_sunat ON comprobantes(ticket_sunat);
 	CREATE INDEX IF NOT EXISTS idx_comprobantes_fecha_creacion ON comprobantes(fecha_creacion);
+	CREATE INDEX IF NOT EXISTS idx_comprobantes_emisor_establecimiento ON comprobantes(emisor_ruc, emisor_establecimiento);
+	CREATE INDEX IF NOT EXISTS idx_comprobantes_percepcion_regimen ON comprobantes(percepcion_regimen) WHERE percepcion_regimen IS NOT NULL;
 	
 	CREATE INDEX IF NOT EXISTS idx_items_comprobante_id ON items(comprobante_id);
 	CREATE INDEX IF NOT EXISTS idx_items_codigo ON items(codigo);
@@ -339,6 +703,12 @@ func createIndices() string {
 	CREATE INDEX IF NOT EXISTS idx_impuestos_item_id ON impuestos(item_id);
 	CREATE INDEX IF NOT EXISTS idx_impuestos_tipo ON impuestos(tipo_impuesto, codigo_impuesto);
 	
+	CREATE INDEX IF NOT EXISTS idx_cargos_descuentos_comprobante_id ON cargos_descuentos(comprobante_id);
+	CREATE INDEX IF NOT EXISTS idx_cargos_descuentos_item_id ON cargos_descuentos(item_id);
+	
+	CREATE INDEX IF NOT EXISTS idx_anticipos_comprobante_id ON anticipos(comprobante_id);
+	CREATE INDEX IF NOT EXISTS idx_anticipos_anticipo_id ON anticipos(anticipo_id);
+	
 	CREATE INDEX IF NOT EXISTS idx_process_log_comprobante_id ON process_log(comprobante_id);
 	CREATE INDEX IF NOT EXISTS idx_process_log_fecha_proceso ON process_log(fecha_proceso);
 	CREATE INDEX IF NOT EXISTS idx_process_log_proceso_estado ON process_log(proceso, estado);
@@ -349,6 +719,10 @@ func createIndices() string {
 	
 	CREATE INDEX IF NOT EXISTS idx_lotes_estado ON lotes(estado);
 	CREATE INDEX IF NOT EXISTS idx_lotes_fecha_creacion ON lotes(fecha_creacion);
+	
+	CREATE INDEX IF NOT EXISTS idx_padron_importaciones_estado ON padron_importaciones(estado, fecha_fin);
+	CREATE INDEX IF NOT EXISTS idx_padron_importaciones_padron ON padron_importaciones(padron, estado, fecha_fin);
+	CREATE INDEX IF NOT EXISTS idx_padron_inscripciones_ruc ON padron_inscripciones(ruc);
 	`
 }
 
@@ -364,7 +738,6 @@ func insertInitialData(db *sql.DB) error {
 		{"empresa_razon_social", "MI EMPRESA SAC", "Razón social de la empresa", "string"},
 		{"serie_factura_default", "F001", "Serie por defecto para facturas", "string"},
 		{"serie_boleta_default", "B001", "Serie por defecto para boletas", "string"},
-		{"igv_rate", "18.00", "Tasa de IGV", "decimal"},
 		{"auto_calculate_totals", "true", "Calcular totales automáticamente", "boolean"},
 		{"auto_send_sunat", "false", "Enviar automáticamente a SUNAT", "boolean"},
 		{"backup_xml", "true", "Respaldar archivos XML", "boolean"},
@@ -386,6 +759,19 @@ func insertInitialData(db *sql.DB) error {
 		}
 	}
 
+	// Insertar tasas de impuestos conocidas sin sobrescribir las actualizadas
+	for _, tasa := range models.TasasPorDefecto {
+		query := `
+		INSERT INTO tasas_impuestos (tributo, regimen, tasa, vigente_desde, vigente_hasta, descripcion)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (tributo, regimen, vigente_desde) DO NOTHING`
+
+		_, err := db.Exec(query, tasa.Tributo, tasa.Regimen, tasa.Tasa, tasa.VigenteDesde, tasa.VigenteHasta, tasa.Descripcion)
+		if err != nil {
+			return fmt.Errorf("error insertando tasa de %s: %v", tasa.Tributo, err)
+		}
+	}
+
 	return nil
 }
 
@@ -468,6 +854,109 @@ func GetDatabaseStats(db *sql.DB) (map[string]interface{}, error) {
 		"aceptados": aceptadosSemana,
 	}
 
+	// Percepciones cobradas por régimen
+	queryPercepciones := `
+	SELECT percepcion_regimen, COUNT(*), COALESCE(SUM(percepcion_monto), 0)
+	FROM comprobantes
+	WHERE percepcion_regimen IS NOT NULL
+	GROUP BY percepcion_regimen
+	ORDER BY percepcion_regimen`
+
+	rows3, err := db.Query(queryPercepciones)
+	if err != nil {
+		return nil, err
+	}
+	defer rows3.Close()
+
+	percepciones := make(map[string]map[string]interface{})
+	for rows3.Next() {
+		var regimen string
+		var cantidad int
+		var monto float64
+		if err := rows3.Scan(&regimen, &cantidad, &monto); err != nil {
+			return nil, err
+		}
+		percepciones[regimen] = map[string]interface{}{
+			"comprobantes": cantidad,
+			"monto":        monto,
+		}
+	}
+	stats["percepciones_por_regimen"] = percepciones
+
+	// Ventas por moneda con su equivalente en soles al tipo de cambio venta de
+	// la fecha de emisión (o del último día hábil anterior)
+	queryMonedas := `
+	SELECT c.tipo_moneda, COUNT(*), COALESCE(SUM(c.importe_total), 0),
+		COALESCE(SUM(c.importe_total * CASE WHEN c.tipo_moneda = 'PEN' THEN 1 ELSE tc.venta END), 0),
+		COUNT(*) FILTER (WHERE c.tipo_moneda <> 'PEN' AND tc.venta IS NULL)
+	FROM comprobantes c
+	LEFT JOIN LATERAL (
+		SELECT t.venta
+		FROM tipos_cambio t
+		WHERE t.moneda = c.tipo_moneda
+			AND t.fecha BETWEEN c.fecha_emision::date - 7 AND c.fecha_emision::date
+		ORDER BY t.fecha DESC
+		LIMIT 1
+	) tc ON true
+	GROUP BY c.tipo_moneda
+	ORDER BY c.tipo_moneda`
+
+	rows4, err := db.Query(queryMonedas)
+	if err != nil {
+		return nil, err
+	}
+	defer rows4.Close()
+
+	monedas := make(map[string]map[string]interface{})
+	for rows4.Next() {
+		var moneda string
+		var cantidad, sinTipoCambio int
+		var importe, importeSoles float64
+		if err := rows4.Scan(&moneda, &cantidad, &importe, &importeSoles, &sinTipoCambio); err != nil {
+			return nil, err
+		}
+		monedas[moneda] = map[string]interface{}{
+			"comprobantes":    cantidad,
+			"importe_total":   importe,
+			"importe_soles":   math.Round(importeSoles*100) / 100,
+			"sin_tipo_cambio": sinTipoCambio,
+		}
+	}
+	stats["ventas_por_moneda"] = monedas
+
+	// Ventas por establecimiento de cada emisor
+	queryEstablecimientos := `
+	SELECT c.emisor_ruc, c.emisor_establecimiento, COALESCE(MAX(e.nombre), ''),
+		COUNT(*), COALESCE(SUM(c.importe_total) FILTER (WHERE c.tipo_moneda = 'PEN'), 0)
+	FROM comprobantes c
+	LEFT JOIN establecimientos e ON e.ruc = c.emisor_ruc AND e.codigo = c.emisor_establecimiento
+	GROUP BY c.emisor_ruc, c.emisor_establecimiento
+	ORDER BY c.emisor_ruc, c.emisor_establecimiento`
+
+	rows5, err := db.Query(queryEstablecimientos)
+	if err != nil {
+		return nil, err
+	}
+	defer rows5.Close()
+
+	establecimientos := make(map[string]map[string]interface{})
+	for rows5.Next() {
+		var ruc, codigo, nombre string
+		var cantidad int
+		var importeSoles float64
+		if err := rows5.Scan(&ruc, &codigo, &nombre, &cantidad, &importeSoles); err != nil {
+			return nil, err
+		}
+		establecimientos[ruc+"-"+codigo] = map[string]interface{}{
+			"ruc":           ruc,
+			"codigo":        codigo,
+			"nombre":        nombre,
+			"comprobantes":  cantidad,
+			"importe_soles": importeSoles,
+		}
+	}
+	stats["ventas_por_establecimiento"] = establecimientos
+
 	// Tamaño de la base de datos (PostgreSQL específico)
 	var dbSize int64
 	querySize := `
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"facturacion_sunat_api_go/internal/models"
+	"fmt"
+)
+
+// ErrSerieAsignada indica que la serie ya pertenece a otro establecimiento del RUC
+var ErrSerieAsignada = errors.New("serie asignada a otro establecimiento")
+
+type EstablecimientoRepository struct {
+	db *sql.DB
+}
+
+func NewEstablecimientoRepository(db *sql.DB) *EstablecimientoRepository {
+	return &EstablecimientoRepository{
+		db: db,
+	}
+}
+
+// Guardar inserta o actualiza un establecimiento y reemplaza sus series
+func (r *EstablecimientoRepository) Guardar(establecimiento *models.Establecimiento) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error iniciando transacción: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO establecimientos (
+			ruc, codigo, nombre, direccion, distrito, provincia, departamento,
+			ubigeo, codigo_pais, activo
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (ruc, codigo) DO UPDATE SET
+			nombre = EXCLUDED.nombre, direccion = EXCLUDED.direccion,
+			distrito = EXCLUDED.distrito, provincia = EXCLUDED.provincia,
+			departamento = EXCLUDED.departamento, ubigeo = EXCLUDED.ubigeo,
+			codigo_pais = EXCLUDED.codigo_pais, activo = EXCLUDED.activo,
+			fecha_actualizacion = CURRENT_TIMESTAMP
+		RETURNING fecha_actualizacion`
+
+	err = tx.QueryRow(query,
+		establecimiento.RUC, establecimiento.Codigo, nullString(establecimiento.Nombre),
+		establecimiento.Direccion, nullString(establecimiento.Distrito), nullString(establecimiento.Provincia),
+		nullString(establecimiento.Departamento), nullString(establecimiento.Ubigeo),
+		establecimiento.CodigoPais, establecimiento.Activo,
+	).Scan(&establecimiento.FechaActualizacion)
+	if err != nil {
+		return fmt.Errorf("error guardando establecimiento: %v", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM establecimiento_series WHERE ruc = $1 AND codigo = $2`,
+		establecimiento.RUC, establecimiento.Codigo); err != nil {
+		return fmt.Errorf("error reemplazando series: %v", err)
+	}
+	for _, serie := range establecimiento.Series {
+		var codigo string
+		err := tx.QueryRow(`SELECT codigo FROM establecimiento_series WHERE ruc = $1 AND serie = $2`,
+			establecimiento.RUC, serie).Scan(&codigo)
+		if err == nil {
+			return fmt.Errorf("%w: la serie %s pertenece al establecimiento %s", ErrSerieAsignada, serie, codigo)
+		}
+		if err != sql.ErrNoRows {
+			return fmt.Errorf("error verificando serie: %v", err)
+		}
+
+		if _, err := tx.Exec(`INSERT INTO establecimiento_series (ruc, serie, codigo) VALUES ($1, $2, $3)`,
+			establecimiento.RUC, serie, establecimiento.Codigo); err != nil {
+			return fmt.Errorf("error insertando serie: %v", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Listar obtiene los establecimientos de un RUC con sus series, empezando por
+// el domicilio fiscal
+func (r *EstablecimientoRepository) Listar(ruc string) ([]models.Establecimiento, error) {
+	query := `
+		SELECT ruc, codigo, nombre, direccion, distrito, provincia, departamento,
+			ubigeo, codigo_pais, activo, fecha_actualizacion
+		FROM establecimientos
+		WHERE ruc = $1
+		ORDER BY codigo`
+
+	rows, err := r.db.Query(query, ruc)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando establecimientos: %v", err)
+	}
+	defer rows.Close()
+
+	var establecimientos []models.Establecimiento
+	for rows.Next() {
+		var establecimiento models.Establecimiento
+		var nombre, distrito, provincia, departamento, ubigeo sql.NullString
+		if err := rows.Scan(&establecimiento.RUC, &establecimiento.Codigo, &nombre,
+			&establecimiento.Direccion, &distrito, &provincia, &departamento, &ubigeo,
+			&establecimiento.CodigoPais, &establecimiento.Activo, &establecimiento.FechaActualizacion); err != nil {
+			return nil, fmt.Errorf("error escaneando establecimiento: %v", err)
+		}
+		establecimiento.Nombre = nombre.String
+		establecimiento.Distrito = distrito.String
+		establecimiento.Provincia = provincia.String
+		establecimiento.Departamento = departamento.String
+		establecimiento.Ubigeo = ubigeo.String
+		establecimientos = append(establecimientos, establecimiento)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	series, err := r.getSeries(ruc)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando series: %v", err)
+	}
+	for i := range establecimientos {
+		establecimientos[i].Series = series[establecimientos[i].Codigo]
+	}
+
+	return establecimientos, nil
+}
+
+// getSeries agrupa las series de un RUC por código de establecimiento
+func (r *EstablecimientoRepository) getSeries(ruc string) (map[string][]string, error) {
+	rows, err := r.db.Query(`SELECT codigo, serie FROM establecimiento_series WHERE ruc = $1 ORDER BY serie`, ruc)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	series := make(map[string][]string)
+	for rows.Next() {
+		var codigo, serie string
+		if err := rows.Scan(&codigo, &serie); err != nil {
+			return nil, err
+		}
+		series[codigo] = append(series[codigo], serie)
+	}
+	return series, rows.Err()
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"database/sql"
+	"facturacion_sunat_api_go/internal/models"
+	"fmt"
+)
+
+type TasaRepository struct {
+	db *sql.DB
+}
+
+func NewTasaRepository(db *sql.DB) *TasaRepository {
+	return &TasaRepository{
+		db: db,
+	}
+}
+
+// ListTasas obtiene la tabla completa de tasas de impuestos con su vigencia
+func (r *TasaRepository) ListTasas() (models.TablaTasas, error) {
+	query := `
+		SELECT tributo, regimen, tasa, vigente_desde, vigente_hasta, COALESCE(descripcion, '')
+		FROM tasas_impuestos
+		ORDER BY tributo, regimen, vigente_desde`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando tasas de impuestos: %v", err)
+	}
+	defer rows.Close()
+
+	var tasas models.TablaTasas
+	for rows.Next() {
+		var tasa models.TasaImpuesto
+		var vigenteHasta sql.NullTime
+
+		if err := rows.Scan(&tasa.Tributo, &tasa.Regimen, &tasa.Tasa, &tasa.VigenteDesde, &vigenteHasta, &tasa.Descripcion); err != nil {
+			return nil, fmt.Errorf("error escaneando tasa de impuesto: %v", err)
+		}
+		if vigenteHasta.Valid {
+			tasa.VigenteHasta = &vigenteHasta.Time
+		}
+		tasas = append(tasas, tasa)
+	}
+
+	return tasas, rows.Err()
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"facturacion_sunat_api_go/internal/models"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrTipoCambioNoEncontrado indica que no hay un tipo de cambio publicado para la fecha
+var ErrTipoCambioNoEncontrado = errors.New("tipo de cambio no encontrado")
+
+type TipoCambioRepository struct {
+	db *sql.DB
+}
+
+func NewTipoCambioRepository(db *sql.DB) *TipoCambioRepository {
+	return &TipoCambioRepository{
+		db: db,
+	}
+}
+
+// Buscar obtiene el último tipo de cambio publicado entre desde y hasta, de modo
+// que una fecha sin publicación resuelve al último día hábil anterior
+func (r *TipoCambioRepository) Buscar(moneda string, desde, hasta time.Time) (*models.TipoCambio, error) {
+	query := `
+		SELECT moneda, fecha, compra, venta, fuente, fecha_actualizacion
+		FROM tipos_cambio
+		WHERE moneda = $1 AND fecha BETWEEN $2 AND $3
+		ORDER BY fecha DESC
+		LIMIT 1`
+
+	var tipoCambio models.TipoCambio
+	err := r.db.QueryRow(query, moneda, desde.Format("2006-01-02"), hasta.Format("2006-01-02")).Scan(
+		&tipoCambio.Moneda, &tipoCambio.Fecha, &tipoCambio.Compra, &tipoCambio.Venta,
+		&tipoCambio.Fuente, &tipoCambio.FechaActualizacion,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s al %s", ErrTipoCambioNoEncontrado, moneda, hasta.Format("2006-01-02"))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo tipo de cambio: %v", err)
+	}
+
+	return &tipoCambio, nil
+}
+
+// GuardarLote inserta o actualiza un lote de tipos de cambio. Una fecha ya
+// registrada se reemplaza con la cotización importada más reciente.
+func (r *TipoCambioRepository) GuardarLote(tiposCambio []models.TipoCambio) (int64, error) {
+	if len(tiposCambio) == 0 {
+		return 0, nil
+	}
+
+	var query strings.Builder
+	query.WriteString("INSERT INTO tipos_cambio (moneda, fecha, compra, venta, fuente) VALUES ")
+	args := make([]interface{}, 0, len(tiposCambio)*5)
+	for i, tipoCambio := range tiposCambio {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		n := len(args)
+		fmt.Fprintf(&query, "($%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5)
+		args = append(args, tipoCambio.Moneda, tipoCambio.Fecha.Format("2006-01-02"),
+			tipoCambio.Compra, tipoCambio.Venta, tipoCambio.Fuente)
+	}
+	query.WriteString(` ON CONFLICT (moneda, fecha) DO UPDATE SET
+		compra = EXCLUDED.compra, venta = EXCLUDED.venta, fuente = EXCLUDED.fuente,
+		fecha_actualizacion = CURRENT_TIMESTAMP`)
+
+	result, err := r.db.Exec(query.String(), args...)
+	if err != nil {
+		return 0, fmt.Errorf("error guardando tipos de cambio: %v", err)
+	}
+	return result.RowsAffected()
+}
@@ -1,20 +1,31 @@
 package services
 
 import (
+	"facturacion_sunat_api_go/internal/config"
 	"facturacion_sunat_api_go/internal/models"
+	"facturacion_sunat_api_go/pkg/catalogos"
+	"facturacion_sunat_api_go/pkg/letras"
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type ConversionService struct {
-	UBLService *UBLService
+	UBLService  *UBLService
+	TasaService *TasaService
+	// TipoCambioService convierte a soles la percepción y la retención de los
+	// comprobantes en moneda extranjera; sin él, el comprobante debe indicar el
+	// tipo de cambio
+	TipoCambioService *TipoCambioService
 }
 
 func NewConversionService(ublService *UBLService) *ConversionService {
 	return &ConversionService{
-		UBLService: ublService,
+		UBLService:  ublService,
+		TasaService: NewTasaService(nil),
 	}
 }
 
@@ -33,6 +44,7 @@ func (s *ConversionService) ConvertToUBL(comprobante *models.Comprobante) (inter
 	if len(comprobante.Items) == 0 {
 		return nil, fmt.Errorf("Debe haber al menos un item en el comprobante")
 	}
+	s.NormalizarDirecciones(comprobante)
 	// Validar tipo de comprobante según catálogo SUNAT
 	switch comprobante.Tipo {
 	case models.TipoFactura:
@@ -44,12 +56,16 @@ func (s *ConversionService) ConvertToUBL(comprobante *models.Comprobante) (inter
 		return s.convertToUBLCreditNote(comprobante)
 	case models.TipoNotaDebito:
 		return s.convertToUBLRealDebitNote(comprobante)
+	case models.TipoLiquidacionCompra:
+		// La liquidación de compra usa la estructura de factura con InvoiceTypeCode "04"
+		return s.convertToUBLInvoice(comprobante)
 	default:
 		return nil, fmt.Errorf("tipo de comprobante no soportado: %v", comprobante.Tipo)
 	}
 }
 
 func (s *ConversionService) convertToUBLInvoice(comprobante *models.Comprobante) (*models.UBLInvoice, error) {
+	fechaEmision, horaEmision := models.FormatUBLIssueDate(comprobante.FechaEmision)
 	invoice := &models.UBLInvoice{
 		Xmlns:                models.UBLConst.Xmlns,
 		XmlnsCac:             models.UBLConst.XmlnsCac,
@@ -65,9 +81,24 @@ func (s *ConversionService) convertToUBLInvoice(comprobante *models.Comprobante)
 		},
 		UBLVersionID:         models.UBLConst.Version,
 		CustomizationID:      models.UBLConst.CustomizationID,
+		ProfileID:            &models.ProfileID{
+			Value:            tipoOperacion(comprobante),
+			SchemeName:       "Tipo de Operacion",
+			SchemeAgencyName: "PE:SUNAT",
+			SchemeURI:        catalogos.URI(catalogos.TipoOperacion),
+		},
 		ID:                   fmt.Sprintf("%s-%s", comprobante.Serie, comprobante.Numero),
-		IssueDate:            models.FormatUBLDate(comprobante.FechaEmision),
-		InvoiceTypeCode:      s.getInvoiceTypeCode(comprobante.Tipo),
+		IssueDate:            fechaEmision,
+		IssueTime:            horaEmision,
+		InvoiceTypeCode:      &models.InvoiceTypeCode{
+			Value:          s.getInvoiceTypeCode(comprobante.Tipo),
+			ListID:         tipoOperacion(comprobante),
+			ListAgencyName: "PE:SUNAT",
+			ListName:       "Tipo de Documento",
+			ListURI:        catalogos.URI(catalogos.TipoDocumento),
+			Name:           "Tipo de Operacion",
+			ListSchemeURI:  catalogos.URI(catalogos.TipoOperacion),
+		},
 		DocumentCurrencyCode: comprobante.TipoMoneda,
 		LineCountNumeric:     len(comprobante.Items),
 	}
@@ -77,51 +108,143 @@ func (s *ConversionService) convertToUBLInvoice(comprobante *models.Comprobante)
 		invoice.DueDate = models.FormatUBLDate(*comprobante.FechaVencimiento)
 	}
 
-	// Mapeo de Note (monto en letras)
-	if comprobante.Observaciones != "" {
-		invoice.Note = []models.Note{{
-			Value: comprobante.Observaciones,
-		}}
+	// Leyendas del catálogo 52 (monto en letras y las que exige el contenido)
+	// y observaciones de texto libre
+	notas, err := notasComprobante(comprobante)
+	if err != nil {
+		return nil, err
 	}
+	invoice.Note = notas
 
-	// Mapeo de PaymentTerms (cuotas de pago y forma de pago)
+	// Forma de pago: al contado o al crédito con el monto neto pendiente y sus cuotas
 	if comprobante.FormaPago != nil {
-		var paymentTerms []models.PaymentTerms
-		// Si es crédito y hay cuotas
-		if strings.ToLower(comprobante.FormaPago.TipoPago) == "credito" && len(comprobante.FormaPago.Cuotas) > 0 {
-			// Total de crédito
-			paymentTerms = append(paymentTerms, models.PaymentTerms{
-				ID: "FormaPago",
-				PaymentMeansID: "Credito",
+		tipoPago := models.NormalizarTipoPago(comprobante.FormaPago.TipoPago)
+		if tipoPago == models.FormaPagoCredito {
+			invoice.PaymentTerms = append(invoice.PaymentTerms, models.PaymentTerms{
+				ID:             "FormaPago",
+				PaymentMeansID: &models.PaymentMeansID{Value: models.FormaPagoCredito},
 				Amount: &models.Amount{
-					Value: comprobante.Totales.ImporteTotal,
+					Value:      comprobante.MontoPendientePago(),
 					CurrencyID: comprobante.TipoMoneda,
 				},
 			})
-			// Cuotas
 			for i, cuota := range comprobante.FormaPago.Cuotas {
-				paymentTerms = append(paymentTerms, models.PaymentTerms{
-					ID: "FormaPago",
-					PaymentMeansID: fmt.Sprintf("Cuota%03d", i+1),
+				invoice.PaymentTerms = append(invoice.PaymentTerms, models.PaymentTerms{
+					ID:             "FormaPago",
+					PaymentMeansID: &models.PaymentMeansID{Value: fmt.Sprintf("Cuota%03d", i+1)},
 					Amount: &models.Amount{
-						Value: cuota.Monto,
+						Value:      cuota.Monto,
 						CurrencyID: comprobante.TipoMoneda,
 					},
 					PaymentDueDate: models.FormatUBLDate(cuota.FechaVencimiento),
 				})
 			}
 		} else {
-			// Pago contado o sin cuotas
-			paymentTerms = append(paymentTerms, models.PaymentTerms{
+			if tipoPago == "" {
+				tipoPago = comprobante.FormaPago.TipoPago
+			}
+			invoice.PaymentTerms = append(invoice.PaymentTerms, models.PaymentTerms{
+				ID:             "FormaPago",
+				PaymentMeansID: &models.PaymentMeansID{Value: tipoPago},
+			})
+		}
+
+		// Medio de pago (catálogo 59)
+		if medioPago := comprobante.FormaPago.MedioPago; medioPago != "" {
+			invoice.PaymentMeans = append(invoice.PaymentMeans, models.PaymentMeans{
 				ID: "FormaPago",
-				PaymentMeansID: comprobante.FormaPago.TipoPago,
-				Amount: &models.Amount{
-					Value: comprobante.Totales.ImporteTotal,
-					CurrencyID: comprobante.TipoMoneda,
+				PaymentMeansCode: &models.PaymentMeansCode{
+					Value:          medioPago,
+					ListName:       "Medio de pago",
+					ListAgencyName: "PE:SUNAT",
+					ListURI:        catalogos.URI(catalogos.MedioPago),
 				},
 			})
 		}
-		invoice.PaymentTerms = paymentTerms
+	}
+
+	// Percepción: importe total a cobrar incluida la percepción y cargo con código 51, 52 o 53, en soles
+	if percepcion := comprobante.Percepcion; percepcion != nil {
+		invoice.PaymentTerms = append(invoice.PaymentTerms, models.PaymentTerms{
+			ID: "Percepcion",
+			Amount: &models.Amount{
+				Value:      percepcion.MontoTotal,
+				CurrencyID: "PEN",
+			},
+		})
+	}
+
+	// Retención: porcentaje y monto en soles que el cliente agente de retención descontará del pago
+	if retencion := comprobante.Retencion; retencion != nil {
+		invoice.PaymentTerms = append(invoice.PaymentTerms, models.PaymentTerms{
+			ID:             "Retencion",
+			PaymentPercent: retencion.Porcentaje,
+			Amount: &models.Amount{
+				Value:      retencion.Monto,
+				CurrencyID: "PEN",
+			},
+		})
+	}
+
+	// Detracción: cuenta del Banco de la Nación, bien o servicio del catálogo 54,
+	// porcentaje y monto en soles
+	if detraccion := comprobante.Detraccion; detraccion != nil {
+		invoice.PaymentMeans = append(invoice.PaymentMeans, models.PaymentMeans{
+			ID: "Detraccion",
+			PaymentMeansCode: &models.PaymentMeansCode{
+				Value:          detraccion.MedioPago,
+				ListName:       "Medio de pago",
+				ListAgencyName: "PE:SUNAT",
+				ListURI:        catalogos.URI(catalogos.MedioPago),
+			},
+			PayeeFinancialAccount: &models.PayeeFinancialAccount{ID: detraccion.NumeroCuenta},
+		})
+		invoice.PaymentTerms = append(invoice.PaymentTerms, models.PaymentTerms{
+			ID: "Detraccion",
+			PaymentMeansID: &models.PaymentMeansID{
+				Value:            detraccion.Codigo,
+				SchemeName:       "Codigo de detraccion",
+				SchemeAgencyName: "PE:SUNAT",
+				SchemeURI:        catalogos.URI(catalogos.Detraccion),
+			},
+			PaymentPercent: detraccion.Porcentaje,
+			Amount: &models.Amount{
+				Value:      detraccion.Monto,
+				CurrencyID: "PEN",
+			},
+		})
+	}
+
+	// Condiciones de entrega (Incoterms) de exportaciones
+	invoice.DeliveryTerms = s.convertDeliveryTerms(comprobante.CondicionesEntrega)
+
+	// Orden de compra, guías de remisión y documentos relacionados
+	var documentosRelacionados []models.AdditionalDocumentReference
+	invoice.OrderReference, invoice.DespatchDocumentReference, documentosRelacionados = s.convertDocumentosRelacionados(comprobante)
+
+	// Anticipos deducidos: documentos relacionados y pagos anticipados
+	invoice.AdditionalDocumentReference, invoice.PrepaidPayment = s.convertAnticipos(comprobante)
+	invoice.AdditionalDocumentReference = append(invoice.AdditionalDocumentReference, documentosRelacionados...)
+
+	// Cargos y descuentos globales (catálogo 53)
+	invoice.AllowanceCharge = s.convertAllowanceCharges(comprobante.CargosDescuentos, comprobante.TipoMoneda)
+	if percepcion := comprobante.Percepcion; percepcion != nil {
+		invoice.AllowanceCharge = append(invoice.AllowanceCharge, s.convertAllowanceCharges([]models.CargoDescuento{{
+			EsCargo:   true,
+			Codigo:    percepcion.CodigoRegimen,
+			Factor:    percepcion.Porcentaje / 100,
+			Monto:     percepcion.Monto,
+			MontoBase: percepcion.BaseImponible,
+		}}, "PEN")...)
+	}
+	if retencion := comprobante.Retencion; retencion != nil {
+		invoice.AllowanceCharge = append(invoice.AllowanceCharge, s.convertAllowanceCharges([]models.CargoDescuento{{
+			EsCargo:   false,
+			Codigo:    models.CodigoRetencion,
+			Factor:    retencion.Porcentaje / 100,
+			Monto:     retencion.Monto,
+			MontoBase: retencion.BaseImponible,
+		}}, "PEN")...)
 	}
 
 	// Proveedor (Emisor)
@@ -145,6 +268,28 @@ func (s *ConversionService) convertToUBLInvoice(comprobante *models.Comprobante)
 	}
 	invoice.TaxTotal = taxTotals
 
+	// Liquidación de compra: IGV (1000) y renta (3000) retenidos al vendedor
+	if liquidacion := comprobante.Liquidacion; liquidacion != nil {
+		retenciones, err := s.convertTaxTotals([]models.Impuesto{
+			{
+				TipoImpuesto:  models.SUNATConstants.IGVCode,
+				BaseImponible: liquidacion.BaseRenta,
+				Tasa:          tasaIGVRetenido(comprobante.Impuestos),
+				MontoImpuesto: liquidacion.IGVRetenido,
+			},
+			{
+				TipoImpuesto:  models.TributoRenta,
+				BaseImponible: liquidacion.BaseRenta,
+				Tasa:          liquidacion.PorcentajeRenta,
+				MontoImpuesto: liquidacion.RentaRetenida,
+			},
+		}, comprobante.TipoMoneda)
+		if err != nil {
+			return nil, fmt.Errorf("error converting withholding tax totals: %v", err)
+		}
+		invoice.WithholdingTaxTotal = retenciones
+	}
+
 	// Totales monetarios
 	monetaryTotal, err := s.convertLegalMonetaryTotal(comprobante.Totales, comprobante.TipoMoneda)
 	if err != nil {
@@ -153,7 +298,11 @@ func (s *ConversionService) convertToUBLInvoice(comprobante *models.Comprobante)
 	invoice.LegalMonetaryTotal = monetaryTotal
 
 	// Líneas de factura
-	invoiceLines, err := s.convertInvoiceLines(comprobante.Items, comprobante.TipoMoneda)
+	tasaIGV, err := s.TasaService.TasaIGV(comprobante.Emisor.Regimen, comprobante.FechaEmision)
+	if err != nil {
+		return nil, err
+	}
+	invoiceLines, err := s.convertInvoiceLines(comprobante.Items, comprobante.TipoMoneda, tasaIGV)
 	if err != nil {
 		return nil, fmt.Errorf("error converting invoice lines: %v", err)
 	}
@@ -162,6 +311,28 @@ func (s *ConversionService) convertToUBLInvoice(comprobante *models.Comprobante)
 	return invoice, nil
 }
 
+// tipoOperacion retorna el tipo de operación del catálogo 51 (venta interna o,
+// en las liquidaciones de compra, compra interna por defecto)
+func tipoOperacion(comprobante *models.Comprobante) string {
+	if comprobante.TipoOperacion == "" {
+		if comprobante.Tipo == models.TipoLiquidacionCompra {
+			return models.OperacionCompraInterna
+		}
+		return models.OperacionVentaInterna
+	}
+	return comprobante.TipoOperacion
+}
+
+// tasaIGVRetenido retorna la tasa del IGV de la liquidación de compra
+func tasaIGVRetenido(impuestos []models.Impuesto) float64 {
+	for _, impuesto := range impuestos {
+		if impuesto.TipoImpuesto == models.SUNATConstants.IGVCode {
+			return impuesto.Tasa
+		}
+	}
+	return 0
+}
+
 // getInvoiceTypeCode retorna el código de tipo de documento según catálogo SUNAT 01
 func (s *ConversionService) getInvoiceTypeCode(tipo models.TipoComprobante) string {
 	switch tipo {
@@ -169,14 +340,17 @@ func (s *ConversionService) getInvoiceTypeCode(tipo models.TipoComprobante) stri
 		return models.SUNATConstants.InvoiceTypeCode
 	case models.TipoBoleta:
 		return models.SUNATConstants.BoletaTypeCode
+	case models.TipoLiquidacionCompra:
+		return models.SUNATConstants.LiquidacionCompraTypeCode
 	default:
 		return models.SUNATConstants.InvoiceTypeCode
 	}
 }
 
 func (s *ConversionService) convertToUBLCreditNote(comprobante *models.Comprobante) (*models.UBLCreditNote, error) {
+	fechaEmision, horaEmision := models.FormatUBLIssueDate(comprobante.FechaEmision)
 	creditNote := &models.UBLCreditNote{
-		Xmlns:                models.UBLConst.Xmlns,
+		Xmlns:                models.UBLConst.XmlnsCreditNote,
 		XmlnsCac:             models.UBLConst.XmlnsCac,
 		XmlnsCbc:             models.UBLConst.XmlnsCbc,
 		XmlnsDs:              models.UBLConst.XmlnsDs,
@@ -191,12 +365,23 @@ func (s *ConversionService) convertToUBLCreditNote(comprobante *models.Comproban
 		UBLVersionID:         models.UBLConst.Version,
 		CustomizationID:      models.UBLConst.CustomizationID,
 		ID:                   fmt.Sprintf("%s-%s", comprobante.Serie, comprobante.Numero),
-		IssueDate:            models.FormatUBLDate(comprobante.FechaEmision),
+		IssueDate:            fechaEmision,
+		IssueTime:            horaEmision,
 		CreditNoteTypeCode:   models.SUNATConstants.CreditNoteTypeCode,
 		DocumentCurrencyCode: comprobante.TipoMoneda,
 		LineCountNumeric:     len(comprobante.Items),
 	}
 
+	// Leyendas y observaciones
+	notas, err := notasComprobante(comprobante)
+	if err != nil {
+		return nil, err
+	}
+	creditNote.Note = notas
+
+	// Orden de compra, guías de remisión y documentos relacionados
+	creditNote.OrderReference, creditNote.DespatchDocumentReference, creditNote.AdditionalDocumentReference = s.convertDocumentosRelacionados(comprobante)
+
 	// Proveedor (Emisor)
 	supplierParty, err := s.convertSupplierParty(comprobante.Emisor)
 	if err != nil {
@@ -226,7 +411,11 @@ func (s *ConversionService) convertToUBLCreditNote(comprobante *models.Comproban
 	creditNote.LegalMonetaryTotal = monetaryTotal
 
 	// Líneas de nota de crédito
-	creditNoteLines, err := s.convertCreditNoteLines(comprobante.Items, comprobante.TipoMoneda)
+	tasaIGV, err := s.TasaService.TasaIGV(comprobante.Emisor.Regimen, comprobante.FechaEmision)
+	if err != nil {
+		return nil, err
+	}
+	creditNoteLines, err := s.convertCreditNoteLines(comprobante.Items, comprobante.TipoMoneda, tasaIGV)
 	if err != nil {
 		return nil, fmt.Errorf("error converting credit note lines: %v", err)
 	}
@@ -237,8 +426,9 @@ func (s *ConversionService) convertToUBLCreditNote(comprobante *models.Comproban
 
 // Implementación para Nota de Débito UBL siguiendo el estándar SUNAT
 func (s *ConversionService) convertToUBLRealDebitNote(comprobante *models.Comprobante) (*models.UBLDebitNote, error) {
+	fechaEmision, horaEmision := models.FormatUBLIssueDate(comprobante.FechaEmision)
 	debitNote := &models.UBLDebitNote{
-		Xmlns:                models.UBLConst.Xmlns,
+		Xmlns:                models.UBLConst.XmlnsDebitNote,
 		XmlnsCac:             models.UBLConst.XmlnsCac,
 		XmlnsCbc:             models.UBLConst.XmlnsCbc,
 		XmlnsDs:              models.UBLConst.XmlnsDs,
@@ -253,12 +443,22 @@ func (s *ConversionService) convertToUBLRealDebitNote(comprobante *models.Compro
 		UBLVersionID:         models.UBLConst.Version,
 		CustomizationID:      models.UBLConst.CustomizationID,
 		ID:                   fmt.Sprintf("%s-%s", comprobante.Serie, comprobante.Numero),
-		IssueDate:            models.FormatUBLDate(comprobante.FechaEmision),
-		DebitNoteTypeCode:    models.SUNATConstants.DebitNoteTypeCode,
+		IssueDate:            fechaEmision,
+		IssueTime:            horaEmision,
 		DocumentCurrencyCode: comprobante.TipoMoneda,
 		LineCountNumeric:     len(comprobante.Items),
 	}
 
+	// Leyendas y observaciones
+	notas, err := notasComprobante(comprobante)
+	if err != nil {
+		return nil, err
+	}
+	debitNote.Note = notas
+
+	// Orden de compra, guías de remisión y documentos relacionados
+	debitNote.OrderReference, debitNote.DespatchDocumentReference, debitNote.AdditionalDocumentReference = s.convertDocumentosRelacionados(comprobante)
+
 	// Proveedor (Emisor)
 	supplierParty, err := s.convertSupplierParty(comprobante.Emisor)
 	if err != nil {
@@ -285,10 +485,14 @@ func (s *ConversionService) convertToUBLRealDebitNote(comprobante *models.Compro
 	if err != nil {
 		return nil, fmt.Errorf("error converting monetary total: %v", err)
 	}
-	debitNote.LegalMonetaryTotal = monetaryTotal
+	debitNote.RequestedMonetaryTotal = monetaryTotal
 
 	// Líneas de nota de débito
-	debitNoteLines, err := s.convertDebitNoteLines(comprobante.Items, comprobante.TipoMoneda)
+	tasaIGV, err := s.TasaService.TasaIGV(comprobante.Emisor.Regimen, comprobante.FechaEmision)
+	if err != nil {
+		return nil, err
+	}
+	debitNoteLines, err := s.convertDebitNoteLines(comprobante.Items, comprobante.TipoMoneda, tasaIGV)
 	if err != nil {
 		return nil, fmt.Errorf("error converting debit note lines: %v", err)
 	}
@@ -315,10 +519,6 @@ func (s *ConversionService) convertSupplierParty(emisor models.Emisor) (*models.
 		return nil, fmt.Errorf("Razón social del emisor es obligatoria")
 	}
 
-	ubigeo := emisor.CodigoPostal
-	if ubigeo == "" {
-		ubigeo = "150101" // valor por defecto Lima
-	}
 	addressLine := emisor.Direccion
 	if addressLine == "" {
 		addressLine = "DIRECCION FISCAL"
@@ -336,7 +536,7 @@ func (s *ConversionService) convertSupplierParty(emisor models.Emisor) (*models.
 					SchemeID:         "6",
 					SchemeName:       "Documento de Identidad",
 					SchemeAgencyName: "PE:SUNAT",
-					SchemeURI:        "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo06",
+					SchemeURI:        catalogos.URI(catalogos.DocumentoIdentidad),
 				},
 			},
 		},
@@ -350,7 +550,7 @@ func (s *ConversionService) convertSupplierParty(emisor models.Emisor) (*models.
 				SchemeID:         "6",
 				SchemeName:       "Documento de Identidad",
 				SchemeAgencyName: "PE:SUNAT",
-				SchemeURI:        "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo06",
+				SchemeURI:        catalogos.URI(catalogos.DocumentoIdentidad),
 			},
 			TaxScheme: &models.TaxScheme{
 				ID: &models.ID{
@@ -358,41 +558,20 @@ func (s *ConversionService) convertSupplierParty(emisor models.Emisor) (*models.
 					SchemeID:         "6",
 					SchemeName:       "Documento de Identidad",
 					SchemeAgencyName: "PE:SUNAT",
-					SchemeURI:        "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo06",
+					SchemeURI:        catalogos.URI(catalogos.DocumentoIdentidad),
 				},
 			},
 		},
 		PartyLegalEntity: &models.PartyLegalEntity{
-			RegistrationName: emisor.RazonSocial,
-			RegistrationAddress: &models.RegistrationAddress{
-				ID: &models.ID{
-					Value:            ubigeo,
-					SchemeID:         "Ubigeo",
-					SchemeName:       "Ubigeos",
-					SchemeAgencyName: "PE:INEI",
-				},
-				AddressTypeCode: "0000",
-				CityName:        emisor.Provincia,
-				CountrySubentity: emisor.Departamento,
-				District:        emisor.Distrito,
-				AddressLine: &models.AddressLine{
-					Line: addressLine,
-				},
-				Country: &models.Country{
-					IdentificationCode: &models.IdentificationCode{
-						ListID:           "ISO 3166-1",
-						ListAgencyName:   "United Nations Economic Commission for Europe",
-						ListName:         "Country",
-						Value:            codigoPais,
-					},
-				},
-			},
+			RegistrationName:    emisor.RazonSocial,
+			RegistrationAddress: establecimientoAddress(emisor, addressLine, codigoPais),
 		},
 		PostalAddress: &models.PostalAddress{
+			ID:                 ubigeoID(emisor.CodigoUbigeo()),
 			StreetName:         addressLine,
-			CitySubdivisionName: emisor.Distrito,
 			CityName:           emisor.Provincia,
 			CountrySubentity:   emisor.Departamento,
+			District:           emisor.Distrito,
 			Country: &models.Country{
 				IdentificationCode: &models.IdentificationCode{
 					ListID:           "ISO 3166-1",
@@ -417,14 +596,87 @@ func (s *ConversionService) convertSupplierParty(emisor models.Emisor) (*models.
 	}, nil
 }
 
+// establecimientoAddress genera la dirección del establecimiento desde el que
+// se emite el comprobante con su código (cbc:AddressTypeCode): la del anexo
+// registrado para la serie o, en su defecto, la del domicilio fiscal
+func establecimientoAddress(emisor models.Emisor, addressLine, codigoPais string) *models.RegistrationAddress {
+	codigo := emisor.CodigoEstablecimiento
+	if codigo == "" {
+		codigo = models.EstablecimientoDomicilioFiscal
+	}
+	address := &models.RegistrationAddress{
+		ID:               ubigeoID(emisor.CodigoUbigeo()),
+		AddressTypeCode:  codigo,
+		CityName:         emisor.Provincia,
+		CountrySubentity: emisor.Departamento,
+		District:         emisor.Distrito,
+		AddressLine: &models.AddressLine{
+			Line: addressLine,
+		},
+		Country: &models.Country{
+			IdentificationCode: &models.IdentificationCode{
+				ListID:         "ISO 3166-1",
+				ListAgencyName: "United Nations Economic Commission for Europe",
+				ListName:       "Country",
+				Value:          codigoPais,
+			},
+		},
+	}
+
+	if establecimiento := emisor.Establecimiento; establecimiento != nil {
+		address.ID = ubigeoID(establecimiento.Ubigeo)
+		address.CityName = establecimiento.Provincia
+		address.CountrySubentity = establecimiento.Departamento
+		address.District = establecimiento.Distrito
+		address.AddressLine.Line = establecimiento.Direccion
+		if establecimiento.CodigoPais != "" {
+			address.Country.IdentificationCode.Value = establecimiento.CodigoPais
+		}
+	}
+	return address
+}
+
+// NormalizarDirecciones resuelve el ubigeo del emisor, del receptor domiciliado
+// y del lugar de entrega a partir del código o de los nombres, y completa los
+// nombres oficiales del INEI. Las direcciones que no se pueden resolver se
+// conservan como se recibieron; ValidationService informa la observación.
+func (s *ConversionService) NormalizarDirecciones(comprobante *models.Comprobante) {
+	emisor := &comprobante.Emisor
+	if ubicacion, err := catalogos.ResolverUbigeo(emisor.CodigoUbigeo(), emisor.Departamento, emisor.Provincia, emisor.Distrito); err == nil {
+		emisor.Ubigeo = ubicacion.Codigo
+		emisor.Departamento = ubicacion.Departamento
+		emisor.Provincia = ubicacion.Provincia
+		emisor.Distrito = ubicacion.Distrito
+	}
+
+	receptor := &comprobante.Receptor
+	if receptor.DomiciliadoEnPeru() && (receptor.Ubigeo != "" || receptor.Distrito != "") {
+		if ubicacion, err := catalogos.ResolverUbigeo(receptor.Ubigeo, receptor.Departamento, receptor.Provincia, receptor.Distrito); err == nil {
+			receptor.Ubigeo = ubicacion.Codigo
+			receptor.Departamento = ubicacion.Departamento
+			receptor.Provincia = ubicacion.Provincia
+			receptor.Distrito = ubicacion.Distrito
+		}
+	}
+}
+
+// ubigeoID genera el cbc:ID de una dirección con su ubigeo INEI
+func ubigeoID(ubigeo string) *models.ID {
+	if ubigeo == "" {
+		return nil
+	}
+	return &models.ID{
+		Value:            ubigeo,
+		SchemeID:         "Ubigeo",
+		SchemeName:       "Ubigeos",
+		SchemeAgencyName: "PE:INEI",
+	}
+}
+
 func (s *ConversionService) convertCustomerParty(receptor models.Receptor) (*models.AccountingCustomerParty, error) {
 	schemeID := "6" // Por defecto RUC
-	if receptor.TipoDocumento == "1" {
-		schemeID = "1" // DNI
-	} else if receptor.TipoDocumento == "4" {
-		schemeID = "4" // CE
-	} else if receptor.TipoDocumento == "7" {
-		schemeID = "7" // Pasaporte
+	if receptor.TipoDocumento != "" {
+		schemeID = receptor.TipoDocumento // Catálogo 06: DNI, CE, pasaporte, no domiciliados (0, A, B)
 	}
 	if strings.TrimSpace(receptor.RazonSocial) == "" {
 		return nil, fmt.Errorf("Razón social del receptor es obligatoria")
@@ -436,6 +688,10 @@ func (s *ConversionService) convertCustomerParty(receptor models.Receptor) (*mod
 	if addressLine == "" {
 		addressLine = "DIRECCION CLIENTE"
 	}
+	codigoPais := receptor.CodigoPais
+	if codigoPais == "" {
+		codigoPais = "PE"
+	}
 
 	party := &models.Party{
 		PartyIdentification: []models.PartyIdentification{
@@ -445,7 +701,7 @@ func (s *ConversionService) convertCustomerParty(receptor models.Receptor) (*mod
 					SchemeID:         schemeID,
 					SchemeName:       "Documento de Identidad",
 					SchemeAgencyName: "PE:SUNAT",
-					SchemeURI:        "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo06",
+					SchemeURI:        catalogos.URI(catalogos.DocumentoIdentidad),
 				},
 			},
 		},
@@ -459,7 +715,7 @@ func (s *ConversionService) convertCustomerParty(receptor models.Receptor) (*mod
 				SchemeID:         schemeID,
 				SchemeName:       "Documento de Identidad",
 				SchemeAgencyName: "PE:SUNAT",
-				SchemeURI:        "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo06",
+				SchemeURI:        catalogos.URI(catalogos.DocumentoIdentidad),
 			},
 			TaxScheme: &models.TaxScheme{
 				ID: &models.ID{
@@ -467,16 +723,13 @@ func (s *ConversionService) convertCustomerParty(receptor models.Receptor) (*mod
 					SchemeID:         schemeID,
 					SchemeName:       "Documento de Identidad",
 					SchemeAgencyName: "PE:SUNAT",
-					SchemeURI:        "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo06",
+					SchemeURI:        catalogos.URI(catalogos.DocumentoIdentidad),
 				},
 			},
 		},
 		PartyLegalEntity: &models.PartyLegalEntity{
 			RegistrationName: receptor.RazonSocial,
 			RegistrationAddress: &models.RegistrationAddress{
-				CityName:         "LIMA",
-				CountrySubentity: "LIMA",
-				District:         "LIMA",
 				AddressLine: &models.AddressLine{
 					Line: addressLine,
 				},
@@ -485,13 +738,22 @@ func (s *ConversionService) convertCustomerParty(receptor models.Receptor) (*mod
 						ListID:           "ISO 3166-1",
 						ListAgencyName:   "United Nations Economic Commission for Europe",
 						ListName:         "Country",
-						Value:            "PE",
+						Value:            codigoPais,
 					},
 				},
 			},
 		},
 	}
 
+	// Los clientes no domiciliados no tienen ubigeo peruano
+	if receptor.DomiciliadoEnPeru() {
+		direccion := party.PartyLegalEntity.RegistrationAddress
+		direccion.ID = ubigeoID(receptor.Ubigeo)
+		direccion.CityName = receptor.Provincia
+		direccion.CountrySubentity = receptor.Departamento
+		direccion.District = receptor.Distrito
+	}
+
 	if receptor.Direccion != "" {
 		party.PostalAddress = &models.PostalAddress{
 			StreetName: receptor.Direccion,
@@ -500,10 +762,16 @@ func (s *ConversionService) convertCustomerParty(receptor models.Receptor) (*mod
 					ListID:           "ISO 3166-1",
 					ListAgencyName:   "United Nations Economic Commission for Europe",
 					ListName:         "Country",
-					Value:            "PE",
+					Value:            codigoPais,
 				},
 			},
 		}
+		if receptor.DomiciliadoEnPeru() {
+			party.PostalAddress.ID = ubigeoID(receptor.Ubigeo)
+			party.PostalAddress.CityName = receptor.Provincia
+			party.PostalAddress.CountrySubentity = receptor.Departamento
+			party.PostalAddress.District = receptor.Distrito
+		}
 	}
 
 	if receptor.Email != "" {
@@ -517,87 +785,85 @@ func (s *ConversionService) convertCustomerParty(receptor models.Receptor) (*mod
 	}, nil
 }
 
+// convertTaxTotals genera un único cac:TaxTotal con un subtotal por tributo. El
+// IGV de las operaciones gratuitas (9996) se informa pero no suma al TaxAmount.
 func (s *ConversionService) convertTaxTotals(impuestos []models.Impuesto, moneda string) ([]models.TaxTotal, error) {
-	var taxTotals []models.TaxTotal
-
-	// Agrupar impuestos por tipo
-	taxGroups := make(map[string][]models.Impuesto)
-	for _, impuesto := range impuestos {
-		key := impuesto.TipoImpuesto + "-" + impuesto.CodigoImpuesto
-		taxGroups[key] = append(taxGroups[key], impuesto)
+	if len(impuestos) == 0 {
+		return nil, nil
 	}
 
-	for _, group := range taxGroups {
-		var totalAmount float64
-		var taxSubtotals []models.TaxSubtotal
-
-		for _, impuesto := range group {
-			totalAmount += impuesto.MontoImpuesto
+	// Ordenar por tributo para que el XML sea determinístico
+	ordenados := make([]models.Impuesto, len(impuestos))
+	copy(ordenados, impuestos)
+	sort.SliceStable(ordenados, func(i, j int) bool {
+		return ordenados[i].TipoImpuesto < ordenados[j].TipoImpuesto
+	})
 
-			taxSubtotal := models.TaxSubtotal{
-				TaxableAmount: &models.Amount{
-					Value:      impuesto.BaseImponible,
-					CurrencyID: moneda,
-				},
-				TaxAmount: &models.Amount{
-					Value:      impuesto.MontoImpuesto,
-					CurrencyID: moneda,
-				},
-				TaxCategory: &models.TaxCategory{
-					ID:      impuesto.CodigoImpuesto,
-					Percent: impuesto.Tasa,
-					TaxScheme: &models.TaxScheme{
-						ID: &models.ID{
-							Value:            impuesto.TipoImpuesto,
-							SchemeID:         "UN/ECE 5153",
-							SchemeName:       "Codigo de tributos",
-							SchemeAgencyName: "PE:SUNAT",
-						},
-						Name:        s.getTaxSchemeName(impuesto.TipoImpuesto),
-						TaxTypeCode: "VAT",
-					},
-				},
-			}
+	var totalAmount float64
+	var taxSubtotals []models.TaxSubtotal
 
-			taxSubtotals = append(taxSubtotals, taxSubtotal)
+	for _, impuesto := range ordenados {
+		if impuesto.TipoImpuesto != models.SUNATConstants.GRACode {
+			totalAmount += impuesto.MontoImpuesto
 		}
 
-		taxTotal := models.TaxTotal{
+		taxSubtotal := models.TaxSubtotal{
+			TaxableAmount: &models.Amount{
+				Value:      impuesto.BaseImponible,
+				CurrencyID: moneda,
+			},
 			TaxAmount: &models.Amount{
-				Value:      totalAmount,
+				Value:      impuesto.MontoImpuesto,
 				CurrencyID: moneda,
 			},
-			TaxSubtotal: taxSubtotals,
+			TaxCategory: &models.TaxCategory{
+				ID:      s.getTaxCategoryID(impuesto.TipoImpuesto),
+				Percent: impuesto.Tasa,
+				TaxScheme: &models.TaxScheme{
+					ID: &models.ID{
+						Value:            impuesto.TipoImpuesto,
+						SchemeID:         "UN/ECE 5153",
+						SchemeName:       "Codigo de tributos",
+						SchemeAgencyName: "PE:SUNAT",
+					},
+					Name:        s.getTaxSchemeName(impuesto.TipoImpuesto),
+					TaxTypeCode: s.getTaxTypeCode(impuesto.TipoImpuesto),
+				},
+			},
 		}
 
-		taxTotals = append(taxTotals, taxTotal)
+		taxSubtotals = append(taxSubtotals, taxSubtotal)
 	}
 
-	return taxTotals, nil
+	return []models.TaxTotal{{
+		TaxAmount: &models.Amount{
+			Value:      redondear(totalAmount),
+			CurrencyID: moneda,
+		},
+		TaxSubtotal: taxSubtotals,
+	}}, nil
 }
 
 func (s *ConversionService) convertLegalMonetaryTotal(totales models.Totales, moneda string) (*models.LegalMonetaryTotal, error) {
+	// El valor de venta sin impuestos descuenta los cargos/descuentos globales que afectan la base
+	taxExclusive := valorVentaNeto(totales)
+
 	return &models.LegalMonetaryTotal{
 		LineExtensionAmount: &models.Amount{
 			Value:      totales.TotalValorVenta,
 			CurrencyID: moneda,
 		},
 		TaxExclusiveAmount: &models.Amount{
-			Value:      totales.TotalValorVenta,
+			Value:      taxExclusive,
 			CurrencyID: moneda,
 		},
 		TaxInclusiveAmount: &models.Amount{
 			Value:      totales.TotalPrecioVenta,
 			CurrencyID: moneda,
 		},
-		ChargeTotalAmount: &models.Amount{
-			Value:      totales.TotalDescuentos,
-			CurrencyID: moneda,
-		},
-		PrepaidAmount: &models.Amount{
-			Value:      totales.TotalAnticipos,
-			CurrencyID: moneda,
-		},
+		AllowanceTotalAmount: optionalAmount(totales.TotalDescuentos, moneda),
+		ChargeTotalAmount:    optionalAmount(totales.TotalCargos, moneda),
+		PrepaidAmount:        optionalAmount(totales.TotalAnticipos, moneda),
 		PayableAmount: &models.Amount{
 			Value:      totales.ImporteTotal,
 			CurrencyID: moneda,
@@ -605,16 +871,243 @@ func (s *ConversionService) convertLegalMonetaryTotal(totales models.Totales, mo
 	}, nil
 }
 
-func (s *ConversionService) convertInvoiceLines(items []models.Item, moneda string) ([]models.InvoiceLine, error) {
+// optionalAmount retorna nil para montos en cero, de modo que el elemento se omita del XML
+func optionalAmount(value float64, moneda string) *models.Amount {
+	if value == 0 {
+		return nil
+	}
+	return &models.Amount{
+		Value:      value,
+		CurrencyID: moneda,
+	}
+}
+
+// convertAllowanceCharges genera los elementos cac:AllowanceCharge según catálogo 53
+func (s *ConversionService) convertAllowanceCharges(cargosDescuentos []models.CargoDescuento, moneda string) []models.AllowanceCharge {
+	var allowanceCharges []models.AllowanceCharge
+
+	for _, cd := range cargosDescuentos {
+		allowanceCharge := models.AllowanceCharge{
+			ChargeIndicator: cd.EsCargo,
+			AllowanceChargeReasonCode: &models.AllowanceChargeReasonCode{
+				Value:          cd.Codigo,
+				ListAgencyName: "PE:SUNAT",
+				ListName:       "Cargo/descuento",
+				ListURI:        catalogos.URI(catalogos.CargoDescuento),
+			},
+			MultiplierFactorNumeric: cd.Factor,
+			Amount: &models.Amount{
+				Value:      cd.Monto,
+				CurrencyID: moneda,
+			},
+			BaseAmount: optionalAmount(cd.MontoBase, moneda),
+		}
+
+		allowanceCharges = append(allowanceCharges, allowanceCharge)
+	}
+
+	return allowanceCharges
+}
+
+// convertDeliveryTerms genera cac:DeliveryTerms con el Incoterm y el lugar de entrega
+func (s *ConversionService) convertDeliveryTerms(entrega *models.CondicionesEntrega) *models.DeliveryTerms {
+	if entrega == nil || entrega.Incoterm == "" {
+		return nil
+	}
+
+	deliveryTerms := &models.DeliveryTerms{
+		ID: entrega.Incoterm,
+	}
+	if entrega.LugarEntrega != "" || entrega.CodigoPais != "" || entrega.Ubigeo != "" {
+		address := &models.PostalAddress{
+			ID:         ubigeoID(entrega.Ubigeo),
+			StreetName: entrega.LugarEntrega,
+		}
+		if entrega.CodigoPais != "" {
+			address.Country = &models.Country{
+				IdentificationCode: &models.IdentificationCode{
+					ListID:         "ISO 3166-1",
+					ListAgencyName: "United Nations Economic Commission for Europe",
+					ListName:       "Country",
+					Value:          entrega.CodigoPais,
+				},
+			}
+		}
+		deliveryTerms.DeliveryLocation = &models.DeliveryLocation{
+			Address: address,
+		}
+	}
+
+	return deliveryTerms
+}
+
+// convertDocumentosRelacionados genera la orden de compra (cac:OrderReference),
+// las guías de remisión (cac:DespatchDocumentReference, catálogo 01) y los
+// documentos relacionados (cac:AdditionalDocumentReference, catálogo 12)
+func (s *ConversionService) convertDocumentosRelacionados(comprobante *models.Comprobante) (*models.OrderReference, []models.AdditionalDocumentReference, []models.AdditionalDocumentReference) {
+	var orderReference *models.OrderReference
+	if comprobante.OrdenCompra != "" {
+		orderReference = &models.OrderReference{ID: comprobante.OrdenCompra}
+	}
+
+	var guias []models.AdditionalDocumentReference
+	for _, guia := range comprobante.Guias {
+		guias = append(guias, models.AdditionalDocumentReference{
+			ID: guia.Numero,
+			DocumentTypeCode: &models.DocumentTypeCode{
+				Value:          guia.TipoDocumento,
+				ListAgencyName: "PE:SUNAT",
+				ListName:       "Tipo de Documento",
+				ListURI:        catalogos.URI(catalogos.TipoDocumento),
+			},
+		})
+	}
+
+	var documentos []models.AdditionalDocumentReference
+	for _, documento := range comprobante.DocumentosRelacionados {
+		documentos = append(documentos, models.AdditionalDocumentReference{
+			ID: documento.Numero,
+			DocumentTypeCode: &models.DocumentTypeCode{
+				Value:          documento.TipoDocumento,
+				ListAgencyName: "PE:SUNAT",
+				ListName:       "Documento Relacionado",
+				ListURI:        catalogos.URI(catalogos.DocumentoRelacionado),
+			},
+		})
+	}
+
+	return orderReference, guias, documentos
+}
+
+// convertAnticipos genera los documentos relacionados (catálogo 12, tipos 02/03)
+// y los cac:PrepaidPayment de los anticipos deducidos, vinculados por su número de orden
+func (s *ConversionService) convertAnticipos(comprobante *models.Comprobante) ([]models.AdditionalDocumentReference, []models.PrepaidPayment) {
+	var references []models.AdditionalDocumentReference
+	var payments []models.PrepaidPayment
+
+	for i, anticipo := range comprobante.Anticipos {
+		orden := fmt.Sprintf("%d", i+1)
+		rucEmisor := anticipo.EmisorRUC
+		if rucEmisor == "" {
+			rucEmisor = comprobante.Emisor.RUC
+		}
+
+		references = append(references, models.AdditionalDocumentReference{
+			ID: fmt.Sprintf("%s-%s", anticipo.Serie, anticipo.Numero),
+			DocumentTypeCode: &models.DocumentTypeCode{
+				Value:          anticipo.TipoDocumento,
+				ListAgencyName: "PE:SUNAT",
+				ListName:       "Documento Relacionado",
+				ListURI:        catalogos.URI(catalogos.DocumentoRelacionado),
+			},
+			DocumentStatusCode: &models.DocumentStatusCode{
+				Value:          orden,
+				ListName:       "Anticipo",
+				ListAgencyName: "PE:SUNAT",
+			},
+			IssuerParty: &models.IssuerParty{
+				PartyIdentification: &models.PartyIdentification{
+					ID: &models.ID{
+						Value:            rucEmisor,
+						SchemeID:         "6",
+						SchemeName:       "Documento de Identidad",
+						SchemeAgencyName: "PE:SUNAT",
+						SchemeURI:        catalogos.URI(catalogos.DocumentoIdentidad),
+					},
+				},
+			},
+		})
+
+		payment := models.PrepaidPayment{
+			ID: &models.PrepaidPaymentID{
+				Value:            orden,
+				SchemeName:       "Anticipo",
+				SchemeAgencyName: "PE:SUNAT",
+			},
+			PaidAmount: &models.Amount{
+				Value:      anticipo.Monto,
+				CurrencyID: comprobante.TipoMoneda,
+			},
+		}
+		if anticipo.FechaPago != nil {
+			payment.PaidDate = models.FormatUBLDate(*anticipo.FechaPago)
+		}
+		payments = append(payments, payment)
+	}
+
+	return references, payments
+}
+
+// cantidadItem genera la cantidad de la línea con su unidad de medida (catálogo 03)
+func cantidadItem(item models.Item) *models.Quantity {
+	return &models.Quantity{
+		Value:                  item.Cantidad,
+		UnitCode:               item.UnidadMedida,
+		UnitCodeListID:         "UN/ECE rec 20",
+		UnitCodeListAgencyName: "United Nations Economic Commission for Europe",
+	}
+}
+
+// clasificacionItem genera el código de producto SUNAT de la línea (catálogo 25)
+func clasificacionItem(item models.Item) []models.CommodityClassification {
+	if item.CodigoSUNAT == "" {
+		return nil
+	}
+	return []models.CommodityClassification{{
+		ItemClassificationCode: &models.ItemClassificationCode{
+			Value:          item.CodigoSUNAT,
+			ListID:         "UNSPSC",
+			ListAgencyName: "GS1 US",
+			ListName:       "Item Classification",
+		},
+	}}
+}
+
+// propiedadesItem genera las propiedades adicionales de la línea (catálogo 55).
+// El tipo de la propiedad en el catálogo determina si el dato va en cbc:Value,
+// cbc:ValueQuantity o cac:UsabilityPeriod.
+func propiedadesItem(item models.Item) []models.AdditionalItemProperty {
+	var propiedades []models.AdditionalItemProperty
+	for _, propiedad := range item.Propiedades {
+		adicional := models.AdditionalItemProperty{
+			Name: propiedad.Nombre,
+			NameCode: &models.NameCode{
+				Value:          propiedad.Codigo,
+				ListName:       "Propiedad del item",
+				ListAgencyName: "PE:SUNAT",
+				ListURI:        catalogos.URI(catalogos.PropiedadItem),
+			},
+		}
+
+		switch propiedad.Tipo() {
+		case models.TipoPropiedadFecha:
+			adicional.UsabilityPeriod = &models.UsabilityPeriod{StartDate: models.FormatUBLDate(*propiedad.Fecha)}
+		case models.TipoPropiedadFechaFin:
+			adicional.UsabilityPeriod = &models.UsabilityPeriod{EndDate: models.FormatUBLDate(*propiedad.Fecha)}
+		case models.TipoPropiedadHora:
+			adicional.UsabilityPeriod = &models.UsabilityPeriod{StartTime: propiedad.Hora}
+		case models.TipoPropiedadDias:
+			adicional.UsabilityPeriod = &models.UsabilityPeriod{
+				DurationMeasure: &models.Measure{Value: propiedad.Cantidad, UnitCode: "DAY"},
+			}
+		case models.TipoPropiedadCantidad:
+			adicional.Value = propiedad.Valor
+			adicional.ValueQuantity = &models.Quantity{Value: propiedad.Cantidad, UnitCode: propiedad.UnidadMedida}
+		default:
+			adicional.Value = propiedad.Valor
+		}
+		propiedades = append(propiedades, adicional)
+	}
+	return propiedades
+}
+
+func (s *ConversionService) convertInvoiceLines(items []models.Item, moneda string, tasaIGV float64) ([]models.InvoiceLine, error) {
 	var invoiceLines []models.InvoiceLine
 
 	for _, item := range items {
 		invoiceLine := models.InvoiceLine{
 			ID: strconv.Itoa(item.ID),
-			InvoicedQuantity: &models.Quantity{
-				Value:    item.Cantidad,
-				UnitCode: item.UnidadMedida,
-			},
+			InvoicedQuantity: cantidadItem(item),
 			LineExtensionAmount: &models.Amount{
 				Value:      item.ValorVenta,
 				CurrencyID: moneda,
@@ -624,34 +1117,21 @@ func (s *ConversionService) convertInvoiceLines(items []models.Item, moneda stri
 				SellersItemIdentification: &models.SellersItemIdentification{
 					ID: item.Codigo,
 				},
-				ClassifiedTaxCategory: s.convertClassifiedTaxCategory(item),
-			},
-			Price: &models.Price{
-				PriceAmount: &models.Amount{
-					Value:      item.PrecioUnitario,
-					CurrencyID: moneda,
-				},
+				CommodityClassification: clasificacionItem(item),
+				ClassifiedTaxCategory:   s.convertClassifiedTaxCategory(item, tasaIGV),
+				AdditionalItemProperty:  propiedadesItem(item),
 			},
 		}
 
-		// Referencia de precios (para diferentes tipos de afectación)
-		if item.TipoAfectacion != models.GravadoOneroso {
-			invoiceLine.PricingReference = &models.PricingReference{
-				AlternativeConditionPrice: []models.AlternativeConditionPrice{
-					{
-						PriceAmount: &models.Amount{
-							Value:      item.ValorUnitario,
-							CurrencyID: moneda,
-						},
-						PriceTypeCode: "01", // Precio unitario (incluye el IGV)
-					},
-				},
-			}
-		}
+		// Precio unitario y valor referencial (catálogo 16)
+		invoiceLine.PricingReference, invoiceLine.Price = s.convertPrecios(item, moneda)
+
+		// Cargos y descuentos por línea (catálogo 53)
+		invoiceLine.AllowanceCharge = s.convertAllowanceCharges(item.CargosDescuentos, moneda)
 
 		// Impuestos por línea
 		if len(item.ImpuestoItem) > 0 {
-			taxTotals, err := s.convertItemTaxTotals(item.ImpuestoItem, moneda)
+			taxTotals, err := s.convertItemTaxTotals(item, moneda)
 			if err != nil {
 				return nil, fmt.Errorf("error converting item tax totals: %v", err)
 			}
@@ -664,16 +1144,13 @@ func (s *ConversionService) convertInvoiceLines(items []models.Item, moneda stri
 	return invoiceLines, nil
 }
 
-func (s *ConversionService) convertCreditNoteLines(items []models.Item, moneda string) ([]models.CreditNoteLine, error) {
+func (s *ConversionService) convertCreditNoteLines(items []models.Item, moneda string, tasaIGV float64) ([]models.CreditNoteLine, error) {
 	var creditNoteLines []models.CreditNoteLine
 
 	for _, item := range items {
 		creditNoteLine := models.CreditNoteLine{
 			ID: strconv.Itoa(item.ID),
-			CreditedQuantity: &models.Quantity{
-				Value:    item.Cantidad,
-				UnitCode: item.UnidadMedida,
-			},
+			CreditedQuantity: cantidadItem(item),
 			LineExtensionAmount: &models.Amount{
 				Value:      item.ValorVenta,
 				CurrencyID: moneda,
@@ -683,16 +1160,15 @@ func (s *ConversionService) convertCreditNoteLines(items []models.Item, moneda s
 				SellersItemIdentification: &models.SellersItemIdentification{
 					ID: item.Codigo,
 				},
-				ClassifiedTaxCategory: s.convertClassifiedTaxCategory(item),
-			},
-			Price: &models.Price{
-				PriceAmount: &models.Amount{
-					Value:      item.PrecioUnitario,
-					CurrencyID: moneda,
-				},
+				CommodityClassification: clasificacionItem(item),
+				ClassifiedTaxCategory:   s.convertClassifiedTaxCategory(item, tasaIGV),
+				AdditionalItemProperty:  propiedadesItem(item),
 			},
 		}
 
+		// Precio unitario y valor referencial (catálogo 16)
+		creditNoteLine.PricingReference, creditNoteLine.Price = s.convertPrecios(item, moneda)
+
 		creditNoteLines = append(creditNoteLines, creditNoteLine)
 	}
 
@@ -700,16 +1176,13 @@ func (s *ConversionService) convertCreditNoteLines(items []models.Item, moneda s
 }
 
 // Conversión de items a DebitNoteLine
-func (s *ConversionService) convertDebitNoteLines(items []models.Item, moneda string) ([]models.DebitNoteLine, error) {
+func (s *ConversionService) convertDebitNoteLines(items []models.Item, moneda string, tasaIGV float64) ([]models.DebitNoteLine, error) {
 	var debitNoteLines []models.DebitNoteLine
 
 	for _, item := range items {
 		debitNoteLine := models.DebitNoteLine{
 			ID: strconv.Itoa(item.ID),
-			DebitedQuantity: &models.Quantity{
-				Value:    item.Cantidad,
-				UnitCode: item.UnidadMedida,
-			},
+			DebitedQuantity: cantidadItem(item),
 			LineExtensionAmount: &models.Amount{
 				Value:      item.ValorVenta,
 				CurrencyID: moneda,
@@ -719,34 +1192,18 @@ func (s *ConversionService) convertDebitNoteLines(items []models.Item, moneda st
 				SellersItemIdentification: &models.SellersItemIdentification{
 					ID: item.Codigo,
 				},
-				ClassifiedTaxCategory: s.convertClassifiedTaxCategory(item),
-			},
-			Price: &models.Price{
-				PriceAmount: &models.Amount{
-					Value:      item.ValorUnitario,
-					CurrencyID: moneda,
-				},
+				CommodityClassification: clasificacionItem(item),
+				ClassifiedTaxCategory:   s.convertClassifiedTaxCategory(item, tasaIGV),
+				AdditionalItemProperty:  propiedadesItem(item),
 			},
 		}
 
-		// Referencia de precios (para diferentes tipos de afectación)
-		if item.TipoAfectacion != models.GravadoOneroso {
-			debitNoteLine.PricingReference = &models.PricingReference{
-				AlternativeConditionPrice: []models.AlternativeConditionPrice{
-					{
-						PriceAmount: &models.Amount{
-							Value:      item.ValorUnitario,
-							CurrencyID: moneda,
-						},
-						PriceTypeCode: "01", // Precio unitario (incluye el IGV)
-					},
-				},
-			}
-		}
+		// Precio unitario y valor referencial (catálogo 16)
+		debitNoteLine.PricingReference, debitNoteLine.Price = s.convertPrecios(item, moneda)
 
 		// Impuestos por línea
 		if len(item.ImpuestoItem) > 0 {
-			taxTotals, err := s.convertItemTaxTotals(item.ImpuestoItem, moneda)
+			taxTotals, err := s.convertItemTaxTotals(item, moneda)
 			if err != nil {
 				return nil, fmt.Errorf("error converting item tax totals: %v", err)
 			}
@@ -759,117 +1216,152 @@ func (s *ConversionService) convertDebitNoteLines(items []models.Item, moneda st
 	return debitNoteLines, nil
 }
 
-// Cambia el ID de TaxCategory para operaciones gravadas a "S"
-func (s *ConversionService) convertClassifiedTaxCategory(item models.Item) []models.ClassifiedTaxCategory {
+// convertPrecios genera el precio de la línea (cac:Price, sin impuestos) y la
+// referencia de precios: código 01 con el precio unitario con impuestos para
+// operaciones onerosas, o código 02 con el valor referencial para las gratuitas,
+// cuyo precio es cero
+func (s *ConversionService) convertPrecios(item models.Item, moneda string) (*models.PricingReference, *models.Price) {
+	priceTypeCode := "01"
+	referencial := item.PrecioUnitario
+	valorUnitario := item.ValorUnitario
+
+	if item.TipoAfectacion.EsGratuita() {
+		priceTypeCode = "02"
+		referencial = item.ValorUnitario
+		valorUnitario = 0
+	} else if referencial == 0 && item.Cantidad > 0 {
+		referencial = redondear(item.ValorTotal / item.Cantidad)
+	}
+
+	pricingReference := &models.PricingReference{
+		AlternativeConditionPrice: []models.AlternativeConditionPrice{
+			{
+				PriceAmount: &models.Amount{
+					Value:      referencial,
+					CurrencyID: moneda,
+				},
+				PriceTypeCode: priceTypeCode,
+			},
+		},
+	}
+	price := &models.Price{
+		PriceAmount: &models.Amount{
+			Value:      valorUnitario,
+			CurrencyID: moneda,
+		},
+	}
+
+	return pricingReference, price
+}
+
+// convertClassifiedTaxCategory informa la categoría de impuesto del ítem según
+// su afectación. tasaIGV es la tasa vigente para el régimen del emisor en la
+// fecha de emisión, la misma de los subtotales de la línea.
+func (s *ConversionService) convertClassifiedTaxCategory(item models.Item, tasaIGV float64) []models.ClassifiedTaxCategory {
 	var categories []models.ClassifiedTaxCategory
 
-	var id, taxExemptionReasonCode string
-	percent := 18.0 // Por defecto IGV, puedes parametrizar si es variable
-
-	switch item.TipoAfectacion.String() {
-	case "10": // Gravado - Operación Onerosa
-		id = "S"
-		taxExemptionReasonCode = "10"
-	case "20": // Exonerado
-		id = "E"
-		taxExemptionReasonCode = "20"
-	case "30": // Inafecto
-		id = "O"
-		taxExemptionReasonCode = "30"
-	case "11": // Gravado - Operación Gratuita (Bonificación)
-		id = "G"
-		taxExemptionReasonCode = "11"
-	case "21": // Transferencia gratuita
-		id = "G"
-		taxExemptionReasonCode = "21"
-	// Puedes agregar más casos según catálogo 07
-	default:
-		id = "S"
-		taxExemptionReasonCode = "10"
+	// Tributo y categoría según la afectación del IGV (catálogos 05 y 07)
+	tributo := item.TipoAfectacion.Tributo()
+	percent := tasaIGV
+	switch {
+	case tributo == models.SUNATConstants.EXPCode:
+		percent = 0
+	case tributo == models.SUNATConstants.IVAPCode:
+		percent = models.TasaIVAP
+	case item.TipoAfectacion.EsGratuita() && !item.TipoAfectacion.EsGravada():
+		// Igual que en impuestosGratuitos: sin IGV referencial
+		percent = 0
 	}
 
 	categories = append(categories, models.ClassifiedTaxCategory{
-		ID:                        id,
+		ID:                        s.getTaxCategoryID(tributo),
 		Percent:                   percent,
-		TaxExemptionReasonCode:    taxExemptionReasonCode,
+		TaxExemptionReasonCode:    item.TipoAfectacion.String(),
 		TaxScheme: &models.TaxScheme{
 			ID: &models.ID{
-				Value:            "1000",
+				Value:            tributo,
 				SchemeID:         "UN/ECE 5153",
 				SchemeName:       "Codigo de tributos",
 				SchemeAgencyName: "PE:SUNAT",
 			},
-			Name:        "IGV",
-			TaxTypeCode: "VAT",
+			Name:        s.getTaxSchemeName(tributo),
+			TaxTypeCode: s.getTaxTypeCode(tributo),
 		},
 	})
 	return categories
 }
 
-func (s *ConversionService) convertItemTaxTotals(impuestosItem []models.ImpuestoItem, moneda string) ([]models.TaxTotal, error) {
-	var taxTotals []models.TaxTotal
+// convertItemTaxTotals genera el cac:TaxTotal de una línea. Para los tributos
+// asociados a la afectación del IGV se informa el código del catálogo 07.
+func (s *ConversionService) convertItemTaxTotals(item models.Item, moneda string) ([]models.TaxTotal, error) {
+	var totalAmount float64
+	var taxSubtotals []models.TaxSubtotal
 
-	for _, impuesto := range impuestosItem {
-		taxTotal := models.TaxTotal{
-			TaxAmount: &models.Amount{
-				Value:      impuesto.MontoImpuesto,
-				CurrencyID: moneda,
-			},
-			TaxSubtotal: []models.TaxSubtotal{
-				{
-					TaxableAmount: &models.Amount{
-						Value:      impuesto.BaseImponible,
-						CurrencyID: moneda,
-					},
-					TaxAmount: &models.Amount{
-						Value:      impuesto.MontoImpuesto,
-						CurrencyID: moneda,
-					},
-					TaxCategory: &models.TaxCategory{
-						ID:      impuesto.CodigoImpuesto,
-						Percent: impuesto.Tasa,
-						TaxScheme: &models.TaxScheme{
-							ID: &models.ID{
-								Value:            impuesto.TipoImpuesto,
-								SchemeID:         "UN/ECE 5153",
-								SchemeName:       "Codigo de tributos",
-								SchemeAgencyName: "PE:SUNAT",
-							},
-							Name: s.getTaxSchemeName(impuesto.TipoImpuesto),
-							TaxTypeCode: "VAT",
-						},
-					},
+	for _, impuesto := range item.ImpuestoItem {
+		totalAmount += impuesto.MontoImpuesto
+
+		taxCategory := &models.TaxCategory{
+			ID:      s.getTaxCategoryID(impuesto.TipoImpuesto),
+			Percent: impuesto.Tasa,
+			TaxScheme: &models.TaxScheme{
+				ID: &models.ID{
+					Value:            impuesto.TipoImpuesto,
+					SchemeID:         "UN/ECE 5153",
+					SchemeName:       "Codigo de tributos",
+					SchemeAgencyName: "PE:SUNAT",
 				},
+				Name:        s.getTaxSchemeName(impuesto.TipoImpuesto),
+				TaxTypeCode: s.getTaxTypeCode(impuesto.TipoImpuesto),
 			},
 		}
+		if impuesto.TipoImpuesto == item.TipoAfectacion.Tributo() {
+			taxCategory.TaxExemptionReasonCode = item.TipoAfectacion.String()
+		}
 
-		taxTotals = append(taxTotals, taxTotal)
+		taxSubtotals = append(taxSubtotals, models.TaxSubtotal{
+			TaxableAmount: &models.Amount{
+				Value:      impuesto.BaseImponible,
+				CurrencyID: moneda,
+			},
+			TaxAmount: &models.Amount{
+				Value:      impuesto.MontoImpuesto,
+				CurrencyID: moneda,
+			},
+			TaxCategory: taxCategory,
+		})
 	}
 
-	return taxTotals, nil
+	return []models.TaxTotal{{
+		TaxAmount: &models.Amount{
+			Value:      redondear(totalAmount),
+			CurrencyID: moneda,
+		},
+		TaxSubtotal: taxSubtotals,
+	}}, nil
 }
 
+// getTaxSchemeName retorna el nombre del tributo (catálogo 05)
 func (s *ConversionService) getTaxSchemeName(tipoImpuesto string) string {
-	switch tipoImpuesto {
-	case models.SUNATConstants.IGVCode: // IGV
-		return "IGV"
-	case "1016": // IVAP
-		return "IVAP"
-	case models.SUNATConstants.ICBCode: // ISC
-		return "ISC"
-	case models.SUNATConstants.ISCCode: // EXP
-		return "EXP"
-	case "9996": // GRA
-		return "GRA"
-	case "9997": // EXO
-		return "EXO"
-	case "9998": // INA
-		return "INA"
-	case "9999": // OTROS
-		return "OTROS"
-	default:
-		return "IGV"
+	if nombre := catalogos.Atributo(catalogos.Tributo, tipoImpuesto, "nombre"); nombre != "" {
+		return nombre
+	}
+	return "IGV"
+}
+
+// getTaxTypeCode retorna el código internacional del tributo (catálogo 05)
+func (s *ConversionService) getTaxTypeCode(tipoImpuesto string) string {
+	if codigo := catalogos.Atributo(catalogos.Tributo, tipoImpuesto, "codigo_internacional"); codigo != "" {
+		return codigo
 	}
+	return "VAT"
+}
+
+// getTaxCategoryID retorna la categoría de impuesto (UN/ECE 5305) del tributo
+func (s *ConversionService) getTaxCategoryID(tipoImpuesto string) string {
+	if categoria := catalogos.Atributo(catalogos.Tributo, tipoImpuesto, "categoria"); categoria != "" {
+		return categoria
+	}
+	return "S"
 }
 
 // CalculateTotals calcula automáticamente los totales del comprobante
@@ -880,25 +1372,113 @@ func (s *ConversionService) CalculateTotals(comprobante *models.Comprobante) err
 	// Mapa para agrupar impuestos
 	impuestosMap := make(map[string]*models.Impuesto)
 
-	for _, item := range comprobante.Items {
+	// El día de emisión es el de Lima: de él dependen las tasas, el tipo de
+	// cambio y los plazos, sin importar la zona horaria en que llegó la fecha
+	comprobante.FechaEmision = models.HoraPeru(comprobante.FechaEmision)
+
+	if err := models.ValidarTipoOperacion(comprobante); err != nil {
+		return err
+	}
+	if err := models.ValidarExportacion(comprobante); err != nil {
+		return err
+	}
+	if err := models.ValidarPercepcion(comprobante); err != nil {
+		return err
+	}
+	if err := models.ValidarRetencion(comprobante); err != nil {
+		return err
+	}
+	if err := models.ValidarLiquidacionCompra(comprobante); err != nil {
+		return err
+	}
+	if err := models.ValidarIVAP(comprobante); err != nil {
+		return err
+	}
+	if err := models.ValidarDocumentosRelacionados(comprobante); err != nil {
+		return err
+	}
+	if err := models.ValidarPropiedadesItem(comprobante); err != nil {
+		return err
+	}
+	regimen := comprobante.Emisor.Regimen
+	tasaIGV, err := s.TasaService.TasaIGV(regimen, comprobante.FechaEmision)
+	if err != nil {
+		return err
+	}
+
+	for i := range comprobante.Items {
+		item := &comprobante.Items[i]
+		gratuita := item.TipoAfectacion.EsGratuita()
+		if gratuita && (item.DescuentoUnitario > 0 || len(item.CargosDescuentos) > 0) {
+			return fmt.Errorf("ítem %d: las operaciones gratuitas no admiten cargos ni descuentos", item.NumeroItem)
+		}
+
 		// Calcular valores del item
-		valorVenta := item.Cantidad * item.ValorUnitario
-		valorTotal := valorVenta + item.DescuentoUnitario
+		valorBruto := redondear(item.Cantidad * item.ValorUnitario)
+		valorVenta, err := s.aplicarCargosDescuentosItem(item, valorBruto, &totales)
+		if err != nil {
+			return fmt.Errorf("ítem %d: %v", item.NumeroItem, err)
+		}
+
+		// Las exportaciones no gravan IGV y se informan con el tributo 9995
+		if item.TipoAfectacion == models.Exportacion {
+			impuestosItem, err := impuestosExportacion(item.ImpuestoItem, valorVenta)
+			if err != nil {
+				return fmt.Errorf("ítem %d: %v", item.NumeroItem, err)
+			}
+			item.ImpuestoItem = impuestosItem
+		}
+
+		// ISC, IGV e ICBPER con las tasas vigentes a la fecha de emisión
+		if err := s.aplicarTasas(item, valorVenta, tasaIGV, regimen, comprobante.FechaEmision); err != nil {
+			return fmt.Errorf("ítem %d: %v", item.NumeroItem, err)
+		}
+
+		// El arroz pilado gravado tributa el IVAP (tributo 1016) en lugar del IGV
+		if item.TipoAfectacion == models.GravadoIVAP {
+			impuestosItem, err := impuestosIVAP(item.ImpuestoItem, valorVenta)
+			if err != nil {
+				return fmt.Errorf("ítem %d: %v", item.NumeroItem, err)
+			}
+			item.ImpuestoItem = impuestosItem
+		}
+
+		// Las operaciones gratuitas informan el IGV que les correspondería (tributo 9996) sin cobrarlo
+		if gratuita {
+			item.ImpuestoItem = impuestosGratuitos(*item, valorVenta, tasaIGV)
+		} else {
+			for _, impuestoItem := range item.ImpuestoItem {
+				if impuestoItem.TipoImpuesto == models.SUNATConstants.GRACode {
+					return fmt.Errorf("ítem %d: el tributo 9996 solo aplica a operaciones gratuitas", item.NumeroItem)
+				}
+			}
+		}
 
 		// Actualizar item con valores calculados
 		item.ValorVenta = valorVenta
-		item.ValorTotal = valorTotal
+		item.ValorTotal = valorVenta
+		for _, impuestoItem := range item.ImpuestoItem {
+			item.ValorTotal += impuestoItem.MontoImpuesto
+		}
+		item.ValorTotal = redondear(item.ValorTotal)
+		if gratuita {
+			item.ValorTotal = 0
+		}
 
 		// Clasificar según tipo de afectación
-		switch item.TipoAfectacion {
-		case models.GravadoOneroso:
-			totales.TotalVentaGravada += valorVenta
-		case models.GravadoGratuito:
+		switch {
+		case gratuita:
 			totales.TotalVentaGratuita += valorVenta
-		case models.Exonerado:
+		case item.TipoAfectacion == models.GravadoOneroso:
+			totales.TotalVentaGravada += valorVenta
+		case item.TipoAfectacion == models.GravadoIVAP:
+			totales.TotalVentaIVAP += valorVenta
+		case item.TipoAfectacion == models.Exonerado || item.TipoAfectacion == models.ExoneradoIVAP:
 			totales.TotalVentaExonerada += valorVenta
-		case models.Inafecto:
+		case item.TipoAfectacion == models.Inafecto || item.TipoAfectacion == models.InafectoIVAP:
 			totales.TotalVentaInafecta += valorVenta
+		case item.TipoAfectacion == models.Exportacion:
+			totales.TotalVentaExportacion += valorVenta
 		}
 
 		// Procesar impuestos del item
@@ -920,23 +1500,607 @@ func (s *ConversionService) CalculateTotals(comprobante *models.Comprobante) err
 		}
 	}
 
+	// Valor de venta de las líneas, antes de cargos/descuentos globales
+	totales.TotalVentaExportacion = redondear(totales.TotalVentaExportacion)
+	totales.TotalVentaGratuita = redondear(totales.TotalVentaGratuita)
+	totales.TotalVentaIVAP = redondear(totales.TotalVentaIVAP)
+	totales.TotalValorVenta = redondear(totales.TotalVentaGravada + totales.TotalVentaExonerada + totales.TotalVentaInafecta + totales.TotalVentaExportacion + totales.TotalVentaIVAP)
+
+	// Anticipos deducidos (descuentos globales 04, 05 y 06)
+	anticiposGravados, err := s.aplicarAnticipos(comprobante, &totales)
+	if err != nil {
+		return err
+	}
+
+	// Cargos y descuentos globales que afectan la base imponible del IGV
+	if err := s.aplicarCargosDescuentosGlobales(comprobante.CargosDescuentos, true, totales.TotalVentaGravada, &totales); err != nil {
+		return err
+	}
+	totales.TotalVentaGravada = redondear(totales.TotalVentaGravada - totales.TotalDescuentosBase + totales.TotalCargosBase - anticiposGravados)
+	if totales.TotalVentaGravada < 0 {
+		return fmt.Errorf("los descuentos globales superan el total de operaciones gravadas")
+	}
+	baseAjustada := totales.TotalDescuentosBase > 0 || totales.TotalCargosBase > 0 || anticiposGravados > 0
+
 	// Convertir mapa a slice
 	for _, impuesto := range impuestosMap {
+		if impuesto.TipoImpuesto == models.SUNATConstants.IGVCode && baseAjustada {
+			impuesto.BaseImponible = totales.TotalVentaGravada
+			impuesto.MontoImpuesto = impuesto.BaseImponible * impuesto.Tasa / 100
+		}
+		impuesto.BaseImponible = redondear(impuesto.BaseImponible)
+		impuesto.MontoImpuesto = redondear(impuesto.MontoImpuesto)
 		impuestos = append(impuestos, *impuesto)
-		totales.TotalImpuestos += impuesto.MontoImpuesto
+		// El IGV de las operaciones gratuitas no se cobra
+		if impuesto.TipoImpuesto != models.SUNATConstants.GRACode {
+			totales.TotalImpuestos += impuesto.MontoImpuesto
+		}
+	}
+	totales.TotalImpuestos = redondear(totales.TotalImpuestos)
+
+	// Calcular totales finales. El precio de venta incluye los anticipos, que se
+	// descuentan del importe total como PrepaidAmount
+	totales.TotalPrecioVenta = redondear(valorVentaNeto(totales) + totales.TotalImpuestos + totales.TotalAnticipos)
+
+	// Cargos y descuentos globales que no afectan la base se calculan sobre el precio de venta
+	if err := s.aplicarCargosDescuentosGlobales(comprobante.CargosDescuentos, false, totales.TotalPrecioVenta, &totales); err != nil {
+		return err
 	}
+	totales.TotalDescuentos = redondear(totales.TotalDescuentos)
+	totales.TotalCargos = redondear(totales.TotalCargos)
 
-	// Calcular totales finales
-	totales.TotalValorVenta = totales.TotalVentaGravada + totales.TotalVentaExonerada + totales.TotalVentaInafecta
-	totales.TotalPrecioVenta = totales.TotalValorVenta + totales.TotalImpuestos
-	totales.ImporteTotal = totales.TotalPrecioVenta - totales.TotalDescuentos - totales.TotalAnticipos + totales.Redondeo
+	totales.ImporteTotal = totales.TotalPrecioVenta - totales.TotalDescuentos + totales.TotalCargos - totales.TotalAnticipos + totales.Redondeo
 
 	// Redondear a 2 decimales
-	totales.ImporteTotal = math.Round(totales.ImporteTotal*100) / 100
+	totales.ImporteTotal = redondear(totales.ImporteTotal)
+
+	// La percepción se cobra sobre el importe total sin formar parte de él
+	if comprobante.Percepcion != nil {
+		tipoCambio, err := s.tipoCambioSoles(comprobante, comprobante.Percepcion.TipoCambio, "la percepción")
+		if err != nil {
+			return err
+		}
+		if err := calcularPercepcion(comprobante.Percepcion, totales.ImporteTotal, tipoCambio); err != nil {
+			return err
+		}
+		if comprobante.TipoMoneda != "PEN" {
+			comprobante.Percepcion.TipoCambio = tipoCambio
+		} else {
+			comprobante.Percepcion.TipoCambio = 0
+		}
+		comprobante.TipoOperacion = models.OperacionSujetaPercepcion
+	} else if comprobante.TipoOperacion == "" && (comprobante.Tipo == models.TipoFactura || comprobante.Tipo == models.TipoBoleta) {
+		comprobante.TipoOperacion = models.OperacionVentaInterna
+	} else if comprobante.TipoOperacion == "" && comprobante.Tipo == models.TipoLiquidacionCompra {
+		comprobante.TipoOperacion = models.OperacionCompraInterna
+	}
+
+	normalizarFormaPago(comprobante)
+
+	// La retención se descuenta del pago sin alterar el importe total y solo
+	// procede cuando la operación supera S/ 700
+	if comprobante.Retencion != nil {
+		tipoCambio, err := s.tipoCambioSoles(comprobante, comprobante.Retencion.TipoCambio, "la retención")
+		if err != nil {
+			return err
+		}
+		if redondear(totales.ImporteTotal*tipoCambio) > models.MontoMinimoRetencion {
+			calcularRetencion(comprobante.Retencion, totales.ImporteTotal, tipoCambio)
+			if comprobante.TipoMoneda != "PEN" {
+				comprobante.Retencion.TipoCambio = tipoCambio
+			} else {
+				comprobante.Retencion.TipoCambio = 0
+			}
+		} else {
+			comprobante.Retencion = nil
+		}
+	}
+
+	// En la liquidación de compra el comprador retiene el IGV y la renta del vendedor
+	if comprobante.Tipo == models.TipoLiquidacionCompra {
+		calcularLiquidacionCompra(comprobante, totales, impuestos)
+	}
 
 	// Actualizar comprobante
 	comprobante.Totales = totales
 	comprobante.Impuestos = impuestos
 
 	return nil
-}
\ No newline at end of file
+}
+
+// aplicarCargosDescuentosItem calcula los cargos/descuentos de un ítem y retorna
+// su valor de venta. El descuento unitario se registra como un descuento código 00.
+func (s *ConversionService) aplicarCargosDescuentosItem(item *models.Item, valorBruto float64, totales *models.Totales) (float64, error) {
+	if item.DescuentoUnitario > 0 && !tieneCodigo(item.CargosDescuentos, "00") {
+		item.CargosDescuentos = append(item.CargosDescuentos, models.CargoDescuento{
+			Codigo: "00",
+			Monto:  redondear(item.DescuentoUnitario * item.Cantidad),
+		})
+	}
+
+	valorVenta := valorBruto
+	afectaBase := false
+	for j := range item.CargosDescuentos {
+		cd := &item.CargosDescuentos[j]
+		if err := models.ValidarCargoDescuento(*cd, false); err != nil {
+			return 0, err
+		}
+		completarCargoDescuento(cd, valorBruto)
+
+		motivo, err := models.BuscarMotivoCargoDescuento(cd.Codigo)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case motivo.AfectaBase && cd.EsCargo:
+			valorVenta += cd.Monto
+			afectaBase = true
+		case motivo.AfectaBase:
+			valorVenta -= cd.Monto
+			afectaBase = true
+		case cd.EsCargo:
+			totales.TotalCargos += cd.Monto
+		default:
+			totales.TotalDescuentos += cd.Monto
+		}
+	}
+
+	valorVenta = redondear(valorVenta)
+	if valorVenta < 0 {
+		return 0, fmt.Errorf("los descuentos superan el valor de venta del ítem")
+	}
+
+	// Si la base imponible cambió, recalcular el IGV del ítem
+	if afectaBase {
+		for j := range item.ImpuestoItem {
+			impuesto := &item.ImpuestoItem[j]
+			if impuesto.TipoImpuesto == models.SUNATConstants.IGVCode {
+				impuesto.BaseImponible = valorVenta
+				impuesto.MontoImpuesto = redondear(valorVenta * impuesto.Tasa / 100)
+			}
+		}
+	}
+
+	return valorVenta, nil
+}
+
+// aplicarCargosDescuentosGlobales acumula en los totales los cargos/descuentos
+// globales que afectan (o no) la base imponible, calculados sobre la base indicada
+func (s *ConversionService) aplicarCargosDescuentosGlobales(cargosDescuentos []models.CargoDescuento, afectaBase bool, base float64, totales *models.Totales) error {
+	for j := range cargosDescuentos {
+		cd := &cargosDescuentos[j]
+		if err := models.ValidarCargoDescuento(*cd, true); err != nil {
+			return err
+		}
+
+		motivo, err := models.BuscarMotivoCargoDescuento(cd.Codigo)
+		if err != nil {
+			return err
+		}
+		if motivo.AfectaBase != afectaBase || models.EsDescuentoAnticipo(cd.Codigo) {
+			continue
+		}
+		completarCargoDescuento(cd, base)
+
+		switch {
+		case afectaBase && cd.EsCargo:
+			totales.TotalCargosBase += cd.Monto
+		case afectaBase:
+			totales.TotalDescuentosBase += cd.Monto
+		case cd.EsCargo:
+			totales.TotalCargos += cd.Monto
+		default:
+			totales.TotalDescuentos += cd.Monto
+		}
+	}
+
+	totales.TotalCargosBase = redondear(totales.TotalCargosBase)
+	totales.TotalDescuentosBase = redondear(totales.TotalDescuentosBase)
+	return nil
+}
+
+// aplicarAnticipos genera los descuentos globales por los anticipos informados
+// y los deduce de las operaciones gravadas (04), exoneradas (05) o inafectas (06).
+// Retorna el valor deducido de las operaciones gravadas.
+func (s *ConversionService) aplicarAnticipos(comprobante *models.Comprobante, totales *models.Totales) (float64, error) {
+	if len(comprobante.Anticipos) > 0 {
+		if comprobante.EsAnticipo {
+			return 0, fmt.Errorf("un comprobante de anticipo no puede deducir otros anticipos")
+		}
+		if comprobante.Tipo != models.TipoFactura && comprobante.Tipo != models.TipoBoleta {
+			return 0, fmt.Errorf("solo facturas y boletas pueden deducir anticipos")
+		}
+	}
+
+	generar := true
+	for _, cd := range comprobante.CargosDescuentos {
+		if models.EsDescuentoAnticipo(cd.Codigo) {
+			generar = false
+			break
+		}
+	}
+	if !generar && len(comprobante.Anticipos) == 0 {
+		return 0, fmt.Errorf("los descuentos por anticipos requieren informar los anticipos deducidos")
+	}
+
+	for _, anticipo := range comprobante.Anticipos {
+		if err := models.ValidarAnticipo(anticipo); err != nil {
+			return 0, err
+		}
+		totales.TotalAnticipos += anticipo.Monto
+
+		if generar {
+			codigo := anticipo.CodigoDescuento
+			if codigo == "" {
+				codigo = "04"
+			}
+			monto := anticipo.Monto
+			if codigo == "04" {
+				// El anticipo se gravó con la tasa vigente a la fecha de su pago
+				fechaPago := comprobante.FechaEmision
+				if anticipo.FechaPago != nil {
+					fechaPago = *anticipo.FechaPago
+				}
+				tasaIGV, err := s.TasaService.TasaIGV(comprobante.Emisor.Regimen, fechaPago)
+				if err != nil {
+					return 0, err
+				}
+				monto = anticipo.Monto / (1 + tasaIGV/100)
+			}
+			comprobante.CargosDescuentos = append(comprobante.CargosDescuentos, models.CargoDescuento{
+				Codigo: codigo,
+				Monto:  redondear(monto),
+			})
+		}
+	}
+	totales.TotalAnticipos = redondear(totales.TotalAnticipos)
+
+	var gravados float64
+	for j := range comprobante.CargosDescuentos {
+		cd := &comprobante.CargosDescuentos[j]
+		if !models.EsDescuentoAnticipo(cd.Codigo) {
+			continue
+		}
+		if err := models.ValidarCargoDescuento(*cd, true); err != nil {
+			return 0, err
+		}
+
+		switch cd.Codigo {
+		case "04":
+			completarCargoDescuento(cd, totales.TotalVentaGravada)
+			gravados += cd.Monto
+		case "05":
+			completarCargoDescuento(cd, totales.TotalVentaExonerada)
+			totales.TotalVentaExonerada = redondear(totales.TotalVentaExonerada - cd.Monto)
+		case "06":
+			completarCargoDescuento(cd, totales.TotalVentaInafecta)
+			totales.TotalVentaInafecta = redondear(totales.TotalVentaInafecta - cd.Monto)
+		}
+	}
+
+	if totales.TotalVentaExonerada < 0 || totales.TotalVentaInafecta < 0 {
+		return 0, fmt.Errorf("los anticipos superan el total de operaciones exoneradas o inafectas")
+	}
+
+	return redondear(gravados), nil
+}
+
+// aplicarTasas calcula los tributos de un ítem con las tasas vigentes a la fecha
+// de emisión: el ISC sin tasa informada, el ICBPER por unidad y, para la
+// afectación 10, el IGV sobre el valor de venta más el ISC
+func (s *ConversionService) aplicarTasas(item *models.Item, valorVenta, tasaIGV float64, regimen string, fecha time.Time) error {
+	var isc float64
+	for i := range item.ImpuestoItem {
+		impuesto := &item.ImpuestoItem[i]
+		switch impuesto.TipoImpuesto {
+		case models.SUNATConstants.ISCCode:
+			if impuesto.Tasa == 0 && impuesto.MontoImpuesto == 0 {
+				tasa, err := s.TasaService.Tasa(models.TributoISC, regimen, fecha)
+				if err != nil {
+					return err
+				}
+				impuesto.BaseImponible = valorVenta
+				impuesto.Tasa = tasa
+				impuesto.MontoImpuesto = redondear(valorVenta * tasa / 100)
+			}
+			isc += impuesto.MontoImpuesto
+		case models.SUNATConstants.ICBCode:
+			tarifa, err := s.TasaService.Tasa(models.TributoICBPER, regimen, fecha)
+			if err != nil {
+				return err
+			}
+			if impuesto.Tasa > 0 && impuesto.Tasa != tarifa {
+				return fmt.Errorf("el ICBPER vigente al %s es %.2f por bolsa, no %.2f", fecha.Format("2006-01-02"), tarifa, impuesto.Tasa)
+			}
+			impuesto.Tasa = tarifa
+			impuesto.MontoImpuesto = redondear(item.Cantidad * tarifa)
+		}
+	}
+
+	if item.TipoAfectacion != models.GravadoOneroso {
+		return nil
+	}
+
+	base := redondear(valorVenta + isc)
+	igv := models.ImpuestoItem{
+		TipoImpuesto:   models.SUNATConstants.IGVCode,
+		CodigoImpuesto: "IGV",
+		BaseImponible:  base,
+		Tasa:           tasaIGV,
+		MontoImpuesto:  redondear(base * tasaIGV / 100),
+	}
+	for i, impuesto := range item.ImpuestoItem {
+		if impuesto.TipoImpuesto != models.SUNATConstants.IGVCode {
+			continue
+		}
+		if impuesto.Tasa > 0 && impuesto.Tasa != tasaIGV {
+			return fmt.Errorf("la tasa del IGV vigente al %s es %v%%, no %v%%", fecha.Format("2006-01-02"), tasaIGV, impuesto.Tasa)
+		}
+		item.ImpuestoItem[i] = igv
+		return nil
+	}
+	item.ImpuestoItem = append(item.ImpuestoItem, igv)
+	return nil
+}
+
+// valorVentaNeto retorna el valor de venta luego de cargos, descuentos globales
+// que afectan la base y anticipos deducidos (TaxExclusiveAmount)
+func valorVentaNeto(totales models.Totales) float64 {
+	return redondear(totales.TotalVentaGravada + totales.TotalVentaExonerada + totales.TotalVentaInafecta + totales.TotalVentaExportacion + totales.TotalVentaIVAP)
+}
+
+// Leyendas del catálogo 52 que se generan a partir del contenido del comprobante
+const (
+	LeyendaMontoEnLetras        = "1000"
+	LeyendaTransferenciaGratuita = "1002"
+)
+
+// notasComprobante genera las notas del comprobante: la leyenda 1000 con el
+// importe total en letras, las demás leyendas del catálogo 52 que exige su
+// contenido y, sin código de leyenda, las observaciones de texto libre
+func notasComprobante(comprobante *models.Comprobante) ([]models.Note, error) {
+	montoEnLetras, err := letras.Monto(comprobante.Totales.ImporteTotal, comprobante.TipoMoneda)
+	if err != nil {
+		return nil, fmt.Errorf("error expresando el importe total en letras: %v", err)
+	}
+	notas := []models.Note{{Value: montoEnLetras, LanguageLocaleID: LeyendaMontoEnLetras}}
+
+	if comprobante.Totales.TotalVentaGratuita > 0 {
+		notas = append(notas, leyenda(LeyendaTransferenciaGratuita))
+	}
+	// Leyenda propia del tipo de operación (detracción, percepción, IVAP)
+	if comprobante.Tipo == models.TipoFactura || comprobante.Tipo == models.TipoBoleta || comprobante.Tipo == models.TipoLiquidacionCompra {
+		if codigo := catalogos.Atributo(catalogos.TipoOperacion, tipoOperacion(comprobante), "leyenda"); codigo != "" {
+			notas = append(notas, leyenda(codigo))
+		}
+	}
+
+	if observaciones := strings.TrimSpace(comprobante.Observaciones); observaciones != "" {
+		notas = append(notas, models.Note{Value: observaciones})
+	}
+	return notas, nil
+}
+
+// leyenda retorna la nota con el texto del catálogo 52 para el código
+func leyenda(codigo string) models.Note {
+	return models.Note{
+		Value:            strings.ToUpper(catalogos.Descripcion(catalogos.Leyenda, codigo)),
+		LanguageLocaleID: codigo,
+	}
+}
+
+// calcularPercepcion completa el régimen, la tasa y los montos de la percepción,
+// que siempre se expresan en soles
+func calcularPercepcion(percepcion *models.Percepcion, importeTotal, tipoCambio float64) error {
+	codigo, tasa, err := models.SeleccionarRegimenPercepcion(percepcion, regimenPercepcionDefecto())
+	if err != nil {
+		return err
+	}
+
+	base := redondear(importeTotal * tipoCambio)
+	percepcion.CodigoRegimen = codigo
+	percepcion.Porcentaje = tasa
+	percepcion.BaseImponible = base
+	percepcion.Monto = redondear(base * tasa / 100)
+	percepcion.MontoTotal = redondear(base + percepcion.Monto)
+	return nil
+}
+
+// tipoCambioSoles retorna el tipo de cambio venta con el que se convierten a
+// soles los montos de un comprobante en moneda extranjera: el informado en el
+// comprobante o, en su defecto, el publicado para la fecha de emisión
+func (s *ConversionService) tipoCambioSoles(comprobante *models.Comprobante, informado float64, concepto string) (float64, error) {
+	if comprobante.TipoMoneda == "" || comprobante.TipoMoneda == "PEN" {
+		return 1, nil
+	}
+	if informado > 0 {
+		return informado, nil
+	}
+	if s.TipoCambioService == nil {
+		return 0, fmt.Errorf("indique el tipo de cambio de %s para comprobantes en %s", concepto, comprobante.TipoMoneda)
+	}
+
+	tipoCambio, err := s.TipoCambioService.Consultar(comprobante.TipoMoneda, comprobante.FechaEmision)
+	if err != nil {
+		return 0, fmt.Errorf("error obteniendo el tipo de cambio de %s: %v", concepto, err)
+	}
+	return tipoCambio.Venta, nil
+}
+
+// calcularRetencion completa la tasa y los montos de la retención del IGV. La
+// base y la retención se expresan en soles y el monto neto, en la moneda del
+// comprobante.
+func calcularRetencion(retencion *models.Retencion, importeTotal, tipoCambio float64) {
+	base := redondear(importeTotal * tipoCambio)
+	retencion.Porcentaje = models.TasaRetencion
+	retencion.BaseImponible = base
+	retencion.Monto = redondear(base * models.TasaRetencion / 100)
+	retencion.MontoNeto = redondear(importeTotal - retencion.Monto/tipoCambio)
+}
+
+// calcularLiquidacionCompra completa las retenciones de la liquidación de
+// compra: todo el IGV y la renta sobre el valor de venta, que se descuentan del
+// importe que se paga al vendedor
+func calcularLiquidacionCompra(comprobante *models.Comprobante, totales models.Totales, impuestos []models.Impuesto) {
+	if comprobante.Liquidacion == nil {
+		comprobante.Liquidacion = &models.LiquidacionCompra{}
+	}
+	liquidacion := comprobante.Liquidacion
+
+	liquidacion.IGVRetenido = 0
+	for _, impuesto := range impuestos {
+		if impuesto.TipoImpuesto == models.SUNATConstants.IGVCode {
+			liquidacion.IGVRetenido += impuesto.MontoImpuesto
+		}
+	}
+	liquidacion.IGVRetenido = redondear(liquidacion.IGVRetenido)
+	liquidacion.PorcentajeRenta = models.TasaRetencionRenta
+	liquidacion.BaseRenta = totales.TotalValorVenta
+	liquidacion.RentaRetenida = redondear(totales.TotalValorVenta * models.TasaRetencionRenta / 100)
+	liquidacion.MontoNeto = redondear(totales.ImporteTotal - liquidacion.IGVRetenido - liquidacion.RentaRetenida)
+}
+
+// normalizarFormaPago completa la forma de pago: las facturas y liquidaciones
+// de compra sin forma de pago se emiten al contado, las cuotas se numeran en el orden recibido (como
+// Cuota001, Cuota002...) y una venta al crédito sin fecha de vencimiento vence
+// con su última cuota
+func normalizarFormaPago(comprobante *models.Comprobante) {
+	if comprobante.FormaPago == nil {
+		if comprobante.Tipo == models.TipoFactura || comprobante.Tipo == models.TipoLiquidacionCompra {
+			comprobante.FormaPago = &models.FormaPago{TipoPago: models.FormaPagoContado}
+		}
+		return
+	}
+
+	formaPago := comprobante.FormaPago
+	if tipoPago := models.NormalizarTipoPago(formaPago.TipoPago); tipoPago != "" {
+		formaPago.TipoPago = tipoPago
+	}
+	for i := range formaPago.Cuotas {
+		formaPago.Cuotas[i].NumeroCuota = i + 1
+	}
+	if formaPago.TipoPago != models.FormaPagoCredito || comprobante.FechaVencimiento != nil {
+		return
+	}
+	for _, cuota := range formaPago.Cuotas {
+		if comprobante.FechaVencimiento == nil || cuota.FechaVencimiento.After(*comprobante.FechaVencimiento) {
+			vencimiento := cuota.FechaVencimiento
+			comprobante.FechaVencimiento = &vencimiento
+		}
+	}
+}
+
+// regimenPercepcionDefecto retorna el régimen de percepción configurado para el
+// emisor (venta interna si no se configuró)
+func regimenPercepcionDefecto() string {
+	if config.AppConfig != nil && config.AppConfig.SUNAT.PercepcionRegimen != "" {
+		return config.AppConfig.SUNAT.PercepcionRegimen
+	}
+	return "51"
+}
+
+// impuestosGratuitos reemplaza los tributos del IGV de un ítem gratuito por el
+// tributo 9996, cuyo monto es el IGV referencial de las afectaciones gravadas
+// (11 a 16) y cero para las exoneradas e inafectas
+func impuestosGratuitos(item models.Item, valorVenta, tasaIGV float64) []models.ImpuestoItem {
+	tasa := 0.0
+	if item.TipoAfectacion.EsGravada() {
+		tasa = tasaIGV
+	}
+
+	var impuestos []models.ImpuestoItem
+	for _, impuesto := range item.ImpuestoItem {
+		switch impuesto.TipoImpuesto {
+		case models.SUNATConstants.IGVCode, models.SUNATConstants.GRACode, "9997", "9998":
+		default:
+			impuestos = append(impuestos, impuesto)
+		}
+	}
+
+	return append(impuestos, models.ImpuestoItem{
+		TipoImpuesto:   models.SUNATConstants.GRACode,
+		CodigoImpuesto: "GRA",
+		BaseImponible:  valorVenta,
+		Tasa:           tasa,
+		MontoImpuesto:  redondear(valorVenta * tasa / 100),
+	})
+}
+
+// impuestosIVAP reemplaza el tributo IVAP de un ítem gravado con arroz pilado
+// por el 4% de su valor de venta. El IVAP no se combina con el IGV.
+func impuestosIVAP(impuestosItem []models.ImpuestoItem, valorVenta float64) ([]models.ImpuestoItem, error) {
+	var impuestos []models.ImpuestoItem
+	for _, impuesto := range impuestosItem {
+		switch impuesto.TipoImpuesto {
+		case models.SUNATConstants.IGVCode:
+			return nil, fmt.Errorf("los ítems gravados con IVAP no pueden incluir IGV")
+		case models.SUNATConstants.IVAPCode:
+			if impuesto.Tasa > 0 && impuesto.Tasa != models.TasaIVAP {
+				return nil, fmt.Errorf("la tasa del IVAP es %v%%, no %v%%", models.TasaIVAP, impuesto.Tasa)
+			}
+		default:
+			impuestos = append(impuestos, impuesto)
+		}
+	}
+
+	return append(impuestos, models.ImpuestoItem{
+		TipoImpuesto:   models.SUNATConstants.IVAPCode,
+		CodigoImpuesto: "IVAP",
+		BaseImponible:  valorVenta,
+		Tasa:           models.TasaIVAP,
+		MontoImpuesto:  redondear(valorVenta * models.TasaIVAP / 100),
+	}), nil
+}
+
+// impuestosExportacion valida que un ítem de exportación no grave IGV y
+// completa su tributo 9995 con la base igual al valor de venta
+func impuestosExportacion(impuestosItem []models.ImpuestoItem, valorVenta float64) ([]models.ImpuestoItem, error) {
+	var impuestos []models.ImpuestoItem
+	for _, impuesto := range impuestosItem {
+		switch {
+		case impuesto.TipoImpuesto == models.SUNATConstants.EXPCode:
+			continue
+		case impuesto.TipoImpuesto == models.SUNATConstants.IGVCode && impuesto.MontoImpuesto > 0:
+			return nil, fmt.Errorf("un ítem de exportación no puede gravar IGV")
+		case impuesto.TipoImpuesto == models.SUNATConstants.IGVCode:
+			continue
+		}
+		impuestos = append(impuestos, impuesto)
+	}
+
+	return append(impuestos, models.ImpuestoItem{
+		TipoImpuesto:   models.SUNATConstants.EXPCode,
+		CodigoImpuesto: "EXP",
+		BaseImponible:  valorVenta,
+		Tasa:           0,
+		MontoImpuesto:  0,
+	}), nil
+}
+
+// completarCargoDescuento completa la base, el factor o el monto que falten
+func completarCargoDescuento(cd *models.CargoDescuento, base float64) {
+	if cd.MontoBase == 0 {
+		cd.MontoBase = redondear(base)
+	}
+	if cd.Monto == 0 && cd.Factor > 0 {
+		cd.Monto = redondear(cd.MontoBase * cd.Factor)
+	}
+	if cd.Factor == 0 && cd.MontoBase > 0 {
+		cd.Factor = math.Round(cd.Monto/cd.MontoBase*100000) / 100000
+	}
+	cd.Monto = redondear(cd.Monto)
+}
+
+func tieneCodigo(cargosDescuentos []models.CargoDescuento, codigo string) bool {
+	for _, cd := range cargosDescuentos {
+		if cd.Codigo == codigo {
+			return true
+		}
+	}
+	return false
+}
+
+// redondear redondea un monto a 2 decimales
+func redondear(valor float64) float64 {
+	return math.Round(valor*100) / 100
+}
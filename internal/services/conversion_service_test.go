@@ -0,0 +1,1012 @@
+package services
+
+import (
+	"errors"
+	"facturacion_sunat_api_go/internal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// facturaPrueba arma una factura en soles con los ítems indicados
+func facturaPrueba(items ...models.Item) *models.Comprobante {
+	return &models.Comprobante{
+		Tipo:         models.TipoFactura,
+		Serie:        "F001",
+		Numero:       "00000001",
+		FechaEmision: time.Date(2024, time.June, 20, 10, 30, 0, 0, time.UTC),
+		TipoMoneda:   "PEN",
+		Emisor: models.Emisor{
+			RUC:           "20100070970",
+			RazonSocial:   "SUPERMERCADOS PERUANOS S.A.",
+			TipoDocumento: "6",
+			Direccion:     "CALLE MORELLI 181, PISO 2",
+			Distrito:      "SAN BORJA",
+			Provincia:     "LIMA",
+			Departamento:  "LIMA",
+			CodigoPais:    "PE",
+		},
+		Receptor: models.Receptor{
+			TipoDocumento:   "6",
+			NumeroDocumento: "20103129061",
+			RazonSocial:     "COMERCIAL LAVAGNA S.A.C.",
+		},
+		Items: items,
+	}
+}
+
+// itemPrueba arma un ítem sin impuestos informados; CalculateTotals los completa
+func itemPrueba(numero int, afectacion models.TipoAfectacionIGV, cantidad, valorUnitario float64) models.Item {
+	return models.Item{
+		ID:             numero,
+		NumeroItem:     numero,
+		Codigo:         "P001",
+		Descripcion:    "Producto de prueba",
+		UnidadMedida:   "NIU",
+		Cantidad:       cantidad,
+		ValorUnitario:  valorUnitario,
+		TipoAfectacion: afectacion,
+	}
+}
+
+// invoiceUBL convierte la factura a UBL
+func invoiceUBL(t *testing.T, service *ConversionService, comprobante *models.Comprobante) *models.UBLInvoice {
+	t.Helper()
+	ubl, err := service.ConvertToUBL(comprobante)
+	require.NoError(t, err)
+	invoice, ok := ubl.(*models.UBLInvoice)
+	require.True(t, ok)
+	return invoice
+}
+
+// lineasUBL convierte la factura a UBL y retorna sus líneas
+func lineasUBL(t *testing.T, service *ConversionService, comprobante *models.Comprobante) []models.InvoiceLine {
+	return invoiceUBL(t, service, comprobante).InvoiceLines
+}
+
+// TestClassifiedTaxCategoryTasa verifica que la categoría del ítem informe la
+// misma tasa que los subtotales de la línea, según régimen y fecha de emisión
+func TestClassifiedTaxCategoryTasa(t *testing.T) {
+	tests := []struct {
+		name       string
+		regimen    string
+		fecha      time.Time
+		afectacion models.TipoAfectacionIGV
+		percent    float64
+	}{
+		{"régimen general", models.RegimenGeneral, time.Date(2024, time.June, 20, 12, 0, 0, 0, time.UTC), models.GravadoOneroso, 18},
+		{"restaurante MYPE 2024", models.RegimenRestauranteMYPE, time.Date(2024, time.June, 20, 12, 0, 0, 0, time.UTC), models.GravadoOneroso, 10},
+		{"restaurante MYPE 2027", models.RegimenRestauranteMYPE, time.Date(2027, time.March, 1, 12, 0, 0, 0, time.UTC), models.GravadoOneroso, 12},
+		{"exonerado", models.RegimenRestauranteMYPE, time.Date(2024, time.June, 20, 12, 0, 0, 0, time.UTC), models.Exonerado, 10},
+		{"gratuito gravado", models.RegimenRestauranteMYPE, time.Date(2024, time.June, 20, 12, 0, 0, 0, time.UTC), models.GravadoGratuito, 10},
+		{"gratuito inafecto", models.RegimenGeneral, time.Date(2024, time.June, 20, 12, 0, 0, 0, time.UTC), models.InafectoBonificacion, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewConversionService(NewUBLService())
+			comprobante := facturaPrueba(itemPrueba(1, tt.afectacion, 2, 100))
+			comprobante.Emisor.Regimen = tt.regimen
+			comprobante.FechaEmision = tt.fecha
+			require.NoError(t, service.CalculateTotals(comprobante))
+
+			lineas := lineasUBL(t, service, comprobante)
+			require.Len(t, lineas, 1)
+			require.Len(t, lineas[0].Item.ClassifiedTaxCategory, 1)
+			assert.Equal(t, tt.percent, lineas[0].Item.ClassifiedTaxCategory[0].Percent)
+
+			// La tasa de la categoría coincide con la del subtotal de la línea
+			for _, taxTotal := range lineas[0].TaxTotal {
+				for _, subtotal := range taxTotal.TaxSubtotal {
+					if subtotal.TaxCategory.TaxScheme.ID.Value == lineas[0].Item.ClassifiedTaxCategory[0].TaxScheme.ID.Value {
+						assert.Equal(t, tt.percent, subtotal.TaxCategory.Percent)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestRegimenNoRegistrado verifica que un régimen fuera de la tabla de tasas se rechace
+func TestRegimenNoRegistrado(t *testing.T) {
+	service := NewConversionService(NewUBLService())
+	comprobante := facturaPrueba(itemPrueba(1, models.GravadoOneroso, 1, 100))
+	comprobante.Emisor.Regimen = "RUS"
+
+	err := service.CalculateTotals(comprobante)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrRegimenInvalido))
+	assert.Contains(t, err.Error(), `"RUS"`)
+}
+
+// casoTotales es un caso de CalculateTotals: los totales esperados o el error,
+// y opcionalmente los elementos UBL que el caso debe generar
+type casoTotales struct {
+	name        string
+	comprobante *models.Comprobante
+	totales     models.Totales
+	wantErr     string
+	configurar  func(service *ConversionService)
+	verificar   func(t *testing.T, comprobante *models.Comprobante, invoice *models.UBLInvoice)
+}
+
+// probarTotales ejecuta CalculateTotals sobre cada caso, compara todos los
+// totales y, si el caso lo pide, verifica el UBL generado
+func probarTotales(t *testing.T, tests []casoTotales) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewConversionService(NewUBLService())
+			if tt.configurar != nil {
+				tt.configurar(service)
+			}
+			err := service.CalculateTotals(tt.comprobante)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.totales, tt.comprobante.Totales)
+			if tt.verificar != nil {
+				tt.verificar(t, tt.comprobante, invoiceUBL(t, service, tt.comprobante))
+			}
+		})
+	}
+}
+
+// cargoUBL verifica que los cac:AllowanceCharge sean exactamente un cargo o
+// descuento con el código, indicador, factor, monto y base indicados
+func cargoUBL(t *testing.T, cargos []models.AllowanceCharge, codigo string, esCargo bool, factor, monto, base float64) {
+	t.Helper()
+	require.Len(t, cargos, 1)
+	assert.Equal(t, codigo, cargos[0].AllowanceChargeReasonCode.Value)
+	assert.Equal(t, esCargo, cargos[0].ChargeIndicator)
+	assert.Equal(t, factor, cargos[0].MultiplierFactorNumeric)
+	require.NotNil(t, cargos[0].Amount)
+	assert.Equal(t, monto, cargos[0].Amount.Value)
+	if base == 0 {
+		assert.Nil(t, cargos[0].BaseAmount)
+		return
+	}
+	require.NotNil(t, cargos[0].BaseAmount)
+	assert.Equal(t, base, cargos[0].BaseAmount.Value)
+}
+
+// conCargos agrega cargos/descuentos al primer ítem del comprobante
+func conCargos(comprobante *models.Comprobante, cargos ...models.CargoDescuento) *models.Comprobante {
+	comprobante.Items[0].CargosDescuentos = cargos
+	return comprobante
+}
+
+// conCargosGlobales agrega cargos/descuentos globales al comprobante
+func conCargosGlobales(comprobante *models.Comprobante, cargos ...models.CargoDescuento) *models.Comprobante {
+	comprobante.CargosDescuentos = cargos
+	return comprobante
+}
+
+func TestCalculateTotalsCargosDescuentos(t *testing.T) {
+	descuentoUnitario := facturaPrueba(itemPrueba(1, models.GravadoOneroso, 2, 100))
+	descuentoUnitario.Items[0].DescuentoUnitario = 5
+
+	probarTotales(t, []casoTotales{
+		{
+			name:        "sin cargos ni descuentos",
+			comprobante: facturaPrueba(itemPrueba(1, models.GravadoOneroso, 2, 100)),
+			totales:     models.Totales{TotalVentaGravada: 200, TotalImpuestos: 36, TotalValorVenta: 200, TotalPrecioVenta: 236, ImporteTotal: 236},
+			verificar: func(t *testing.T, _ *models.Comprobante, invoice *models.UBLInvoice) {
+				assert.Empty(t, invoice.AllowanceCharge)
+				assert.Empty(t, invoice.InvoiceLines[0].AllowanceCharge)
+				assert.Nil(t, invoice.LegalMonetaryTotal.AllowanceTotalAmount)
+				assert.Nil(t, invoice.LegalMonetaryTotal.ChargeTotalAmount)
+			},
+		},
+		{
+			name:        "descuento unitario del ítem (00)",
+			comprobante: descuentoUnitario,
+			totales:     models.Totales{TotalVentaGravada: 190, TotalImpuestos: 34.2, TotalValorVenta: 190, TotalPrecioVenta: 224.2, ImporteTotal: 224.2},
+			verificar: func(t *testing.T, comprobante *models.Comprobante, invoice *models.UBLInvoice) {
+				// El descuento unitario se informa como un descuento 00 con su base y factor
+				assert.Equal(t, []models.CargoDescuento{{Codigo: "00", Factor: 0.05, Monto: 10, MontoBase: 200}}, comprobante.Items[0].CargosDescuentos)
+				cargoUBL(t, invoice.InvoiceLines[0].AllowanceCharge, "00", false, 0.05, 10, 200)
+				assert.Empty(t, invoice.AllowanceCharge)
+			},
+		},
+		{
+			name: "cargo del ítem que afecta la base (47)",
+			comprobante: conCargos(facturaPrueba(itemPrueba(1, models.GravadoOneroso, 2, 100)),
+				models.CargoDescuento{EsCargo: true, Codigo: "47", Factor: 0.1}),
+			totales: models.Totales{TotalVentaGravada: 220, TotalImpuestos: 39.6, TotalValorVenta: 220, TotalPrecioVenta: 259.6, ImporteTotal: 259.6},
+			verificar: func(t *testing.T, _ *models.Comprobante, invoice *models.UBLInvoice) {
+				cargoUBL(t, invoice.InvoiceLines[0].AllowanceCharge, "47", true, 0.1, 20, 200)
+				assert.Equal(t, 220.0, invoice.InvoiceLines[0].LineExtensionAmount.Value)
+			},
+		},
+		{
+			name: "descuento del ítem que no afecta la base (01)",
+			comprobante: conCargos(facturaPrueba(itemPrueba(1, models.GravadoOneroso, 2, 100)),
+				models.CargoDescuento{Codigo: "01", Monto: 10}),
+			totales: models.Totales{TotalVentaGravada: 200, TotalDescuentos: 10, TotalImpuestos: 36, TotalValorVenta: 200, TotalPrecioVenta: 236, ImporteTotal: 226},
+			verificar: func(t *testing.T, _ *models.Comprobante, invoice *models.UBLInvoice) {
+				cargoUBL(t, invoice.InvoiceLines[0].AllowanceCharge, "01", false, 0.05, 10, 200)
+				require.NotNil(t, invoice.LegalMonetaryTotal.AllowanceTotalAmount)
+				assert.Equal(t, 10.0, invoice.LegalMonetaryTotal.AllowanceTotalAmount.Value)
+			},
+		},
+		{
+			name: "factor de compensación del ítem (07)",
+			comprobante: conCargos(facturaPrueba(itemPrueba(1, models.GravadoOneroso, 2, 100)),
+				models.CargoDescuento{Codigo: "07", Monto: 5}),
+			totales: models.Totales{TotalVentaGravada: 200, TotalDescuentos: 5, TotalImpuestos: 36, TotalValorVenta: 200, TotalPrecioVenta: 236, ImporteTotal: 231},
+			verificar: func(t *testing.T, _ *models.Comprobante, invoice *models.UBLInvoice) {
+				cargoUBL(t, invoice.InvoiceLines[0].AllowanceCharge, "07", false, 0.025, 5, 200)
+			},
+		},
+		{
+			name: "descuento global que afecta la base (02)",
+			comprobante: conCargosGlobales(facturaPrueba(itemPrueba(1, models.GravadoOneroso, 2, 100)),
+				models.CargoDescuento{Codigo: "02", Factor: 0.1}),
+			totales: models.Totales{TotalVentaGravada: 180, TotalDescuentosBase: 20, TotalImpuestos: 32.4, TotalValorVenta: 200, TotalPrecioVenta: 212.4, ImporteTotal: 212.4},
+			verificar: func(t *testing.T, _ *models.Comprobante, invoice *models.UBLInvoice) {
+				cargoUBL(t, invoice.AllowanceCharge, "02", false, 0.1, 20, 200)
+				assert.Empty(t, invoice.InvoiceLines[0].AllowanceCharge)
+				assert.Equal(t, 180.0, invoice.LegalMonetaryTotal.TaxExclusiveAmount.Value)
+			},
+		},
+		{
+			name: "cargo global que no afecta la base (50)",
+			comprobante: conCargosGlobales(facturaPrueba(itemPrueba(1, models.GravadoOneroso, 2, 100)),
+				models.CargoDescuento{EsCargo: true, Codigo: "50", Factor: 0.05}),
+			totales: models.Totales{TotalVentaGravada: 200, TotalCargos: 11.8, TotalImpuestos: 36, TotalValorVenta: 200, TotalPrecioVenta: 236, ImporteTotal: 247.8},
+			verificar: func(t *testing.T, _ *models.Comprobante, invoice *models.UBLInvoice) {
+				cargoUBL(t, invoice.AllowanceCharge, "50", true, 0.05, 11.8, 236)
+				require.NotNil(t, invoice.LegalMonetaryTotal.ChargeTotalAmount)
+				assert.Equal(t, 11.8, invoice.LegalMonetaryTotal.ChargeTotalAmount.Value)
+			},
+		},
+		{
+			name: "descuento del ítem mayor al valor de venta",
+			comprobante: conCargos(facturaPrueba(itemPrueba(1, models.GravadoOneroso, 2, 100)),
+				models.CargoDescuento{Codigo: "00", Monto: 250}),
+			wantErr: "superan el valor de venta del ítem",
+		},
+		{
+			name: "descuento global mayor a las operaciones gravadas",
+			comprobante: conCargosGlobales(facturaPrueba(itemPrueba(1, models.GravadoOneroso, 2, 100)),
+				models.CargoDescuento{Codigo: "02", Monto: 300}),
+			wantErr: "superan el total de operaciones gravadas",
+		},
+		{
+			name: "código global en el ítem",
+			comprobante: conCargos(facturaPrueba(itemPrueba(1, models.GravadoOneroso, 2, 100)),
+				models.CargoDescuento{Codigo: "02", Monto: 10}),
+			wantErr: "no corresponde a un cargo/descuento por ítem",
+		},
+		{
+			name: "código fuera del catálogo 53",
+			comprobante: conCargos(facturaPrueba(itemPrueba(1, models.GravadoOneroso, 2, 100)),
+				models.CargoDescuento{Codigo: "99", Monto: 10}),
+			wantErr: "código de cargo/descuento inválido",
+		},
+	})
+}
+
+func TestCalculateTotalsRedondeo(t *testing.T) {
+	probarTotales(t, []casoTotales{
+		{
+			name: "valores de venta redondeados por línea",
+			comprobante: facturaPrueba(
+				itemPrueba(1, models.GravadoOneroso, 3, 33.333),
+				itemPrueba(2, models.Exonerado, 1, 10.125),
+			),
+			totales: models.Totales{TotalVentaGravada: 100, TotalVentaExonerada: 10.13, TotalImpuestos: 18, TotalValorVenta: 110.13, TotalPrecioVenta: 128.13, ImporteTotal: 128.13},
+		},
+		{
+			name: "IGV redondeado por línea",
+			comprobante: facturaPrueba(
+				itemPrueba(1, models.GravadoOneroso, 1, 10.01),
+				itemPrueba(2, models.GravadoOneroso, 1, 10.01),
+			),
+			totales: models.Totales{TotalVentaGravada: 20.02, TotalImpuestos: 3.6, TotalValorVenta: 20.02, TotalPrecioVenta: 23.62, ImporteTotal: 23.62},
+		},
+	})
+}
+
+func TestRedondear(t *testing.T) {
+	tests := []struct {
+		valor float64
+		want  float64
+	}{
+		{0, 0},
+		{1.994, 1.99},
+		{1.996, 2},
+		{0.125, 0.13},
+		{-0.125, -0.13},
+		{99.999, 100},
+		{1234567.891, 1234567.89},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, redondear(tt.valor), "redondear(%v)", tt.valor)
+	}
+}
+
+// conAnticipos agrega anticipos a deducir al comprobante
+func conAnticipos(comprobante *models.Comprobante, anticipos ...models.Anticipo) *models.Comprobante {
+	comprobante.Anticipos = anticipos
+	return comprobante
+}
+
+func TestCalculateTotalsAnticipos(t *testing.T) {
+	gravado := conAnticipos(facturaPrueba(itemPrueba(1, models.GravadoOneroso, 1, 1000)),
+		models.Anticipo{TipoDocumento: "02", Serie: "F001", Numero: "10", Monto: 118})
+
+	pagoMYPE := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	tasaDelPago := conAnticipos(facturaPrueba(itemPrueba(1, models.GravadoOneroso, 1, 1000)),
+		models.Anticipo{TipoDocumento: "02", Serie: "F001", Numero: "10", Monto: 110, FechaPago: &pagoMYPE})
+	tasaDelPago.Emisor.Regimen = models.RegimenRestauranteMYPE
+	tasaDelPago.FechaEmision = time.Date(2027, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	notaCredito := conAnticipos(facturaPrueba(itemPrueba(1, models.GravadoOneroso, 1, 1000)),
+		models.Anticipo{TipoDocumento: "02", Serie: "F001", Numero: "10", Monto: 118})
+	notaCredito.Tipo = models.TipoNotaCredito
+
+	deAnticipo := conAnticipos(facturaPrueba(itemPrueba(1, models.GravadoOneroso, 1, 1000)),
+		models.Anticipo{TipoDocumento: "02", Serie: "F001", Numero: "10", Monto: 118})
+	deAnticipo.EsAnticipo = true
+
+	probarTotales(t, []casoTotales{
+		{
+			name:        "anticipo gravado (04)",
+			comprobante: gravado,
+			totales:     models.Totales{TotalVentaGravada: 900, TotalAnticipos: 118, TotalImpuestos: 162, TotalValorVenta: 1000, TotalPrecioVenta: 1180, ImporteTotal: 1062},
+			verificar: func(t *testing.T, comprobante *models.Comprobante, invoice *models.UBLInvoice) {
+				// El anticipo gravado se deduce sin IGV como descuento global 04
+				assert.Equal(t, []models.CargoDescuento{{Codigo: "04", Factor: 0.1, Monto: 100, MontoBase: 1000}}, comprobante.CargosDescuentos)
+				cargoUBL(t, invoice.AllowanceCharge, "04", false, 0.1, 100, 1000)
+
+				// El documento del anticipo y su pago se vinculan por el número de orden
+				require.Len(t, invoice.AdditionalDocumentReference, 1)
+				referencia := invoice.AdditionalDocumentReference[0]
+				assert.Equal(t, "F001-10", referencia.ID)
+				assert.Equal(t, "02", referencia.DocumentTypeCode.Value)
+				assert.Equal(t, "1", referencia.DocumentStatusCode.Value)
+				assert.Equal(t, "20100070970", referencia.IssuerParty.PartyIdentification.ID.Value)
+				require.Len(t, invoice.PrepaidPayment, 1)
+				assert.Equal(t, "1", invoice.PrepaidPayment[0].ID.Value)
+				assert.Equal(t, 118.0, invoice.PrepaidPayment[0].PaidAmount.Value)
+				assert.Empty(t, invoice.PrepaidPayment[0].PaidDate)
+
+				require.NotNil(t, invoice.LegalMonetaryTotal.PrepaidAmount)
+				assert.Equal(t, 118.0, invoice.LegalMonetaryTotal.PrepaidAmount.Value)
+				assert.Equal(t, 1062.0, invoice.LegalMonetaryTotal.PayableAmount.Value)
+			},
+		},
+		{
+			name:        "anticipo gravado con la tasa vigente a su pago",
+			comprobante: tasaDelPago,
+			totales:     models.Totales{TotalVentaGravada: 900, TotalAnticipos: 110, TotalImpuestos: 108, TotalValorVenta: 1000, TotalPrecioVenta: 1118, ImporteTotal: 1008},
+			verificar: func(t *testing.T, _ *models.Comprobante, invoice *models.UBLInvoice) {
+				require.Len(t, invoice.PrepaidPayment, 1)
+				assert.Equal(t, "2024-06-01", invoice.PrepaidPayment[0].PaidDate)
+			},
+		},
+		{
+			name: "anticipo exonerado (05)",
+			comprobante: conAnticipos(facturaPrueba(itemPrueba(1, models.Exonerado, 1, 500)),
+				models.Anticipo{TipoDocumento: "02", Serie: "F001", Numero: "10", Monto: 100, CodigoDescuento: "05"}),
+			totales: models.Totales{TotalVentaExonerada: 400, TotalAnticipos: 100, TotalValorVenta: 500, TotalPrecioVenta: 500, ImporteTotal: 400},
+			verificar: func(t *testing.T, _ *models.Comprobante, invoice *models.UBLInvoice) {
+				cargoUBL(t, invoice.AllowanceCharge, "05", false, 0.2, 100, 500)
+				require.Len(t, invoice.PrepaidPayment, 1)
+				assert.Equal(t, 100.0, invoice.PrepaidPayment[0].PaidAmount.Value)
+			},
+		},
+		{
+			name: "anticipo exonerado mayor a las operaciones exoneradas",
+			comprobante: conAnticipos(facturaPrueba(itemPrueba(1, models.Exonerado, 1, 500)),
+				models.Anticipo{TipoDocumento: "02", Serie: "F001", Numero: "10", Monto: 600, CodigoDescuento: "05"}),
+			wantErr: "superan el total de operaciones exoneradas",
+		},
+		{
+			name:        "anticipo en una nota de crédito",
+			comprobante: notaCredito,
+			wantErr:     "solo facturas y boletas",
+		},
+		{
+			name:        "anticipo que deduce otros anticipos",
+			comprobante: deAnticipo,
+			wantErr:     "no puede deducir otros anticipos",
+		},
+		{
+			name: "descuento por anticipo sin anticipos",
+			comprobante: conCargosGlobales(facturaPrueba(itemPrueba(1, models.GravadoOneroso, 1, 1000)),
+				models.CargoDescuento{Codigo: "04", Monto: 100}),
+			wantErr: "requieren informar los anticipos",
+		},
+		{
+			name: "anticipo con un tipo de documento inválido",
+			comprobante: conAnticipos(facturaPrueba(itemPrueba(1, models.GravadoOneroso, 1, 1000)),
+				models.Anticipo{TipoDocumento: "01", Serie: "F001", Numero: "10", Monto: 118}),
+			wantErr: "debe ser 02 o 03",
+		},
+	})
+}
+
+// exportacionPrueba arma una factura de exportación en dólares a un cliente no domiciliado
+func exportacionPrueba(items ...models.Item) *models.Comprobante {
+	comprobante := facturaPrueba(items...)
+	comprobante.TipoMoneda = "USD"
+	comprobante.TipoOperacion = "0200"
+	comprobante.Receptor = models.Receptor{
+		TipoDocumento:   "0",
+		NumeroDocumento: "US123456789",
+		RazonSocial:     "ACME IMPORTS INC.",
+		CodigoPais:      "US",
+	}
+	return comprobante
+}
+
+func TestCalculateTotalsExportacion(t *testing.T) {
+	conEntrega := exportacionPrueba(itemPrueba(1, models.Exportacion, 5, 200))
+	conEntrega.CondicionesEntrega = &models.CondicionesEntrega{Incoterm: "FOB", LugarEntrega: "TERMINAL PORTUARIO DEL CALLAO", CodigoPais: "PE"}
+
+	incotermInvalido := exportacionPrueba(itemPrueba(1, models.Exportacion, 5, 200))
+	incotermInvalido.CondicionesEntrega = &models.CondicionesEntrega{Incoterm: "XYZ"}
+
+	conIGV := exportacionPrueba(itemPrueba(1, models.Exportacion, 5, 200))
+	conIGV.Items[0].ImpuestoItem = []models.ImpuestoItem{{TipoImpuesto: models.SUNATConstants.IGVCode, CodigoImpuesto: "IGV", BaseImponible: 1000, Tasa: 18, MontoImpuesto: 180}}
+
+	domiciliado := exportacionPrueba(itemPrueba(1, models.Exportacion, 5, 200))
+	domiciliado.Receptor = facturaPrueba().Receptor
+
+	probarTotales(t, []casoTotales{
+		{
+			name:        "exportación de bienes (0200)",
+			comprobante: exportacionPrueba(itemPrueba(1, models.Exportacion, 5, 200)),
+			totales:     models.Totales{TotalVentaExportacion: 1000, TotalValorVenta: 1000, TotalPrecioVenta: 1000, ImporteTotal: 1000},
+			verificar: func(t *testing.T, comprobante *models.Comprobante, invoice *models.UBLInvoice) {
+				// El ítem informa el tributo 9995 sin impuesto
+				assert.Equal(t, []models.ImpuestoItem{{TipoImpuesto: models.SUNATConstants.EXPCode, CodigoImpuesto: "EXP", BaseImponible: 1000}}, comprobante.Items[0].ImpuestoItem)
+				require.Len(t, invoice.TaxTotal, 1)
+				require.Len(t, invoice.TaxTotal[0].TaxSubtotal, 1)
+				subtotal := invoice.TaxTotal[0].TaxSubtotal[0]
+				assert.Equal(t, models.SUNATConstants.EXPCode, subtotal.TaxCategory.TaxScheme.ID.Value)
+				assert.Equal(t, 1000.0, subtotal.TaxableAmount.Value)
+				assert.Equal(t, 0.0, subtotal.TaxAmount.Value)
+				assert.Equal(t, "USD", subtotal.TaxableAmount.CurrencyID)
+				assert.Nil(t, invoice.DeliveryTerms)
+			},
+		},
+		{
+			name:        "exportación con Incoterm y lugar de entrega",
+			comprobante: conEntrega,
+			totales:     models.Totales{TotalVentaExportacion: 1000, TotalValorVenta: 1000, TotalPrecioVenta: 1000, ImporteTotal: 1000},
+			verificar: func(t *testing.T, _ *models.Comprobante, invoice *models.UBLInvoice) {
+				require.NotNil(t, invoice.DeliveryTerms)
+				assert.Equal(t, "FOB", invoice.DeliveryTerms.ID)
+				require.NotNil(t, invoice.DeliveryTerms.DeliveryLocation)
+				address := invoice.DeliveryTerms.DeliveryLocation.Address
+				assert.Equal(t, "TERMINAL PORTUARIO DEL CALLAO", address.StreetName)
+				assert.Equal(t, "PE", address.Country.IdentificationCode.Value)
+			},
+		},
+		{
+			name:        "Incoterm inválido",
+			comprobante: incotermInvalido,
+			wantErr:     "Incoterm inválido: XYZ",
+		},
+		{
+			name:        "ítem de exportación con IGV",
+			comprobante: conIGV,
+			wantErr:     "no puede gravar IGV",
+		},
+		{
+			name:        "exportación a un receptor domiciliado",
+			comprobante: domiciliado,
+			wantErr:     "debe ser no domiciliado",
+		},
+		{
+			name:        "exportación con un ítem gravado",
+			comprobante: exportacionPrueba(itemPrueba(1, models.Exportacion, 5, 200), itemPrueba(2, models.GravadoOneroso, 1, 100)),
+			wantErr:     "todos los ítems deben tener afectación 40",
+		},
+		{
+			name:        "afectación 40 en una venta interna",
+			comprobante: facturaPrueba(itemPrueba(1, models.Exportacion, 5, 200)),
+			wantErr:     "requiere un tipo de operación de exportación",
+		},
+	})
+}
+
+// leyendasUBL retorna los códigos de leyenda (catálogo 52) de las notas del UBL
+func leyendasUBL(invoice *models.UBLInvoice) []string {
+	codigos := []string{}
+	for _, nota := range invoice.Note {
+		codigos = append(codigos, nota.LanguageLocaleID)
+	}
+	return codigos
+}
+
+func TestCalculateTotalsGratuitas(t *testing.T) {
+	conDescuento := conCargos(facturaPrueba(itemPrueba(1, models.GravadoGratuito, 2, 50)),
+		models.CargoDescuento{Codigo: "00", Monto: 10})
+
+	tributoGratuito := facturaPrueba(itemPrueba(1, models.GravadoOneroso, 1, 100))
+	tributoGratuito.Items[0].ImpuestoItem = []models.ImpuestoItem{{TipoImpuesto: models.SUNATConstants.GRACode, CodigoImpuesto: "GRA", BaseImponible: 100, Tasa: 18, MontoImpuesto: 18}}
+
+	probarTotales(t, []casoTotales{
+		{
+			name:        "retiro gravado gratuito (11)",
+			comprobante: facturaPrueba(itemPrueba(1, models.GravadoGratuito, 2, 50)),
+			totales:     models.Totales{TotalVentaGratuita: 100},
+			verificar: func(t *testing.T, comprobante *models.Comprobante, invoice *models.UBLInvoice) {
+				// El IGV referencial de la afectación gravada se informa en el tributo 9996 sin cobrarse
+				assert.Equal(t, []models.ImpuestoItem{{TipoImpuesto: models.SUNATConstants.GRACode, CodigoImpuesto: "GRA", BaseImponible: 100, Tasa: 18, MontoImpuesto: 18}}, comprobante.Items[0].ImpuestoItem)
+				assert.Zero(t, comprobante.Items[0].ValorTotal)
+
+				require.Len(t, invoice.TaxTotal, 1)
+				require.Len(t, invoice.TaxTotal[0].TaxSubtotal, 1)
+				subtotal := invoice.TaxTotal[0].TaxSubtotal[0]
+				assert.Equal(t, models.SUNATConstants.GRACode, subtotal.TaxCategory.TaxScheme.ID.Value)
+				assert.Equal(t, 100.0, subtotal.TaxableAmount.Value)
+				assert.Equal(t, 18.0, subtotal.TaxAmount.Value)
+				assert.Equal(t, 0.0, invoice.TaxTotal[0].TaxAmount.Value)
+
+				// Precio cero y valor referencial con el código 02 del catálogo 16
+				linea := invoice.InvoiceLines[0]
+				assert.Equal(t, 0.0, linea.Price.PriceAmount.Value)
+				require.Len(t, linea.PricingReference.AlternativeConditionPrice, 1)
+				assert.Equal(t, "02", linea.PricingReference.AlternativeConditionPrice[0].PriceTypeCode)
+				assert.Equal(t, 50.0, linea.PricingReference.AlternativeConditionPrice[0].PriceAmount.Value)
+
+				// Leyenda 1002 de transferencia gratuita
+				assert.Contains(t, leyendasUBL(invoice), LeyendaTransferenciaGratuita)
+			},
+		},
+		{
+			name: "venta con bonificación inafecta (31)",
+			comprobante: facturaPrueba(
+				itemPrueba(1, models.GravadoOneroso, 1, 100),
+				itemPrueba(2, models.InafectoBonificacion, 1, 20),
+			),
+			totales: models.Totales{TotalVentaGravada: 100, TotalVentaGratuita: 20, TotalImpuestos: 18, TotalValorVenta: 100, TotalPrecioVenta: 118, ImporteTotal: 118},
+			verificar: func(t *testing.T, comprobante *models.Comprobante, invoice *models.UBLInvoice) {
+				// La bonificación inafecta no tiene IGV referencial
+				assert.Equal(t, []models.ImpuestoItem{{TipoImpuesto: models.SUNATConstants.GRACode, CodigoImpuesto: "GRA", BaseImponible: 20}}, comprobante.Items[1].ImpuestoItem)
+				assert.Equal(t, "01", invoice.InvoiceLines[0].PricingReference.AlternativeConditionPrice[0].PriceTypeCode)
+				assert.Equal(t, "02", invoice.InvoiceLines[1].PricingReference.AlternativeConditionPrice[0].PriceTypeCode)
+				assert.Contains(t, leyendasUBL(invoice), LeyendaTransferenciaGratuita)
+			},
+		},
+		{
+			name:        "venta onerosa sin leyenda de transferencia gratuita",
+			comprobante: facturaPrueba(itemPrueba(1, models.GravadoOneroso, 1, 100)),
+			totales:     models.Totales{TotalVentaGravada: 100, TotalImpuestos: 18, TotalValorVenta: 100, TotalPrecioVenta: 118, ImporteTotal: 118},
+			verificar: func(t *testing.T, _ *models.Comprobante, invoice *models.UBLInvoice) {
+				assert.NotContains(t, leyendasUBL(invoice), LeyendaTransferenciaGratuita)
+			},
+		},
+		{
+			name:        "operación gratuita con descuento",
+			comprobante: conDescuento,
+			wantErr:     "no admiten cargos ni descuentos",
+		},
+		{
+			name:        "tributo 9996 en una operación onerosa",
+			comprobante: tributoGratuito,
+			wantErr:     "solo aplica a operaciones gratuitas",
+		},
+	})
+}
+
+// percepcionPrueba arma una factura gravada de S/ 1,180 sujeta a percepción
+func percepcionPrueba(percepcion models.Percepcion, afectacion models.TipoAfectacionIGV, operacion string) *models.Comprobante {
+	comprobante := facturaPrueba(itemPrueba(1, afectacion, 1, 1000))
+	comprobante.Percepcion = &percepcion
+	comprobante.TipoOperacion = operacion
+	return comprobante
+}
+
+// percepcionUBL verifica los datos de la percepción, el cargo del catálogo 53 y
+// el importe a cobrar (PaymentTerms), ambos en soles
+func percepcionUBL(want models.Percepcion) func(t *testing.T, comprobante *models.Comprobante, invoice *models.UBLInvoice) {
+	return func(t *testing.T, comprobante *models.Comprobante, invoice *models.UBLInvoice) {
+		assert.Equal(t, want, *comprobante.Percepcion)
+		assert.Equal(t, models.OperacionSujetaPercepcion, comprobante.TipoOperacion)
+
+		cargoUBL(t, invoice.AllowanceCharge, want.CodigoRegimen, true, want.Porcentaje/100, want.Monto, want.BaseImponible)
+		assert.Equal(t, "PEN", invoice.AllowanceCharge[0].Amount.CurrencyID)
+		assert.Equal(t, "PEN", invoice.AllowanceCharge[0].BaseAmount.CurrencyID)
+
+		require.Len(t, invoice.PaymentTerms, 2)
+		terms := invoice.PaymentTerms[1]
+		assert.Equal(t, "Percepcion", terms.ID)
+		assert.Equal(t, want.MontoTotal, terms.Amount.Value)
+		assert.Equal(t, "PEN", terms.Amount.CurrencyID)
+
+		// La percepción no forma parte del importe total
+		assert.Equal(t, 1180.0, invoice.LegalMonetaryTotal.PayableAmount.Value)
+		assert.Equal(t, comprobante.TipoMoneda, invoice.LegalMonetaryTotal.PayableAmount.CurrencyID)
+	}
+}
+
+func TestCalculateTotalsPercepcion(t *testing.T) {
+	enDolares := percepcionPrueba(models.Percepcion{TipoCambio: 3.775}, models.GravadoOneroso, "")
+	enDolares.TipoMoneda = "USD"
+
+	publicado := percepcionPrueba(models.Percepcion{}, models.GravadoOneroso, "")
+	publicado.TipoMoneda = "USD"
+
+	sinTipoCambio := percepcionPrueba(models.Percepcion{}, models.GravadoOneroso, "")
+	sinTipoCambio.TipoMoneda = "USD"
+
+	totales := models.Totales{TotalVentaGravada: 1000, TotalImpuestos: 180, TotalValorVenta: 1000, TotalPrecioVenta: 1180, ImporteTotal: 1180}
+
+	probarTotales(t, []casoTotales{
+		{
+			name:        "régimen por defecto (51)",
+			comprobante: percepcionPrueba(models.Percepcion{}, models.GravadoOneroso, ""),
+			totales:     totales,
+			verificar:   percepcionUBL(models.Percepcion{CodigoRegimen: "51", Porcentaje: 2, BaseImponible: 1180, Monto: 23.6, MontoTotal: 1203.6}),
+		},
+		{
+			name:        "régimen por porcentaje (52)",
+			comprobante: percepcionPrueba(models.Percepcion{Porcentaje: 1}, models.GravadoOneroso, ""),
+			totales:     totales,
+			verificar:   percepcionUBL(models.Percepcion{CodigoRegimen: "52", Porcentaje: 1, BaseImponible: 1180, Monto: 11.8, MontoTotal: 1191.8}),
+		},
+		{
+			name:        "tasa especial (53)",
+			comprobante: percepcionPrueba(models.Percepcion{CodigoRegimen: "53"}, models.GravadoOneroso, models.OperacionSujetaPercepcion),
+			totales:     totales,
+			verificar:   percepcionUBL(models.Percepcion{CodigoRegimen: "53", Porcentaje: 0.5, BaseImponible: 1180, Monto: 5.9, MontoTotal: 1185.9}),
+		},
+		{
+			name:        "en dólares con el tipo de cambio informado",
+			comprobante: enDolares,
+			totales:     totales,
+			verificar:   percepcionUBL(models.Percepcion{CodigoRegimen: "51", Porcentaje: 2, BaseImponible: 4454.5, Monto: 89.09, MontoTotal: 4543.59, TipoCambio: 3.775}),
+		},
+		{
+			name:        "en dólares con el tipo de cambio publicado",
+			comprobante: publicado,
+			configurar: func(service *ConversionService) {
+				service.TipoCambioService = NewTipoCambioService(tipoCambioStorePrueba{"USD": 3.75})
+			},
+			totales:   totales,
+			verificar: percepcionUBL(models.Percepcion{CodigoRegimen: "51", Porcentaje: 2, BaseImponible: 4425, Monto: 88.5, MontoTotal: 4513.5, TipoCambio: 3.75}),
+		},
+		{name: "en dólares sin tipo de cambio", comprobante: sinTipoCambio, wantErr: "indique el tipo de cambio de la percepción para comprobantes en USD"},
+		{name: "porcentaje inexistente", comprobante: percepcionPrueba(models.Percepcion{Porcentaje: 3}, models.GravadoOneroso, ""), wantErr: "porcentaje de percepción inválido"},
+		{name: "porcentaje distinto al del régimen", comprobante: percepcionPrueba(models.Percepcion{CodigoRegimen: "51", Porcentaje: 1}, models.GravadoOneroso, ""), wantErr: "no corresponde al régimen de percepción 51"},
+		{name: "régimen que no es de percepción", comprobante: percepcionPrueba(models.Percepcion{CodigoRegimen: "62"}, models.GravadoOneroso, ""), wantErr: "régimen de percepción inválido: 62"},
+		{name: "operación exonerada", comprobante: percepcionPrueba(models.Percepcion{}, models.Exonerado, ""), wantErr: "solo aplica a operaciones gravadas"},
+		{name: "otro tipo de operación", comprobante: percepcionPrueba(models.Percepcion{}, models.GravadoOneroso, models.OperacionVentaInterna), wantErr: "requiere el tipo de operación 2001"},
+	})
+}
+
+// retencionPrueba arma una factura gravada a un agente de retención
+func retencionPrueba(moneda string, cantidad float64, retencion models.Retencion) *models.Comprobante {
+	comprobante := facturaPrueba(itemPrueba(1, models.GravadoOneroso, cantidad, 100))
+	comprobante.TipoMoneda = moneda
+	comprobante.Retencion = &retencion
+	return comprobante
+}
+
+// retencionUBL verifica los datos de la retención, el descuento 62 del
+// catálogo 53 y el monto retenido (PaymentTerms), ambos en soles
+func retencionUBL(want models.Retencion) func(t *testing.T, comprobante *models.Comprobante, invoice *models.UBLInvoice) {
+	return func(t *testing.T, comprobante *models.Comprobante, invoice *models.UBLInvoice) {
+		require.NotNil(t, comprobante.Retencion)
+		assert.Equal(t, want, *comprobante.Retencion)
+		assert.Equal(t, want.MontoNeto, comprobante.MontoPendientePago())
+
+		cargoUBL(t, invoice.AllowanceCharge, models.CodigoRetencion, false, 0.03, want.Monto, want.BaseImponible)
+		assert.Equal(t, "PEN", invoice.AllowanceCharge[0].Amount.CurrencyID)
+
+		require.Len(t, invoice.PaymentTerms, 2)
+		terms := invoice.PaymentTerms[1]
+		assert.Equal(t, "Retencion", terms.ID)
+		assert.Equal(t, models.TasaRetencion, terms.PaymentPercent)
+		assert.Equal(t, want.Monto, terms.Amount.Value)
+		assert.Equal(t, "PEN", terms.Amount.CurrencyID)
+	}
+}
+
+func TestCalculateTotalsRetencion(t *testing.T) {
+	totales := func(cantidad float64) models.Totales {
+		valor := cantidad * 100
+		return models.Totales{TotalVentaGravada: valor, TotalImpuestos: valor * 0.18, TotalValorVenta: valor, TotalPrecioVenta: valor * 1.18, ImporteTotal: valor * 1.18}
+	}
+
+	probarTotales(t, []casoTotales{
+		{
+			name:        "en soles sobre el mínimo",
+			comprobante: retencionPrueba("PEN", 10, models.Retencion{}),
+			totales:     totales(10),
+			verificar:   retencionUBL(models.Retencion{BaseImponible: 1180, Porcentaje: 3, Monto: 35.4, MontoNeto: 1144.6}),
+		},
+		{
+			name:        "en soles bajo el mínimo",
+			comprobante: retencionPrueba("PEN", 5, models.Retencion{}),
+			totales:     totales(5),
+			verificar: func(t *testing.T, comprobante *models.Comprobante, invoice *models.UBLInvoice) {
+				assert.Nil(t, comprobante.Retencion)
+				assert.Empty(t, invoice.AllowanceCharge)
+			},
+		},
+		{
+			name:        "en dólares con el tipo de cambio informado",
+			comprobante: retencionPrueba("USD", 5, models.Retencion{TipoCambio: 3.775}),
+			totales:     totales(5),
+			verificar:   retencionUBL(models.Retencion{BaseImponible: 2227.25, Porcentaje: 3, Monto: 66.82, MontoNeto: 572.3, TipoCambio: 3.775}),
+		},
+		{
+			name:        "en dólares con el tipo de cambio publicado",
+			comprobante: retencionPrueba("USD", 2, models.Retencion{}),
+			configurar: func(service *ConversionService) {
+				service.TipoCambioService = NewTipoCambioService(tipoCambioStorePrueba{"USD": 3.75})
+			},
+			totales:   totales(2),
+			verificar: retencionUBL(models.Retencion{BaseImponible: 885, Porcentaje: 3, Monto: 26.55, MontoNeto: 228.92, TipoCambio: 3.75}),
+		},
+		{
+			name:        "en dólares bajo el mínimo en soles",
+			comprobante: retencionPrueba("USD", 1, models.Retencion{TipoCambio: 3.75}),
+			totales:     totales(1),
+			verificar: func(t *testing.T, comprobante *models.Comprobante, _ *models.UBLInvoice) {
+				assert.Nil(t, comprobante.Retencion)
+			},
+		},
+		{name: "en dólares sin tipo de cambio", comprobante: retencionPrueba("USD", 10, models.Retencion{}), wantErr: "indique el tipo de cambio de la retención para comprobantes en USD"},
+		{name: "porcentaje distinto al 3%", comprobante: retencionPrueba("PEN", 10, models.Retencion{Porcentaje: 6}), wantErr: "el porcentaje de retención debe ser 3%"},
+	})
+}
+
+// ivapPrueba arma una factura de una operación sujeta al IVAP (2100)
+func ivapPrueba(items ...models.Item) *models.Comprobante {
+	comprobante := facturaPrueba(items...)
+	comprobante.TipoOperacion = models.OperacionIVAP
+	return comprobante
+}
+
+func TestCalculateTotalsIVAP(t *testing.T) {
+	tasaErrada := ivapPrueba(itemPrueba(1, models.GravadoIVAP, 10, 50))
+	tasaErrada.Items[0].ImpuestoItem = []models.ImpuestoItem{{TipoImpuesto: models.SUNATConstants.IVAPCode, CodigoImpuesto: "IVAP", Tasa: 18}}
+
+	conIGV := ivapPrueba(itemPrueba(1, models.GravadoIVAP, 10, 50))
+	conIGV.Items[0].ImpuestoItem = []models.ImpuestoItem{{TipoImpuesto: models.SUNATConstants.IGVCode, CodigoImpuesto: "IGV", Tasa: 18}}
+
+	probarTotales(t, []casoTotales{
+		{
+			name: "arroz pilado gravado y exonerado",
+			comprobante: ivapPrueba(
+				itemPrueba(1, models.GravadoIVAP, 10, 50),
+				itemPrueba(2, models.ExoneradoIVAP, 1, 100),
+			),
+			totales: models.Totales{TotalVentaExonerada: 100, TotalVentaIVAP: 500, TotalImpuestos: 20, TotalValorVenta: 600, TotalPrecioVenta: 620, ImporteTotal: 620},
+			verificar: func(t *testing.T, comprobante *models.Comprobante, invoice *models.UBLInvoice) {
+				assert.Equal(t, []models.ImpuestoItem{{TipoImpuesto: models.SUNATConstants.IVAPCode, CodigoImpuesto: "IVAP", BaseImponible: 500, Tasa: 4, MontoImpuesto: 20}}, comprobante.Items[0].ImpuestoItem)
+
+				// Subtotal del tributo 1016 con la tasa del 4%
+				require.Len(t, invoice.TaxTotal, 1)
+				assert.Equal(t, 20.0, invoice.TaxTotal[0].TaxAmount.Value)
+				var ivap *models.TaxSubtotal
+				for i, subtotal := range invoice.TaxTotal[0].TaxSubtotal {
+					if subtotal.TaxCategory.TaxScheme.ID.Value == models.SUNATConstants.IVAPCode {
+						ivap = &invoice.TaxTotal[0].TaxSubtotal[i]
+					}
+				}
+				require.NotNil(t, ivap)
+				assert.Equal(t, 500.0, ivap.TaxableAmount.Value)
+				assert.Equal(t, 20.0, ivap.TaxAmount.Value)
+				assert.Equal(t, 4.0, invoice.InvoiceLines[0].Item.ClassifiedTaxCategory[0].Percent)
+
+				// Tipo de operación 2100 y leyenda 2007
+				assert.Equal(t, models.OperacionIVAP, invoice.InvoiceTypeCode.ListID)
+				assert.Contains(t, leyendasUBL(invoice), "2007")
+			},
+		},
+		{
+			name:        "tasa del IVAP distinta al 4%",
+			comprobante: tasaErrada,
+			wantErr:     "la tasa del IVAP es 4%",
+		},
+		{
+			name:        "ítem IVAP con IGV",
+			comprobante: conIGV,
+			wantErr:     "no pueden incluir IGV",
+		},
+		{
+			name:        "ítem con IGV en una operación IVAP",
+			comprobante: ivapPrueba(itemPrueba(1, models.GravadoIVAP, 10, 50), itemPrueba(2, models.GravadoOneroso, 1, 100)),
+			wantErr:     "todos los ítems deben tener afectación 17, 27 o 37",
+		},
+		{
+			name:        "afectación 17 en una venta interna",
+			comprobante: facturaPrueba(itemPrueba(1, models.GravadoIVAP, 10, 50)),
+			wantErr:     "requiere el tipo de operación 2100",
+		},
+	})
+}
+
+// conImpuestos informa los tributos del primer ítem del comprobante
+func conImpuestos(comprobante *models.Comprobante, impuestos ...models.ImpuestoItem) *models.Comprobante {
+	comprobante.Items[0].ImpuestoItem = impuestos
+	return comprobante
+}
+
+// subtotalUBL retorna el subtotal del tributo (catálogo 05) en el TaxTotal del comprobante
+func subtotalUBL(t *testing.T, invoice *models.UBLInvoice, tributo string) models.TaxSubtotal {
+	t.Helper()
+	require.Len(t, invoice.TaxTotal, 1)
+	for _, subtotal := range invoice.TaxTotal[0].TaxSubtotal {
+		if subtotal.TaxCategory.TaxScheme.ID.Value == tributo {
+			return subtotal
+		}
+	}
+	require.Failf(t, "subtotal no encontrado", "el TaxTotal no informa el tributo %s", tributo)
+	return models.TaxSubtotal{}
+}
+
+func TestCalculateTotalsTasas(t *testing.T) {
+	mype := facturaPrueba(itemPrueba(1, models.GravadoOneroso, 1, 100))
+	mype.Emisor.Regimen = models.RegimenRestauranteMYPE
+
+	mypeTasaGeneral := conImpuestos(facturaPrueba(itemPrueba(1, models.GravadoOneroso, 1, 100)),
+		models.ImpuestoItem{TipoImpuesto: models.SUNATConstants.IGVCode, CodigoImpuesto: "IGV", Tasa: 18})
+	mypeTasaGeneral.Emisor.Regimen = models.RegimenRestauranteMYPE
+
+	bolsas2021 := conImpuestos(facturaPrueba(itemPrueba(1, models.GravadoOneroso, 2, 0.1)),
+		models.ImpuestoItem{TipoImpuesto: models.SUNATConstants.ICBCode, CodigoImpuesto: "ICBPER"})
+	bolsas2021.FechaEmision = time.Date(2021, time.May, 3, 12, 0, 0, 0, time.UTC)
+
+	probarTotales(t, []casoTotales{
+		{
+			name:        "IGV reducido de restaurantes MYPE",
+			comprobante: mype,
+			totales:     models.Totales{TotalVentaGravada: 100, TotalImpuestos: 10, TotalValorVenta: 100, TotalPrecioVenta: 110, ImporteTotal: 110},
+			verificar: func(t *testing.T, _ *models.Comprobante, invoice *models.UBLInvoice) {
+				igv := subtotalUBL(t, invoice, models.SUNATConstants.IGVCode)
+				assert.Equal(t, 10.0, igv.TaxAmount.Value)
+				assert.Equal(t, 10.0, igv.TaxCategory.Percent)
+				assert.Equal(t, 10.0, invoice.InvoiceLines[0].Item.ClassifiedTaxCategory[0].Percent)
+			},
+		},
+		{
+			name:        "tasa del IGV distinta a la vigente",
+			comprobante: mypeTasaGeneral,
+			wantErr:     "la tasa del IGV vigente al 2024-06-20 es 10%, no 18%",
+		},
+		{
+			name: "ISC informado forma parte de la base del IGV",
+			comprobante: conImpuestos(facturaPrueba(itemPrueba(1, models.GravadoOneroso, 1, 100)),
+				models.ImpuestoItem{TipoImpuesto: models.SUNATConstants.ISCCode, CodigoImpuesto: "ISC", BaseImponible: 100, Tasa: 10, MontoImpuesto: 10}),
+			totales: models.Totales{TotalVentaGravada: 100, TotalImpuestos: 29.8, TotalValorVenta: 100, TotalPrecioVenta: 129.8, ImporteTotal: 129.8},
+			verificar: func(t *testing.T, _ *models.Comprobante, invoice *models.UBLInvoice) {
+				isc := subtotalUBL(t, invoice, models.SUNATConstants.ISCCode)
+				assert.Equal(t, 100.0, isc.TaxableAmount.Value)
+				assert.Equal(t, 10.0, isc.TaxAmount.Value)
+				igv := subtotalUBL(t, invoice, models.SUNATConstants.IGVCode)
+				assert.Equal(t, 110.0, igv.TaxableAmount.Value)
+				assert.Equal(t, 19.8, igv.TaxAmount.Value)
+				assert.Equal(t, 29.8, invoice.TaxTotal[0].TaxAmount.Value)
+			},
+		},
+		{
+			name: "ISC sin tasa registrada",
+			comprobante: conImpuestos(facturaPrueba(itemPrueba(1, models.GravadoOneroso, 1, 100)),
+				models.ImpuestoItem{TipoImpuesto: models.SUNATConstants.ISCCode, CodigoImpuesto: "ISC"}),
+			wantErr: "no hay una tasa de ISC vigente",
+		},
+		{
+			name: "ICBPER vigente por bolsa",
+			comprobante: conImpuestos(facturaPrueba(itemPrueba(1, models.GravadoOneroso, 2, 0.1)),
+				models.ImpuestoItem{TipoImpuesto: models.SUNATConstants.ICBCode, CodigoImpuesto: "ICBPER"}),
+			totales: models.Totales{TotalVentaGravada: 0.2, TotalImpuestos: 1.04, TotalValorVenta: 0.2, TotalPrecioVenta: 1.24, ImporteTotal: 1.24},
+			verificar: func(t *testing.T, _ *models.Comprobante, invoice *models.UBLInvoice) {
+				assert.Equal(t, 1.0, subtotalUBL(t, invoice, models.SUNATConstants.ICBCode).TaxAmount.Value)
+				assert.Equal(t, 0.04, subtotalUBL(t, invoice, models.SUNATConstants.IGVCode).TaxAmount.Value)
+			},
+		},
+		{
+			name:        "ICBPER de 2021",
+			comprobante: bolsas2021,
+			totales:     models.Totales{TotalVentaGravada: 0.2, TotalImpuestos: 0.64, TotalValorVenta: 0.2, TotalPrecioVenta: 0.84, ImporteTotal: 0.84},
+			verificar: func(t *testing.T, _ *models.Comprobante, invoice *models.UBLInvoice) {
+				assert.Equal(t, 0.6, subtotalUBL(t, invoice, models.SUNATConstants.ICBCode).TaxAmount.Value)
+			},
+		},
+		{
+			name: "ICBPER con una tarifa que no es la vigente",
+			comprobante: conImpuestos(facturaPrueba(itemPrueba(1, models.GravadoOneroso, 2, 0.1)),
+				models.ImpuestoItem{TipoImpuesto: models.SUNATConstants.ICBCode, CodigoImpuesto: "ICBPER", Tasa: 0.3}),
+			wantErr: "el ICBPER vigente al 2024-06-20 es 0.50 por bolsa",
+		},
+	})
+}
+
+func TestNotasComprobante(t *testing.T) {
+	enDolares := facturaPrueba(itemPrueba(1, models.GravadoOneroso, 1, 100))
+	enDolares.TipoMoneda = "USD"
+
+	conObservaciones := facturaPrueba(itemPrueba(1, models.GravadoOneroso, 1, 100))
+	conObservaciones.Observaciones = "  Entrega en almacén  "
+
+	percepcion := facturaPrueba(itemPrueba(1, models.GravadoOneroso, 1, 100))
+	percepcion.Percepcion = &models.Percepcion{}
+
+	detraccion := facturaPrueba(itemPrueba(1, models.GravadoOneroso, 1, 1000))
+	detraccion.Detraccion = &models.Detraccion{Codigo: "037", NumeroCuenta: "00-000-123456"}
+
+	tests := []struct {
+		name        string
+		comprobante *models.Comprobante
+		notas       []models.Note
+	}{
+		{
+			name:        "importe en letras",
+			comprobante: facturaPrueba(itemPrueba(1, models.GravadoOneroso, 1, 100)),
+			notas:       []models.Note{{Value: "CIENTO DIECIOCHO CON 00/100 SOLES", LanguageLocaleID: "1000"}},
+		},
+		{
+			name:        "importe en dólares",
+			comprobante: enDolares,
+			notas:       []models.Note{{Value: "CIENTO DIECIOCHO CON 00/100 DÓLARES AMERICANOS", LanguageLocaleID: "1000"}},
+		},
+		{
+			name:        "transferencia gratuita",
+			comprobante: facturaPrueba(itemPrueba(1, models.GravadoGratuito, 1, 100)),
+			notas: []models.Note{
+				{Value: "CERO CON 00/100 SOLES", LanguageLocaleID: "1000"},
+				{Value: "TRANSFERENCIA GRATUITA DE UN BIEN Y/O SERVICIO PRESTADO GRATUITAMENTE", LanguageLocaleID: "1002"},
+			},
+		},
+		{
+			name:        "percepción",
+			comprobante: percepcion,
+			notas: []models.Note{
+				{Value: "CIENTO DIECIOCHO CON 00/100 SOLES", LanguageLocaleID: "1000"},
+				{Value: "COMPROBANTE DE PERCEPCIÓN", LanguageLocaleID: "2000"},
+			},
+		},
+		{
+			name:        "IVAP",
+			comprobante: ivapPrueba(itemPrueba(1, models.GravadoIVAP, 1, 100)),
+			notas: []models.Note{
+				{Value: "CIENTO CUATRO CON 00/100 SOLES", LanguageLocaleID: "1000"},
+				{Value: "OPERACIÓN SUJETA AL IVAP", LanguageLocaleID: "2007"},
+			},
+		},
+		{
+			name:        "detracción",
+			comprobante: detraccion,
+			notas: []models.Note{
+				{Value: "MIL CIENTO OCHENTA CON 00/100 SOLES", LanguageLocaleID: "1000"},
+				{Value: "OPERACIÓN SUJETA A DETRACCIÓN", LanguageLocaleID: "2006"},
+			},
+		},
+		{
+			name:        "observaciones de texto libre",
+			comprobante: conObservaciones,
+			notas: []models.Note{
+				{Value: "CIENTO DIECIOCHO CON 00/100 SOLES", LanguageLocaleID: "1000"},
+				{Value: "Entrega en almacén"},
+			},
+		},
+	}
+
+	// Las leyendas se verifican en los cbc:Note del UBL, con los totales y la
+	// detracción calculados como al crear el comprobante
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewConversionService(NewUBLService())
+			require.NoError(t, service.CalculateTotals(tt.comprobante))
+			require.NoError(t, NewDetraccionService(nil).Aplicar(tt.comprobante))
+
+			assert.Equal(t, tt.notas, invoiceUBL(t, service, tt.comprobante).Note)
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"facturacion_sunat_api_go/internal/models"
+	"facturacion_sunat_api_go/pkg/catalogos"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+)
+
+// toleranciaMontoDetraccion es la diferencia admitida entre el monto de
+// detracción informado y el calculado, originada en el redondeo a soles
+const toleranciaMontoDetraccion = 1.0
+
+// formatoCuentaDetraccion admite la cuenta del Banco de la Nación con o sin guiones
+var formatoCuentaDetraccion = regexp.MustCompile(`^[0-9][0-9-]{5,28}[0-9]$`)
+
+// ReglaDetraccion reúne los datos del catálogo 54 que determinan si una
+// operación está sujeta al SPOT y por cuánto. Se leen de los atributos del
+// catálogo, de modo que un cambio de tasas o umbrales solo requiere actualizar
+// catalogo54.json.
+type ReglaDetraccion struct {
+	Codigo           string  `json:"codigo"`
+	Descripcion      string  `json:"descripcion"`
+	Porcentaje       float64 `json:"porcentaje"`
+	MontoMinimo      float64 `json:"monto_minimo"`
+	TipoOperacion    string  `json:"tipo_operacion"`
+	ValorReferencial bool    `json:"valor_referencial"`
+}
+
+// DetraccionService determina y valida la detracción de las facturas
+type DetraccionService struct {
+	tipoCambioService *TipoCambioService
+}
+
+// NewDetraccionService crea el servicio. El servicio de tipos de cambio es
+// opcional: sin él, las facturas en moneda extranjera deben indicar el tipo de
+// cambio de la detracción.
+func NewDetraccionService(tipoCambioService *TipoCambioService) *DetraccionService {
+	return &DetraccionService{tipoCambioService: tipoCambioService}
+}
+
+// Regla retorna la regla de detracción del código del catálogo 54
+func (s *DetraccionService) Regla(codigo string) (*ReglaDetraccion, error) {
+	catalogo, err := catalogos.Obtener(catalogos.Detraccion)
+	if err != nil {
+		return nil, err
+	}
+	valor, ok := catalogo.Buscar(codigo)
+	if !ok {
+		return nil, fmt.Errorf("el código de detracción %q no existe en el catálogo 54", codigo)
+	}
+
+	regla := &ReglaDetraccion{
+		Codigo:           valor.Codigo,
+		Descripcion:      valor.Descripcion,
+		TipoOperacion:    valor.Atributos["tipo_operacion"],
+		ValorReferencial: valor.Atributos["valor_referencial"] == "permitido",
+	}
+	if regla.Porcentaje, err = strconv.ParseFloat(valor.Atributos["porcentaje"], 64); err != nil {
+		return nil, fmt.Errorf("el código de detracción %s no tiene porcentaje en el catálogo 54", codigo)
+	}
+	if minimo := valor.Atributos["monto_minimo"]; minimo != "" {
+		if regla.MontoMinimo, err = strconv.ParseFloat(minimo, 64); err != nil {
+			return nil, fmt.Errorf("monto mínimo inválido para el código de detracción %s: %v", codigo, err)
+		}
+	}
+	if regla.TipoOperacion == "" {
+		regla.TipoOperacion = models.OperacionDetraccion
+	}
+	return regla, nil
+}
+
+// Aplicar valida la detracción de un comprobante con los totales ya calculados
+// y completa el porcentaje, la base y el monto en soles según el catálogo 54.
+// El código se deduce de los ítems si no se informa (CodigoDetraccionItems) y
+// una operación que no supera el monto mínimo del código no está sujeta a
+// detracción: se descarta sin error. Rechaza los códigos que no corresponden a
+// los ítems, los porcentajes o montos que no corresponden al código, las
+// operaciones sujetas sin la cuenta del Banco de la Nación y las que concurren
+// con percepción o retención.
+func (s *DetraccionService) Aplicar(comprobante *models.Comprobante) error {
+	detraccion := comprobante.Detraccion
+	if detraccion != nil && comprobante.Tipo != models.TipoFactura {
+		return fmt.Errorf("la detracción solo se informa en facturas")
+	}
+
+	codigoItems, err := s.codigoItems(comprobante)
+	if err != nil {
+		return err
+	}
+	if detraccion == nil {
+		if codigoItems == "" {
+			if models.EsOperacionDetraccion(comprobante.TipoOperacion) {
+				return fmt.Errorf("el tipo de operación %s requiere los datos de la detracción", comprobante.TipoOperacion)
+			}
+			return nil
+		}
+		// Los ítems están sujetos al SPOT: se evalúa el monto mínimo antes de
+		// exigir los datos de la detracción
+		detraccion = &models.Detraccion{}
+	}
+
+	switch {
+	case detraccion.Codigo == "" && codigoItems == "":
+		return fmt.Errorf("indique el código del catálogo 54 de la detracción")
+	case detraccion.Codigo == "":
+		detraccion.Codigo = codigoItems
+	case codigoItems != "" && detraccion.Codigo != codigoItems:
+		return fmt.Errorf("el código de detracción %s no corresponde al de los ítems (%s)", detraccion.Codigo, codigoItems)
+	}
+
+	regla, err := s.Regla(detraccion.Codigo)
+	if err != nil {
+		return err
+	}
+	if detraccion.ValorReferencial < 0 {
+		return fmt.Errorf("el valor referencial no puede ser negativo")
+	}
+	if detraccion.ValorReferencial > 0 && !regla.ValorReferencial {
+		return fmt.Errorf("el código de detracción %s no admite valor referencial", regla.Codigo)
+	}
+
+	tipoCambio, err := s.tipoCambioDetraccion(comprobante, detraccion.TipoCambio)
+	if err != nil {
+		return err
+	}
+
+	// La detracción se calcula sobre el importe total en soles o, en el
+	// transporte de carga, sobre el valor referencial si es mayor
+	base := redondear(comprobante.Totales.ImporteTotal * tipoCambio)
+	if detraccion.ValorReferencial > base {
+		base = redondear(detraccion.ValorReferencial)
+	}
+	if base <= regla.MontoMinimo {
+		comprobante.Detraccion = nil
+		if models.EsOperacionDetraccion(comprobante.TipoOperacion) {
+			comprobante.TipoOperacion = models.OperacionVentaInterna
+		}
+		return nil
+	}
+	if comprobante.Detraccion == nil {
+		return fmt.Errorf("la operación está sujeta a detracción (código %s, %s): indique la cuenta de detracciones del Banco de la Nación",
+			regla.Codigo, regla.Descripcion)
+	}
+
+	if comprobante.Percepcion != nil {
+		return fmt.Errorf("una operación sujeta a percepción no está sujeta a detracción")
+	}
+	if comprobante.Retencion != nil {
+		return fmt.Errorf("una operación sujeta a detracción no está sujeta a retención")
+	}
+
+	switch {
+	case comprobante.TipoOperacion == "" || comprobante.TipoOperacion == models.OperacionVentaInterna:
+		comprobante.TipoOperacion = regla.TipoOperacion
+	case comprobante.TipoOperacion != regla.TipoOperacion:
+		return fmt.Errorf("el código de detracción %s corresponde al tipo de operación %s, no %s",
+			regla.Codigo, regla.TipoOperacion, comprobante.TipoOperacion)
+	}
+
+	if !formatoCuentaDetraccion.MatchString(detraccion.NumeroCuenta) {
+		return fmt.Errorf("el número de cuenta de detracciones del Banco de la Nación es obligatorio")
+	}
+	if detraccion.MedioPago == "" {
+		detraccion.MedioPago = models.MedioPagoDetraccionDefecto
+	}
+	if !catalogos.Existe(catalogos.MedioPago, detraccion.MedioPago) {
+		return fmt.Errorf("el medio de pago %s no existe en el catálogo 59", detraccion.MedioPago)
+	}
+	if detraccion.Porcentaje != 0 && detraccion.Porcentaje != regla.Porcentaje {
+		return fmt.Errorf("el porcentaje de detracción del código %s es %v%%, no %v%%",
+			regla.Codigo, regla.Porcentaje, detraccion.Porcentaje)
+	}
+
+	monto := math.Round(base * regla.Porcentaje / 100)
+	if detraccion.Monto != 0 && math.Abs(detraccion.Monto-monto) > toleranciaMontoDetraccion {
+		return fmt.Errorf("el monto de detracción informado (S/ %.2f) no corresponde al calculado (S/ %.2f)",
+			detraccion.Monto, monto)
+	}
+
+	detraccion.Porcentaje = regla.Porcentaje
+	detraccion.MontoBase = base
+	detraccion.Monto = monto
+	if comprobante.TipoMoneda != "PEN" {
+		detraccion.TipoCambio = tipoCambio
+	} else {
+		detraccion.TipoCambio = 0
+	}
+	return nil
+}
+
+// Proponer completa los datos de detracción de una factura: aplica las reglas
+// del catálogo 54 a la detracción informada o deducida de los ítems y refleja
+// el resultado en los campos DetraccionAplicada, PorcentajeDetraccion y
+// MontoDetraccion
+func (s *DetraccionService) Proponer(factura *models.Factura) error {
+	if factura.Detraccion == nil && factura.DetraccionAplicada {
+		factura.Detraccion = &models.Detraccion{}
+	}
+	if err := s.Aplicar(&factura.Comprobante); err != nil {
+		return err
+	}
+
+	factura.DetraccionAplicada = factura.Detraccion != nil
+	factura.PorcentajeDetraccion = 0
+	factura.MontoDetraccion = 0
+	if factura.Detraccion != nil {
+		factura.PorcentajeDetraccion = factura.Detraccion.Porcentaje
+		factura.MontoDetraccion = factura.Detraccion.Monto
+	}
+	return nil
+}
+
+// codigoItems deduce de los ítems el código del catálogo 54 de las facturas de
+// venta interna o ya marcadas como sujetas al SPOT; las demás operaciones,
+// como las exportaciones, no están sujetas a detracción
+func (s *DetraccionService) codigoItems(comprobante *models.Comprobante) (string, error) {
+	if comprobante.Tipo != models.TipoFactura {
+		return "", nil
+	}
+	switch tipoOperacion := comprobante.TipoOperacion; {
+	case tipoOperacion == "", tipoOperacion == models.OperacionVentaInterna, models.EsOperacionDetraccion(tipoOperacion):
+		return models.CodigoDetraccionItems(comprobante.Items)
+	}
+	return "", nil
+}
+
+// tipoCambioDetraccion retorna el tipo de cambio venta con el que se convierte
+// a soles el importe de una factura en moneda extranjera, o el informado
+func (s *DetraccionService) tipoCambioDetraccion(comprobante *models.Comprobante, informado float64) (float64, error) {
+	if comprobante.TipoMoneda == "" || comprobante.TipoMoneda == "PEN" {
+		return 1, nil
+	}
+	if informado > 0 {
+		return informado, nil
+	}
+	if s.tipoCambioService == nil {
+		return 0, fmt.Errorf("indique el tipo de cambio de la detracción para facturas en %s", comprobante.TipoMoneda)
+	}
+
+	tipoCambio, err := s.tipoCambioService.Consultar(comprobante.TipoMoneda, comprobante.FechaEmision)
+	if err != nil {
+		return 0, fmt.Errorf("error obteniendo el tipo de cambio de la detracción: %v", err)
+	}
+	return tipoCambio.Venta, nil
+}
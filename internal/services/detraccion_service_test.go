@@ -0,0 +1,210 @@
+package services
+
+import (
+	"facturacion_sunat_api_go/internal/models"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tipoCambioStorePrueba publica un tipo de cambio venta fijo por moneda
+type tipoCambioStorePrueba map[string]float64
+
+func (s tipoCambioStorePrueba) Buscar(moneda string, desde, hasta time.Time) (*models.TipoCambio, error) {
+	venta, ok := s[moneda]
+	if !ok {
+		return nil, fmt.Errorf("no hay tipo de cambio de %s", moneda)
+	}
+	return &models.TipoCambio{Moneda: moneda, Fecha: hasta, Compra: venta - 0.01, Venta: venta, Fuente: "SBS"}, nil
+}
+
+func (s tipoCambioStorePrueba) GuardarLote(tiposCambio []models.TipoCambio) (int64, error) {
+	return 0, nil
+}
+
+// facturaDetraccion arma una factura con el importe total ya calculado
+func facturaDetraccion(importe float64, moneda string, detraccion *models.Detraccion) *models.Comprobante {
+	comprobante := facturaPrueba(itemPrueba(1, models.GravadoOneroso, 1, importe))
+	comprobante.TipoMoneda = moneda
+	comprobante.Totales.ImporteTotal = importe
+	comprobante.Detraccion = detraccion
+	return comprobante
+}
+
+func TestDetraccionAplicar(t *testing.T) {
+	tipoCambio := NewTipoCambioService(tipoCambioStorePrueba{"USD": 3.75})
+
+	tests := []struct {
+		name       string
+		service    *DetraccionService
+		importe    float64
+		moneda     string
+		detraccion models.Detraccion
+		base       float64
+		monto      float64
+		tipoCambio float64
+		wantErr    string
+	}{
+		{"en el umbral de S/ 700 no está sujeta", NewDetraccionService(nil), 700, "PEN", models.Detraccion{Codigo: "037"}, 0, 0, 0, ""},
+		{"sobre el umbral de S/ 700", NewDetraccionService(nil), 700.01, "PEN", models.Detraccion{Codigo: "037"}, 700.01, 84, 0, ""},
+		{"monto redondeado a soles", NewDetraccionService(nil), 1180, "PEN", models.Detraccion{Codigo: "022"}, 1180, 142, 0, ""},
+		{"USD convertido con la venta SBS", NewDetraccionService(tipoCambio), 200, "USD", models.Detraccion{Codigo: "037"}, 750, 90, 3.75, ""},
+		{"USD bajo el umbral en soles no está sujeta", NewDetraccionService(tipoCambio), 186, "USD", models.Detraccion{Codigo: "037"}, 0, 0, 0, ""},
+		{"USD con tipo de cambio informado", NewDetraccionService(nil), 200, "USD", models.Detraccion{Codigo: "037", TipoCambio: 3.80}, 760, 91, 3.80, ""},
+		{"USD sin tipo de cambio", NewDetraccionService(nil), 200, "USD", models.Detraccion{Codigo: "037"}, 0, 0, 0, "indique el tipo de cambio"},
+		{"moneda sin publicación", NewDetraccionService(tipoCambio), 200, "EUR", models.Detraccion{Codigo: "037"}, 0, 0, 0, "error obteniendo el tipo de cambio"},
+		{"porcentaje que no corresponde al código", NewDetraccionService(nil), 1000, "PEN", models.Detraccion{Codigo: "037", Porcentaje: 10}, 0, 0, 0, "es 12%, no 10%"},
+		{"monto que no corresponde al calculado", NewDetraccionService(nil), 1000, "PEN", models.Detraccion{Codigo: "037", Monto: 100}, 0, 0, 0, "no corresponde al calculado"},
+		{"monto dentro de la tolerancia", NewDetraccionService(nil), 1000, "PEN", models.Detraccion{Codigo: "037", Monto: 121}, 1000, 120, 0, ""},
+		{"transporte sobre el valor referencial", NewDetraccionService(nil), 300, "PEN", models.Detraccion{Codigo: "027", ValorReferencial: 500}, 500, 20, 0, ""},
+		{"transporte en el umbral de S/ 400 no está sujeta", NewDetraccionService(nil), 400, "PEN", models.Detraccion{Codigo: "027"}, 0, 0, 0, ""},
+		{"valor referencial no admitido", NewDetraccionService(nil), 1000, "PEN", models.Detraccion{Codigo: "037", ValorReferencial: 2000}, 0, 0, 0, "no admite valor referencial"},
+		{"código inexistente", NewDetraccionService(nil), 1000, "PEN", models.Detraccion{Codigo: "999"}, 0, 0, 0, "no existe en el catálogo 54"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detraccion := tt.detraccion
+			detraccion.NumeroCuenta = "00-000-123456"
+			comprobante := facturaDetraccion(tt.importe, tt.moneda, &detraccion)
+
+			err := tt.service.Aplicar(comprobante)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			if tt.base == 0 {
+				// Sin superar el monto mínimo la factura se emite sin detracción
+				assert.Nil(t, comprobante.Detraccion)
+				assert.False(t, models.EsOperacionDetraccion(comprobante.TipoOperacion))
+				return
+			}
+			require.Same(t, &detraccion, comprobante.Detraccion)
+			assert.Equal(t, tt.base, detraccion.MontoBase)
+			assert.Equal(t, tt.monto, detraccion.Monto)
+			assert.Equal(t, tt.tipoCambio, detraccion.TipoCambio)
+			assert.Equal(t, models.MedioPagoDetraccionDefecto, detraccion.MedioPago)
+		})
+	}
+}
+
+func TestDetraccionAplicarIncompatibles(t *testing.T) {
+	service := NewDetraccionService(nil)
+
+	comprobante := facturaDetraccion(1000, "PEN", &models.Detraccion{Codigo: "037", NumeroCuenta: "00-000-123456"})
+	comprobante.Tipo = models.TipoBoleta
+	assert.Error(t, service.Aplicar(comprobante))
+
+	comprobante = facturaDetraccion(1000, "PEN", &models.Detraccion{Codigo: "037", NumeroCuenta: "00-000-123456"})
+	comprobante.Retencion = &models.Retencion{}
+	assert.Error(t, service.Aplicar(comprobante))
+
+	comprobante = facturaDetraccion(1000, "PEN", &models.Detraccion{Codigo: "037"})
+	err := service.Aplicar(comprobante)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "número de cuenta")
+
+	comprobante = facturaDetraccion(1000, "PEN", nil)
+	comprobante.TipoOperacion = models.OperacionDetraccion
+	assert.Error(t, service.Aplicar(comprobante))
+}
+
+func TestDetraccionProponer(t *testing.T) {
+	service := NewDetraccionService(nil)
+
+	// Marcada como aplicada sin los datos de la detracción
+	factura := &models.Factura{Comprobante: *facturaDetraccion(1000, "PEN", nil), DetraccionAplicada: true}
+	err := service.Proponer(factura)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "catálogo 54")
+
+	// Con los datos de la detracción aunque no se marcó como aplicada
+	factura = &models.Factura{Comprobante: *facturaDetraccion(1000, "PEN", &models.Detraccion{Codigo: "037", NumeroCuenta: "00-000-123456"})}
+	require.NoError(t, service.Proponer(factura))
+	assert.True(t, factura.DetraccionAplicada)
+	assert.Equal(t, 12.0, factura.PorcentajeDetraccion)
+	assert.Equal(t, 120.0, factura.MontoDetraccion)
+
+	// Los montos de una detracción que no procede se limpian
+	factura = &models.Factura{Comprobante: *facturaDetraccion(1000, "PEN", nil), PorcentajeDetraccion: 12, MontoDetraccion: 120}
+	require.NoError(t, service.Proponer(factura))
+	assert.False(t, factura.DetraccionAplicada)
+	assert.Zero(t, factura.PorcentajeDetraccion)
+	assert.Zero(t, factura.MontoDetraccion)
+
+	// Bajo el umbral no procede aunque se solicite
+	factura = &models.Factura{Comprobante: *facturaDetraccion(650, "PEN", &models.Detraccion{Codigo: "037", NumeroCuenta: "00-000-123456"}), DetraccionAplicada: true}
+	require.NoError(t, service.Proponer(factura))
+	assert.False(t, factura.DetraccionAplicada)
+	assert.Nil(t, factura.Detraccion)
+	assert.Zero(t, factura.MontoDetraccion)
+
+	// Propuesta a partir del producto SUNAT de los ítems
+	factura = &models.Factura{Comprobante: *facturaDetraccion(1000, "PEN", &models.Detraccion{NumeroCuenta: "00-000-123456"})}
+	factura.Items[0].CodigoSUNAT = "78101802"
+	require.NoError(t, service.Proponer(factura))
+	assert.True(t, factura.DetraccionAplicada)
+	assert.Equal(t, "027", factura.Detraccion.Codigo)
+	assert.Equal(t, 4.0, factura.PorcentajeDetraccion)
+	assert.Equal(t, 40.0, factura.MontoDetraccion)
+}
+
+func TestDetraccionCodigoItems(t *testing.T) {
+	service := NewDetraccionService(nil)
+	cuenta := func() *models.Detraccion { return &models.Detraccion{NumeroCuenta: "00-000-123456"} }
+	propiedad := func(codigo string) []models.PropiedadItem {
+		return []models.PropiedadItem{{Codigo: models.PropiedadCodigoDetraccion, Valor: codigo}}
+	}
+
+	tests := []struct {
+		name          string
+		importe       float64
+		tipoOperacion string
+		detraccion    *models.Detraccion
+		items         []models.Item
+		codigo        string
+		tipoSPOT      string
+		wantErr       string
+	}{
+		{"producto de transporte de carga", 1000, "", cuenta(), []models.Item{{NumeroItem: 1, CodigoSUNAT: "78101801"}}, "027", "1004", ""},
+		{"producto de personal temporal", 1000, "", cuenta(), []models.Item{{NumeroItem: 1, CodigoSUNAT: "80111601"}}, "012", "1001", ""},
+		{"propiedad 3000 del ítem", 1000, "", cuenta(), []models.Item{{NumeroItem: 1, CodigoSUNAT: "80111601", Propiedades: propiedad("037")}}, "037", "1001", ""},
+		{"ítems sin detracción junto a uno sujeto", 1000, "", cuenta(), []models.Item{{NumeroItem: 1, CodigoSUNAT: "43211501"}, {NumeroItem: 2, Propiedades: propiedad("037")}}, "037", "1001", ""},
+		{"sujeta bajo el monto mínimo", 400, "", nil, []models.Item{{NumeroItem: 1, CodigoSUNAT: "78101801"}}, "", "", ""},
+		{"operación 1001 bajo el monto mínimo", 700, models.OperacionDetraccion, cuenta(), []models.Item{{NumeroItem: 1, Propiedades: propiedad("037")}}, "", models.OperacionVentaInterna, ""},
+		{"exportación sin detracción", 1000, "0200", nil, []models.Item{{NumeroItem: 1, CodigoSUNAT: "78101801"}}, "", "0200", ""},
+		{"sujeta sin la cuenta", 1000, "", nil, []models.Item{{NumeroItem: 1, CodigoSUNAT: "78101801"}}, "", "", "sujeta a detracción (código 027"},
+		{"código distinto al de los ítems", 1000, "", &models.Detraccion{Codigo: "037", NumeroCuenta: "00-000-123456"}, []models.Item{{NumeroItem: 1, CodigoSUNAT: "78101801"}}, "", "", "no corresponde al de los ítems (027)"},
+		{"ítems con códigos distintos", 1000, "", cuenta(), []models.Item{{NumeroItem: 1, CodigoSUNAT: "78101801"}, {NumeroItem: 2, Propiedades: propiedad("037")}}, "", "", "los ítems 1 y 2 corresponden a distintos códigos de detracción (027 y 037)"},
+		{"propiedad 3000 fuera del catálogo", 1000, "", cuenta(), []models.Item{{NumeroItem: 1, Propiedades: propiedad("999")}}, "", "", "no existe en el catálogo 54"},
+		{"sin código informado ni deducido", 1000, "", cuenta(), []models.Item{{NumeroItem: 1, CodigoSUNAT: "43211501"}}, "", "", "indique el código del catálogo 54"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comprobante := facturaDetraccion(tt.importe, "PEN", tt.detraccion)
+			comprobante.TipoOperacion = tt.tipoOperacion
+			comprobante.Items = tt.items
+
+			err := service.Aplicar(comprobante)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.tipoSPOT, comprobante.TipoOperacion)
+			if tt.codigo == "" {
+				assert.Nil(t, comprobante.Detraccion)
+				return
+			}
+			require.NotNil(t, comprobante.Detraccion)
+			assert.Equal(t, tt.codigo, comprobante.Detraccion.Codigo)
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"errors"
+	"facturacion_sunat_api_go/internal/models"
+	"facturacion_sunat_api_go/pkg/catalogos"
+	"facturacion_sunat_api_go/pkg/identidad"
+	"fmt"
+	"strings"
+)
+
+// ErrEstablecimientoInvalido indica que los datos de un establecimiento no son
+// válidos o que la serie o el código de establecimiento de un comprobante no
+// corresponde a los establecimientos registrados del emisor
+var ErrEstablecimientoInvalido = errors.New("establecimiento inválido")
+
+// EstablecimientoStore guarda y consulta los establecimientos de cada RUC
+type EstablecimientoStore interface {
+	Guardar(establecimiento *models.Establecimiento) error
+	Listar(ruc string) ([]models.Establecimiento, error)
+}
+
+// EstablecimientoService administra el domicilio fiscal y los establecimientos
+// anexos de los emisores y asigna a cada comprobante el establecimiento de su serie
+type EstablecimientoService struct {
+	store EstablecimientoStore
+}
+
+func NewEstablecimientoService(store EstablecimientoStore) *EstablecimientoService {
+	return &EstablecimientoService{
+		store: store,
+	}
+}
+
+// Guardar valida y registra un establecimiento con sus series. El ubigeo se
+// resuelve desde el código o los nombres como en las direcciones del comprobante.
+func (s *EstablecimientoService) Guardar(establecimiento *models.Establecimiento) error {
+	if err := identidad.ValidarRUC(establecimiento.RUC); err != nil {
+		return fmt.Errorf("%w: RUC del emisor: %v", ErrEstablecimientoInvalido, err)
+	}
+	if err := models.ValidarCodigoEstablecimiento(establecimiento.Codigo); err != nil {
+		return fmt.Errorf("%w: %v", ErrEstablecimientoInvalido, err)
+	}
+	establecimiento.Direccion = strings.TrimSpace(establecimiento.Direccion)
+	if establecimiento.Direccion == "" {
+		return fmt.Errorf("%w: la dirección del establecimiento %s es obligatoria", ErrEstablecimientoInvalido, establecimiento.Codigo)
+	}
+	if establecimiento.CodigoPais == "" {
+		establecimiento.CodigoPais = "PE"
+	}
+
+	ubicacion, err := catalogos.ResolverUbigeo(establecimiento.Ubigeo, establecimiento.Departamento,
+		establecimiento.Provincia, establecimiento.Distrito)
+	if err != nil {
+		return fmt.Errorf("%w: ubigeo del establecimiento %s: %v", ErrEstablecimientoInvalido, establecimiento.Codigo, err)
+	}
+	establecimiento.Ubigeo = ubicacion.Codigo
+	establecimiento.Departamento = ubicacion.Departamento
+	establecimiento.Provincia = ubicacion.Provincia
+	establecimiento.Distrito = ubicacion.Distrito
+
+	series := make(map[string]bool)
+	for i, serie := range establecimiento.Series {
+		serie = strings.ToUpper(strings.TrimSpace(serie))
+		if !formatoSerie.MatchString(serie) {
+			return fmt.Errorf("%w: serie %s (debe iniciar con F o B seguida de 3 caracteres)", ErrEstablecimientoInvalido, serie)
+		}
+		if series[serie] {
+			return fmt.Errorf("%w: la serie %s está repetida", ErrEstablecimientoInvalido, serie)
+		}
+		series[serie] = true
+		establecimiento.Series[i] = serie
+	}
+
+	return s.store.Guardar(establecimiento)
+}
+
+// Listar retorna los establecimientos registrados de un RUC
+func (s *EstablecimientoService) Listar(ruc string) ([]models.Establecimiento, error) {
+	return s.store.Listar(ruc)
+}
+
+// Asignar determina el establecimiento desde el que se emite el comprobante.
+// Si el RUC no tiene establecimientos registrados se usa el código informado o,
+// en su defecto, el domicilio fiscal. Si los tiene, la serie debe estar
+// asignada a un establecimiento activo, cuya dirección se informa en el XML.
+func (s *EstablecimientoService) Asignar(comprobante *models.Comprobante) error {
+	emisor := &comprobante.Emisor
+	establecimientos, err := s.store.Listar(emisor.RUC)
+	if err != nil {
+		return fmt.Errorf("error consultando los establecimientos del emisor: %v", err)
+	}
+
+	if len(establecimientos) == 0 {
+		if emisor.CodigoEstablecimiento == "" {
+			emisor.CodigoEstablecimiento = models.EstablecimientoDomicilioFiscal
+		}
+		if err := models.ValidarCodigoEstablecimiento(emisor.CodigoEstablecimiento); err != nil {
+			return fmt.Errorf("%w: %v", ErrEstablecimientoInvalido, err)
+		}
+		return nil
+	}
+
+	for i := range establecimientos {
+		establecimiento := &establecimientos[i]
+		for _, serie := range establecimiento.Series {
+			if serie != comprobante.Serie {
+				continue
+			}
+			if emisor.CodigoEstablecimiento != "" && emisor.CodigoEstablecimiento != establecimiento.Codigo {
+				return fmt.Errorf("%w: la serie %s pertenece al establecimiento %s, no al %s",
+					ErrEstablecimientoInvalido, comprobante.Serie, establecimiento.Codigo, emisor.CodigoEstablecimiento)
+			}
+			if !establecimiento.Activo {
+				return fmt.Errorf("%w: el establecimiento %s de la serie %s está dado de baja",
+					ErrEstablecimientoInvalido, establecimiento.Codigo, comprobante.Serie)
+			}
+			emisor.CodigoEstablecimiento = establecimiento.Codigo
+			emisor.Establecimiento = establecimiento
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: la serie %s no está asignada a ningún establecimiento del RUC %s",
+		ErrEstablecimientoInvalido, comprobante.Serie, emisor.RUC)
+}
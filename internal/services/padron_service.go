@@ -0,0 +1,464 @@
+package services
+
+import (
+	"archive/zip"
+	"bufio"
+	"facturacion_sunat_api_go/internal/models"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// PadronStore guarda y consulta el padrón reducido de RUC y los padrones de
+// agentes de retención, agentes de percepción y buenos contribuyentes
+type PadronStore interface {
+	GetByRUC(ruc string) (*models.Contribuyente, error)
+	GuardarLote(contribuyentes []models.Contribuyente) (insertados, actualizados int64, err error)
+	GetInscripciones(ruc string) ([]models.InscripcionPadron, error)
+	GuardarInscripciones(importacionID int64, inscripciones []models.InscripcionPadron) (insertados, actualizados int64, err error)
+	DepurarPadron(padron string, importacionID int64) (int64, error)
+	IniciarImportacion(padron, archivo string) (int64, error)
+	FinalizarImportacion(importacion *models.ImportacionPadron) error
+	UltimaImportacion(padron string) (*models.ImportacionPadron, error)
+}
+
+// Estados de una importación del padrón
+const (
+	ImportacionEnProceso  = "EN_PROCESO"
+	ImportacionCompletada = "COMPLETADO"
+	ImportacionError      = "ERROR"
+)
+
+// camposPadron es el número de columnas de padron_reducido_ruc.txt: RUC, razón
+// social, estado, condición de domicilio, ubigeo, tipo de vía, nombre de vía,
+// código de zona, tipo de zona, número, interior, lote, departamento, manzana
+// y kilómetro
+const camposPadron = 15
+
+// camposInscripcion es el número de columnas de los padrones de agentes de
+// retención, agentes de percepción y buenos contribuyentes: RUC, razón social,
+// fecha de inclusión y resolución
+const camposInscripcion = 4
+
+// tamanoLotePadron es el número de registros que se envían por sentencia; la
+// memoria de la importación queda acotada por este valor y no por el archivo
+const tamanoLotePadron = 1000
+
+// PadronService importa el padrón reducido de RUC que publica SUNAT y resuelve
+// las consultas de contribuyentes contra la copia local
+type PadronService struct {
+	store      PadronStore
+	TamanoLote int
+}
+
+func NewPadronService(store PadronStore) *PadronService {
+	return &PadronService{
+		store:      store,
+		TamanoLote: tamanoLotePadron,
+	}
+}
+
+// Consultar obtiene un contribuyente del padrón local
+func (s *PadronService) Consultar(ruc string) (*models.Contribuyente, error) {
+	return s.store.GetByRUC(strings.TrimSpace(ruc))
+}
+
+// UltimaImportacion obtiene la última carga completa de un padrón, o nil si
+// todavía no se ha importado
+func (s *PadronService) UltimaImportacion(padron string) (*models.ImportacionPadron, error) {
+	return s.store.UltimaImportacion(padron)
+}
+
+// SituacionIGV indica si un RUC es agente de retención, agente de percepción o
+// buen contribuyente según los padrones importados
+func (s *PadronService) SituacionIGV(ruc string) (*models.SituacionIGV, error) {
+	ruc = strings.TrimSpace(ruc)
+	inscripciones, err := s.store.GetInscripciones(ruc)
+	if err != nil {
+		return nil, err
+	}
+	return models.NuevaSituacionIGV(ruc, inscripciones), nil
+}
+
+// AplicarRegimenesIGV determina la retención y la tasa de percepción de una
+// venta a partir de la situación del emisor y del receptor en los padrones:
+//   - Se marca la retención del 3% en las facturas en soles a un agente de
+//     retención, salvo que el emisor sea agente de retención o buen
+//     contribuyente, o que la venta esté sujeta a percepción o detracción. El
+//     mínimo de S/ 700 se verifica al calcular los totales.
+//   - La percepción a un agente de percepción usa la tasa especial (régimen 53).
+//
+// Lo que el cliente indicó expresamente en el comprobante no se modifica.
+func (s *PadronService) AplicarRegimenesIGV(comprobante *models.Comprobante) error {
+	receptor := comprobante.Receptor
+	if receptor.TipoDocumento != "6" && !(receptor.TipoDocumento == "" && len(receptor.NumeroDocumento) == 11) {
+		return nil
+	}
+	situacionReceptor, err := s.SituacionIGV(receptor.NumeroDocumento)
+	if err != nil {
+		return err
+	}
+
+	if percepcion := comprobante.Percepcion; percepcion != nil {
+		if percepcion.CodigoRegimen == "" && percepcion.Porcentaje == 0 && situacionReceptor.AgentePercepcion {
+			percepcion.CodigoRegimen = "53"
+		}
+		return nil
+	}
+
+	if comprobante.Retencion != nil || !situacionReceptor.AgenteRetencion ||
+		comprobante.Tipo != models.TipoFactura ||
+		comprobante.Detraccion != nil || models.EsOperacionDetraccion(comprobante.TipoOperacion) {
+		return nil
+	}
+	situacionEmisor, err := s.SituacionIGV(comprobante.Emisor.RUC)
+	if err != nil {
+		return err
+	}
+	if situacionEmisor.AgenteRetencion || situacionEmisor.BuenContribuyente {
+		return nil
+	}
+	comprobante.Retencion = &models.Retencion{}
+	return nil
+}
+
+// CompletarReceptor completa la razón social y el domicilio de un receptor con
+// RUC a partir del padrón. Solo se llenan los datos que el cliente no envió; el
+// ubigeo se toma del padrón únicamente cuando también se toma la dirección.
+// Un receptor sin tipo de documento se trata como RUC, igual que en el UBL.
+func (s *PadronService) CompletarReceptor(receptor *models.Receptor) (*models.Contribuyente, error) {
+	if receptor.TipoDocumento != "6" && !(receptor.TipoDocumento == "" && len(receptor.NumeroDocumento) == 11) {
+		return nil, nil
+	}
+
+	contribuyente, err := s.Consultar(receptor.NumeroDocumento)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(receptor.RazonSocial) == "" {
+		receptor.RazonSocial = contribuyente.RazonSocial
+	}
+	if strings.TrimSpace(receptor.Direccion) == "" {
+		receptor.Direccion = contribuyente.Direccion()
+		if receptor.Ubigeo == "" && receptor.Distrito == "" {
+			receptor.Ubigeo = contribuyente.Ubigeo
+		}
+	}
+	return contribuyente, nil
+}
+
+// Importar carga un padrón desde el .txt o desde el .zip que publica SUNAT
+func (s *PadronService) Importar(padron, archivo string) (*models.ImportacionPadron, error) {
+	if strings.EqualFold(filepath.Ext(archivo), ".zip") {
+		zipReader, err := zip.OpenReader(archivo)
+		if err != nil {
+			return nil, fmt.Errorf("error abriendo %s: %v", archivo, err)
+		}
+		defer zipReader.Close()
+
+		for _, f := range zipReader.File {
+			if !strings.EqualFold(filepath.Ext(f.Name), ".txt") {
+				continue
+			}
+			contenido, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("error abriendo %s: %v", f.Name, err)
+			}
+			defer contenido.Close()
+			return s.ImportarDesde(padron, contenido, archivo)
+		}
+		return nil, fmt.Errorf("el archivo %s no contiene el padrón en formato .txt", archivo)
+	}
+
+	f, err := os.Open(archivo)
+	if err != nil {
+		return nil, fmt.Errorf("error abriendo %s: %v", archivo, err)
+	}
+	defer f.Close()
+	return s.ImportarDesde(padron, f, archivo)
+}
+
+// ImportarDesde lee un padrón línea por línea y lo guarda por lotes. En el
+// padrón de RUC los registros sin cambios respecto a la carga anterior no se
+// reescriben, por lo que la misma operación sirve para la carga inicial y para
+// los refrescos. Los padrones de agentes y de buenos contribuyentes se
+// reemplazan completos: al terminar se eliminan los RUC excluidos.
+func (s *PadronService) ImportarDesde(padron string, r io.Reader, archivo string) (*models.ImportacionPadron, error) {
+	leer := s.leerPadron
+	switch padron {
+	case models.PadronRUC:
+	case models.PadronAgentesRetencion, models.PadronAgentesPercepcion, models.PadronBuenosContribuyentes:
+		leer = s.leerInscripciones
+	default:
+		return nil, fmt.Errorf("padrón desconocido: %s", padron)
+	}
+
+	id, err := s.store.IniciarImportacion(padron, archivo)
+	if err != nil {
+		return nil, err
+	}
+	importacion := &models.ImportacionPadron{
+		ID:          id,
+		Padron:      padron,
+		Archivo:     archivo,
+		Estado:      ImportacionEnProceso,
+		FechaInicio: time.Now(),
+	}
+
+	if err := leer(r, importacion); err != nil {
+		importacion.Estado = ImportacionError
+		importacion.Error = err.Error()
+	} else {
+		importacion.Estado = ImportacionCompletada
+	}
+	fin := time.Now()
+	importacion.FechaFin = &fin
+
+	if err := s.store.FinalizarImportacion(importacion); err != nil {
+		return importacion, err
+	}
+	if importacion.Estado == ImportacionError {
+		return importacion, fmt.Errorf("error importando el padrón: %s", importacion.Error)
+	}
+	return importacion, nil
+}
+
+func (s *PadronService) leerPadron(r io.Reader, importacion *models.ImportacionPadron) error {
+	tamano := s.TamanoLote
+	if tamano <= 0 {
+		tamano = tamanoLotePadron
+	}
+
+	lote := make([]models.Contribuyente, 0, tamano)
+	posiciones := make(map[string]int, tamano)
+	guardar := func() error {
+		insertados, actualizados, err := s.store.GuardarLote(lote)
+		if err != nil {
+			return err
+		}
+		importacion.Insertados += insertados
+		importacion.Actualizados += actualizados
+		lote = lote[:0]
+		for ruc := range posiciones {
+			delete(posiciones, ruc)
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for linea := 0; scanner.Scan(); linea++ {
+		texto := decodificarLatin1(scanner.Bytes())
+		if linea == 0 && strings.HasPrefix(strings.ToUpper(texto), "RUC|") {
+			continue // cabecera
+		}
+		if strings.TrimSpace(texto) == "" {
+			continue
+		}
+
+		importacion.Leidos++
+		contribuyente, ok := parsearLineaPadron(texto)
+		if !ok {
+			importacion.Rechazados++
+			continue
+		}
+
+		// Un RUC repetido dentro del lote reemplaza al anterior
+		if i, repetido := posiciones[contribuyente.RUC]; repetido {
+			lote[i] = contribuyente
+			continue
+		}
+		posiciones[contribuyente.RUC] = len(lote)
+		lote = append(lote, contribuyente)
+
+		if len(lote) == tamano {
+			if err := guardar(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error leyendo el padrón en la línea %d: %v", importacion.Leidos+1, err)
+	}
+	return guardar()
+}
+
+func (s *PadronService) leerInscripciones(r io.Reader, importacion *models.ImportacionPadron) error {
+	tamano := s.TamanoLote
+	if tamano <= 0 {
+		tamano = tamanoLotePadron
+	}
+
+	lote := make([]models.InscripcionPadron, 0, tamano)
+	posiciones := make(map[string]int, tamano)
+	guardar := func() error {
+		insertados, actualizados, err := s.store.GuardarInscripciones(importacion.ID, lote)
+		if err != nil {
+			return err
+		}
+		importacion.Insertados += insertados
+		importacion.Actualizados += actualizados
+		lote = lote[:0]
+		for ruc := range posiciones {
+			delete(posiciones, ruc)
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for linea := 0; scanner.Scan(); linea++ {
+		texto := decodificarLatin1(scanner.Bytes())
+		if linea == 0 && strings.HasPrefix(strings.ToUpper(texto), "RUC|") {
+			continue // cabecera
+		}
+		if strings.TrimSpace(texto) == "" {
+			continue
+		}
+
+		importacion.Leidos++
+		inscripcion, ok := parsearLineaInscripcion(texto)
+		if !ok {
+			importacion.Rechazados++
+			continue
+		}
+		inscripcion.Padron = importacion.Padron
+
+		if i, repetido := posiciones[inscripcion.RUC]; repetido {
+			lote[i] = inscripcion
+			continue
+		}
+		posiciones[inscripcion.RUC] = len(lote)
+		lote = append(lote, inscripcion)
+
+		if len(lote) == tamano {
+			if err := guardar(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error leyendo el padrón en la línea %d: %v", importacion.Leidos+1, err)
+	}
+	if err := guardar(); err != nil {
+		return err
+	}
+
+	// Un archivo vacío o ilegible no debe vaciar el padrón vigente
+	if importacion.Insertados+importacion.Actualizados == 0 {
+		return fmt.Errorf("el archivo no contiene registros válidos")
+	}
+	eliminados, err := s.store.DepurarPadron(importacion.Padron, importacion.ID)
+	if err != nil {
+		return err
+	}
+	importacion.Eliminados = eliminados
+	return nil
+}
+
+// parsearLineaInscripcion convierte una línea de un padrón de agentes o de
+// buenos contribuyentes. Igual que en el padrón de RUC, los "|" sobrantes
+// pertenecen a la razón social.
+func parsearLineaInscripcion(linea string) (models.InscripcionPadron, bool) {
+	campos := strings.Split(strings.TrimRight(linea, "\r"), "|")
+	if len(campos) > camposInscripcion && campos[len(campos)-1] == "" {
+		campos = campos[:len(campos)-1] // separador final
+	}
+	if len(campos) < camposInscripcion {
+		return models.InscripcionPadron{}, false
+	}
+	if extra := len(campos) - camposInscripcion; extra > 0 {
+		razonSocial := strings.Join(campos[1:2+extra], "|")
+		campos = append([]string{campos[0], razonSocial}, campos[2+extra:]...)
+	}
+	for i := range campos {
+		campos[i] = strings.TrimSpace(campos[i])
+		if campos[i] == "-" {
+			campos[i] = ""
+		}
+	}
+
+	inscripcion := models.InscripcionPadron{
+		RUC:         campos[0],
+		RazonSocial: campos[1],
+		Resolucion:  campos[3],
+	}
+	if len(inscripcion.RUC) != 11 || strings.Trim(inscripcion.RUC, "0123456789") != "" || inscripcion.RazonSocial == "" {
+		return models.InscripcionPadron{}, false
+	}
+	if fecha, err := time.Parse("02/01/2006", campos[2]); err == nil {
+		inscripcion.FechaInicio = &fecha
+	}
+	return inscripcion, true
+}
+
+// parsearLineaPadron convierte una línea del padrón en un contribuyente. SUNAT
+// marca los campos vacíos con "-" y algunas razones sociales contienen "|",
+// por lo que las columnas sobrantes se devuelven a la razón social.
+func parsearLineaPadron(linea string) (models.Contribuyente, bool) {
+	campos := strings.Split(strings.TrimRight(linea, "\r"), "|")
+	if len(campos) > camposPadron && campos[len(campos)-1] == "" {
+		campos = campos[:len(campos)-1] // separador final
+	}
+	if len(campos) < camposPadron {
+		return models.Contribuyente{}, false
+	}
+	if extra := len(campos) - camposPadron; extra > 0 {
+		razonSocial := strings.Join(campos[1:2+extra], "|")
+		campos = append([]string{campos[0], razonSocial}, campos[2+extra:]...)
+	}
+
+	for i := range campos {
+		campos[i] = strings.TrimSpace(campos[i])
+		if campos[i] == "-" {
+			campos[i] = ""
+		}
+	}
+
+	c := models.Contribuyente{
+		RUC:                campos[0],
+		RazonSocial:        campos[1],
+		Estado:             campos[2],
+		CondicionDomicilio: campos[3],
+		Ubigeo:             campos[4],
+		TipoVia:            campos[5],
+		NombreVia:          campos[6],
+		CodigoZona:         campos[7],
+		TipoZona:           campos[8],
+		Numero:             campos[9],
+		Interior:           campos[10],
+		Lote:               campos[11],
+		Dpto:               campos[12],
+		Manzana:            campos[13],
+		Kilometro:          campos[14],
+	}
+	if len(c.RUC) != 11 || strings.Trim(c.RUC, "0123456789") != "" || c.RazonSocial == "" {
+		return models.Contribuyente{}, false
+	}
+	if len(c.Ubigeo) != 6 {
+		c.Ubigeo = ""
+	}
+
+	huella := fnv.New64a()
+	io.WriteString(huella, strings.Join(campos, "|"))
+	c.Huella = fmt.Sprintf("%016x", huella.Sum64())
+	return c, true
+}
+
+// decodificarLatin1 convierte a UTF-8 las líneas del padrón, que SUNAT publica
+// en ISO-8859-1
+func decodificarLatin1(linea []byte) string {
+	if utf8.Valid(linea) {
+		return string(linea)
+	}
+	runas := make([]rune, len(linea))
+	for i, b := range linea {
+		runas[i] = rune(b)
+	}
+	return string(runas)
+}
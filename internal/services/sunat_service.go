@@ -2,14 +2,23 @@ package services
 
 import (
 	"encoding/xml"
+	"errors"
 	"facturacion_sunat_api_go/internal/config"
+	"facturacion_sunat_api_go/internal/models"
 	"facturacion_sunat_api_go/pkg/sunat"
 	"fmt"
 	"io"
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// ErrExcepcionSUNAT indica que SUNAT no procesó el comprobante (códigos 0100 a
+// 1999): el comprobante queda pendiente de un nuevo envío
+var ErrExcepcionSUNAT = errors.New("SUNAT no procesó el comprobante")
+
 type SUNATService struct {
 	Client         *sunat.Client
 	config         *config.SUNATConfig
@@ -105,21 +114,6 @@ func (s *SUNATService) DownloadCDR(ruc, tipo, serie, numero string) (*CDRRespons
 	return s.processCDRResponse(response)
 }
 
-// ValidateRUC valida un RUC contra SUNAT
-func (s *SUNATService) ValidateRUC(ruc string) (*RUCValidationResponse, error) {
-	if len(ruc) != 11 {
-		return nil, fmt.Errorf("RUC debe tener 11 dígitos")
-	}
-	response, err := s.Client.ValidateRUC(ruc)
-	if err != nil {
-		if err.Error() == "validación de RUC no implementada aún" {
-			return nil, fmt.Errorf("validación de RUC contra SUNAT no implementada")
-		}
-		return nil, fmt.Errorf("error validando RUC: %v", err)
-	}
-	return s.processRUCValidationResponse(response)
-}
-
 // processResponse procesa la respuesta de envío
 func (s *SUNATService) processResponse(response *http.Response) (*SUNATSendResponse, error) {
 	defer response.Body.Close()
@@ -140,21 +134,29 @@ func (s *SUNATService) processResponse(response *http.Response) (*SUNATSendRespo
 		}, nil
 	}
 
-	// Parsear respuesta SOAP usando el cliente SUNAT
-	soapResponse, err := s.Client.ParseSOAPResponse(response)
+	// Parsear respuesta SOAP usando el cliente SUNAT (el cuerpo ya fue leído)
+	soapResponse, err := s.Client.ParseSOAPBody(body)
 	if err != nil {
 		return nil, fmt.Errorf("error parseando respuesta SOAP: %v", err)
 	}
+	if soapResponse.Body.SendBillResponse == nil {
+		return nil, fmt.Errorf("la respuesta SOAP no contiene sendBillResponse")
+	}
 
 	fmt.Printf("🔍 Respuesta SOAP parseada - SendBillResponse: %+v\n", soapResponse.Body.SendBillResponse)
 
 	// Procesar CDR si está presente
 	var cdrData []byte
-	if soapResponse.Body.SendBillResponse != nil && soapResponse.Body.SendBillResponse.ApplicationResponse != "" {
+	var respuesta *RespuestaCDR
+	if soapResponse.Body.SendBillResponse.ApplicationResponse != "" {
 		cdrData, err = s.encodingService.DecodeFromBase64(soapResponse.Body.SendBillResponse.ApplicationResponse)
 		if err != nil {
 			return nil, fmt.Errorf("error decodificando CDR: %v", err)
 		}
+		respuesta, err = LeerCDR(cdrData)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return &SUNATSendResponse{
@@ -162,11 +164,89 @@ func (s *SUNATService) processResponse(response *http.Response) (*SUNATSendRespo
 		StatusCode:          response.StatusCode,
 		Ticket:              soapResponse.Body.SendBillResponse.Ticket,
 		ApplicationResponse: cdrData,
+		Respuesta:           respuesta,
 		Message:             "Documento enviado exitosamente",
 		Timestamp:           time.Now(),
 	}, nil
 }
 
+// cdrXML es la parte del ApplicationResponse (CDR) que informa el resultado
+type cdrXML struct {
+	Notas            []string `xml:"Note"`
+	DocumentResponse struct {
+		Response struct {
+			ReferenceID  string `xml:"ReferenceID"`
+			ResponseCode string `xml:"ResponseCode"`
+			Description  string `xml:"Description"`
+		} `xml:"Response"`
+	} `xml:"DocumentResponse"`
+}
+
+// RespuestaCDR es el resultado que SUNAT informa en la constancia de recepción:
+// el código de cac:DocumentResponse/cac:Response y las observaciones (cbc:Note)
+type RespuestaCDR struct {
+	Referencia    string   `json:"referencia"`
+	Codigo        string   `json:"codigo"`
+	Descripcion   string   `json:"descripcion"`
+	Observaciones []string `json:"observaciones,omitempty"`
+}
+
+// LeerCDR lee el código de respuesta de un CDR, comprimido en ZIP tal como lo
+// devuelve sendBill o ya extraído
+func LeerCDR(cdr []byte) (*RespuestaCDR, error) {
+	encodingService := &EncodingService{}
+	contenido := cdr
+	if encodingService.isZipData(cdr) {
+		archivos, err := encodingService.ExtractFromZip(cdr)
+		if err != nil {
+			return nil, fmt.Errorf("error descomprimiendo CDR: %v", err)
+		}
+		contenido = nil
+		for nombre, data := range archivos {
+			if strings.EqualFold(path.Ext(nombre), ".xml") {
+				contenido = data
+				break
+			}
+		}
+		if contenido == nil {
+			return nil, fmt.Errorf("el CDR no contiene un archivo XML")
+		}
+	}
+
+	var doc cdrXML
+	if err := xml.Unmarshal(contenido, &doc); err != nil {
+		return nil, fmt.Errorf("error leyendo CDR: %v", err)
+	}
+	response := doc.DocumentResponse.Response
+	if strings.TrimSpace(response.ResponseCode) == "" {
+		return nil, fmt.Errorf("el CDR no informa el código de respuesta")
+	}
+	return &RespuestaCDR{
+		Referencia:    strings.TrimSpace(response.ReferenceID),
+		Codigo:        strings.TrimSpace(response.ResponseCode),
+		Descripcion:   strings.TrimSpace(response.Description),
+		Observaciones: doc.Notas,
+	}, nil
+}
+
+// Estado retorna el estado del comprobante según el código de respuesta: 0 es
+// aceptado, 4000 en adelante aceptado con observaciones y 2000 a 3999
+// rechazado. Los demás códigos son excepciones (ErrExcepcionSUNAT).
+func (r *RespuestaCDR) Estado() (models.EstadoProceso, error) {
+	codigo, err := strconv.Atoi(r.Codigo)
+	if err != nil {
+		return 0, fmt.Errorf("código de respuesta del CDR inválido: %q", r.Codigo)
+	}
+	switch {
+	case codigo == 0 || codigo >= 4000:
+		return models.EstadoAceptado, nil
+	case codigo >= 2000:
+		return models.EstadoRechazado, nil
+	default:
+		return 0, fmt.Errorf("%w: %s - %s", ErrExcepcionSUNAT, r.Codigo, r.Descripcion)
+	}
+}
+
 // processStatusResponse procesa respuesta de consulta de estado
 func (s *SUNATService) processStatusResponse(response *http.Response) (*SUNATStatusResponse, error) {
 	defer response.Body.Close()
@@ -218,29 +298,6 @@ func (s *SUNATService) processCDRResponse(response *http.Response) (*CDRResponse
 	}, nil
 }
 
-// processRUCValidationResponse procesa respuesta de validación de RUC
-func (s *SUNATService) processRUCValidationResponse(response *http.Response) (*RUCValidationResponse, error) {
-	defer response.Body.Close()
-
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error leyendo respuesta de validación RUC: %v", err)
-	}
-
-	var validationResponse RUCValidationSOAPResponse
-	if err := xml.Unmarshal(body, &validationResponse); err != nil {
-		return nil, fmt.Errorf("error parseando respuesta de validación RUC: %v", err)
-	}
-
-	return &RUCValidationResponse{
-		Valid:       validationResponse.Body.ValidateResponse.Valid,
-		RazonSocial: validationResponse.Body.ValidateResponse.RazonSocial,
-		Estado:      validationResponse.Body.ValidateResponse.Estado,
-		Direccion:   validationResponse.Body.ValidateResponse.Direccion,
-		Timestamp:   time.Now(),
-	}, nil
-}
-
 // TestConnection prueba la conectividad con SUNAT
 func (s *SUNATService) TestConnection() error {
 	response, err := s.Client.TestConnection(nil)
@@ -289,13 +346,34 @@ func (s *SUNATService) isSimulationMode() bool {
 // simulateSUNATResponse simula una respuesta exitosa de SUNAT
 func (s *SUNATService) simulateSUNATResponse(pkg *SUNATPackage) (*SUNATSendResponse, error) {
 	fmt.Println("🎭 Modo simulación activado - Simulando respuesta exitosa de SUNAT")
-	
+
+	referencia := strings.TrimSuffix(pkg.FileName, path.Ext(pkg.FileName))
+	cdrXML := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<ar:ApplicationResponse xmlns:ar="urn:oasis:names:specification:ubl:schema:xsd:ApplicationResponse-2" xmlns:cac="urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2" xmlns:cbc="urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2">
+	<cac:DocumentResponse>
+		<cac:Response>
+			<cbc:ReferenceID>%s</cbc:ReferenceID>
+			<cbc:ResponseCode>0</cbc:ResponseCode>
+			<cbc:Description>El comprobante %s ha sido aceptado (SIMULACIÓN)</cbc:Description>
+		</cac:Response>
+	</cac:DocumentResponse>
+</ar:ApplicationResponse>`, referencia, referencia)
+	cdr, err := s.encodingService.CreateZipFile([]byte(cdrXML), "R-"+referencia)
+	if err != nil {
+		return nil, fmt.Errorf("error generando CDR simulado: %v", err)
+	}
+	respuesta, err := LeerCDR(cdr)
+	if err != nil {
+		return nil, err
+	}
+
 	return &SUNATSendResponse{
 		Success:             true,
 		StatusCode:          200,
 		Message:             "Documento aceptado por SUNAT (SIMULACIÓN)",
 		Ticket:              "123456789",
-		ApplicationResponse: []byte("ACEPTADO"),
+		ApplicationResponse: cdr,
+		Respuesta:           respuesta,
 		Timestamp:           time.Now(),
 	}, nil
 }
@@ -329,29 +407,15 @@ type DownloadResponse struct {
 	Message string `xml:"message"`
 }
 
-type RUCValidationSOAPResponse struct {
-	Body RUCValidationResponseBody `xml:"Body"`
-}
-
-type RUCValidationResponseBody struct {
-	ValidateResponse RUCValidateResponse `xml:"validateResponse"`
-}
-
-type RUCValidateResponse struct {
-	Valid       bool   `xml:"valid"`
-	RazonSocial string `xml:"razonSocial"`
-	Estado      string `xml:"estado"`
-	Direccion   string `xml:"direccion"`
-}
-
 // Estructuras de respuesta del servicio
 type SUNATSendResponse struct {
-	Success             bool      `json:"success"`
-	StatusCode          int       `json:"status_code"`
-	Ticket              string    `json:"ticket,omitempty"`
-	ApplicationResponse []byte    `json:"-"`
-	Message             string    `json:"message"`
-	Timestamp           time.Time `json:"timestamp"`
+	Success             bool          `json:"success"`
+	StatusCode          int           `json:"status_code"`
+	Ticket              string        `json:"ticket,omitempty"`
+	ApplicationResponse []byte        `json:"-"`
+	Respuesta           *RespuestaCDR `json:"respuesta,omitempty"`
+	Message             string        `json:"message"`
+	Timestamp           time.Time     `json:"timestamp"`
 }
 
 type SUNATStatusResponse struct {
@@ -369,14 +433,6 @@ type CDRResponse struct {
 	Timestamp time.Time `json:"timestamp"`
 }
 
-type RUCValidationResponse struct {
-	Valid       bool      `json:"valid"`
-	RazonSocial string    `json:"razon_social"`
-	Estado      string    `json:"estado"`
-	Direccion   string    `json:"direccion"`
-	Timestamp   time.Time `json:"timestamp"`
-}
-
 type ServiceStatusResponse struct {
 	Available bool      `json:"available"`
 	Message   string    `json:"message"`
@@ -2,355 +2,330 @@ package services
 
 import (
 	"encoding/base64"
-	"encoding/xml"
+	"errors"
+	"facturacion_sunat_api_go/internal/config"
 	"facturacion_sunat_api_go/internal/models"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// cdrPrueba arma un ApplicationResponse con el código y las notas indicadas
+func cdrPrueba(codigo, descripcion string, notas ...string) string {
+	var sb strings.Builder
+	for _, nota := range notas {
+		sb.WriteString("  <cbc:Note>" + nota + "</cbc:Note>\n")
+	}
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<ar:ApplicationResponse xmlns:ar="urn:oasis:names:specification:ubl:schema:xsd:ApplicationResponse-2" xmlns:cac="urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2" xmlns:cbc="urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2">
+` + sb.String() + `  <cac:DocumentResponse>
+    <cac:Response>
+      <cbc:ReferenceID>F001-00000001</cbc:ReferenceID>
+      <cbc:ResponseCode>` + codigo + `</cbc:ResponseCode>
+      <cbc:Description>` + descripcion + `</cbc:Description>
+    </cac:Response>
+  </cac:DocumentResponse>
+</ar:ApplicationResponse>`
+}
+
+// respuestaSendBill envuelve un CDR comprimido en la respuesta SOAP de sendBill
+func respuestaSendBill(t *testing.T, cdr string) string {
+	zipCDR, err := NewEncodingService().CreateZipFile([]byte(cdr), "R-20123456789-01-F001-00000001")
+	require.NoError(t, err)
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body>
+    <ns2:sendBillResponse xmlns:ns2="http://service.sunat.gob.pe">
+      <applicationResponse>` + base64.StdEncoding.EncodeToString(zipCDR) + `</applicationResponse>
+    </ns2:sendBillResponse>
+  </soap:Body>
+</soap:Envelope>`
+}
+
+// cdrRechazo es un CDR de rechazo de SUNAT
+var cdrRechazo = cdrPrueba("2017", "El numero de documento de identidad del receptor debe ser RUC")
+
+// servicioPrueba crea un SUNATService que envía al servidor indicado
+func servicioPrueba(url string) *SUNATService {
+	sunatConfig := &config.SUNATConfig{
+		BetaURL:       url,
+		Username:      "20103129061MODDATOS",
+		Password:      "MODDATOS",
+		Timeout:       30,
+		ForceRealSend: true,
+	}
+	return NewSUNATService(sunatConfig, NewEncodingService())
+}
+
+// paquetePrueba genera un paquete ZIP válido para el envío
+func paquetePrueba(t *testing.T) *SUNATPackage {
+	pkg, err := NewEncodingService().ProcessForSUNAT([]byte("<Invoice/>"), "20123456789-01-F001-00000001")
+	require.NoError(t, err)
+	return pkg
+}
+
 // TestSUNATServiceSendDocumentAccepted prueba el envío exitoso a SUNAT
 func TestSUNATServiceSendDocumentAccepted(t *testing.T) {
 	// Crear servidor mock que simula SUNAT
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Verificar que es una petición POST
+		// Verificar método y Content-Type
 		assert.Equal(t, "POST", r.Method)
-		
-		// Verificar Content-Type
 		assert.Contains(t, r.Header.Get("Content-Type"), "text/xml")
-		
-		// Leer el body de la petición
-		body := make([]byte, r.ContentLength)
-		r.Body.Read(body)
-		bodyStr := string(body)
-		
+
 		// Verificar que contiene elementos SOAP esperados
+		body, _ := io.ReadAll(r.Body)
+		bodyStr := string(body)
 		assert.Contains(t, bodyStr, "<soap:Envelope")
 		assert.Contains(t, bodyStr, "<sendBill")
 		assert.Contains(t, bodyStr, "<fileName>")
 		assert.Contains(t, bodyStr, "<contentFile>")
-		
-		// Simular respuesta exitosa de SUNAT
+
 		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
-		
-		// Respuesta SOAP de aceptación (ejemplo real de SUNAT)
-		response := `<?xml version="1.0" encoding="UTF-8"?>
-<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
-  <soap:Body>
-    <ns2:sendBillResponse xmlns:ns2="http://service.sunat.gob.pe">
-      <applicationResponse>` + base64.StdEncoding.EncodeToString([]byte("CDR-ACEPTADO")) + `</applicationResponse>
-    </ns2:sendBillResponse>
-  </soap:Body>
-</soap:Envelope>`
-		
-		w.Write([]byte(response))
+		w.Write([]byte(respuestaSendBill(t, cdrPrueba("0", "La Factura numero F001-00000001, ha sido aceptada"))))
 	}))
 	defer server.Close()
 
-	// Crear configuración SUNAT con el servidor mock
-	sunatConfig := &models.SUNATConfig{
-		Endpoint: server.URL,
-		Username: "20103129061MODDATOS",
-		Password: "MODDATOS",
-		Timeout:  30,
-	}
+	response, err := servicioPrueba(server.URL).SendDocument(paquetePrueba(t))
 
-	// Crear servicio de codificación
-	encodingService := NewEncodingService()
-	
-	// Crear servicio SUNAT
-	sunatService := NewSUNATService(sunatConfig, encodingService)
-
-	// Crear paquete de prueba
-	testPackage := &SUNATPackage{
-		FileName:     "20123456789-01-F001-00000001.zip",
-		ZipContent:   []byte("test zip content"),
-		Base64Content: base64.StdEncoding.EncodeToString([]byte("test zip content")),
-		XMLContent:   []byte("test xml content"),
-	}
-
-	// Enviar documento
-	response, err := sunatService.SendDocument(testPackage)
+	assert.NoError(t, err)
+	require.NotNil(t, response)
+	assert.True(t, response.Success)
+	assert.NotEmpty(t, response.ApplicationResponse)
+	require.NotNil(t, response.Respuesta)
+	assert.Equal(t, "0", response.Respuesta.Codigo)
 
-	// Verificar que no hay error
+	estado, err := response.Respuesta.Estado()
 	assert.NoError(t, err)
-	assert.NotNil(t, response)
-	
-	// Verificar que la respuesta indica aceptación
-	assert.Contains(t, string(response.CDR), "CDR-ACEPTADO")
-	assert.Equal(t, "ACEPTADO", response.Status)
+	assert.Equal(t, models.EstadoAceptado, estado)
 }
 
 // TestSUNATServiceSendDocumentRejected prueba el envío rechazado por SUNAT
 func TestSUNATServiceSendDocumentRejected(t *testing.T) {
-	// Crear servidor mock que simula SUNAT rechazando
+	// SUNAT responde HTTP 200 con el CDR de rechazo
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Simular respuesta de rechazo de SUNAT
 		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
-		
-		// Respuesta SOAP de rechazo
-		rejectionCDR := `<?xml version="1.0" encoding="UTF-8"?>
-<ApplicationResponse xmlns="urn:oasis:names:specification:ubl:schema:xsd:ApplicationResponse-2">
-  <cbc:ReferenceID>20123456789-01-F001-00000001</cbc:ReferenceID>
-  <cbc:ResponseCode>0003</cbc:ResponseCode>
-  <cbc:Description>El Comprobante ingresado no cumple con el estandar establecido.</cbc:Description>
-</ApplicationResponse>`
-		
-		response := `<?xml version="1.0" encoding="UTF-8"?>
-<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
-  <soap:Body>
-    <ns2:sendBillResponse xmlns:ns2="http://service.sunat.gob.pe">
-      <applicationResponse>` + base64.StdEncoding.EncodeToString([]byte(rejectionCDR)) + `</applicationResponse>
-    </ns2:sendBillResponse>
-  </soap:Body>
-</soap:Envelope>`
-		
-		w.Write([]byte(response))
+		w.Write([]byte(respuestaSendBill(t, cdrRechazo)))
 	}))
 	defer server.Close()
 
-	// Crear configuración SUNAT con el servidor mock
-	sunatConfig := &models.SUNATConfig{
-		Endpoint: server.URL,
-		Username: "20103129061MODDATOS",
-		Password: "MODDATOS",
-		Timeout:  30,
-	}
-
-	// Crear servicio de codificación
-	encodingService := NewEncodingService()
-	
-	// Crear servicio SUNAT
-	sunatService := NewSUNATService(sunatConfig, encodingService)
-
-	// Crear paquete de prueba
-	testPackage := &SUNATPackage{
-		FileName:     "20123456789-01-F001-00000001.zip",
-		ZipContent:   []byte("test zip content"),
-		Base64Content: base64.StdEncoding.EncodeToString([]byte("test zip content")),
-		XMLContent:   []byte("test xml content"),
-	}
+	response, err := servicioPrueba(server.URL).SendDocument(paquetePrueba(t))
 
-	// Enviar documento
-	response, err := sunatService.SendDocument(testPackage)
+	assert.NoError(t, err)
+	require.NotNil(t, response)
+	require.NotNil(t, response.Respuesta)
+	assert.Equal(t, "2017", response.Respuesta.Codigo)
+	assert.Contains(t, response.Respuesta.Descripcion, "debe ser RUC")
 
-	// Verificar que no hay error (SUNAT responde con CDR de rechazo)
+	estado, err := response.Respuesta.Estado()
 	assert.NoError(t, err)
-	assert.NotNil(t, response)
-	
-	// Verificar que la respuesta indica rechazo
-	assert.Contains(t, string(response.CDR), "0003")
-	assert.Contains(t, string(response.CDR), "El Comprobante ingresado no cumple con el estandar establecido")
-	assert.Equal(t, "RECHAZADO", response.Status)
+	assert.Equal(t, models.EstadoRechazado, estado)
 }
 
 // TestSUNATServiceSendDocumentError prueba el error de comunicación con SUNAT
 func TestSUNATServiceSendDocumentError(t *testing.T) {
-	// Crear servidor mock que simula error de SUNAT
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Simular error 500 de SUNAT
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte("Error interno del servidor"))
 	}))
 	defer server.Close()
 
-	// Crear configuración SUNAT con el servidor mock
-	sunatConfig := &models.SUNATConfig{
-		Endpoint: server.URL,
-		Username: "20103129061MODDATOS",
-		Password: "MODDATOS",
-		Timeout:  30,
-	}
-
-	// Crear servicio de codificación
-	encodingService := NewEncodingService()
-	
-	// Crear servicio SUNAT
-	sunatService := NewSUNATService(sunatConfig, encodingService)
-
-	// Crear paquete de prueba
-	testPackage := &SUNATPackage{
-		FileName:     "20123456789-01-F001-00000001.zip",
-		ZipContent:   []byte("test zip content"),
-		Base64Content: base64.StdEncoding.EncodeToString([]byte("test zip content")),
-		XMLContent:   []byte("test xml content"),
-	}
-
-	// Enviar documento
-	response, err := sunatService.SendDocument(testPackage)
+	response, err := servicioPrueba(server.URL).SendDocument(paquetePrueba(t))
 
-	// Verificar que hay error
-	assert.Error(t, err)
-	assert.Nil(t, response)
-	assert.Contains(t, err.Error(), "Error en respuesta de SUNAT")
+	// El error HTTP se informa en la respuesta, sin CDR
+	assert.NoError(t, err)
+	require.NotNil(t, response)
+	assert.False(t, response.Success)
+	assert.Equal(t, http.StatusInternalServerError, response.StatusCode)
+	assert.Contains(t, response.Message, "Error interno del servidor")
+	assert.Empty(t, response.ApplicationResponse)
+	assert.Nil(t, response.Respuesta)
 }
 
 // TestSUNATServiceBuildSOAPRequest prueba la construcción del SOAP request
 func TestSUNATServiceBuildSOAPRequest(t *testing.T) {
-	// Crear configuración SUNAT
-	sunatConfig := &models.SUNATConfig{
-		Endpoint: "https://e-beta.sunat.gob.pe/ol-ti-itcpfegem-beta/billService",
-		Username: "20103129061MODDATOS",
-		Password: "MODDATOS",
-		Timeout:  30,
-	}
-
-	// Crear servicio de codificación
-	encodingService := NewEncodingService()
-	
-	// Crear servicio SUNAT
-	sunatService := NewSUNATService(sunatConfig, encodingService)
-
-	// Crear paquete de prueba
-	testPackage := &SUNATPackage{
-		FileName:     "20123456789-01-F001-00000001.zip",
-		ZipContent:   []byte("test zip content"),
-		Base64Content: base64.StdEncoding.EncodeToString([]byte("test zip content")),
-		XMLContent:   []byte("test xml content"),
-	}
-
-	// Construir SOAP request
-	soapRequest, err := sunatService.buildSOAPRequest(testPackage)
+	var soapStr string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		soapStr = string(body)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(respuestaSendBill(t, cdrPrueba("0", "aceptada"))))
+	}))
+	defer server.Close()
 
-	// Verificar que no hay error
-	assert.NoError(t, err)
-	assert.NotNil(t, soapRequest)
+	pkg := paquetePrueba(t)
+	_, err := servicioPrueba(server.URL).SendDocument(pkg)
+	require.NoError(t, err)
 
 	// Verificar estructura SOAP
-	soapStr := string(soapRequest)
 	assert.Contains(t, soapStr, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
 	assert.Contains(t, soapStr, "<soap:Envelope")
 	assert.Contains(t, soapStr, "<soap:Header>")
-	assert.Contains(t, soapStr, "<wsse:Security>")
 	assert.Contains(t, soapStr, "<wsse:UsernameToken>")
 	assert.Contains(t, soapStr, "<wsse:Username>20103129061MODDATOS</wsse:Username>")
 	assert.Contains(t, soapStr, "<wsse:Password>MODDATOS</wsse:Password>")
 	assert.Contains(t, soapStr, "<soap:Body>")
 	assert.Contains(t, soapStr, "<sendBill")
 	assert.Contains(t, soapStr, "<fileName>20123456789-01-F001-00000001.zip</fileName>")
-	assert.Contains(t, soapStr, "<contentFile>")
-	assert.Contains(t, soapStr, base64.StdEncoding.EncodeToString([]byte("test zip content")))
+	assert.Contains(t, soapStr, "<contentFile>"+pkg.Base64Content+"</contentFile>")
 }
 
 // TestSUNATServiceParseSOAPResponse prueba el parsing de respuestas SOAP
 func TestSUNATServiceParseSOAPResponse(t *testing.T) {
-	// Crear configuración SUNAT
-	sunatConfig := &models.SUNATConfig{
-		Endpoint: "https://e-beta.sunat.gob.pe/ol-ti-itcpfegem-beta/billService",
-		Username: "20103129061MODDATOS",
-		Password: "MODDATOS",
-		Timeout:  30,
+	sunatService := servicioPrueba("")
+
+	tests := []struct {
+		name string
+		cdr  string
+	}{
+		{"aceptación", cdrPrueba("0", "ha sido aceptada")},
+		{"rechazo", cdrRechazo},
 	}
 
-	// Crear servicio de codificación
-	encodingService := NewEncodingService()
-	
-	// Crear servicio SUNAT
-	sunatService := NewSUNATService(sunatConfig, encodingService)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			soapResponse, err := sunatService.Client.ParseSOAPBody([]byte(respuestaSendBill(t, tt.cdr)))
+			require.NoError(t, err)
+			require.NotNil(t, soapResponse.Body.SendBillResponse)
+
+			cdr, err := NewEncodingService().DecodeFromBase64(soapResponse.Body.SendBillResponse.ApplicationResponse)
+			require.NoError(t, err)
+			archivos, err := NewEncodingService().ExtractFromZip(cdr)
+			require.NoError(t, err)
+			require.Len(t, archivos, 1)
+			for _, contenido := range archivos {
+				assert.Equal(t, tt.cdr, string(contenido))
+			}
+		})
+	}
 
-	// Respuesta SOAP de aceptación
-	acceptanceResponse := `<?xml version="1.0" encoding="UTF-8"?>
+	// Un SOAP Fault se informa como error
+	fault := `<?xml version="1.0" encoding="UTF-8"?>
 <soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
   <soap:Body>
-    <ns2:sendBillResponse xmlns:ns2="http://service.sunat.gob.pe">
-      <applicationResponse>` + base64.StdEncoding.EncodeToString([]byte("CDR-ACEPTADO")) + `</applicationResponse>
-    </ns2:sendBillResponse>
+    <soap:Fault>
+      <faultcode>soap:Client.0111</faultcode>
+      <faultstring>No tiene el perfil para enviar comprobantes electronicos</faultstring>
+    </soap:Fault>
   </soap:Body>
 </soap:Envelope>`
+	_, err := sunatService.Client.ParseSOAPBody([]byte(fault))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "SOAP Fault")
+}
 
-	// Parsear respuesta
-	response, err := sunatService.parseSOAPResponse([]byte(acceptanceResponse))
+// TestLeerCDR prueba la lectura del código de respuesta y su estado
+func TestLeerCDR(t *testing.T) {
+	tests := []struct {
+		name    string
+		cdr     string
+		codigo  string
+		estado  models.EstadoProceso
+		notas   int
+		wantErr error
+	}{
+		{"aceptado", cdrPrueba("0", "ha sido aceptada"), "0", models.EstadoAceptado, 0, nil},
+		{"aceptado con observaciones", cdrPrueba("0", "ha sido aceptada", "4252 - El dato ingresado como atributo @listName es incorrecto"), "0", models.EstadoAceptado, 1, nil},
+		{"código de observación", cdrPrueba("4093", "El código de ubigeo no existe"), "4093", models.EstadoAceptado, 0, nil},
+		{"rechazo inicial", cdrPrueba("2000", "rechazado"), "2000", models.EstadoRechazado, 0, nil},
+		{"rechazo final", cdrPrueba("3999", "rechazado"), "3999", models.EstadoRechazado, 0, nil},
+		{"excepción", cdrPrueba("0111", "No tiene el perfil para enviar comprobantes electronicos"), "0111", 0, 0, ErrExcepcionSUNAT},
+		{"excepción límite", cdrPrueba("1999", "excepción"), "1999", 0, 0, ErrExcepcionSUNAT},
+	}
 
-	// Verificar que no hay error
-	assert.NoError(t, err)
-	assert.NotNil(t, response)
-	assert.Contains(t, string(response.CDR), "CDR-ACEPTADO")
-	assert.Equal(t, "ACEPTADO", response.Status)
-
-	// Respuesta SOAP de rechazo
-	rejectionCDR := `<?xml version="1.0" encoding="UTF-8"?>
-<ApplicationResponse xmlns="urn:oasis:names:specification:ubl:schema:xsd:ApplicationResponse-2">
-  <cbc:ReferenceID>20123456789-01-F001-00000001</cbc:ReferenceID>
-  <cbc:ResponseCode>0003</cbc:ResponseCode>
-  <cbc:Description>El Comprobante ingresado no cumple con el estandar establecido.</cbc:Description>
-</ApplicationResponse>`
-
-	rejectionResponse := `<?xml version="1.0" encoding="UTF-8"?>
-<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
-  <soap:Body>
-    <ns2:sendBillResponse xmlns:ns2="http://service.sunat.gob.pe">
-      <applicationResponse>` + base64.StdEncoding.EncodeToString([]byte(rejectionCDR)) + `</applicationResponse>
-    </ns2:sendBillResponse>
-  </soap:Body>
-</soap:Envelope>`
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, comprimido := range []bool{false, true} {
+				cdr := []byte(tt.cdr)
+				if comprimido {
+					var err error
+					cdr, err = NewEncodingService().CreateZipFile(cdr, "R-20123456789-01-F001-00000001")
+					require.NoError(t, err)
+				}
+
+				respuesta, err := LeerCDR(cdr)
+				require.NoError(t, err)
+				assert.Equal(t, tt.codigo, respuesta.Codigo)
+				assert.Equal(t, "F001-00000001", respuesta.Referencia)
+				assert.Len(t, respuesta.Observaciones, tt.notas)
+
+				estado, err := respuesta.Estado()
+				if tt.wantErr != nil {
+					assert.True(t, errors.Is(err, tt.wantErr), fmt.Sprintf("error inesperado: %v", err))
+					continue
+				}
+				assert.NoError(t, err)
+				assert.Equal(t, tt.estado, estado)
+			}
+		})
+	}
+}
 
-	// Parsear respuesta de rechazo
-	response, err = sunatService.parseSOAPResponse([]byte(rejectionResponse))
+// TestLeerCDRInvalido prueba CDRs que no informan un código de respuesta
+func TestLeerCDRInvalido(t *testing.T) {
+	_, err := LeerCDR([]byte("CDR-ACEPTADO"))
+	assert.Error(t, err)
 
-	// Verificar que no hay error
-	assert.NoError(t, err)
-	assert.NotNil(t, response)
-	assert.Contains(t, string(response.CDR), "0003")
-	assert.Contains(t, string(response.CDR), "El Comprobante ingresado no cumple con el estandar establecido")
-	assert.Equal(t, "RECHAZADO", response.Status)
+	_, err = LeerCDR([]byte(cdrPrueba("", "sin código")))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "código de respuesta")
+
+	_, err = (&RespuestaCDR{Codigo: "abc"}).Estado()
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrExcepcionSUNAT))
 }
 
-// TestSUNATServiceValidatePackage prueba la validación del paquete antes del envío
-func TestSUNATServiceValidatePackage(t *testing.T) {
-	// Crear configuración SUNAT
-	sunatConfig := &models.SUNATConfig{
-		Endpoint: "https://e-beta.sunat.gob.pe/ol-ti-itcpfegem-beta/billService",
+// TestSUNATServiceSimulacion prueba que el modo simulación devuelve un CDR legible
+func TestSUNATServiceSimulacion(t *testing.T) {
+	sunatConfig := &config.SUNATConfig{
 		Username: "20103129061MODDATOS",
 		Password: "MODDATOS",
 		Timeout:  30,
 	}
+	sunatService := NewSUNATService(sunatConfig, NewEncodingService())
 
-	// Crear servicio de codificación
-	encodingService := NewEncodingService()
-	
-	// Crear servicio SUNAT
-	sunatService := NewSUNATService(sunatConfig, encodingService)
+	response, err := sunatService.SendDocument(paquetePrueba(t))
 
-	// Paquete válido
-	validPackage := &SUNATPackage{
-		FileName:     "20123456789-01-F001-00000001.zip",
-		ZipContent:   []byte("test zip content"),
-		Base64Content: base64.StdEncoding.EncodeToString([]byte("test zip content")),
-		XMLContent:   []byte("test xml content"),
-	}
+	require.NoError(t, err)
+	require.NotNil(t, response.Respuesta)
+	assert.Equal(t, "0", response.Respuesta.Codigo)
+	assert.Equal(t, "20123456789-01-F001-00000001", response.Respuesta.Referencia)
 
-	// Validar paquete válido
-	err := sunatService.validatePackage(validPackage)
-	assert.NoError(t, err)
+	respuesta, err := LeerCDR(response.ApplicationResponse)
+	require.NoError(t, err)
+	assert.Equal(t, response.Respuesta.Codigo, respuesta.Codigo)
+}
 
-	// Paquete inválido - sin nombre de archivo
-	invalidPackage1 := &SUNATPackage{
-		FileName:     "",
-		ZipContent:   []byte("test zip content"),
-		Base64Content: base64.StdEncoding.EncodeToString([]byte("test zip content")),
-		XMLContent:   []byte("test xml content"),
-	}
+// TestSUNATServiceValidatePackage prueba la validación del paquete antes del envío
+func TestSUNATServiceValidatePackage(t *testing.T) {
+	// Paquete válido
+	validPackage := paquetePrueba(t)
+	assert.NoError(t, validPackage.ValidatePackage())
 
-	// Validar paquete inválido
-	err = sunatService.validatePackage(invalidPackage1)
+	// Paquete inválido - sin nombre de archivo
+	invalidPackage1 := paquetePrueba(t)
+	invalidPackage1.FileName = ""
+	err := invalidPackage1.ValidatePackage()
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "nombre de archivo requerido")
 
 	// Paquete inválido - ZIP vacío
-	invalidPackage2 := &SUNATPackage{
-		FileName:     "20123456789-01-F001-00000001.zip",
-		ZipContent:   []byte{},
-		Base64Content: "",
-		XMLContent:   []byte("test xml content"),
-	}
+	invalidPackage2 := paquetePrueba(t)
+	invalidPackage2.ZipContent = []byte{}
+	invalidPackage2.Base64Content = ""
+	err = invalidPackage2.ValidatePackage()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "contenido ZIP vacío")
 
-	// Validar paquete inválido
-	err = sunatService.validatePackage(invalidPackage2)
+	// El servicio no envía paquetes inválidos
+	_, err = servicioPrueba("http://127.0.0.1:0").SendDocument(invalidPackage2)
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "contenido ZIP requerido")
-} 
\ No newline at end of file
+	assert.Contains(t, err.Error(), "paquete inválido")
+}
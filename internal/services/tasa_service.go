@@ -0,0 +1,83 @@
+package services
+
+import (
+	"errors"
+	"facturacion_sunat_api_go/internal/models"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TasaLoader obtiene la tabla de tasas de impuestos desde el almacenamiento
+type TasaLoader interface {
+	ListTasas() (models.TablaTasas, error)
+}
+
+// ErrRegimenInvalido indica un régimen del emisor sin tasas registradas
+var ErrRegimenInvalido = errors.New("régimen del emisor no registrado en la tabla de tasas")
+
+// TasaService resuelve las tasas de impuestos vigentes según la fecha de
+// emisión y el régimen del emisor
+type TasaService struct {
+	loader TasaLoader
+	mu     sync.RWMutex
+	tabla  models.TablaTasas
+}
+
+// NewTasaService crea el servicio con las tasas por defecto. Si se indica un
+// loader, Cargar reemplaza la tabla con las tasas registradas.
+func NewTasaService(loader TasaLoader) *TasaService {
+	return &TasaService{
+		loader: loader,
+		tabla:  models.TasasPorDefecto,
+	}
+}
+
+// Cargar actualiza la tabla de tasas desde el almacenamiento
+func (s *TasaService) Cargar() error {
+	if s.loader == nil {
+		return nil
+	}
+
+	tabla, err := s.loader.ListTasas()
+	if err != nil {
+		return fmt.Errorf("error cargando tasas de impuestos: %v", err)
+	}
+	if len(tabla) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	s.tabla = tabla
+	s.mu.Unlock()
+	return nil
+}
+
+// Tasa retorna la tasa vigente de un tributo
+func (s *TasaService) Tasa(tributo, regimen string, fecha time.Time) (float64, error) {
+	s.mu.RLock()
+	registrado := regimen == "" || s.tabla.TieneRegimen(regimen)
+	tasa, ok := s.tabla.Buscar(tributo, regimen, fecha)
+	s.mu.RUnlock()
+
+	if !registrado {
+		return 0, fmt.Errorf("%w: %q", ErrRegimenInvalido, regimen)
+	}
+	if !ok {
+		return 0, fmt.Errorf("no hay una tasa de %s vigente al %s", tributo, fecha.Format("2006-01-02"))
+	}
+	return tasa.Tasa, nil
+}
+
+// TasaIGV retorna la tasa que se informa como IGV: IGV más IPM
+func (s *TasaService) TasaIGV(regimen string, fecha time.Time) (float64, error) {
+	igv, err := s.Tasa(models.TributoIGV, regimen, fecha)
+	if err != nil {
+		return 0, err
+	}
+	ipm, err := s.Tasa(models.TributoIPM, regimen, fecha)
+	if err != nil {
+		return 0, err
+	}
+	return igv + ipm, nil
+}
@@ -0,0 +1,366 @@
+package services
+
+import (
+	"encoding/csv"
+	"facturacion_sunat_api_go/internal/models"
+	"facturacion_sunat_api_go/pkg/catalogos"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TipoCambioStore guarda y consulta los tipos de cambio oficiales
+type TipoCambioStore interface {
+	Buscar(moneda string, desde, hasta time.Time) (*models.TipoCambio, error)
+	GuardarLote(tiposCambio []models.TipoCambio) (int64, error)
+}
+
+// diasRetrocesoTipoCambio es el número de días hacia atrás en que se busca la
+// última publicación; cubre fines de semana largos y feriados consecutivos
+const diasRetrocesoTipoCambio = 7
+
+// tamanoLoteTipoCambio es el número de cotizaciones que se envían por sentencia
+const tamanoLoteTipoCambio = 500
+
+// Cotizaciones que se aplican en una conversión
+const (
+	OperacionCompra = "compra"
+	OperacionVenta  = "venta"
+)
+
+// monedasSBS relaciona los nombres con los que la SBS publica las monedas con
+// su código ISO 4217 (catálogo 02)
+var monedasSBS = []struct {
+	nombre string
+	codigo string
+}{
+	{"dolar de n.a", "USD"},
+	{"dolar americano", "USD"},
+	{"dolar canadiense", "CAD"},
+	{"dolar australiano", "AUD"},
+	{"euro", "EUR"},
+	{"libra esterlina", "GBP"},
+	{"yen japones", "JPY"},
+	{"franco suizo", "CHF"},
+	{"corona sueca", "SEK"},
+	{"peso mexicano", "MXN"},
+	{"real brasileno", "BRL"},
+	{"yuan", "CNY"},
+}
+
+// TipoCambioService consulta los tipos de cambio oficiales publicados por la
+// SBS y SUNAT e importa sus archivos CSV
+type TipoCambioService struct {
+	store TipoCambioStore
+}
+
+func NewTipoCambioService(store TipoCambioStore) *TipoCambioService {
+	return &TipoCambioService{
+		store: store,
+	}
+}
+
+// ImportacionTipoCambio resume la carga de un archivo de tipos de cambio
+type ImportacionTipoCambio struct {
+	Leidos     int64 `json:"leidos"`
+	Guardados  int64 `json:"guardados"`
+	Rechazados int64 `json:"rechazados"`
+}
+
+// Conversion es el resultado de convertir un importe entre dos monedas
+type Conversion struct {
+	Valor       float64              `json:"valor_inicial"`
+	De          string               `json:"de"`
+	A           string               `json:"a"`
+	Fecha       time.Time            `json:"fecha"`
+	Operacion   string               `json:"operacion"`
+	Tasa        float64              `json:"tasa"`
+	Resultado   float64              `json:"resultado"`
+	TiposCambio []*models.TipoCambio `json:"tipos_cambio"`
+}
+
+// Consultar obtiene el tipo de cambio de una moneda para una fecha. Si ese día
+// no hubo publicación se usa la del último día hábil anterior; la fecha del
+// resultado es la de la publicación usada.
+func (s *TipoCambioService) Consultar(moneda string, fecha time.Time) (*models.TipoCambio, error) {
+	moneda = strings.ToUpper(strings.TrimSpace(moneda))
+	if moneda == "PEN" {
+		return nil, fmt.Errorf("el sol (PEN) es la moneda de referencia y no tiene tipo de cambio")
+	}
+	if !catalogos.Existe(catalogos.Moneda, moneda) {
+		return nil, fmt.Errorf("moneda inválida: %s", moneda)
+	}
+
+	dia := time.Date(fecha.Year(), fecha.Month(), fecha.Day(), 0, 0, 0, 0, time.UTC)
+	return s.store.Buscar(moneda, dia.AddDate(0, 0, -diasRetrocesoTipoCambio), dia)
+}
+
+// Convertir convierte un importe entre dos monedas con el tipo de cambio de la
+// fecha. Entre dos monedas extranjeras la conversión pasa por soles.
+func (s *TipoCambioService) Convertir(valor float64, de, a string, fecha time.Time, operacion string) (*Conversion, error) {
+	if operacion == "" {
+		operacion = OperacionVenta
+	}
+	if operacion != OperacionCompra && operacion != OperacionVenta {
+		return nil, fmt.Errorf("operación inválida: %s (use compra o venta)", operacion)
+	}
+
+	conversion := &Conversion{
+		Valor:       valor,
+		De:          strings.ToUpper(strings.TrimSpace(de)),
+		A:           strings.ToUpper(strings.TrimSpace(a)),
+		Fecha:       fecha,
+		Operacion:   operacion,
+		TiposCambio: []*models.TipoCambio{},
+	}
+
+	// enSoles retorna cuántos soles vale una unidad de la moneda
+	enSoles := func(moneda string) (float64, error) {
+		if moneda == "PEN" {
+			return 1, nil
+		}
+		tipoCambio, err := s.Consultar(moneda, fecha)
+		if err != nil {
+			return 0, err
+		}
+		conversion.TiposCambio = append(conversion.TiposCambio, tipoCambio)
+		if operacion == OperacionCompra {
+			return tipoCambio.Compra, nil
+		}
+		return tipoCambio.Venta, nil
+	}
+
+	origen, err := enSoles(conversion.De)
+	if err != nil {
+		return nil, err
+	}
+	destino, err := enSoles(conversion.A)
+	if err != nil {
+		return nil, err
+	}
+
+	conversion.Tasa = math.Round(origen/destino*1e6) / 1e6
+	conversion.Resultado = redondear(valor * origen / destino)
+	return conversion, nil
+}
+
+// ImportarCSV carga los tipos de cambio de un archivo exportado de la SBS o de
+// SUNAT. Las columnas se reconocen por su cabecera (fecha, moneda, compra y
+// venta); sin cabecera se asume fecha, compra y venta de la moneda por defecto.
+// El separador puede ser coma, punto y coma, barra vertical o tabulador.
+func (s *TipoCambioService) ImportarCSV(r io.Reader, fuente, monedaDefecto string) (*ImportacionTipoCambio, error) {
+	if fuente != models.FuenteTipoCambioSBS && fuente != models.FuenteTipoCambioSUNAT {
+		return nil, fmt.Errorf("fuente de tipo de cambio inválida: %s", fuente)
+	}
+
+	contenido, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo el archivo de tipos de cambio: %v", err)
+	}
+	texto := decodificarLatin1(contenido)
+	separador := detectarSeparador(texto)
+
+	lector := csv.NewReader(strings.NewReader(texto))
+	lector.Comma = separador
+	lector.FieldsPerRecord = -1
+	lector.LazyQuotes = true
+	lector.TrimLeadingSpace = true
+
+	columnas := map[string]int{"fecha": 0, "compra": 1, "venta": 2}
+	importacion := &ImportacionTipoCambio{}
+	lote := make([]models.TipoCambio, 0, tamanoLoteTipoCambio)
+	posiciones := make(map[string]int, tamanoLoteTipoCambio)
+	guardar := func() error {
+		guardados, err := s.store.GuardarLote(lote)
+		if err != nil {
+			return err
+		}
+		importacion.Guardados += guardados
+		lote = lote[:0]
+		for clave := range posiciones {
+			delete(posiciones, clave)
+		}
+		return nil
+	}
+
+	for linea := 0; ; linea++ {
+		registro, err := lector.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error leyendo la línea %d: %v", linea+1, err)
+		}
+		if vacio(registro) {
+			continue
+		}
+		if cabecera, ok := columnasTipoCambio(registro); ok {
+			columnas = cabecera
+			continue
+		}
+
+		importacion.Leidos++
+		tipoCambio, ok := parsearTipoCambio(registro, columnas, separador, monedaDefecto)
+		if !ok {
+			importacion.Rechazados++
+			continue
+		}
+		tipoCambio.Fuente = fuente
+
+		clave := tipoCambio.Moneda + tipoCambio.Fecha.Format("20060102")
+		if i, repetido := posiciones[clave]; repetido {
+			lote[i] = tipoCambio
+			continue
+		}
+		posiciones[clave] = len(lote)
+		lote = append(lote, tipoCambio)
+
+		if len(lote) == tamanoLoteTipoCambio {
+			if err := guardar(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := guardar(); err != nil {
+		return nil, err
+	}
+	return importacion, nil
+}
+
+// detectarSeparador elige el separador más frecuente de las primeras líneas;
+// algunos archivos empiezan con un título sin separadores
+func detectarSeparador(texto string) rune {
+	lineas := strings.SplitN(texto, "\n", 6)
+	if len(lineas) > 5 {
+		lineas = lineas[:5]
+	}
+	inicio := strings.Join(lineas, "\n")
+
+	separador, maximo := ',', 0
+	for _, candidato := range []rune{';', '|', '\t', ','} {
+		if n := strings.Count(inicio, string(candidato)); n > maximo {
+			separador, maximo = candidato, n
+		}
+	}
+	return separador
+}
+
+// columnasTipoCambio reconoce una fila de cabecera y retorna la posición de cada columna
+func columnasTipoCambio(registro []string) (map[string]int, bool) {
+	columnas := make(map[string]int)
+	for i, celda := range registro {
+		nombre := normalizarCabecera(celda)
+		switch {
+		case nombre == "fecha" || nombre == "dia" || strings.HasPrefix(nombre, "fecha "):
+			columnas["fecha"] = i
+		case strings.HasPrefix(nombre, "moneda") || nombre == "divisa":
+			columnas["moneda"] = i
+		case strings.HasPrefix(nombre, "compra"):
+			columnas["compra"] = i
+		case strings.HasPrefix(nombre, "venta"):
+			columnas["venta"] = i
+		}
+	}
+	_, fecha := columnas["fecha"]
+	_, compra := columnas["compra"]
+	_, venta := columnas["venta"]
+	return columnas, fecha && (compra || venta)
+}
+
+// parsearTipoCambio convierte una fila en una cotización. Si solo se publicó
+// la compra o la venta, se usa el mismo valor para ambas.
+func parsearTipoCambio(registro []string, columnas map[string]int, separador rune, monedaDefecto string) (models.TipoCambio, bool) {
+	celda := func(columna string) string {
+		i, ok := columnas[columna]
+		if !ok || i >= len(registro) {
+			return ""
+		}
+		return strings.TrimSpace(registro[i])
+	}
+
+	fecha, ok := parsearFechaTipoCambio(celda("fecha"))
+	if !ok {
+		return models.TipoCambio{}, false
+	}
+	moneda := strings.ToUpper(monedaDefecto)
+	if _, ok := columnas["moneda"]; ok {
+		if moneda, ok = codigoMoneda(celda("moneda")); !ok {
+			return models.TipoCambio{}, false
+		}
+	}
+
+	compra := parsearCotizacion(celda("compra"), separador)
+	venta := parsearCotizacion(celda("venta"), separador)
+	if compra <= 0 {
+		compra = venta
+	}
+	if venta <= 0 {
+		venta = compra
+	}
+	if venta <= 0 || moneda == "PEN" {
+		return models.TipoCambio{}, false
+	}
+
+	return models.TipoCambio{
+		Moneda: moneda,
+		Fecha:  fecha,
+		Compra: compra,
+		Venta:  venta,
+	}, true
+}
+
+// parsearFechaTipoCambio admite los formatos de fecha de la SBS y de SUNAT
+func parsearFechaTipoCambio(valor string) (time.Time, bool) {
+	for _, formato := range []string{"02/01/2006", "2006-01-02", "02-01-2006", "2/1/2006"} {
+		if fecha, err := time.Parse(formato, valor); err == nil {
+			return fecha, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parsearCotizacion lee un importe; con separadores distintos de la coma se
+// admite la coma decimal
+func parsearCotizacion(valor string, separador rune) float64 {
+	if separador != ',' {
+		valor = strings.ReplaceAll(valor, ",", ".")
+	}
+	cotizacion, err := strconv.ParseFloat(valor, 64)
+	if err != nil {
+		return 0
+	}
+	return cotizacion
+}
+
+// codigoMoneda acepta el código ISO de la moneda o el nombre publicado por la SBS
+func codigoMoneda(valor string) (string, bool) {
+	codigo := strings.ToUpper(valor)
+	if catalogos.Existe(catalogos.Moneda, codigo) {
+		return codigo, true
+	}
+	nombre := normalizarCabecera(valor)
+	for _, moneda := range monedasSBS {
+		if strings.Contains(nombre, moneda.nombre) {
+			return moneda.codigo, true
+		}
+	}
+	return "", false
+}
+
+var sinTildesCabecera = strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ñ", "n")
+
+func normalizarCabecera(valor string) string {
+	return sinTildesCabecera.Replace(strings.ToLower(strings.Trim(strings.TrimSpace(valor), "\"\ufeff")))
+}
+
+func vacio(registro []string) bool {
+	for _, celda := range registro {
+		if strings.TrimSpace(celda) != "" {
+			return false
+		}
+	}
+	return true
+}
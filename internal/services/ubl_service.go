@@ -47,7 +47,7 @@ func (s *UBLService) validateInvoice(invoice *models.UBLInvoice) error {
 		return fmt.Errorf("fecha de emisión es requerida")
 	}
 
-	if invoice.InvoiceTypeCode == "" {
+	if invoice.InvoiceTypeCode == nil || invoice.InvoiceTypeCode.Value == "" {
 		return fmt.Errorf("tipo de comprobante es requerido")
 	}
 
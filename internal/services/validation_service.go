@@ -0,0 +1,791 @@
+package services
+
+import (
+	"facturacion_sunat_api_go/internal/models"
+	"facturacion_sunat_api_go/pkg/catalogos"
+	"facturacion_sunat_api_go/pkg/identidad"
+	"facturacion_sunat_api_go/pkg/xsd"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Severidad de una regla de validación SUNAT: los errores provocan el rechazo
+// del comprobante y las observaciones se aceptan con reparos en el CDR
+type Severidad string
+
+const (
+	SeveridadError       Severidad = "ERROR"
+	SeveridadObservacion Severidad = "OBSERVACION"
+)
+
+// CodigoEsquemaXSD identifica los hallazgos de la validación contra los esquemas
+// UBL 2.1; SUNAT rechaza estos documentos antes de aplicar sus reglas de negocio
+const CodigoEsquemaXSD = "XSD"
+
+// montoBoletaSinIdentificacion es el importe máximo de una boleta emitida sin
+// identificar al adquirente
+const montoBoletaSinIdentificacion = 700.0
+
+// toleranciaTotales es la diferencia máxima que SUNAT admite entre un total y la suma de sus componentes
+const toleranciaTotales = 1.0
+
+// maxNumeroItem es el mayor número de orden de ítem que admite el formato SUNAT (n..3)
+const maxNumeroItem = 999
+
+// Hallazgo es el incumplimiento de una regla de validación SUNAT
+type Hallazgo struct {
+	Codigo    string    `json:"codigo"`
+	Severidad Severidad `json:"severidad"`
+	Ruta      string    `json:"ruta"`
+	Mensaje   string    `json:"mensaje"`
+}
+
+// TieneErrores indica si alguno de los hallazgos provocaría el rechazo del comprobante
+func TieneErrores(hallazgos []Hallazgo) bool {
+	for _, hallazgo := range hallazgos {
+		if hallazgo.Severidad == SeveridadError {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	formatoNumero       = regexp.MustCompile(`^[0-9]{1,8}$`)
+	formatoSerie        = regexp.MustCompile(`^[FBEL][A-Z0-9]{3}$`)
+	formatoContingencia = regexp.MustCompile(`^[0-9]{4}$`)
+	formatoIDDocumento  = regexp.MustCompile(`^([A-Z0-9]{4})-([0-9]{1,8})$`)
+)
+
+// categoriasTributo relaciona cada tributo del catálogo 05 con su categoría UN/ECE 5305
+var categoriasTributo = map[string]string{
+	models.SUNATConstants.IGVCode:  "S",
+	models.SUNATConstants.IVAPCode: "S",
+	models.SUNATConstants.EXPCode:  "G",
+	models.SUNATConstants.GRACode:  "Z",
+	"9997":                         "E",
+	"9998":                         "O",
+}
+
+// ValidationService ejecuta sin conexión las reglas de validación publicadas
+// por SUNAT sobre el comprobante de negocio y sobre el UBL generado
+type ValidationService struct {
+	ahora func() time.Time
+}
+
+func NewValidationService() *ValidationService {
+	return &ValidationService{
+		ahora: time.Now,
+	}
+}
+
+// validador acumula los hallazgos de una ejecución de reglas
+type validador struct {
+	hallazgos []Hallazgo
+}
+
+func (v *validador) agregar(codigo string, severidad Severidad, ruta, formato string, args ...interface{}) {
+	v.hallazgos = append(v.hallazgos, Hallazgo{
+		Codigo:    codigo,
+		Severidad: severidad,
+		Ruta:      ruta,
+		Mensaje:   fmt.Sprintf(formato, args...),
+	})
+}
+
+// ValidarComprobante aplica las reglas SUNAT al comprobante de negocio
+func (s *ValidationService) ValidarComprobante(comprobante *models.Comprobante) []Hallazgo {
+	v := &validador{}
+	tipo := comprobante.Tipo.String()
+
+	// Emisor
+	if err := identidad.ValidarRUC(comprobante.Emisor.RUC); err != nil {
+		v.agregar("1034", SeveridadError, "emisor.ruc", "El RUC del emisor %q no es válido: %v", comprobante.Emisor.RUC, err)
+	}
+
+	// Serie y número
+	s.validarSerieNumero(v, tipo, comprobante.Serie, comprobante.Numero, "serie")
+
+	// Receptor
+	s.validarReceptor(v, comprobante.Tipo, comprobante.TipoOperacion, comprobante.Receptor.TipoDocumento, comprobante.Receptor.NumeroDocumento, "receptor")
+
+	// Las boletas por más de S/ 700 deben identificar al adquirente
+	if comprobante.Tipo == models.TipoBoleta && comprobante.TipoMoneda == "PEN" &&
+		identidad.EsAnonimo(comprobante.Receptor.TipoDocumento, comprobante.Receptor.NumeroDocumento) &&
+		comprobante.Totales.ImporteTotal > montoBoletaSinIdentificacion {
+		v.agregar("2014", SeveridadError, "receptor", "Una boleta por más de S/ %.2f debe identificar al adquirente", montoBoletaSinIdentificacion)
+	}
+
+	// Ubigeos de las direcciones
+	s.validarUbigeos(v, comprobante)
+
+	// Fecha de emisión
+	s.validarFechaEmision(v, comprobante.Tipo, models.HoraPeru(comprobante.FechaEmision), "fecha_emision")
+
+	// Moneda
+	if !catalogos.Existe(catalogos.Moneda, comprobante.TipoMoneda) {
+		v.agregar("3088", SeveridadError, "tipo_moneda", "La moneda %q no existe en el catálogo 02", comprobante.TipoMoneda)
+	}
+
+	// Tipo de operación
+	if err := models.ValidarTipoOperacion(comprobante); err != nil {
+		v.agregar("3206", SeveridadError, "tipo_operacion", "El tipo de operación no es válido: %v", err)
+	}
+
+	// Guías de remisión en formato serie-número
+	for i, guia := range comprobante.Guias {
+		if !formatoIDDocumento.MatchString(guia.Numero) {
+			v.agregar("4006", SeveridadObservacion, fmt.Sprintf("guias[%d].numero", i),
+				"La guía de remisión %q debe informarse como serie-número", guia.Numero)
+		}
+	}
+
+	// Unidades de medida y códigos de producto de cada ítem
+	s.validarItems(v, comprobante)
+
+	// Afectación y tributos de cada ítem
+	numeros := make(map[int]bool)
+	for i, item := range comprobante.Items {
+		ruta := fmt.Sprintf("items[%d]", i)
+		if item.NumeroItem < 1 || item.NumeroItem > maxNumeroItem {
+			v.agregar("2023", SeveridadError, ruta+".numero_item", "El número de orden del ítem %d debe estar entre 1 y %d", item.NumeroItem, maxNumeroItem)
+		} else if numeros[item.NumeroItem] {
+			v.agregar("2752", SeveridadError, ruta+".numero_item", "El número de orden del ítem %d se repite en el comprobante", item.NumeroItem)
+		}
+		numeros[item.NumeroItem] = true
+
+		if item.Cantidad <= 0 {
+			v.agregar("2024", SeveridadError, ruta+".cantidad", "La cantidad del ítem debe ser mayor a cero")
+		}
+		if strings.TrimSpace(item.Descripcion) == "" {
+			v.agregar("2026", SeveridadError, ruta+".descripcion", "El ítem no tiene descripción")
+		}
+
+		afectacion := item.TipoAfectacion.String()
+		if afectacion != fmt.Sprint(int(item.TipoAfectacion)) {
+			v.agregar("2371", SeveridadError, ruta+".tipo_afectacion", "El tipo de afectación %d no existe en el catálogo 07", item.TipoAfectacion)
+			continue
+		}
+
+		// Las operaciones gratuitas se informan con su valor referencial
+		if item.TipoAfectacion.EsGratuita() && item.ValorUnitario <= 0 {
+			v.agregar("2640", SeveridadError, ruta+".valor_unitario", "Una operación gratuita debe informar un valor referencial mayor a cero")
+		}
+
+		tributo := item.TipoAfectacion.Tributo()
+		for j, impuesto := range item.ImpuestoItem {
+			if _, ok := categoriasTributo[impuesto.TipoImpuesto]; ok && impuesto.TipoImpuesto != tributo {
+				v.agregar("3105", SeveridadError, fmt.Sprintf("%s.impuesto_item[%d].tipo_impuesto", ruta, j),
+					"El tributo %s no corresponde a la afectación %s (se esperaba %s)", impuesto.TipoImpuesto, afectacion, tributo)
+			}
+		}
+	}
+
+	return v.hallazgos
+}
+
+// ImportesDeclarados conserva los importes que informó el cliente, antes de que
+// CalculateTotals los reemplace por los recalculados
+type ImportesDeclarados struct {
+	totales models.Totales
+	items   []importesItem
+}
+
+type importesItem struct {
+	valorVenta float64
+	igv        float64
+}
+
+// DeclararImportes toma los importes del comprobante tal como llegaron; debe
+// llamarse antes de CalculateTotals
+func DeclararImportes(comprobante *models.Comprobante) ImportesDeclarados {
+	declarados := ImportesDeclarados{
+		totales: comprobante.Totales,
+		items:   make([]importesItem, len(comprobante.Items)),
+	}
+	for i, item := range comprobante.Items {
+		declarados.items[i] = importesItem{
+			valorVenta: item.ValorVenta,
+			igv:        montoTributo(item.ImpuestoItem, models.SUNATConstants.IGVCode),
+		}
+	}
+	return declarados
+}
+
+// montoTributo suma el monto de un tributo del catálogo 05 en los impuestos de un ítem
+func montoTributo(impuestos []models.ImpuestoItem, tributo string) float64 {
+	var monto float64
+	for _, impuesto := range impuestos {
+		if impuesto.TipoImpuesto == tributo {
+			monto += impuesto.MontoImpuesto
+		}
+	}
+	return monto
+}
+
+// ValidarImportesDeclarados contrasta los importes que informó el cliente con
+// los recalculados por CalculateTotals. Solo se contrastan los importes que
+// llegaron informados: quien deja el cálculo a la API no los envía.
+func (s *ValidationService) ValidarImportesDeclarados(declarados ImportesDeclarados, comprobante *models.Comprobante) []Hallazgo {
+	v := &validador{}
+
+	for i, item := range declarados.items {
+		if i >= len(comprobante.Items) {
+			break
+		}
+		ruta := fmt.Sprintf("items[%d]", i)
+		calculado := comprobante.Items[i]
+		if item.valorVenta != 0 && math.Abs(item.valorVenta-calculado.ValorVenta) > toleranciaTotales {
+			v.agregar("4288", SeveridadObservacion, ruta+".valor_venta",
+				"El valor de venta del ítem %.2f no coincide con el calculado %.2f", item.valorVenta, calculado.ValorVenta)
+		}
+		igv := montoTributo(calculado.ImpuestoItem, models.SUNATConstants.IGVCode)
+		if item.igv != 0 && math.Abs(item.igv-igv) > toleranciaTotales {
+			v.agregar("4290", SeveridadObservacion, ruta+".impuesto_item",
+				"El IGV del ítem %.2f no coincide con el calculado %.2f", item.igv, igv)
+		}
+	}
+
+	declarado, calculado := declarados.totales, comprobante.Totales
+	if declarado == (models.Totales{}) {
+		return v.hallazgos
+	}
+	totales := []struct {
+		codigo    string
+		campo     string
+		nombre    string
+		declarado float64
+		calculado float64
+	}{
+		{"4307", "total_descuentos", "total de descuentos", declarado.TotalDescuentos, calculado.TotalDescuentos},
+		{"4308", "total_cargos", "total de cargos", declarado.TotalCargos, calculado.TotalCargos},
+		{"4309", "total_valor_venta", "total valor de venta", declarado.TotalValorVenta, calculado.TotalValorVenta},
+		{"4301", "total_impuestos", "total de impuestos", declarado.TotalImpuestos, calculado.TotalImpuestos},
+		{"4310", "total_precio_venta", "total precio de venta", declarado.TotalPrecioVenta, calculado.TotalPrecioVenta},
+		{"4312", "importe_total", "importe total", declarado.ImporteTotal, calculado.ImporteTotal},
+	}
+	for _, total := range totales {
+		if math.Abs(total.declarado-total.calculado) > toleranciaTotales {
+			v.agregar(total.codigo, SeveridadObservacion, "totales."+total.campo,
+				"El %s %.2f no coincide con el calculado %.2f", total.nombre, total.declarado, total.calculado)
+		}
+	}
+
+	return v.hallazgos
+}
+
+// documentoUBL reúne los elementos comunes de facturas, boletas y notas para validarlos
+type documentoUBL struct {
+	raiz            string
+	tipo            string
+	id              string
+	issueDate       string
+	operacion       string
+	emisor          *models.Party
+	receptor        *models.Party
+	taxTotal        []models.TaxTotal
+	monetario       *models.LegalMonetaryTotal
+	monetarioNombre string
+	lineaNombre     string
+	lineas          []lineaUBL
+	notas           []models.Note
+}
+
+type lineaUBL struct {
+	lineExtension *models.Amount
+	taxTotal      []models.TaxTotal
+}
+
+// ValidarEsquema valida el XML serializado contra los esquemas UBL 2.1 y las
+// extensiones SUNAT incluidos en el binario: orden de los elementos,
+// cardinalidad y tipos de datos. Debe ejecutarse antes de firmar. Si el binario
+// se compiló sin los esquemas oficiales retorna un error: ningún comprobante se
+// firma sin haberse validado contra el XSD.
+func (s *ValidationService) ValidarEsquema(xmlData []byte) ([]Hallazgo, error) {
+	esquema, err := xsd.UBL21()
+	if err != nil {
+		return nil, fmt.Errorf("error cargando esquemas UBL 2.1: %w", err)
+	}
+
+	var hallazgos []Hallazgo
+	for _, e := range esquema.ValidarSinFirmar(xmlData) {
+		hallazgos = append(hallazgos, Hallazgo{
+			Codigo:    CodigoEsquemaXSD,
+			Severidad: SeveridadError,
+			Ruta:      e.Ruta,
+			Mensaje:   e.Mensaje,
+		})
+	}
+	return hallazgos, nil
+}
+
+// ValidarUBL aplica las reglas SUNAT al documento UBL generado
+func (s *ValidationService) ValidarUBL(ublDocument interface{}) []Hallazgo {
+	v := &validador{}
+
+	doc, err := normalizarDocumentoUBL(ublDocument)
+	if err != nil {
+		v.agregar("0306", SeveridadError, "/", "%v", err)
+		return v.hallazgos
+	}
+	raiz := "/" + doc.raiz
+
+	// Serie y número
+	partes := formatoIDDocumento.FindStringSubmatch(doc.id)
+	if partes == nil {
+		v.agregar("1001", SeveridadError, raiz+"/cbc:ID", "El dato SERIE-CORRELATIVO %q no cumple con el formato", doc.id)
+	} else {
+		s.validarSerieNumero(v, doc.tipo, partes[1], partes[2], raiz+"/cbc:ID")
+	}
+
+	// Fecha de emisión
+	fecha, err := time.Parse("2006-01-02", doc.issueDate)
+	if err != nil {
+		v.agregar("2329", SeveridadError, raiz+"/cbc:IssueDate", "La fecha de emisión %q no tiene el formato AAAA-MM-DD", doc.issueDate)
+	} else {
+		s.validarFechaEmision(v, tipoComprobantePorCodigo(doc.tipo), fecha, raiz+"/cbc:IssueDate")
+	}
+
+	// Emisor y receptor
+	if id := identificacionParte(doc.emisor); id == nil || id.SchemeID != "6" || identidad.ValidarRUC(id.Value) != nil {
+		v.agregar("1034", SeveridadError, raiz+"/cac:AccountingSupplierParty/cac:Party/cac:PartyIdentification/cbc:ID",
+			"El emisor debe identificarse con un RUC válido")
+	}
+	if id := identificacionParte(doc.receptor); id == nil {
+		v.agregar("2800", SeveridadError, raiz+"/cac:AccountingCustomerParty", "No existe información del receptor")
+	} else {
+		s.validarReceptor(v, tipoComprobantePorCodigo(doc.tipo), doc.operacion, id.SchemeID, id.Value,
+			raiz+"/cac:AccountingCustomerParty/cac:Party/cac:PartyIdentification/cbc:ID")
+	}
+
+	// Leyendas: códigos del catálogo 52 sin repetir
+	leyendas := make(map[string]bool)
+	for i, nota := range doc.notas {
+		codigo := nota.LanguageLocaleID
+		if codigo == "" {
+			continue
+		}
+		ruta := fmt.Sprintf("%s/cbc:Note[%d]", raiz, i+1)
+		if !catalogos.Existe(catalogos.Leyenda, codigo) {
+			v.agregar("3027", SeveridadError, ruta, "El código de leyenda %s no existe en el catálogo 52", codigo)
+		}
+		if leyendas[codigo] {
+			v.agregar("3014", SeveridadError, ruta, "La leyenda %s se repite en el comprobante", codigo)
+		}
+		leyendas[codigo] = true
+	}
+
+	// Categorías de impuestos de las líneas y suma de valores de venta
+	var sumaLineas float64
+	for i, linea := range doc.lineas {
+		rutaLinea := fmt.Sprintf("%s/%s[%d]", raiz, doc.lineaNombre, i+1)
+		gratuita := false
+		for _, taxTotal := range linea.taxTotal {
+			for j, subtotal := range taxTotal.TaxSubtotal {
+				ruta := fmt.Sprintf("%s/cac:TaxTotal/cac:TaxSubtotal[%d]/cac:TaxCategory", rutaLinea, j+1)
+				tributo := s.validarCategoria(v, subtotal, ruta, true)
+				if tributo == models.SUNATConstants.GRACode {
+					gratuita = true
+				}
+			}
+		}
+		if linea.lineExtension != nil && !gratuita {
+			sumaLineas += linea.lineExtension.Value
+		}
+	}
+
+	// Totales del comprobante
+	var sumaTributos, taxAmount float64
+	for _, taxTotal := range doc.taxTotal {
+		if taxTotal.TaxAmount != nil {
+			taxAmount += taxTotal.TaxAmount.Value
+		}
+		for j, subtotal := range taxTotal.TaxSubtotal {
+			ruta := fmt.Sprintf("%s/cac:TaxTotal/cac:TaxSubtotal[%d]/cac:TaxCategory", raiz, j+1)
+			tributo := s.validarCategoria(v, subtotal, ruta, false)
+			if tributo != models.SUNATConstants.GRACode && subtotal.TaxAmount != nil {
+				sumaTributos += subtotal.TaxAmount.Value
+			}
+		}
+	}
+	if math.Abs(sumaTributos-taxAmount) > toleranciaTotales {
+		v.agregar("4301", SeveridadObservacion, raiz+"/cac:TaxTotal/cbc:TaxAmount",
+			"El monto total de impuestos %.2f no coincide con la suma de los subtotales %.2f", taxAmount, sumaTributos)
+	}
+
+	monetario := doc.monetario
+	if monetario == nil || monetario.PayableAmount == nil {
+		v.agregar("2062", SeveridadError, raiz+"/"+doc.monetarioNombre+"/cbc:PayableAmount", "No existe el importe total del comprobante")
+		return v.hallazgos
+	}
+	if monetario.LineExtensionAmount != nil && math.Abs(sumaLineas-monetario.LineExtensionAmount.Value) > toleranciaTotales {
+		v.agregar("4309", SeveridadObservacion, raiz+"/"+doc.monetarioNombre+"/cbc:LineExtensionAmount",
+			"El total valor de venta %.2f no coincide con la suma de las líneas %.2f", monetario.LineExtensionAmount.Value, sumaLineas)
+	}
+	if monetario.TaxInclusiveAmount != nil {
+		esperado := monetario.TaxInclusiveAmount.Value - montoUBL(monetario.AllowanceTotalAmount) +
+			montoUBL(monetario.ChargeTotalAmount) - montoUBL(monetario.PrepaidAmount)
+		if math.Abs(esperado-monetario.PayableAmount.Value) > toleranciaTotales {
+			v.agregar("4312", SeveridadObservacion, raiz+"/"+doc.monetarioNombre+"/cbc:PayableAmount",
+				"El importe total %.2f no coincide con el calculado %.2f", monetario.PayableAmount.Value, esperado)
+		}
+	}
+
+	return v.hallazgos
+}
+
+// validarSerieNumero verifica el formato de la serie y que su prefijo corresponda al tipo de comprobante
+func (s *ValidationService) validarSerieNumero(v *validador, tipo, serie, numero, ruta string) {
+	if !formatoNumero.MatchString(numero) {
+		v.agregar("1001", SeveridadError, ruta, "El correlativo %q debe tener entre 1 y 8 dígitos", numero)
+	}
+	if formatoContingencia.MatchString(serie) {
+		return
+	}
+	if !formatoSerie.MatchString(serie) {
+		v.agregar("1001", SeveridadError, ruta, "La serie %q no cumple con el formato", serie)
+		return
+	}
+
+	switch tipo {
+	case "01":
+		if serie[0] != 'F' {
+			v.agregar("1001", SeveridadError, ruta, "La serie de una factura debe empezar con F")
+		}
+	case "03":
+		if serie[0] != 'B' {
+			v.agregar("1001", SeveridadError, ruta, "La serie de una boleta debe empezar con B")
+		}
+	case "04":
+		// E para las emitidas desde SEE-SOL, L para las del emisor electrónico
+		if serie[0] != 'E' && serie[0] != 'L' {
+			v.agregar("1001", SeveridadError, ruta, "La serie de una liquidación de compra debe empezar con E o L")
+		}
+	}
+}
+
+// validarUbigeos verifica que los ubigeos del emisor, del receptor domiciliado y
+// del lugar de entrega existan en el catálogo 13 y coincidan con los nombres informados
+func (s *ValidationService) validarUbigeos(v *validador, comprobante *models.Comprobante) {
+	emisor := comprobante.Emisor
+	if _, err := catalogos.ResolverUbigeo(emisor.CodigoUbigeo(), emisor.Departamento, emisor.Provincia, emisor.Distrito); err != nil {
+		v.agregar("4093", SeveridadObservacion, "emisor.ubigeo", "El ubigeo del domicilio fiscal del emisor no es válido: %v", err)
+	}
+
+	receptor := comprobante.Receptor
+	switch {
+	case !receptor.DomiciliadoEnPeru() && receptor.Ubigeo != "":
+		v.agregar("4093", SeveridadObservacion, "receptor.ubigeo", "Un receptor con dirección en %s no se informa con ubigeo", receptor.CodigoPais)
+	case receptor.DomiciliadoEnPeru() && (receptor.Ubigeo != "" || receptor.Distrito != ""):
+		if _, err := catalogos.ResolverUbigeo(receptor.Ubigeo, receptor.Departamento, receptor.Provincia, receptor.Distrito); err != nil {
+			v.agregar("4093", SeveridadObservacion, "receptor.ubigeo", "El ubigeo de la dirección del receptor no es válido: %v", err)
+		}
+	}
+
+	if entrega := comprobante.CondicionesEntrega; entrega != nil && entrega.Ubigeo != "" {
+		if entrega.CodigoPais != "" && entrega.CodigoPais != "PE" {
+			v.agregar("4093", SeveridadObservacion, "condiciones_entrega.ubigeo", "Un lugar de entrega en %s no se informa con ubigeo", entrega.CodigoPais)
+		} else if _, err := catalogos.BuscarUbigeo(entrega.Ubigeo); err != nil {
+			v.agregar("4093", SeveridadObservacion, "condiciones_entrega.ubigeo", "El ubigeo del lugar de entrega no es válido: %v", err)
+		}
+	}
+}
+
+// ValidarItems valida las unidades de medida (catálogo 03) y los códigos de
+// producto SUNAT (catálogo 25) de las líneas del comprobante
+func (s *ValidationService) ValidarItems(comprobante *models.Comprobante) []Hallazgo {
+	v := &validador{}
+	s.validarItems(v, comprobante)
+	return v.hallazgos
+}
+
+func (s *ValidationService) validarItems(v *validador, comprobante *models.Comprobante) {
+	// El catálogo 51 indica los tipos de operación que exigen el código de producto
+	productoObligatorio := catalogos.Atributo(catalogos.TipoOperacion, comprobante.TipoOperacion, "producto_sunat") == "obligatorio"
+
+	for i, item := range comprobante.Items {
+		ruta := fmt.Sprintf("items[%d]", i)
+		if !catalogos.Existe(catalogos.UnidadMedida, item.UnidadMedida) {
+			v.agregar("2883", SeveridadError, ruta+".unidad_medida", "La unidad de medida %q no existe en el catálogo 03", item.UnidadMedida)
+		}
+
+		switch {
+		case item.CodigoSUNAT != "" && !catalogos.Existe(catalogos.ProductoSUNAT, item.CodigoSUNAT):
+			// Con la selección embebida un código no enumerado puede existir en la lista oficial
+			if catalogos.ProductosCompletos() {
+				v.agregar("3002", SeveridadError, ruta+".codigo_sunat", "El código de producto SUNAT %q no existe en el catálogo 25", item.CodigoSUNAT)
+			} else {
+				v.agregar("3002", SeveridadObservacion, ruta+".codigo_sunat",
+					"El código de producto SUNAT %q no figura en la selección embebida del catálogo 25; no se cargó la lista oficial", item.CodigoSUNAT)
+			}
+		case item.CodigoSUNAT == "" && productoObligatorio:
+			v.agregar("4331", SeveridadObservacion, ruta+".codigo_sunat",
+				"El tipo de operación %s requiere informar el código de producto SUNAT", comprobante.TipoOperacion)
+		}
+	}
+}
+
+// ValidarFormaPago valida la forma de pago, las cuotas y el medio de pago
+// (catálogo 59). Se ejecuta con los totales, la retención y la detracción ya
+// calculados porque las cuotas deben sumar el monto neto pendiente de pago.
+func (s *ValidationService) ValidarFormaPago(comprobante *models.Comprobante) []Hallazgo {
+	v := &validador{}
+	s.validarFormaPago(v, comprobante)
+	return v.hallazgos
+}
+
+func (s *ValidationService) validarFormaPago(v *validador, comprobante *models.Comprobante) {
+	emision := truncarDia(models.HoraPeru(comprobante.FechaEmision))
+	if comprobante.FechaVencimiento != nil && truncarDia(*comprobante.FechaVencimiento).Before(emision) {
+		v.agregar("3267", SeveridadError, "fecha_vencimiento", "La fecha de vencimiento %s es anterior a la fecha de emisión",
+			comprobante.FechaVencimiento.Format("2006-01-02"))
+	}
+
+	formaPago := comprobante.FormaPago
+	if formaPago == nil {
+		if comprobante.Tipo == models.TipoFactura {
+			v.agregar("3244", SeveridadError, "forma_pago", "La factura debe informar la forma de pago")
+		}
+		return
+	}
+
+	if formaPago.MedioPago != "" && !catalogos.Existe(catalogos.MedioPago, formaPago.MedioPago) {
+		v.agregar("3248", SeveridadError, "forma_pago.medio_pago", "El medio de pago %q no existe en el catálogo 59", formaPago.MedioPago)
+	}
+
+	switch models.NormalizarTipoPago(formaPago.TipoPago) {
+	case models.FormaPagoContado:
+		if len(formaPago.Cuotas) > 0 {
+			v.agregar("3250", SeveridadError, "forma_pago.cuotas", "Una venta al contado no debe informar cuotas")
+		}
+	case models.FormaPagoCredito:
+		if comprobante.Tipo == models.TipoBoleta {
+			v.agregar("3244", SeveridadError, "forma_pago.tipo_pago", "Las boletas de venta no admiten la forma de pago al crédito")
+			return
+		}
+		if len(formaPago.Cuotas) == 0 {
+			v.agregar("3249", SeveridadError, "forma_pago.cuotas", "Una venta al crédito debe informar al menos una cuota")
+			return
+		}
+
+		var suma float64
+		var ultimoVencimiento time.Time
+		for i, cuota := range formaPago.Cuotas {
+			ruta := fmt.Sprintf("forma_pago.cuotas[%d]", i)
+			if cuota.Monto <= 0 {
+				v.agregar("3251", SeveridadError, ruta+".monto", "El monto de la cuota debe ser mayor a cero")
+			}
+			vencimiento := truncarDia(cuota.FechaVencimiento)
+			if !vencimiento.After(emision) {
+				v.agregar("3266", SeveridadError, ruta+".fecha_vencimiento",
+					"La fecha de vencimiento de la cuota %s debe ser posterior a la fecha de emisión", vencimiento.Format("2006-01-02"))
+			}
+			if vencimiento.After(ultimoVencimiento) {
+				ultimoVencimiento = vencimiento
+			}
+			suma += cuota.Monto
+		}
+
+		if pendiente := comprobante.MontoPendientePago(); math.Abs(redondear(suma)-pendiente) > 0.005 {
+			v.agregar("3265", SeveridadError, "forma_pago.cuotas",
+				"Las cuotas suman %.2f y deben sumar el monto neto pendiente de pago %.2f", suma, pendiente)
+		}
+		if comprobante.FechaVencimiento != nil && !truncarDia(*comprobante.FechaVencimiento).Equal(ultimoVencimiento) {
+			v.agregar("4321", SeveridadObservacion, "fecha_vencimiento",
+				"La fecha de vencimiento %s no coincide con el vencimiento de la última cuota %s",
+				comprobante.FechaVencimiento.Format("2006-01-02"), ultimoVencimiento.Format("2006-01-02"))
+		}
+	default:
+		v.agregar("3245", SeveridadError, "forma_pago.tipo_pago", "La forma de pago %q no es válida: use Contado o Credito", formaPago.TipoPago)
+	}
+}
+
+// ValidarReceptor valida el documento del receptor según el tipo de comprobante:
+// RUC en las facturas que no son exportaciones, DNI del vendedor en la
+// liquidación de compra y, en boletas y notas, cualquier documento del catálogo
+// 06, incluido el adquirente sin identificación ("-")
+func (s *ValidationService) ValidarReceptor(comprobante *models.Comprobante) []Hallazgo {
+	v := &validador{}
+	s.validarReceptor(v, comprobante.Tipo, comprobante.TipoOperacion, comprobante.Receptor.TipoDocumento, comprobante.Receptor.NumeroDocumento, "receptor")
+	return v.hallazgos
+}
+
+// validarReceptor verifica el tipo y número de documento del receptor según el tipo de comprobante
+func (s *ValidationService) validarReceptor(v *validador, tipo models.TipoComprobante, tipoOperacion, tipoDocumento, numero, ruta string) {
+	if !catalogos.Existe(catalogos.DocumentoIdentidad, tipoDocumento) {
+		v.agregar("2800", SeveridadError, ruta, "El tipo de documento de identidad %q no existe en el catálogo 06", tipoDocumento)
+		return
+	}
+	if tipo == models.TipoFactura && tipoDocumento != "6" && !models.EsOperacionExportacion(tipoOperacion) {
+		v.agregar("2800", SeveridadError, ruta, "El receptor de una factura debe identificarse con RUC")
+	}
+	if tipo == models.TipoLiquidacionCompra && tipoDocumento != identidad.DNI {
+		v.agregar("2800", SeveridadError, ruta, "El vendedor de una liquidación de compra debe identificarse con DNI")
+	}
+
+	if err := identidad.Validar(tipoDocumento, numero); err != nil {
+		codigo := "2801"
+		if tipoDocumento == identidad.RUC {
+			codigo = "2017"
+		}
+		v.agregar(codigo, SeveridadError, ruta, "El documento del receptor %q no es válido: %v", numero, err)
+	}
+}
+
+// ValidarFechaEmision valida la fecha de emisión del comprobante contra el día
+// actual en Lima (reglas 2329 y 2108)
+func (s *ValidationService) ValidarFechaEmision(comprobante *models.Comprobante) []Hallazgo {
+	v := &validador{}
+	s.validarFechaEmision(v, comprobante.Tipo, models.HoraPeru(comprobante.FechaEmision), "fecha_emision")
+	return v.hallazgos
+}
+
+// validarFechaEmision verifica que la fecha de emisión no sea futura ni exceda
+// el plazo de envío (3 días para facturas y notas, 7 días para boletas). La
+// fecha se compara con el día actual en Lima.
+func (s *ValidationService) validarFechaEmision(v *validador, tipo models.TipoComprobante, fecha time.Time, ruta string) {
+	hoy := truncarDia(models.HoraPeru(s.ahora()))
+	emision := truncarDia(fecha)
+
+	if emision.After(hoy) {
+		v.agregar("2329", SeveridadError, ruta, "La fecha de emisión %s es posterior a la fecha actual", emision.Format("2006-01-02"))
+		return
+	}
+
+	plazo := 3
+	if tipo == models.TipoBoleta {
+		plazo = 7
+	}
+	if emision.Before(hoy.AddDate(0, 0, -plazo)) {
+		v.agregar("2108", SeveridadError, ruta, "Presentación fuera de fecha: el plazo de envío es de %d días calendario", plazo)
+	}
+}
+
+// validarCategoria verifica que la categoría del subtotal corresponda a su tributo
+// y, en las líneas, que el código de afectación sea coherente con el tributo
+func (s *ValidationService) validarCategoria(v *validador, subtotal models.TaxSubtotal, ruta string, linea bool) string {
+	categoria := subtotal.TaxCategory
+	if categoria == nil || categoria.TaxScheme == nil || categoria.TaxScheme.ID == nil {
+		v.agregar("2036", SeveridadError, ruta, "No existe el código de tributo del subtotal")
+		return ""
+	}
+	tributo := categoria.TaxScheme.ID.Value
+
+	esperada, ok := categoriasTributo[tributo]
+	if ok && categoria.ID != esperada {
+		v.agregar("3105", SeveridadError, ruta+"/cbc:ID", "La categoría %s no corresponde al tributo %s (se esperaba %s)", categoria.ID, tributo, esperada)
+	}
+	if !linea || !ok {
+		return tributo
+	}
+
+	codigo := categoria.TaxExemptionReasonCode
+	var afectacion int
+	if _, err := fmt.Sscan(codigo, &afectacion); err != nil || models.TipoAfectacionIGV(afectacion).String() != codigo {
+		v.agregar("2371", SeveridadError, ruta+"/cbc:TaxExemptionReasonCode", "El tipo de afectación %q no existe en el catálogo 07", codigo)
+		return tributo
+	}
+	if models.TipoAfectacionIGV(afectacion).Tributo() != tributo {
+		v.agregar("3105", SeveridadError, ruta+"/cbc:TaxExemptionReasonCode", "La afectación %s no corresponde al tributo %s", codigo, tributo)
+	}
+	return tributo
+}
+
+// normalizarDocumentoUBL extrae los elementos validables de un documento UBL
+func normalizarDocumentoUBL(ublDocument interface{}) (*documentoUBL, error) {
+	switch doc := ublDocument.(type) {
+	case *models.UBLInvoice:
+		tipo, operacion := "", ""
+		if doc.InvoiceTypeCode != nil {
+			tipo, operacion = doc.InvoiceTypeCode.Value, doc.InvoiceTypeCode.ListID
+		}
+		documento := &documentoUBL{
+			raiz: "Invoice", tipo: tipo, operacion: operacion, id: doc.ID, issueDate: doc.IssueDate,
+			emisor: parteEmisor(doc.AccountingSupplierParty), receptor: parteReceptor(doc.AccountingCustomerParty),
+			taxTotal: doc.TaxTotal, monetario: doc.LegalMonetaryTotal, monetarioNombre: "cac:LegalMonetaryTotal", lineaNombre: "cac:InvoiceLine",
+			notas: doc.Note,
+		}
+		for _, linea := range doc.InvoiceLines {
+			documento.lineas = append(documento.lineas, lineaUBL{linea.LineExtensionAmount, linea.TaxTotal})
+		}
+		return documento, nil
+	case *models.UBLCreditNote:
+		documento := &documentoUBL{
+			raiz: "CreditNote", tipo: models.SUNATConstants.CreditNoteTypeCode, id: doc.ID, issueDate: doc.IssueDate,
+			emisor: parteEmisor(doc.AccountingSupplierParty), receptor: parteReceptor(doc.AccountingCustomerParty),
+			taxTotal: doc.TaxTotal, monetario: doc.LegalMonetaryTotal, monetarioNombre: "cac:LegalMonetaryTotal", lineaNombre: "cac:CreditNoteLine",
+			notas: doc.Note,
+		}
+		for _, linea := range doc.CreditNoteLines {
+			documento.lineas = append(documento.lineas, lineaUBL{linea.LineExtensionAmount, linea.TaxTotal})
+		}
+		return documento, nil
+	case *models.UBLDebitNote:
+		documento := &documentoUBL{
+			raiz: "DebitNote", tipo: models.SUNATConstants.DebitNoteTypeCode, id: doc.ID, issueDate: doc.IssueDate,
+			emisor: parteEmisor(doc.AccountingSupplierParty), receptor: parteReceptor(doc.AccountingCustomerParty),
+			taxTotal: doc.TaxTotal, monetario: doc.RequestedMonetaryTotal, monetarioNombre: "cac:RequestedMonetaryTotal", lineaNombre: "cac:DebitNoteLine",
+			notas: doc.Note,
+		}
+		for _, linea := range doc.DebitNoteLines {
+			documento.lineas = append(documento.lineas, lineaUBL{linea.LineExtensionAmount, linea.TaxTotal})
+		}
+		return documento, nil
+	default:
+		return nil, fmt.Errorf("tipo de documento UBL no soportado")
+	}
+}
+
+func parteEmisor(supplier *models.AccountingSupplierParty) *models.Party {
+	if supplier == nil {
+		return nil
+	}
+	return supplier.Party
+}
+
+func parteReceptor(customer *models.AccountingCustomerParty) *models.Party {
+	if customer == nil {
+		return nil
+	}
+	return customer.Party
+}
+
+// identificacionParte retorna el primer documento de identidad de una parte
+func identificacionParte(parte *models.Party) *models.ID {
+	if parte == nil || len(parte.PartyIdentification) == 0 {
+		return nil
+	}
+	return parte.PartyIdentification[0].ID
+}
+
+// tipoComprobantePorCodigo convierte un código del catálogo 01 al tipo de comprobante
+func tipoComprobantePorCodigo(codigo string) models.TipoComprobante {
+	switch codigo {
+	case models.SUNATConstants.BoletaTypeCode:
+		return models.TipoBoleta
+	case models.SUNATConstants.CreditNoteTypeCode:
+		return models.TipoNotaCredito
+	case models.SUNATConstants.DebitNoteTypeCode:
+		return models.TipoNotaDebito
+	case models.SUNATConstants.LiquidacionCompraTypeCode:
+		return models.TipoLiquidacionCompra
+	default:
+		return models.TipoFactura
+	}
+}
+
+func montoUBL(amount *models.Amount) float64 {
+	if amount == nil {
+		return 0
+	}
+	return amount.Value
+}
+
+// truncarDia retorna el día calendario de la fecha tal como está expresada; las
+// fechas de emisión se convierten antes a la hora de Lima
+func truncarDia(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"errors"
+	"facturacion_sunat_api_go/internal/models"
+	"facturacion_sunat_api_go/pkg/xsd"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// validacionPrueba fija el día actual en la fecha de emisión de facturaPrueba
+func validacionPrueba() *ValidationService {
+	return &ValidationService{
+		ahora: func() time.Time { return time.Date(2024, time.June, 20, 18, 0, 0, 0, time.UTC) },
+	}
+}
+
+// codigosError retorna los códigos de los hallazgos que provocarían el rechazo
+func codigosError(hallazgos []Hallazgo) []string {
+	var codigos []string
+	for _, hallazgo := range hallazgos {
+		if hallazgo.Severidad == SeveridadError {
+			codigos = append(codigos, hallazgo.Codigo)
+		}
+	}
+	return codigos
+}
+
+func TestValidarComprobanteItems(t *testing.T) {
+	tests := []struct {
+		name    string
+		ajustar func(items []models.Item)
+		codigos []string
+	}{
+		{"ítems válidos", func(items []models.Item) {}, nil},
+		{"número de orden cero", func(items []models.Item) { items[0].NumeroItem = 0 }, []string{"2023"}},
+		{"número de orden de cuatro dígitos", func(items []models.Item) { items[1].NumeroItem = 1000 }, []string{"2023"}},
+		{"número de orden repetido", func(items []models.Item) { items[1].NumeroItem = 1 }, []string{"2752"}},
+		{"cantidad cero", func(items []models.Item) { items[0].Cantidad = 0 }, []string{"2024"}},
+		{"sin descripción", func(items []models.Item) { items[1].Descripcion = "  " }, []string{"2026"}},
+		{"gratuita sin valor referencial", func(items []models.Item) {
+			items[1].TipoAfectacion = models.GravadoGratuito
+			items[1].ValorUnitario = 0
+		}, []string{"2640"}},
+		{"afectación inexistente", func(items []models.Item) { items[0].TipoAfectacion = 99 }, []string{"2371"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comprobante := facturaPrueba(itemPrueba(1, models.GravadoOneroso, 2, 100), itemPrueba(2, models.GravadoOneroso, 1, 50))
+			tt.ajustar(comprobante.Items)
+
+			hallazgos := validacionPrueba().ValidarComprobante(comprobante)
+			assert.Equal(t, tt.codigos, codigosError(hallazgos))
+		})
+	}
+}
+
+func TestValidarImportesDeclarados(t *testing.T) {
+	tests := []struct {
+		name     string
+		declarar func(comprobante *models.Comprobante)
+		codigos  []string
+	}{
+		{"sin importes declarados", func(comprobante *models.Comprobante) {}, nil},
+		{"totales correctos", func(comprobante *models.Comprobante) {
+			comprobante.Totales = models.Totales{TotalVentaGravada: 250, TotalValorVenta: 250, TotalImpuestos: 45, TotalPrecioVenta: 295, ImporteTotal: 295}
+		}, nil},
+		{"diferencia dentro de la tolerancia", func(comprobante *models.Comprobante) {
+			comprobante.Totales = models.Totales{TotalValorVenta: 250, TotalImpuestos: 45, TotalPrecioVenta: 295, ImporteTotal: 295.90}
+		}, nil},
+		{"importe total errado", func(comprobante *models.Comprobante) {
+			comprobante.Totales = models.Totales{TotalValorVenta: 250, TotalImpuestos: 45, TotalPrecioVenta: 295, ImporteTotal: 300}
+		}, []string{"4312"}},
+		{"IGV calculado con otra tasa", func(comprobante *models.Comprobante) {
+			comprobante.Totales = models.Totales{TotalValorVenta: 250, TotalImpuestos: 25, TotalPrecioVenta: 275, ImporteTotal: 275}
+		}, []string{"4301", "4310", "4312"}},
+		{"descuento no declarado", func(comprobante *models.Comprobante) {
+			comprobante.Totales = models.Totales{TotalValorVenta: 250, TotalImpuestos: 45, TotalPrecioVenta: 295, TotalDescuentos: 10, ImporteTotal: 285}
+		}, []string{"4307", "4312"}},
+		{"valor de venta del ítem errado", func(comprobante *models.Comprobante) {
+			comprobante.Items[0].ValorVenta = 180
+		}, []string{"4288"}},
+		{"IGV del ítem errado", func(comprobante *models.Comprobante) {
+			comprobante.Items[1].ImpuestoItem = []models.ImpuestoItem{{TipoImpuesto: "1000", CodigoImpuesto: "IGV", BaseImponible: 50, Tasa: 18, MontoImpuesto: 5}}
+		}, []string{"4290"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comprobante := facturaPrueba(itemPrueba(1, models.GravadoOneroso, 2, 100), itemPrueba(2, models.GravadoOneroso, 1, 50))
+			tt.declarar(comprobante)
+
+			declarados := DeclararImportes(comprobante)
+			require.NoError(t, NewConversionService(NewUBLService()).CalculateTotals(comprobante))
+
+			var codigos []string
+			for _, hallazgo := range validacionPrueba().ValidarImportesDeclarados(declarados, comprobante) {
+				assert.Equal(t, SeveridadObservacion, hallazgo.Severidad)
+				codigos = append(codigos, hallazgo.Codigo)
+			}
+			assert.Equal(t, tt.codigos, codigos)
+		})
+	}
+}
+
+func TestValidarItemsProductoNoEnumerado(t *testing.T) {
+	comprobante := facturaPrueba(itemPrueba(1, models.GravadoOneroso, 1, 100))
+	comprobante.Items[0].CodigoSUNAT = "43211599"
+
+	// Sin la lista oficial cargada, el código puede existir: se observa sin rechazar
+	hallazgos := validacionPrueba().ValidarItems(comprobante)
+	require.Len(t, hallazgos, 1)
+	assert.Equal(t, "3002", hallazgos[0].Codigo)
+	assert.Equal(t, SeveridadObservacion, hallazgos[0].Severidad)
+
+	comprobante.Items[0].CodigoSUNAT = "43211503"
+	assert.Empty(t, validacionPrueba().ValidarItems(comprobante))
+}
+
+func TestValidarEsquemaSinEsquemasOficiales(t *testing.T) {
+	if _, err := xsd.UBL21(); !errors.Is(err, xsd.ErrEsquemasNoInstalados) {
+		t.Skip("los esquemas oficiales están instalados")
+	}
+
+	// Sin los esquemas el comprobante no se da por validado
+	hallazgos, err := validacionPrueba().ValidarEsquema([]byte("<Invoice/>"))
+	require.Error(t, err)
+	assert.ErrorIs(t, err, xsd.ErrEsquemasNoInstalados)
+	assert.Empty(t, hallazgos)
+}
@@ -0,0 +1,276 @@
+// Package catalogos expone los catálogos SUNAT (anexo 8 de las especificaciones
+// de comprobantes electrónicos) embebidos en el binario. Cada catálogo se
+// mantiene en datos/catalogoNN.json con la versión del anexo del que proviene,
+// de modo que una actualización de SUNAT no requiere cambios de código.
+package catalogos
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Números de los catálogos usados por la conversión y la validación
+const (
+	TipoDocumento           = "01"
+	Moneda                  = "02"
+	UnidadMedida            = "03"
+	Pais                    = "04"
+	Tributo                 = "05"
+	DocumentoIdentidad      = "06"
+	AfectacionIGV           = "07"
+	SistemaISC              = "08"
+	TipoNotaCredito         = "09"
+	TipoNotaDebito          = "10"
+	DocumentoRelacionado    = "12"
+	Ubigeo                  = "13"
+	TipoPrecio              = "16"
+	ModalidadTraslado       = "18"
+	MotivoTraslado          = "20"
+	RegimenPercepcion       = "22"
+	RegimenRetencion        = "23"
+	ProductoSUNAT           = "25"
+	TipoOperacion           = "51"
+	Leyenda                 = "52"
+	CargoDescuento          = "53"
+	Detraccion              = "54"
+	PropiedadItem           = "55"
+	MedioPago               = "59"
+	TipoDireccion           = "60"
+	DocumentoRelacionadoGRE = "61"
+)
+
+// prefijoURI es el identificador con el que SUNAT publica sus catálogos (listURI/schemeURI)
+const prefijoURI = "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo"
+
+//go:embed datos/*.json
+var datos embed.FS
+
+// Codigo es un valor de un catálogo. Los atributos contienen datos propios del
+// catálogo, por ejemplo la categoría UN/ECE 5305 de un tributo o la tasa de un
+// régimen de percepción.
+type Codigo struct {
+	Codigo      string            `json:"codigo"`
+	Descripcion string            `json:"descripcion"`
+	Atributos   map[string]string `json:"atributos,omitempty"`
+}
+
+// Catalogo es un catálogo SUNAT. Los catálogos sin enumeración completa
+// declaran un formato con el que se validan los códigos.
+type Catalogo struct {
+	Numero  string   `json:"numero"`
+	Nombre  string   `json:"nombre"`
+	Version string   `json:"version"`
+	Vigente bool     `json:"vigente"`
+	Formato string   `json:"formato,omitempty"`
+	Codigos []Codigo `json:"codigos"`
+
+	indice  map[string]int
+	formato *regexp.Regexp
+}
+
+var (
+	cargarUnaVez sync.Once
+	catalogos    map[string]*Catalogo
+	errorCarga   error
+)
+
+// cargar lee los catálogos embebidos una sola vez por proceso
+func cargar() (map[string]*Catalogo, error) {
+	cargarUnaVez.Do(func() {
+		catalogos, errorCarga = leerCatalogos(datos, "datos/*.json")
+		if errorCarga != nil {
+			return
+		}
+		if ubigeos, errorCarga = leerUbigeos(bytes.NewReader(datosUbigeo)); errorCarga != nil {
+			return
+		}
+		if catalogo, ok := catalogos[Ubigeo]; ok {
+			completarCatalogoUbigeo(catalogo, ubigeos)
+		}
+
+		var productos []Codigo
+		if productos, errorCarga = leerProductos(bytes.NewReader(datosProductos)); errorCarga != nil {
+			return
+		}
+		if catalogo, ok := catalogos[ProductoSUNAT]; ok {
+			errorCarga = completarCatalogoProductos(catalogo, productos)
+		}
+	})
+	return catalogos, errorCarga
+}
+
+func leerCatalogos(fsys fs.FS, patron string) (map[string]*Catalogo, error) {
+	archivos, err := fs.Glob(fsys, patron)
+	if err != nil {
+		return nil, fmt.Errorf("error buscando catálogos: %v", err)
+	}
+
+	resultado := make(map[string]*Catalogo, len(archivos))
+	for _, archivo := range archivos {
+		data, err := fs.ReadFile(fsys, archivo)
+		if err != nil {
+			return nil, fmt.Errorf("error leyendo %s: %v", archivo, err)
+		}
+
+		catalogo := &Catalogo{}
+		if err := json.Unmarshal(data, catalogo); err != nil {
+			return nil, fmt.Errorf("error decodificando %s: %v", path.Base(archivo), err)
+		}
+		if catalogo.Formato != "" {
+			if catalogo.formato, err = regexp.Compile(catalogo.Formato); err != nil {
+				return nil, fmt.Errorf("formato inválido en el catálogo %s: %v", catalogo.Numero, err)
+			}
+		}
+
+		catalogo.indice = make(map[string]int, len(catalogo.Codigos))
+		for i, codigo := range catalogo.Codigos {
+			if _, ok := catalogo.indice[codigo.Codigo]; ok {
+				return nil, fmt.Errorf("código %s duplicado en el catálogo %s", codigo.Codigo, catalogo.Numero)
+			}
+			catalogo.indice[codigo.Codigo] = i
+		}
+
+		if _, ok := resultado[catalogo.Numero]; ok {
+			return nil, fmt.Errorf("catálogo %s duplicado", catalogo.Numero)
+		}
+		resultado[catalogo.Numero] = catalogo
+	}
+	return resultado, nil
+}
+
+// normalizarNumero admite el número del catálogo con o sin cero a la izquierda ("1" o "01")
+func normalizarNumero(numero string) string {
+	numero = strings.TrimSpace(numero)
+	if len(numero) == 1 {
+		return "0" + numero
+	}
+	return numero
+}
+
+// Obtener retorna el catálogo con el número indicado
+func Obtener(numero string) (*Catalogo, error) {
+	todos, err := cargar()
+	if err != nil {
+		return nil, err
+	}
+	catalogo, ok := todos[normalizarNumero(numero)]
+	if !ok {
+		return nil, fmt.Errorf("el catálogo %s no existe", numero)
+	}
+	return catalogo, nil
+}
+
+// Listar retorna todos los catálogos ordenados por número
+func Listar() ([]*Catalogo, error) {
+	todos, err := cargar()
+	if err != nil {
+		return nil, err
+	}
+	lista := make([]*Catalogo, 0, len(todos))
+	for _, catalogo := range todos {
+		lista = append(lista, catalogo)
+	}
+	sort.Slice(lista, func(i, j int) bool { return lista[i].Numero < lista[j].Numero })
+	return lista, nil
+}
+
+// URI retorna el listURI/schemeURI con el que se referencia el catálogo en el UBL
+func URI(numero string) string {
+	return prefijoURI + normalizarNumero(numero)
+}
+
+// Existe indica si el código es válido en el catálogo
+func Existe(numero, codigo string) bool {
+	catalogo, err := Obtener(numero)
+	if err != nil {
+		return false
+	}
+	return catalogo.Valido(codigo)
+}
+
+// Descripcion retorna la descripción del código o una cadena vacía si no existe
+func Descripcion(numero, codigo string) string {
+	catalogo, err := Obtener(numero)
+	if err != nil {
+		return ""
+	}
+	valor, _ := catalogo.Buscar(codigo)
+	return valor.Descripcion
+}
+
+// Atributo retorna un atributo del código o una cadena vacía si no existe
+func Atributo(numero, codigo, nombre string) string {
+	catalogo, err := Obtener(numero)
+	if err != nil {
+		return ""
+	}
+	valor, _ := catalogo.Buscar(codigo)
+	return valor.Atributos[nombre]
+}
+
+// URI retorna el listURI/schemeURI del catálogo
+func (c *Catalogo) URI() string {
+	return URI(c.Numero)
+}
+
+// Buscar retorna el código enumerado en el catálogo
+func (c *Catalogo) Buscar(codigo string) (Codigo, bool) {
+	i, ok := c.indice[codigo]
+	if !ok {
+		return Codigo{}, false
+	}
+	return c.Codigos[i], true
+}
+
+// Valido indica si el código está enumerado en el catálogo o, en los catálogos
+// que declaran un formato, si cumple dicho formato.
+func (c *Catalogo) Valido(codigo string) bool {
+	if _, ok := c.indice[codigo]; ok {
+		return true
+	}
+	return c.formato != nil && c.formato.MatchString(codigo)
+}
+
+// Filtrar retorna los códigos cuyo valor o descripción contienen el texto, sin
+// distinguir mayúsculas ni tildes. Un texto vacío retorna todos los códigos.
+func (c *Catalogo) Filtrar(texto string) []Codigo {
+	texto = normalizarTexto(texto)
+	if texto == "" {
+		return c.Codigos
+	}
+
+	var resultado []Codigo
+	for _, codigo := range c.Codigos {
+		if strings.Contains(normalizarTexto(codigo.Codigo), texto) ||
+			strings.Contains(normalizarTexto(codigo.Descripcion), texto) {
+			resultado = append(resultado, codigo)
+		}
+	}
+	return resultado
+}
+
+// Mapa retorna los códigos del catálogo indexados por valor con su descripción
+func (c *Catalogo) Mapa() map[string]string {
+	mapa := make(map[string]string, len(c.Codigos))
+	for _, codigo := range c.Codigos {
+		mapa[codigo.Codigo] = codigo.Descripcion
+	}
+	return mapa
+}
+
+var sinTildes = strings.NewReplacer(
+	"á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u", "ñ", "n",
+)
+
+// normalizarTexto prepara un texto para búsquedas sin distinguir mayúsculas ni tildes
+func normalizarTexto(texto string) string {
+	return sinTildes.Replace(strings.ToLower(strings.TrimSpace(texto)))
+}
@@ -0,0 +1,112 @@
+package catalogos
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+)
+
+// datosProductos contiene los segmentos UNSPSC y una selección de productos
+// del catálogo 25 en el formato codigo,descripcion. La lista oficial completa
+// se carga al iniciar con CargarProductos.
+//
+//go:embed datos/productos.csv
+var datosProductos []byte
+
+// productosCompletos indica si el catálogo 25 enumera la lista oficial completa
+// o solo la selección embebida
+var productosCompletos atomic.Bool
+
+// leerProductos lee los códigos de producto en el formato codigo,descripcion.
+// Se omiten las líneas de comentario (#) y una cabecera en la primera fila, como
+// la que deja la exportación a CSV de la lista publicada por SUNAT.
+func leerProductos(r io.Reader) ([]Codigo, error) {
+	lector := csv.NewReader(r)
+	lector.Comment = '#'
+	lector.FieldsPerRecord = 2
+
+	var codigos []Codigo
+	for fila := 1; ; fila++ {
+		registro, err := lector.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error leyendo productos: %v", err)
+		}
+
+		codigo := strings.TrimSpace(strings.TrimPrefix(registro[0], "\ufeff"))
+		if len(codigo) != 8 || strings.Trim(codigo, "0123456789") != "" {
+			if fila == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("código de producto inválido: %s", codigo)
+		}
+		codigos = append(codigos, Codigo{
+			Codigo:      codigo,
+			Descripcion: strings.TrimSpace(registro[1]),
+			Atributos:   map[string]string{"nivel": nivelProducto(codigo)},
+		})
+	}
+	return codigos, nil
+}
+
+// nivelProducto indica el nivel de la jerarquía UNSPSC del código
+func nivelProducto(codigo string) string {
+	switch {
+	case codigo[2:] == "000000":
+		return "segmento"
+	case codigo[4:] == "0000":
+		return "familia"
+	case codigo[6:] == "00":
+		return "clase"
+	default:
+		return "producto"
+	}
+}
+
+// completarCatalogoProductos enumera en el catálogo 25 los códigos de producto;
+// solo los códigos enumerados son válidos
+func completarCatalogoProductos(catalogo *Catalogo, codigos []Codigo) error {
+	indice := make(map[string]int, len(codigos))
+	for i, codigo := range codigos {
+		if _, ok := indice[codigo.Codigo]; ok {
+			return fmt.Errorf("código %s duplicado en el catálogo %s", codigo.Codigo, catalogo.Numero)
+		}
+		indice[codigo.Codigo] = i
+	}
+	catalogo.indice = indice
+	catalogo.Codigos = codigos
+	return nil
+}
+
+// CargarProductos reemplaza la selección embebida por la lista oficial del
+// catálogo 25 que publica SUNAT, exportada a CSV con las columnas
+// codigo,descripcion. Debe llamarse al iniciar, antes de atender solicitudes.
+func CargarProductos(r io.Reader) error {
+	catalogo, err := Obtener(ProductoSUNAT)
+	if err != nil {
+		return err
+	}
+	codigos, err := leerProductos(r)
+	if err != nil {
+		return err
+	}
+	if len(codigos) == 0 {
+		return fmt.Errorf("el archivo no contiene códigos de producto")
+	}
+	if err := completarCatalogoProductos(catalogo, codigos); err != nil {
+		return err
+	}
+	productosCompletos.Store(true)
+	return nil
+}
+
+// ProductosCompletos indica si se cargó la lista oficial completa del catálogo
+// 25. Con la selección embebida, un código no enumerado puede ser válido.
+func ProductosCompletos() bool {
+	return productosCompletos.Load()
+}
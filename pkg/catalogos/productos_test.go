@@ -0,0 +1,76 @@
+package catalogos
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProductosEmbebidos(t *testing.T) {
+	tests := []struct {
+		codigo string
+		valido bool
+	}{
+		{"43211503", true},
+		{"43000000", true},
+		{"43211599", false}, // Segmento existente, código no enumerado
+		{"00000000", false},
+		{"4321150", false},
+		{"4321150A", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.codigo, func(t *testing.T) {
+			assert.Equal(t, tt.valido, Existe(ProductoSUNAT, tt.codigo))
+		})
+	}
+	assert.False(t, ProductosCompletos())
+}
+
+func TestLeerProductos(t *testing.T) {
+	// Exportación de la lista oficial: BOM, cabecera y descripciones entre comillas
+	codigos, err := leerProductos(strings.NewReader("\ufeffCódigo,Descripción\n43211503,Computadores portátiles\n10101501,\"Gatos vivos, de compañía\"\n"))
+	require.NoError(t, err)
+	require.Len(t, codigos, 2)
+	assert.Equal(t, "43211503", codigos[0].Codigo)
+	assert.Equal(t, "producto", codigos[0].Atributos["nivel"])
+	assert.Equal(t, "Gatos vivos, de compañía", codigos[1].Descripcion)
+
+	_, err = leerProductos(strings.NewReader("43211503,Computadores portátiles\n4321150X,Errado\n"))
+	assert.Error(t, err)
+
+	catalogo := &Catalogo{Numero: ProductoSUNAT}
+	err = completarCatalogoProductos(catalogo, append(codigos, codigos[0]))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "duplicado")
+
+	require.NoError(t, completarCatalogoProductos(catalogo, codigos))
+	assert.True(t, catalogo.Valido("10101501"))
+	assert.False(t, catalogo.Valido("10101502"))
+}
+
+// restaurarProductos vuelve a la selección embebida al terminar la prueba
+func restaurarProductos(t *testing.T) {
+	t.Cleanup(func() {
+		require.NoError(t, CargarProductos(bytes.NewReader(datosProductos)))
+		productosCompletos.Store(false)
+	})
+}
+
+func TestCargarProductos(t *testing.T) {
+	restaurarProductos(t)
+	assert.False(t, Existe(ProductoSUNAT, "10101501"))
+
+	// Lista oficial con productos que no figuran en la selección embebida
+	lista := "Código,Descripción\n10000000,Material Vivo Animal y Vegetal\n10101501,Gatos vivos\n43211503,Computadores portátiles\n"
+	require.NoError(t, CargarProductos(strings.NewReader(lista)))
+	assert.True(t, ProductosCompletos())
+
+	assert.True(t, Existe(ProductoSUNAT, "10101501"))
+	assert.Equal(t, "Gatos vivos", Descripcion(ProductoSUNAT, "10101501"))
+	assert.True(t, Existe(ProductoSUNAT, "43211503"))
+	assert.False(t, Existe(ProductoSUNAT, "10101502"))
+}
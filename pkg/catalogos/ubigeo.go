@@ -0,0 +1,230 @@
+package catalogos
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// datosUbigeo contiene el ubigeo INEI (catálogo 13) en el formato
+// codigo,departamento,provincia,distrito: todos los departamentos y provincias y
+// una selección de distritos. La tabla completa se carga al iniciar con
+// CargarUbigeos.
+//
+//go:embed datos/ubigeo.csv
+var datosUbigeo []byte
+
+var formatoUbigeo = regexp.MustCompile(`^[0-9]{6}$`)
+
+// ubigeosCompletos indica si se cargó la tabla completa de distritos del INEI
+// o solo la selección embebida
+var ubigeosCompletos atomic.Bool
+
+// Ubicacion es un ubigeo resuelto con los nombres oficiales del INEI
+type Ubicacion struct {
+	Codigo       string `json:"codigo"`
+	Departamento string `json:"departamento"`
+	Provincia    string `json:"provincia"`
+	Distrito     string `json:"distrito"`
+}
+
+// tablaUbigeo indexa los departamentos, provincias y distritos por código
+type tablaUbigeo struct {
+	departamentos map[string]string   // 2 dígitos -> nombre
+	provincias    map[string]string   // 4 dígitos -> nombre
+	distritos     map[string]string   // 6 dígitos -> nombre
+	orden         []Ubicacion         // distritos en el orden del archivo
+	porNombre     map[string][]string // departamento|provincia|distrito normalizados -> códigos
+}
+
+var ubigeos *tablaUbigeo
+
+func leerUbigeos(r io.Reader) (*tablaUbigeo, error) {
+	lector := csv.NewReader(r)
+	lector.Comment = '#'
+	lector.FieldsPerRecord = 4
+
+	tabla := &tablaUbigeo{
+		departamentos: make(map[string]string),
+		provincias:    make(map[string]string),
+		distritos:     make(map[string]string),
+		porNombre:     make(map[string][]string),
+	}
+	for {
+		registro, err := lector.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error leyendo ubigeo: %v", err)
+		}
+
+		codigo := strings.TrimSpace(registro[0])
+		if !formatoUbigeo.MatchString(codigo) {
+			return nil, fmt.Errorf("código de ubigeo inválido: %s", codigo)
+		}
+		departamento, provincia, distrito := registro[1], registro[2], registro[3]
+		switch {
+		case codigo[2:] == "0000":
+			tabla.departamentos[codigo[:2]] = departamento
+		case codigo[4:] == "00":
+			tabla.provincias[codigo[:4]] = provincia
+		default:
+			if _, ok := tabla.distritos[codigo]; ok {
+				return nil, fmt.Errorf("ubigeo %s duplicado", codigo)
+			}
+			tabla.distritos[codigo] = distrito
+			tabla.orden = append(tabla.orden, Ubicacion{codigo, departamento, provincia, distrito})
+			clave := claveUbigeo(departamento, provincia, distrito)
+			tabla.porNombre[clave] = append(tabla.porNombre[clave], codigo)
+		}
+	}
+	return tabla, nil
+}
+
+func claveUbigeo(departamento, provincia, distrito string) string {
+	return normalizarTexto(departamento) + "|" + normalizarTexto(provincia) + "|" + normalizarTexto(distrito)
+}
+
+// buscar retorna la ubicación de un código de distrito
+func (t *tablaUbigeo) buscar(codigo string) (Ubicacion, error) {
+	if !formatoUbigeo.MatchString(codigo) {
+		return Ubicacion{}, fmt.Errorf("el ubigeo %q debe tener 6 dígitos", codigo)
+	}
+	departamento, ok := t.departamentos[codigo[:2]]
+	if !ok {
+		return Ubicacion{}, fmt.Errorf("el departamento %s del ubigeo %s no existe", codigo[:2], codigo)
+	}
+	provincia, ok := t.provincias[codigo[:4]]
+	if !ok {
+		return Ubicacion{}, fmt.Errorf("la provincia %s del ubigeo %s no existe", codigo[:4], codigo)
+	}
+	if codigo[4:] == "00" {
+		return Ubicacion{}, fmt.Errorf("el ubigeo %s corresponde a una provincia, no a un distrito", codigo)
+	}
+
+	distrito, ok := t.distritos[codigo]
+	if !ok {
+		if !ubigeosCompletos.Load() {
+			return Ubicacion{}, fmt.Errorf("el distrito %s no figura en la selección embebida de la provincia %s; no se cargó la tabla completa del INEI", codigo, provincia)
+		}
+		return Ubicacion{}, fmt.Errorf("el distrito %s no existe en la provincia %s", codigo, provincia)
+	}
+	return Ubicacion{Codigo: codigo, Departamento: departamento, Provincia: provincia, Distrito: distrito}, nil
+}
+
+// porNombres resuelve el código a partir de los nombres del departamento,
+// provincia y distrito, sin distinguir mayúsculas ni tildes
+func (t *tablaUbigeo) porNombres(departamento, provincia, distrito string) (Ubicacion, error) {
+	codigos := t.porNombre[claveUbigeo(departamento, provincia, distrito)]
+	if len(codigos) != 1 {
+		return Ubicacion{}, fmt.Errorf("no se encontró el ubigeo de %s / %s / %s", departamento, provincia, distrito)
+	}
+	return t.buscar(codigos[0])
+}
+
+// BuscarUbigeo valida un código de ubigeo y retorna sus nombres oficiales
+func BuscarUbigeo(codigo string) (Ubicacion, error) {
+	if _, err := cargar(); err != nil {
+		return Ubicacion{}, err
+	}
+	return ubigeos.buscar(strings.TrimSpace(codigo))
+}
+
+// ResolverUbigeo obtiene el ubigeo de una dirección. Si se indica el código se
+// valida y se verifica que los nombres informados, si los hay, correspondan a
+// él; si no, se busca el código a partir de los nombres.
+func ResolverUbigeo(codigo, departamento, provincia, distrito string) (Ubicacion, error) {
+	if _, err := cargar(); err != nil {
+		return Ubicacion{}, err
+	}
+
+	codigo = strings.TrimSpace(codigo)
+	if codigo == "" {
+		return ubigeos.porNombres(departamento, provincia, distrito)
+	}
+
+	ubicacion, err := ubigeos.buscar(codigo)
+	if err != nil {
+		return Ubicacion{}, err
+	}
+	if departamento != "" && normalizarTexto(departamento) != normalizarTexto(ubicacion.Departamento) {
+		return Ubicacion{}, fmt.Errorf("el ubigeo %s corresponde al departamento %s, no a %s", codigo, ubicacion.Departamento, departamento)
+	}
+	if provincia != "" && normalizarTexto(provincia) != normalizarTexto(ubicacion.Provincia) {
+		return Ubicacion{}, fmt.Errorf("el ubigeo %s corresponde a la provincia %s, no a %s", codigo, ubicacion.Provincia, provincia)
+	}
+	if distrito != "" && normalizarTexto(distrito) != normalizarTexto(ubicacion.Distrito) {
+		return Ubicacion{}, fmt.Errorf("el ubigeo %s corresponde al distrito %s, no a %s", codigo, ubicacion.Distrito, distrito)
+	}
+	return ubicacion, nil
+}
+
+// FiltrarUbigeos retorna los distritos enumerados cuyo código o nombres
+// contienen el texto, sin distinguir mayúsculas ni tildes
+func FiltrarUbigeos(texto string) ([]Ubicacion, error) {
+	if _, err := cargar(); err != nil {
+		return nil, err
+	}
+
+	texto = normalizarTexto(texto)
+	resultado := []Ubicacion{}
+	for _, ubicacion := range ubigeos.orden {
+		if texto == "" || strings.HasPrefix(ubicacion.Codigo, texto) ||
+			strings.Contains(claveUbigeo(ubicacion.Departamento, ubicacion.Provincia, ubicacion.Distrito), texto) {
+			resultado = append(resultado, ubicacion)
+		}
+	}
+	return resultado, nil
+}
+
+// completarCatalogoUbigeo enumera en el catálogo 13 los distritos de la tabla;
+// solo los distritos enumerados son válidos
+func completarCatalogoUbigeo(catalogo *Catalogo, tabla *tablaUbigeo) {
+	catalogo.indice = make(map[string]int, len(tabla.orden))
+	catalogo.Codigos = make([]Codigo, 0, len(tabla.orden))
+	for _, ubicacion := range tabla.orden {
+		catalogo.indice[ubicacion.Codigo] = len(catalogo.Codigos)
+		catalogo.Codigos = append(catalogo.Codigos, Codigo{
+			Codigo:      ubicacion.Codigo,
+			Descripcion: ubicacion.Departamento + " - " + ubicacion.Provincia + " - " + ubicacion.Distrito,
+			Atributos: map[string]string{
+				"departamento": ubicacion.Departamento,
+				"provincia":    ubicacion.Provincia,
+				"distrito":     ubicacion.Distrito,
+			},
+		})
+	}
+}
+
+// CargarUbigeos reemplaza la selección embebida por la tabla completa de
+// ubigeos del INEI en el formato codigo,departamento,provincia,distrito, con
+// las filas de departamento (0000) y provincia (00). Debe llamarse al iniciar,
+// antes de atender solicitudes.
+func CargarUbigeos(r io.Reader) error {
+	catalogo, err := Obtener(Ubigeo)
+	if err != nil {
+		return err
+	}
+	tabla, err := leerUbigeos(r)
+	if err != nil {
+		return err
+	}
+	if len(tabla.orden) == 0 {
+		return fmt.Errorf("el archivo no contiene distritos")
+	}
+	ubigeos = tabla
+	completarCatalogoUbigeo(catalogo, tabla)
+	ubigeosCompletos.Store(true)
+	return nil
+}
+
+// UbigeosCompletos indica si se cargó la tabla completa de distritos del INEI.
+// Con la selección embebida, un distrito no enumerado puede existir.
+func UbigeosCompletos() bool {
+	return ubigeosCompletos.Load()
+}
@@ -0,0 +1,112 @@
+package catalogos
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuscarUbigeo(t *testing.T) {
+	tests := []struct {
+		name     string
+		codigo   string
+		distrito string
+		wantErr  string
+	}{
+		{"distrito enumerado", "150105", "BREÑA", ""},
+		{"con espacios", " 150101 ", "LIMA", ""},
+		{"distrito no enumerado", "060101", "", "no figura en la selección embebida"},
+		{"provincia", "150100", "", "corresponde a una provincia"},
+		{"provincia inexistente", "159900", "", "la provincia 1599"},
+		{"departamento inexistente", "990101", "", "el departamento 99"},
+		{"corto", "15010", "", "6 dígitos"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ubicacion, err := BuscarUbigeo(tt.codigo)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				assert.False(t, Existe(Ubigeo, strings.TrimSpace(tt.codigo)))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.distrito, ubicacion.Distrito)
+			assert.True(t, Existe(Ubigeo, strings.TrimSpace(tt.codigo)))
+		})
+	}
+	assert.False(t, UbigeosCompletos())
+}
+
+func TestResolverUbigeo(t *testing.T) {
+	ubicacion, err := ResolverUbigeo("", "Lima", "lima", "Brena")
+	require.NoError(t, err)
+	assert.Equal(t, "150105", ubicacion.Codigo)
+
+	ubicacion, err = ResolverUbigeo("150105", "LIMA", "LIMA", "BREÑA")
+	require.NoError(t, err)
+	assert.Equal(t, "BREÑA", ubicacion.Distrito)
+
+	_, err = ResolverUbigeo("150105", "LIMA", "LIMA", "ATE")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "corresponde al distrito BREÑA")
+
+	_, err = ResolverUbigeo("", "LIMA", "LIMA", "MACHU PICCHU")
+	assert.Error(t, err)
+}
+
+func TestLeerUbigeos(t *testing.T) {
+	tabla, err := leerUbigeos(strings.NewReader("080000,CUSCO,,\n080800,CUSCO,ESPINAR,\n080801,CUSCO,ESPINAR,ESPINAR\n"))
+	require.NoError(t, err)
+
+	catalogo := &Catalogo{Numero: Ubigeo}
+	completarCatalogoUbigeo(catalogo, tabla)
+	assert.True(t, catalogo.Valido("080801"))
+	assert.False(t, catalogo.Valido("080802"))
+	assert.False(t, catalogo.Valido("080800"))
+
+	_, err = leerUbigeos(strings.NewReader("080801,CUSCO,ESPINAR,ESPINAR\n080801,CUSCO,ESPINAR,ESPINAR\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "duplicado")
+
+	_, err = leerUbigeos(strings.NewReader("08080,CUSCO,ESPINAR,ESPINAR\n"))
+	assert.Error(t, err)
+}
+
+// restaurarUbigeos vuelve a la selección embebida al terminar la prueba
+func restaurarUbigeos(t *testing.T) {
+	t.Cleanup(func() {
+		require.NoError(t, CargarUbigeos(bytes.NewReader(datosUbigeo)))
+		ubigeosCompletos.Store(false)
+	})
+}
+
+func TestCargarUbigeos(t *testing.T) {
+	restaurarUbigeos(t)
+	_, err := BuscarUbigeo("060101")
+	require.Error(t, err)
+
+	// Tabla del INEI con distritos que no figuran en la selección embebida
+	tabla := "060000,CAJAMARCA,,\n060100,CAJAMARCA,CAJAMARCA,\n060101,CAJAMARCA,CAJAMARCA,CAJAMARCA\n060102,CAJAMARCA,CAJAMARCA,ASUNCION\n" +
+		"150000,LIMA,,\n150100,LIMA,LIMA,\n150105,LIMA,LIMA,BREÑA\n"
+	require.NoError(t, CargarUbigeos(strings.NewReader(tabla)))
+	assert.True(t, UbigeosCompletos())
+
+	ubicacion, err := BuscarUbigeo("060101")
+	require.NoError(t, err)
+	assert.Equal(t, Ubicacion{Codigo: "060101", Departamento: "CAJAMARCA", Provincia: "CAJAMARCA", Distrito: "CAJAMARCA"}, ubicacion)
+	assert.True(t, Existe(Ubigeo, "060101"))
+
+	ubicacion, err = ResolverUbigeo("", "Cajamarca", "Cajamarca", "Asunción")
+	require.NoError(t, err)
+	assert.Equal(t, "060102", ubicacion.Codigo)
+
+	// Con la tabla completa, un distrito que no figura en ella no existe
+	_, err = BuscarUbigeo("060103")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no existe en la provincia CAJAMARCA")
+}
@@ -0,0 +1,134 @@
+// Package identidad valida los números de los documentos de identidad del
+// catálogo 06 de SUNAT, incluido el dígito verificador (módulo 11) del RUC.
+package identidad
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Tipos de documento de identidad del catálogo 06
+const (
+	NoDomiciliadoSinRUC     = "0"
+	DNI                     = "1"
+	CarnetExtranjeria       = "4"
+	RUC                     = "6"
+	Pasaporte               = "7"
+	CedulaDiplomatica       = "A"
+	DocumentoPaisResidencia = "B"
+	TIN                     = "C"
+	IN                      = "D"
+	TAM                     = "E"
+	PTP                     = "F"
+	Salvoconducto           = "G"
+	Varios                  = "-" // Boletas sin identificación del adquirente (ventas menores a S/ 700)
+)
+
+// prefijosRUC son los tipos de contribuyente que SUNAT asigna en los dos
+// primeros dígitos del RUC: 10 persona natural, 15 y 17 no domiciliados y
+// casos especiales, 16 sociedades conyugales y sucesiones, 20 persona jurídica
+var prefijosRUC = map[string]bool{"10": true, "15": true, "16": true, "17": true, "20": true}
+
+// pesosRUC son los factores del módulo 11 para los diez primeros dígitos
+var pesosRUC = [10]int{5, 4, 3, 2, 7, 6, 5, 4, 3, 2}
+
+var (
+	formatoDigitos       = regexp.MustCompile(`^[0-9]+$`)
+	formatoAlfanumerico  = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+	formatoVarios        = regexp.MustCompile(`^(-|[0-9]{1,15})$`)
+	longitudAlfanumerica = map[string]int{
+		NoDomiciliadoSinRUC:     15,
+		CarnetExtranjeria:       12,
+		Pasaporte:               12,
+		CedulaDiplomatica:       15,
+		DocumentoPaisResidencia: 15,
+		TIN:                     15,
+		IN:                      15,
+		TAM:                     15,
+		PTP:                     15,
+		Salvoconducto:           15,
+	}
+)
+
+// DigitoVerificadorRUC calcula el dígito verificador de los diez primeros
+// dígitos de un RUC con el algoritmo módulo 11 de SUNAT
+func DigitoVerificadorRUC(base string) (int, error) {
+	if len(base) != 10 || !formatoDigitos.MatchString(base) {
+		return 0, fmt.Errorf("la base del RUC debe tener 10 dígitos")
+	}
+	suma := 0
+	for i, peso := range pesosRUC {
+		suma += int(base[i]-'0') * peso
+	}
+	digito := 11 - suma%11
+	switch digito {
+	case 10:
+		digito = 0
+	case 11:
+		digito = 1
+	}
+	return digito, nil
+}
+
+// ValidarRUC valida la longitud, el tipo de contribuyente y el dígito verificador del RUC
+func ValidarRUC(ruc string) error {
+	if len(ruc) != 11 {
+		return fmt.Errorf("RUC debe tener 11 dígitos")
+	}
+	if !formatoDigitos.MatchString(ruc) {
+		return fmt.Errorf("RUC debe contener solo números")
+	}
+	if !prefijosRUC[ruc[:2]] {
+		return fmt.Errorf("tipo de contribuyente inválido: %s", ruc[:2])
+	}
+	digito, _ := DigitoVerificadorRUC(ruc[:10])
+	if int(ruc[10]-'0') != digito {
+		return fmt.Errorf("el dígito verificador del RUC %s no es válido", ruc)
+	}
+	return nil
+}
+
+// ValidarDNI valida que el DNI tenga 8 dígitos
+func ValidarDNI(dni string) error {
+	if len(dni) != 8 || !formatoDigitos.MatchString(dni) {
+		return fmt.Errorf("DNI debe tener 8 dígitos")
+	}
+	return nil
+}
+
+// Validar valida el número de un documento según su tipo del catálogo 06
+func Validar(tipo, numero string) error {
+	numero = strings.TrimSpace(numero)
+	switch tipo {
+	case RUC:
+		return ValidarRUC(numero)
+	case DNI:
+		return ValidarDNI(numero)
+	case Varios:
+		if !formatoVarios.MatchString(numero) {
+			return fmt.Errorf("el número de un adquirente sin identificación debe ser \"-\" o numérico")
+		}
+		return nil
+	}
+
+	maximo, ok := longitudAlfanumerica[tipo]
+	if !ok {
+		return fmt.Errorf("el tipo de documento de identidad %q no existe en el catálogo 06", tipo)
+	}
+	if numero == "" {
+		return fmt.Errorf("el número de documento es obligatorio")
+	}
+	if tipo == NoDomiciliadoSinRUC && numero == "-" {
+		return nil
+	}
+	if len(numero) > maximo || !formatoAlfanumerico.MatchString(numero) {
+		return fmt.Errorf("el número de documento debe ser alfanumérico de hasta %d caracteres", maximo)
+	}
+	return nil
+}
+
+// EsAnonimo indica si el documento corresponde a un adquirente sin identificación
+func EsAnonimo(tipo, numero string) bool {
+	return tipo == Varios || strings.TrimSpace(numero) == "-"
+}
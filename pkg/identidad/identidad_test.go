@@ -0,0 +1,125 @@
+package identidad
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDigitoVerificadorRUC(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    string
+		digito  int
+		wantErr bool
+	}{
+		{"SUNAT", "2013131295", 5, false},
+		{"resto 10 se informa como 0", "2010000005", 0, false},
+		{"resto 11 se informa como 1", "2010000013", 1, false},
+		{"base corta", "201313129", 0, true},
+		{"base con letras", "20131312A5", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			digito, err := DigitoVerificadorRUC(tt.base)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.digito, digito)
+		})
+	}
+}
+
+func TestValidarRUC(t *testing.T) {
+	tests := []struct {
+		name    string
+		ruc     string
+		wantErr string
+	}{
+		{"SUNAT", "20131312955", ""},
+		{"persona jurídica", "20100070970", ""},
+		{"persona natural", "10467793549", ""},
+		{"prefijo 10", "10100000003", ""},
+		{"prefijo 15", "15100000005", ""},
+		{"prefijo 16", "16100000001", ""},
+		{"prefijo 17", "17100000008", ""},
+		{"prefijo 20", "20100000009", ""},
+		{"dígito 0 por resto 10", "20100000050", ""},
+		{"dígito 1 por resto 11", "20100000131", ""},
+		{"dígito verificador errado", "20131312954", "dígito verificador"},
+		{"resto 10 informado como 10", "20100000051", "dígito verificador"},
+		{"prefijo inexistente", "30131312955", "tipo de contribuyente"},
+		{"prefijo 11", "11100000003", "tipo de contribuyente"},
+		{"corto", "2013131295", "11 dígitos"},
+		{"largo", "201313129550", "11 dígitos"},
+		{"con letras", "2013131295A", "solo números"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidarRUC(tt.ruc)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidar(t *testing.T) {
+	tests := []struct {
+		name    string
+		tipo    string
+		numero  string
+		wantErr bool
+	}{
+		{"RUC", RUC, "20131312955", false},
+		{"RUC con espacios", RUC, " 20131312955 ", false},
+		{"RUC errado", RUC, "20131312954", true},
+		{"DNI", DNI, "46779354", false},
+		{"DNI corto", DNI, "4677935", true},
+		{"DNI largo", DNI, "467793541", true},
+		{"DNI con letras", DNI, "4677935A", true},
+		{"carné de extranjería", CarnetExtranjeria, "001234567", false},
+		{"carné de extranjería de 12", CarnetExtranjeria, "123456789012", false},
+		{"carné de extranjería de 13", CarnetExtranjeria, "1234567890123", true},
+		{"pasaporte alfanumérico", Pasaporte, "AB1234567", false},
+		{"pasaporte de 12", Pasaporte, "AB1234567890", false},
+		{"pasaporte de 13", Pasaporte, "AB12345678901", true},
+		{"pasaporte con guion", Pasaporte, "AB-123456", true},
+		{"pasaporte vacío", Pasaporte, "", true},
+		{"TIN de 15", TIN, "123456789012345", false},
+		{"TIN de 16", TIN, "1234567890123456", true},
+		{"no domiciliado anónimo", NoDomiciliadoSinRUC, "-", false},
+		{"adquirente anónimo", Varios, "-", false},
+		{"adquirente anónimo numérico", Varios, "00000000", false},
+		{"adquirente anónimo de 16 dígitos", Varios, "1234567890123456", true},
+		{"adquirente anónimo con letras", Varios, "ABC", true},
+		{"tipo inexistente", "9", "12345678", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validar(tt.tipo, tt.numero)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestEsAnonimo(t *testing.T) {
+	assert.True(t, EsAnonimo(Varios, "00000000"))
+	assert.True(t, EsAnonimo(DNI, "-"))
+	assert.True(t, EsAnonimo(NoDomiciliadoSinRUC, " - "))
+	assert.False(t, EsAnonimo(DNI, "46779354"))
+	assert.False(t, EsAnonimo(RUC, "20131312955"))
+}
@@ -0,0 +1,137 @@
+// Package letras expresa importes en letras en castellano, como exige la
+// leyenda 1000 del catálogo 52 de SUNAT: la parte entera en palabras y los
+// céntimos como fracción de 100, seguidos del nombre de la moneda.
+package letras
+
+import (
+	"facturacion_sunat_api_go/pkg/catalogos"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// maximo es el mayor entero que se expresa en letras (un billón menos uno)
+const maximo = 999_999_999_999
+
+// nombresMoneda son los nombres en plural con que se expresan las monedas más
+// usadas; las demás toman la descripción del catálogo 02
+var nombresMoneda = map[string]string{
+	"PEN": "SOLES",
+	"USD": "DÓLARES AMERICANOS",
+	"EUR": "EUROS",
+}
+
+var (
+	unidades = [...]string{
+		"CERO", "UNO", "DOS", "TRES", "CUATRO", "CINCO", "SEIS", "SIETE", "OCHO", "NUEVE",
+		"DIEZ", "ONCE", "DOCE", "TRECE", "CATORCE", "QUINCE", "DIECISÉIS", "DIECISIETE", "DIECIOCHO", "DIECINUEVE",
+		"VEINTE", "VEINTIUNO", "VEINTIDÓS", "VEINTITRÉS", "VEINTICUATRO", "VEINTICINCO", "VEINTISÉIS", "VEINTISIETE", "VEINTIOCHO", "VEINTINUEVE",
+	}
+	decenas  = [...]string{"", "", "", "TREINTA", "CUARENTA", "CINCUENTA", "SESENTA", "SETENTA", "OCHENTA", "NOVENTA"}
+	centenas = [...]string{"", "CIENTO", "DOSCIENTOS", "TRESCIENTOS", "CUATROCIENTOS", "QUINIENTOS", "SEISCIENTOS", "SETECIENTOS", "OCHOCIENTOS", "NOVECIENTOS"}
+)
+
+// Monto expresa un importe en letras, por ejemplo 1234.5 en PEN como
+// "MIL DOSCIENTOS TREINTA Y CUATRO CON 50/100 SOLES"
+func Monto(valor float64, moneda string) (string, error) {
+	if valor < 0 || math.IsNaN(valor) || math.IsInf(valor, 0) {
+		return "", fmt.Errorf("el importe %v no puede expresarse en letras", valor)
+	}
+	centimosTotales := int64(math.Round(valor * 100))
+	entero := centimosTotales / 100
+	centimos := centimosTotales % 100
+
+	texto, err := Numero(entero)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s CON %02d/100 %s", texto, centimos, NombreMoneda(moneda)), nil
+}
+
+// NombreMoneda retorna el nombre de la moneda con que se cierra el importe en letras
+func NombreMoneda(moneda string) string {
+	if nombre, ok := nombresMoneda[moneda]; ok {
+		return nombre
+	}
+	if descripcion := catalogos.Descripcion(catalogos.Moneda, moneda); descripcion != "" {
+		return strings.ToUpper(descripcion)
+	}
+	return moneda
+}
+
+// Numero expresa en letras un entero no negativo menor a un billón
+func Numero(n int64) (string, error) {
+	if n < 0 || n > maximo {
+		return "", fmt.Errorf("el número %d está fuera del rango que se expresa en letras", n)
+	}
+	if n == 0 {
+		return unidades[0], nil
+	}
+
+	var partes []string
+	if millones := n / 1_000_000; millones > 0 {
+		if millones == 1 {
+			partes = append(partes, "UN MILLÓN")
+		} else {
+			partes = append(partes, miles(millones, true)+" MILLONES")
+		}
+	}
+	if resto := n % 1_000_000; resto > 0 {
+		partes = append(partes, miles(resto, false))
+	}
+	return strings.Join(partes, " "), nil
+}
+
+// miles expresa un número menor a un millón. Con apocope, el número termina en
+// "UN" en lugar de "UNO" porque precede a un sustantivo ("VEINTIÚN MILLONES").
+func miles(n int64, apocope bool) string {
+	var partes []string
+	if m := n / 1000; m > 0 {
+		if m == 1 {
+			partes = append(partes, "MIL")
+		} else {
+			partes = append(partes, cientos(m, true)+" MIL")
+		}
+	}
+	if resto := n % 1000; resto > 0 {
+		partes = append(partes, cientos(resto, apocope))
+	}
+	return strings.Join(partes, " ")
+}
+
+// cientos expresa un número entre 1 y 999
+func cientos(n int64, apocope bool) string {
+	if n == 100 {
+		return "CIEN"
+	}
+
+	var partes []string
+	if c := n / 100; c > 0 {
+		partes = append(partes, centenas[c])
+	}
+	if resto := n % 100; resto > 0 {
+		partes = append(partes, decenasYUnidades(resto, apocope))
+	}
+	return strings.Join(partes, " ")
+}
+
+// decenasYUnidades expresa un número entre 1 y 99
+func decenasYUnidades(n int64, apocope bool) string {
+	var texto string
+	switch {
+	case n < 30:
+		texto = unidades[n]
+	case n%10 == 0:
+		texto = decenas[n/10]
+	default:
+		texto = decenas[n/10] + " Y " + unidades[n%10]
+	}
+
+	if apocope && n%10 == 1 && n != 11 {
+		if n == 21 {
+			return "VEINTIÚN"
+		}
+		return strings.TrimSuffix(texto, "UNO") + "UN"
+	}
+	return texto
+}
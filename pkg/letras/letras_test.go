@@ -0,0 +1,56 @@
+package letras
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMonto(t *testing.T) {
+	tests := []struct {
+		valor  float64
+		moneda string
+		texto  string
+	}{
+		{0, "PEN", "CERO CON 00/100 SOLES"},
+		{1, "PEN", "UNO CON 00/100 SOLES"},
+		{21, "PEN", "VEINTIUNO CON 00/100 SOLES"},
+		{100, "PEN", "CIEN CON 00/100 SOLES"},
+		{101, "PEN", "CIENTO UNO CON 00/100 SOLES"},
+		{1000, "PEN", "MIL CON 00/100 SOLES"},
+		{1001, "PEN", "MIL UNO CON 00/100 SOLES"},
+		{21_000, "PEN", "VEINTIÚN MIL CON 00/100 SOLES"},
+		{21_000_000, "PEN", "VEINTIÚN MILLONES CON 00/100 SOLES"},
+		{1_001_000_000, "PEN", "MIL UN MILLONES CON 00/100 SOLES"},
+		{1_000_000, "PEN", "UN MILLÓN CON 00/100 SOLES"},
+		{0.005, "PEN", "CERO CON 01/100 SOLES"},
+		{0.004, "PEN", "CERO CON 00/100 SOLES"},
+		{1234.5, "PEN", "MIL DOSCIENTOS TREINTA Y CUATRO CON 50/100 SOLES"},
+		{99.999, "PEN", "CIEN CON 00/100 SOLES"},
+		{236, "USD", "DOSCIENTOS TREINTA Y SEIS CON 00/100 DÓLARES AMERICANOS"},
+		{15.75, "EUR", "QUINCE CON 75/100 EUROS"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.texto, func(t *testing.T) {
+			texto, err := Monto(tt.valor, tt.moneda)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.texto, texto)
+		})
+	}
+}
+
+func TestMontoInvalido(t *testing.T) {
+	for _, valor := range []float64{-1, math.NaN(), math.Inf(1), 1_000_000_000_000} {
+		_, err := Monto(valor, "PEN")
+		assert.Error(t, err, "valor %v", valor)
+	}
+}
+
+func TestNombreMoneda(t *testing.T) {
+	assert.Equal(t, "SOLES", NombreMoneda("PEN"))
+	assert.Equal(t, "DÓLARES AMERICANOS", NombreMoneda("USD"))
+	assert.Equal(t, "EUROS", NombreMoneda("EUR"))
+	assert.Equal(t, "XYZ", NombreMoneda("XYZ"))
+}
@@ -158,12 +158,6 @@ func (c *Client) DownloadCDR(request *GetCDRRequest) (*http.Response, error) {
 	return c.sendSOAPRequest(envelope, "getStatusCdr")
 }
 
-// ValidateRUC valida un RUC (funcionalidad extendida)
-func (c *Client) ValidateRUC(ruc string) (*http.Response, error) {
-	// TODO: Implementar integración real con endpoint de SUNAT para validación de RUC
-	return nil, fmt.Errorf("validación de RUC no implementada aún")
-}
-
 // TestConnection prueba la conectividad con SUNAT
 func (c *Client) TestConnection(request *http.Request) (*http.Response, error) {
 	// Crear un request simple para probar conectividad
@@ -256,7 +250,11 @@ func (c *Client) ParseSOAPResponse(resp *http.Response) (*SOAPResponse, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error leyendo respuesta: %v", err)
 	}
+	return c.ParseSOAPBody(body)
+}
 
+// ParseSOAPBody parsea el cuerpo ya leído de una respuesta SOAP de SUNAT
+func (c *Client) ParseSOAPBody(body []byte) (*SOAPResponse, error) {
 	var soapResp SOAPResponse
 	if err := xml.Unmarshal(body, &soapResp); err != nil {
 		return nil, fmt.Errorf("error parseando respuesta SOAP: %v", err)
@@ -0,0 +1,1114 @@
+package xsd
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// EspacioXSD es el espacio de nombres de XML Schema 1.0
+const EspacioXSD = "http://www.w3.org/2001/XMLSchema"
+
+// espacioXML es el espacio de nombres del prefijo xml, declarado implícitamente en todo documento
+const espacioXML = "http://www.w3.org/XML/1998/namespace"
+
+// Esquema es un conjunto compilado de documentos XSD. Soporta el subconjunto de
+// XML Schema 1.0 que usan UBL 2.1, sus módulos de firma (xmldsig, XAdES) y las
+// extensiones SUNAT: declaraciones globales, referencias entre espacios de
+// nombres, xsd:sequence, xsd:choice, xsd:all, xsd:group, xsd:any, cardinalidad,
+// simpleContent y complexContent por extensión o restricción, atributos,
+// grupos de atributos, xsd:anyAttribute y tipos simples por restricción, lista
+// o unión. Las facetas que no se reconocen se ignoran.
+type Esquema struct {
+	elementos       map[xml.Name]*elemento
+	complejos       map[xml.Name]*tipoComplejo
+	simples         map[xml.Name]*tipoSimple
+	atributos       map[xml.Name]*atributo
+	grupos          map[xml.Name]*particula
+	gruposAtributos map[xml.Name]*grupoAtributos
+	prefijos        map[string]string
+
+	// tipos contiene todos los tipos complejos compilados, incluidos los anónimos
+	tipos []*tipoComplejo
+}
+
+type elemento struct {
+	nombre   xml.Name
+	tipo     xml.Name
+	complejo *tipoComplejo
+	simple   *tipoSimple
+}
+
+type clase int
+
+const (
+	claseElemento clase = iota
+	claseSecuencia
+	claseEleccion
+	claseTodos
+	claseAny
+	claseGrupo
+)
+
+const ilimitado = -1
+
+type particula struct {
+	clase    clase
+	min, max int
+	elemento *elemento
+	ref      xml.Name
+	hijos    []*particula
+	espacios string
+	destino  string
+	proceso  string
+}
+
+type tipoComplejo struct {
+	nombre            xml.Name
+	contenido         *particula
+	mixto             bool
+	simple            bool
+	complejo          bool
+	texto             xml.Name
+	base              xml.Name
+	extension         bool
+	atributos         map[xml.Name]*atributo
+	gruposAtributos   []xml.Name
+	cualquierAtributo bool
+	resuelto          bool
+}
+
+type atributo struct {
+	nombre    xml.Name
+	tipo      xml.Name
+	simple    *tipoSimple
+	ref       bool
+	requerido bool
+	prohibido bool
+}
+
+type grupoAtributos struct {
+	atributos         []*atributo
+	grupos            []xml.Name
+	cualquierAtributo bool
+}
+
+type variedad int
+
+const (
+	variedadRestriccion variedad = iota
+	variedadLista
+	variedadUnion
+)
+
+type tipoSimple struct {
+	nombre      xml.Name
+	variedad    variedad
+	base        xml.Name
+	baseSimple  *tipoSimple
+	miembros    []xml.Name
+	anonimos    []*tipoSimple
+	enumeracion []string
+	patrones    []*regexp.Regexp
+	longitud    *int
+	minLongitud *int
+	maxLongitud *int
+}
+
+// documentoPendiente es un documento XSD por compilar; destino es el espacio de
+// nombres que hereda un documento incluido que no declara targetNamespace
+type documentoPendiente struct {
+	archivo string
+	destino string
+}
+
+// Cargar compila los documentos XSD de fsys que coinciden con patron y los que
+// estos importan o incluyen. Ver CargarDocumentos.
+func Cargar(fsys fs.FS, patron string) (*Esquema, error) {
+	archivos, err := fs.Glob(fsys, patron)
+	if err != nil {
+		return nil, fmt.Errorf("patrón de esquemas inválido: %v", err)
+	}
+	if len(archivos) == 0 {
+		return nil, fmt.Errorf("no se encontraron esquemas XSD para %s", patron)
+	}
+	return CargarDocumentos(fsys, archivos...)
+}
+
+// CargarDocumentos compila los documentos XSD indicados y, siguiendo su
+// schemaLocation como ruta relativa al documento, los que importan o incluyen.
+// Las ubicaciones remotas (http://...) no se descargan: el espacio de nombres
+// debe estar cubierto por otro documento cargado. Las referencias entre
+// documentos se resuelven por espacio de nombres.
+func CargarDocumentos(fsys fs.FS, raices ...string) (*Esquema, error) {
+	esquema := &Esquema{
+		elementos:       make(map[xml.Name]*elemento),
+		complejos:       make(map[xml.Name]*tipoComplejo),
+		simples:         make(map[xml.Name]*tipoSimple),
+		atributos:       make(map[xml.Name]*atributo),
+		grupos:          make(map[xml.Name]*particula),
+		gruposAtributos: make(map[xml.Name]*grupoAtributos),
+		prefijos:        make(map[string]string),
+	}
+
+	cargados := make(map[string]bool)
+	var pendientes []documentoPendiente
+	for _, raiz := range raices {
+		pendientes = append(pendientes, documentoPendiente{archivo: path.Clean(raiz)})
+	}
+	for len(pendientes) > 0 {
+		actual := pendientes[0]
+		pendientes = pendientes[1:]
+		if cargados[actual.archivo] {
+			continue
+		}
+		cargados[actual.archivo] = true
+
+		data, err := fs.ReadFile(fsys, actual.archivo)
+		if err != nil {
+			return nil, fmt.Errorf("error leyendo esquema %s: %v", actual.archivo, err)
+		}
+		referencias, err := esquema.compilar(data, actual.destino)
+		if err != nil {
+			return nil, fmt.Errorf("error compilando esquema %s: %v", path.Base(actual.archivo), err)
+		}
+		for _, referencia := range referencias {
+			if referencia.archivo == "" || strings.Contains(referencia.archivo, "://") {
+				continue
+			}
+			referencia.archivo = path.Join(path.Dir(actual.archivo), referencia.archivo)
+			pendientes = append(pendientes, referencia)
+		}
+	}
+
+	if err := esquema.resolver(); err != nil {
+		return nil, err
+	}
+	if err := esquema.verificarReferencias(); err != nil {
+		return nil, err
+	}
+	return esquema, nil
+}
+
+// Documento XSD tal como se lee del archivo
+
+type xsdSchema struct {
+	TargetNamespace      string              `xml:"targetNamespace,attr"`
+	ElementFormDefault   string              `xml:"elementFormDefault,attr"`
+	AttributeFormDefault string              `xml:"attributeFormDefault,attr"`
+	Atributos            []xml.Attr          `xml:",any,attr"`
+	Importaciones        []xsdReferencia     `xml:"import"`
+	Inclusiones          []xsdReferencia     `xml:"include"`
+	Redefiniciones       []xsdReferencia     `xml:"redefine"`
+	Elementos            []xsdParticula      `xml:"element"`
+	Complejos            []xsdComplexType    `xml:"complexType"`
+	Simples              []xsdSimpleType     `xml:"simpleType"`
+	AtributosGlobales    []xsdAttribute      `xml:"attribute"`
+	Grupos               []xsdGrupo          `xml:"group"`
+	GruposAtributos      []xsdGrupoAtributos `xml:"attributeGroup"`
+}
+
+type xsdReferencia struct {
+	Namespace      string `xml:"namespace,attr"`
+	SchemaLocation string `xml:"schemaLocation,attr"`
+}
+
+type xsdParticula struct {
+	Clase           string
+	Name            string
+	Ref             string
+	Type            string
+	Form            string
+	MinOccurs       string
+	MaxOccurs       string
+	Namespace       string
+	ProcessContents string
+	ComplexType     *xsdComplexType
+	SimpleType      *xsdSimpleType
+	Hijos           []xsdParticula
+}
+
+type xsdGrupo struct {
+	Name     string        `xml:"name,attr"`
+	Sequence *xsdParticula `xml:"sequence"`
+	Choice   *xsdParticula `xml:"choice"`
+	All      *xsdParticula `xml:"all"`
+}
+
+type xsdComplexType struct {
+	Name           string              `xml:"name,attr"`
+	Mixed          string              `xml:"mixed,attr"`
+	Sequence       *xsdParticula       `xml:"sequence"`
+	Choice         *xsdParticula       `xml:"choice"`
+	All            *xsdParticula       `xml:"all"`
+	Group          *xsdParticula       `xml:"group"`
+	SimpleContent  *xsdContenido       `xml:"simpleContent"`
+	ComplexContent *xsdContenido       `xml:"complexContent"`
+	Atributos      []xsdAttribute      `xml:"attribute"`
+	GruposAtributo []xsdGrupoAtributos `xml:"attributeGroup"`
+	AnyAttribute   *xsdReferencia      `xml:"anyAttribute"`
+}
+
+type xsdContenido struct {
+	Mixed       string         `xml:"mixed,attr"`
+	Extension   *xsdDerivacion `xml:"extension"`
+	Restriction *xsdDerivacion `xml:"restriction"`
+}
+
+type xsdDerivacion struct {
+	Base           string              `xml:"base,attr"`
+	SimpleType     *xsdSimpleType      `xml:"simpleType"`
+	Sequence       *xsdParticula       `xml:"sequence"`
+	Choice         *xsdParticula       `xml:"choice"`
+	All            *xsdParticula       `xml:"all"`
+	Group          *xsdParticula       `xml:"group"`
+	Atributos      []xsdAttribute      `xml:"attribute"`
+	GruposAtributo []xsdGrupoAtributos `xml:"attributeGroup"`
+	AnyAttribute   *xsdReferencia      `xml:"anyAttribute"`
+	Enumeracion    []xsdFaceta         `xml:"enumeration"`
+	Patrones       []xsdFaceta         `xml:"pattern"`
+	Longitud       *xsdFaceta          `xml:"length"`
+	MinLongitud    *xsdFaceta          `xml:"minLength"`
+	MaxLongitud    *xsdFaceta          `xml:"maxLength"`
+}
+
+type xsdSimpleType struct {
+	Name        string         `xml:"name,attr"`
+	Restriction *xsdDerivacion `xml:"restriction"`
+	List        *xsdLista      `xml:"list"`
+	Union       *xsdUnion      `xml:"union"`
+}
+
+type xsdLista struct {
+	ItemType   string         `xml:"itemType,attr"`
+	SimpleType *xsdSimpleType `xml:"simpleType"`
+}
+
+type xsdUnion struct {
+	MemberTypes string          `xml:"memberTypes,attr"`
+	SimpleTypes []xsdSimpleType `xml:"simpleType"`
+}
+
+type xsdAttribute struct {
+	Name       string         `xml:"name,attr"`
+	Ref        string         `xml:"ref,attr"`
+	Type       string         `xml:"type,attr"`
+	Use        string         `xml:"use,attr"`
+	Form       string         `xml:"form,attr"`
+	SimpleType *xsdSimpleType `xml:"simpleType"`
+}
+
+type xsdGrupoAtributos struct {
+	Name           string              `xml:"name,attr"`
+	Ref            string              `xml:"ref,attr"`
+	Atributos      []xsdAttribute      `xml:"attribute"`
+	GruposAtributo []xsdGrupoAtributos `xml:"attributeGroup"`
+	AnyAttribute   *xsdReferencia      `xml:"anyAttribute"`
+}
+
+type xsdFaceta struct {
+	Value string `xml:"value,attr"`
+}
+
+// UnmarshalXML conserva el orden de las partículas de un modelo de contenido
+func (p *xsdParticula) UnmarshalXML(d *xml.Decoder, inicio xml.StartElement) error {
+	p.Clase = inicio.Name.Local
+	for _, attr := range inicio.Attr {
+		switch attr.Name.Local {
+		case "name":
+			p.Name = attr.Value
+		case "ref":
+			p.Ref = attr.Value
+		case "type":
+			p.Type = attr.Value
+		case "form":
+			p.Form = attr.Value
+		case "minOccurs":
+			p.MinOccurs = attr.Value
+		case "maxOccurs":
+			p.MaxOccurs = attr.Value
+		case "namespace":
+			p.Namespace = attr.Value
+		case "processContents":
+			p.ProcessContents = attr.Value
+		}
+	}
+
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "element", "sequence", "choice", "all", "group", "any":
+				var hijo xsdParticula
+				if err := d.DecodeElement(&hijo, &t); err != nil {
+					return err
+				}
+				p.Hijos = append(p.Hijos, hijo)
+			case "complexType":
+				p.ComplexType = &xsdComplexType{}
+				if err := d.DecodeElement(p.ComplexType, &t); err != nil {
+					return err
+				}
+			case "simpleType":
+				p.SimpleType = &xsdSimpleType{}
+				if err := d.DecodeElement(p.SimpleType, &t); err != nil {
+					return err
+				}
+			default:
+				if err := d.Skip(); err != nil {
+					return err
+				}
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// declaracionEntidad reconoce las entidades generales del subconjunto interno
+// de la DTD, como las que declara el esquema xmldsig
+var declaracionEntidad = regexp.MustCompile(`<!ENTITY\s+([A-Za-z_][\w.-]*)\s+(?:"([^"]*)"|'([^']*)')\s*>`)
+
+func entidadesDTD(data []byte) map[string]string {
+	entidades := make(map[string]string)
+	for _, m := range declaracionEntidad.FindAllSubmatch(data, -1) {
+		entidades[string(m[1])] = string(m[2]) + string(m[3])
+	}
+	return entidades
+}
+
+// compilador mantiene el contexto de un documento XSD durante su compilación
+type compilador struct {
+	esquema              *Esquema
+	destino              string
+	calificado           bool
+	atributosCalificados bool
+	espacios             map[string]string
+}
+
+// compilar agrega las declaraciones del documento al esquema y retorna los
+// documentos que importa o incluye
+func (e *Esquema) compilar(data []byte, destinoIncluido string) ([]documentoPendiente, error) {
+	var doc xsdSchema
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Entity = entidadesDTD(data)
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Redefiniciones) > 0 {
+		return nil, fmt.Errorf("xsd:redefine no está soportado")
+	}
+
+	c := &compilador{
+		esquema:              e,
+		destino:              doc.TargetNamespace,
+		calificado:           doc.ElementFormDefault == "qualified",
+		atributosCalificados: doc.AttributeFormDefault == "qualified",
+		espacios:             map[string]string{"xml": espacioXML},
+	}
+	if c.destino == "" {
+		c.destino = destinoIncluido
+	}
+	for _, attr := range doc.Atributos {
+		switch {
+		case attr.Name.Space == "xmlns":
+			c.espacios[attr.Name.Local] = attr.Value
+			if _, ok := e.prefijos[attr.Value]; !ok && attr.Value != EspacioXSD {
+				e.prefijos[attr.Value] = attr.Name.Local
+			}
+		case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+			c.espacios[""] = attr.Value
+		}
+	}
+
+	for _, ct := range doc.Complejos {
+		tc, err := c.complejo(ct)
+		if err != nil {
+			return nil, err
+		}
+		e.complejos[tc.nombre] = tc
+	}
+	for _, st := range doc.Simples {
+		ts, err := c.simple(st)
+		if err != nil {
+			return nil, err
+		}
+		e.simples[ts.nombre] = ts
+	}
+	for _, xe := range doc.Elementos {
+		el, err := c.elemento(xe, true)
+		if err != nil {
+			return nil, err
+		}
+		e.elementos[el.nombre] = el
+	}
+	for _, xa := range doc.AtributosGlobales {
+		attr, err := c.atributo(xa, true)
+		if err != nil {
+			return nil, err
+		}
+		e.atributos[attr.nombre] = attr
+	}
+	for _, xg := range doc.Grupos {
+		var contenido *xsdParticula
+		switch {
+		case xg.Sequence != nil:
+			contenido = xg.Sequence
+		case xg.Choice != nil:
+			contenido = xg.Choice
+		case xg.All != nil:
+			contenido = xg.All
+		default:
+			return nil, fmt.Errorf("el grupo %s no declara contenido", xg.Name)
+		}
+		p, err := c.particula(*contenido)
+		if err != nil {
+			return nil, err
+		}
+		e.grupos[xml.Name{Space: c.destino, Local: xg.Name}] = p
+	}
+	for _, xg := range doc.GruposAtributos {
+		grupo := &grupoAtributos{}
+		if err := c.declararAtributos(xg.Atributos, xg.GruposAtributo, xg.AnyAttribute, func(attr *atributo) {
+			grupo.atributos = append(grupo.atributos, attr)
+		}, &grupo.grupos, &grupo.cualquierAtributo); err != nil {
+			return nil, err
+		}
+		e.gruposAtributos[xml.Name{Space: c.destino, Local: xg.Name}] = grupo
+	}
+
+	var referencias []documentoPendiente
+	for _, imp := range doc.Importaciones {
+		referencias = append(referencias, documentoPendiente{archivo: imp.SchemaLocation})
+	}
+	for _, inc := range doc.Inclusiones {
+		referencias = append(referencias, documentoPendiente{archivo: inc.SchemaLocation, destino: c.destino})
+	}
+	return referencias, nil
+}
+
+// qname resuelve un nombre calificado del esquema (por ejemplo cbc:IDType)
+func (c *compilador) qname(valor string) (xml.Name, error) {
+	valor = strings.TrimSpace(valor)
+	prefijo, local := "", valor
+	if i := strings.Index(valor, ":"); i >= 0 {
+		prefijo, local = valor[:i], valor[i+1:]
+	}
+	espacio, ok := c.espacios[prefijo]
+	if !ok {
+		return xml.Name{}, fmt.Errorf("prefijo %q no declarado en %s", prefijo, valor)
+	}
+	return xml.Name{Space: espacio, Local: local}, nil
+}
+
+func (c *compilador) elemento(xe xsdParticula, global bool) (*elemento, error) {
+	el := &elemento{nombre: xml.Name{Local: xe.Name}}
+	if global || xe.Form == "qualified" || (xe.Form == "" && c.calificado) {
+		el.nombre.Space = c.destino
+	}
+
+	var err error
+	switch {
+	case xe.Type != "":
+		el.tipo, err = c.qname(xe.Type)
+	case xe.ComplexType != nil:
+		el.complejo, err = c.complejo(*xe.ComplexType)
+	case xe.SimpleType != nil:
+		el.simple, err = c.simple(*xe.SimpleType)
+	default:
+		el.tipo = xml.Name{Space: EspacioXSD, Local: "anyType"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return el, nil
+}
+
+func (c *compilador) particula(xp xsdParticula) (*particula, error) {
+	p := &particula{min: 1, max: 1}
+	if xp.MinOccurs != "" {
+		n, err := strconv.Atoi(xp.MinOccurs)
+		if err != nil {
+			return nil, fmt.Errorf("minOccurs inválido %q", xp.MinOccurs)
+		}
+		p.min = n
+	}
+	if xp.MaxOccurs == "unbounded" {
+		p.max = ilimitado
+	} else if xp.MaxOccurs != "" {
+		n, err := strconv.Atoi(xp.MaxOccurs)
+		if err != nil {
+			return nil, fmt.Errorf("maxOccurs inválido %q", xp.MaxOccurs)
+		}
+		p.max = n
+	}
+
+	switch xp.Clase {
+	case "element":
+		p.clase = claseElemento
+		if xp.Ref != "" {
+			ref, err := c.qname(xp.Ref)
+			if err != nil {
+				return nil, err
+			}
+			p.ref = ref
+			return p, nil
+		}
+		el, err := c.elemento(xp, false)
+		if err != nil {
+			return nil, err
+		}
+		p.elemento = el
+		p.ref = el.nombre
+	case "group":
+		p.clase = claseGrupo
+		ref, err := c.qname(xp.Ref)
+		if err != nil {
+			return nil, err
+		}
+		p.ref = ref
+	case "sequence", "choice", "all":
+		switch xp.Clase {
+		case "sequence":
+			p.clase = claseSecuencia
+		case "choice":
+			p.clase = claseEleccion
+		default:
+			p.clase = claseTodos
+		}
+		for _, hijo := range xp.Hijos {
+			ph, err := c.particula(hijo)
+			if err != nil {
+				return nil, err
+			}
+			p.hijos = append(p.hijos, ph)
+		}
+	case "any":
+		p.clase = claseAny
+		p.espacios = xp.Namespace
+		if p.espacios == "" {
+			p.espacios = "##any"
+		}
+		p.destino = c.destino
+		p.proceso = xp.ProcessContents
+		if p.proceso == "" {
+			p.proceso = "strict"
+		}
+	default:
+		return nil, fmt.Errorf("partícula %s no soportada", xp.Clase)
+	}
+	return p, nil
+}
+
+// modelo compila el modelo de contenido declarado con sequence, choice, all o group
+func (c *compilador) modelo(candidatos ...*xsdParticula) (*particula, error) {
+	for _, candidato := range candidatos {
+		if candidato != nil {
+			return c.particula(*candidato)
+		}
+	}
+	return nil, nil
+}
+
+func (c *compilador) complejo(ct xsdComplexType) (*tipoComplejo, error) {
+	tc := &tipoComplejo{
+		nombre:    xml.Name{Space: c.destino, Local: ct.Name},
+		mixto:     ct.Mixed == "true",
+		atributos: make(map[xml.Name]*atributo),
+	}
+	c.esquema.tipos = append(c.esquema.tipos, tc)
+
+	var err error
+	switch {
+	case ct.SimpleContent != nil:
+		tc.simple = true
+		derivacion := c.derivacion(tc, ct.SimpleContent)
+		if derivacion == nil {
+			return nil, fmt.Errorf("simpleContent sin derivación en %s", ct.Name)
+		}
+		tc.base, err = c.qname(derivacion.Base)
+		if err == nil {
+			err = c.atributosDerivacion(tc, derivacion)
+		}
+	case ct.ComplexContent != nil:
+		tc.complejo = true
+		if ct.ComplexContent.Mixed == "true" {
+			tc.mixto = true
+		}
+		derivacion := c.derivacion(tc, ct.ComplexContent)
+		if derivacion == nil {
+			return nil, fmt.Errorf("complexContent sin derivación en %s", ct.Name)
+		}
+		tc.base, err = c.qname(derivacion.Base)
+		if err == nil {
+			tc.contenido, err = c.modelo(derivacion.Sequence, derivacion.Choice, derivacion.All, derivacion.Group)
+		}
+		if err == nil {
+			err = c.atributosDerivacion(tc, derivacion)
+		}
+	default:
+		tc.contenido, err = c.modelo(ct.Sequence, ct.Choice, ct.All, ct.Group)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := c.declararAtributos(ct.Atributos, ct.GruposAtributo, ct.AnyAttribute, func(attr *atributo) {
+		tc.atributos[attr.nombre] = attr
+	}, &tc.gruposAtributos, &tc.cualquierAtributo); err != nil {
+		return nil, err
+	}
+	return tc, nil
+}
+
+// derivacion retorna la extensión o restricción de un simpleContent o complexContent
+func (c *compilador) derivacion(tc *tipoComplejo, contenido *xsdContenido) *xsdDerivacion {
+	if contenido.Extension != nil {
+		tc.extension = true
+		return contenido.Extension
+	}
+	return contenido.Restriction
+}
+
+func (c *compilador) atributosDerivacion(tc *tipoComplejo, derivacion *xsdDerivacion) error {
+	return c.declararAtributos(derivacion.Atributos, derivacion.GruposAtributo, derivacion.AnyAttribute, func(attr *atributo) {
+		tc.atributos[attr.nombre] = attr
+	}, &tc.gruposAtributos, &tc.cualquierAtributo)
+}
+
+// declararAtributos compila los atributos, las referencias a grupos de
+// atributos y el xsd:anyAttribute de un tipo o grupo
+func (c *compilador) declararAtributos(xas []xsdAttribute, grupos []xsdGrupoAtributos, cualquiera *xsdReferencia,
+	agregar func(*atributo), refs *[]xml.Name, cualquierAtributo *bool) error {
+	for _, xa := range xas {
+		attr, err := c.atributo(xa, false)
+		if err != nil {
+			return err
+		}
+		agregar(attr)
+	}
+	for _, xg := range grupos {
+		ref, err := c.qname(xg.Ref)
+		if err != nil {
+			return err
+		}
+		*refs = append(*refs, ref)
+	}
+	if cualquiera != nil {
+		*cualquierAtributo = true
+	}
+	return nil
+}
+
+func (c *compilador) atributo(xa xsdAttribute, global bool) (*atributo, error) {
+	attr := &atributo{
+		tipo:      xml.Name{Space: EspacioXSD, Local: "anySimpleType"},
+		requerido: xa.Use == "required",
+		prohibido: xa.Use == "prohibited",
+	}
+	if xa.Ref != "" {
+		ref, err := c.qname(xa.Ref)
+		if err != nil {
+			return nil, err
+		}
+		attr.nombre = ref
+		attr.ref = true
+		return attr, nil
+	}
+
+	attr.nombre = xml.Name{Local: xa.Name}
+	if global || xa.Form == "qualified" || (xa.Form == "" && c.atributosCalificados) {
+		attr.nombre.Space = c.destino
+	}
+	switch {
+	case xa.Type != "":
+		tipo, err := c.qname(xa.Type)
+		if err != nil {
+			return nil, err
+		}
+		attr.tipo = tipo
+	case xa.SimpleType != nil:
+		ts, err := c.simple(*xa.SimpleType)
+		if err != nil {
+			return nil, err
+		}
+		attr.simple = ts
+	}
+	return attr, nil
+}
+
+func (c *compilador) simple(st xsdSimpleType) (*tipoSimple, error) {
+	ts := &tipoSimple{nombre: xml.Name{Space: c.destino, Local: st.Name}}
+
+	switch {
+	case st.List != nil:
+		ts.variedad = variedadLista
+		if st.List.SimpleType != nil {
+			item, err := c.simple(*st.List.SimpleType)
+			if err != nil {
+				return nil, err
+			}
+			ts.baseSimple = item
+			return ts, nil
+		}
+		item, err := c.qname(st.List.ItemType)
+		if err != nil {
+			return nil, err
+		}
+		ts.base = item
+		return ts, nil
+
+	case st.Union != nil:
+		ts.variedad = variedadUnion
+		for _, miembro := range strings.Fields(st.Union.MemberTypes) {
+			tipo, err := c.qname(miembro)
+			if err != nil {
+				return nil, err
+			}
+			ts.miembros = append(ts.miembros, tipo)
+		}
+		for _, anonimo := range st.Union.SimpleTypes {
+			miembro, err := c.simple(anonimo)
+			if err != nil {
+				return nil, err
+			}
+			ts.anonimos = append(ts.anonimos, miembro)
+		}
+		return ts, nil
+
+	case st.Restriction == nil:
+		return nil, fmt.Errorf("el tipo simple %s debe derivarse por restricción, lista o unión", st.Name)
+	}
+
+	restriccion := st.Restriction
+	if restriccion.SimpleType != nil {
+		base, err := c.simple(*restriccion.SimpleType)
+		if err != nil {
+			return nil, err
+		}
+		ts.baseSimple = base
+	} else {
+		base, err := c.qname(restriccion.Base)
+		if err != nil {
+			return nil, err
+		}
+		ts.base = base
+	}
+
+	for _, faceta := range restriccion.Enumeracion {
+		ts.enumeracion = append(ts.enumeracion, faceta.Value)
+	}
+	for _, faceta := range restriccion.Patrones {
+		patron, err := regexp.Compile("^(?:" + faceta.Value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("patrón inválido en %s: %v", st.Name, err)
+		}
+		ts.patrones = append(ts.patrones, patron)
+	}
+	facetas := []struct {
+		origen  *xsdFaceta
+		destino **int
+	}{
+		{restriccion.Longitud, &ts.longitud},
+		{restriccion.MinLongitud, &ts.minLongitud},
+		{restriccion.MaxLongitud, &ts.maxLongitud},
+	}
+	for _, f := range facetas {
+		if f.origen == nil {
+			continue
+		}
+		n, err := strconv.Atoi(f.origen.Value)
+		if err != nil {
+			return nil, fmt.Errorf("faceta de longitud inválida en %s", st.Name)
+		}
+		*f.destino = &n
+	}
+	return ts, nil
+}
+
+// resolver completa lo que solo se conoce con todos los documentos cargados:
+// referencias a grupos y a atributos globales, y la herencia de los tipos derivados
+func (e *Esquema) resolver() error {
+	for _, grupo := range e.grupos {
+		if err := e.resolverGrupos(grupo, 0); err != nil {
+			return err
+		}
+	}
+	for _, tc := range e.tipos {
+		if err := e.resolverGrupos(tc.contenido, 0); err != nil {
+			return err
+		}
+	}
+	for _, tc := range e.tipos {
+		if err := e.resolverComplejo(tc, 0); err != nil {
+			return err
+		}
+	}
+	for _, tc := range e.tipos {
+		for _, attr := range tc.atributos {
+			if err := e.resolverAtributo(attr); err != nil {
+				return fmt.Errorf("tipo %s: %v", tc.nombre.Local, err)
+			}
+		}
+	}
+	return nil
+}
+
+// resolverGrupos reemplaza cada referencia xsd:group por el contenido del grupo,
+// conservando la cardinalidad de la referencia
+func (e *Esquema) resolverGrupos(p *particula, profundidad int) error {
+	if p == nil {
+		return nil
+	}
+	if profundidad > 32 {
+		return fmt.Errorf("referencia circular entre grupos")
+	}
+	if p.clase == claseGrupo {
+		grupo, ok := e.grupos[p.ref]
+		if !ok {
+			return fmt.Errorf("grupo no declarado {%s}%s", p.ref.Space, p.ref.Local)
+		}
+		if err := e.resolverGrupos(grupo, profundidad+1); err != nil {
+			return err
+		}
+		p.clase = grupo.clase
+		p.hijos = grupo.hijos
+		return nil
+	}
+	for _, hijo := range p.hijos {
+		if err := e.resolverGrupos(hijo, profundidad+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolverAtributo toma el tipo de un atributo global referenciado. Los
+// atributos del espacio xml (xml:lang, xml:space) se admiten sin declararlos.
+func (e *Esquema) resolverAtributo(attr *atributo) error {
+	if !attr.ref {
+		return nil
+	}
+	global, ok := e.atributos[attr.nombre]
+	if !ok {
+		if attr.nombre.Space == espacioXML {
+			return nil
+		}
+		return fmt.Errorf("atributo no declarado {%s}%s", attr.nombre.Space, attr.nombre.Local)
+	}
+	attr.tipo = global.tipo
+	attr.simple = global.simple
+	return nil
+}
+
+// agregarGrupoAtributos incorpora al tipo los atributos de un grupo y de los grupos que este referencia
+func (e *Esquema) agregarGrupoAtributos(tc *tipoComplejo, ref xml.Name, profundidad int) error {
+	if profundidad > 32 {
+		return fmt.Errorf("referencia circular entre grupos de atributos")
+	}
+	grupo, ok := e.gruposAtributos[ref]
+	if !ok {
+		return fmt.Errorf("grupo de atributos no declarado {%s}%s", ref.Space, ref.Local)
+	}
+	for _, attr := range grupo.atributos {
+		if _, ok := tc.atributos[attr.nombre]; !ok {
+			tc.atributos[attr.nombre] = attr
+		}
+	}
+	if grupo.cualquierAtributo {
+		tc.cualquierAtributo = true
+	}
+	for _, anidado := range grupo.grupos {
+		if err := e.agregarGrupoAtributos(tc, anidado, profundidad+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolverComplejo incorpora los grupos de atributos y hereda de la base de un
+// tipo derivado el tipo de texto (simpleContent), el modelo de contenido
+// (complexContent por extensión) y los atributos
+func (e *Esquema) resolverComplejo(tc *tipoComplejo, profundidad int) error {
+	if tc.resuelto {
+		return nil
+	}
+	if profundidad > 32 {
+		return fmt.Errorf("derivación circular en el tipo %s", tc.nombre.Local)
+	}
+	for _, ref := range tc.gruposAtributos {
+		if err := e.agregarGrupoAtributos(tc, ref, 0); err != nil {
+			return fmt.Errorf("tipo %s: %v", tc.nombre.Local, err)
+		}
+	}
+	tc.gruposAtributos = nil
+	if !tc.simple && !tc.complejo {
+		tc.resuelto = true
+		return nil
+	}
+
+	base, ok := e.complejos[tc.base]
+	if !ok {
+		// Base predefinida: un tipo simple de XML Schema o xsd:anyType
+		if tc.simple {
+			tc.texto = tc.base
+		}
+		tc.resuelto = true
+		return nil
+	}
+	if err := e.resolverComplejo(base, profundidad+1); err != nil {
+		return err
+	}
+
+	if tc.simple {
+		if !base.simple {
+			return fmt.Errorf("el tipo %s deriva de %s, que no tiene contenido simple", tc.nombre.Local, base.nombre.Local)
+		}
+		tc.texto = base.texto
+	} else if tc.extension {
+		tc.contenido = secuencia(base.contenido, tc.contenido)
+		tc.mixto = tc.mixto || base.mixto
+	}
+	if tc.extension {
+		tc.cualquierAtributo = tc.cualquierAtributo || base.cualquierAtributo
+	}
+
+	atributos := make(map[xml.Name]*atributo, len(base.atributos)+len(tc.atributos))
+	for nombre, attr := range base.atributos {
+		atributos[nombre] = attr
+	}
+	for nombre, attr := range tc.atributos {
+		if attr.prohibido {
+			delete(atributos, nombre)
+			continue
+		}
+		atributos[nombre] = attr
+	}
+	tc.atributos = atributos
+	tc.resuelto = true
+	return nil
+}
+
+// secuencia encadena el contenido de la base y el de la extensión
+func secuencia(base, extension *particula) *particula {
+	switch {
+	case base == nil:
+		return extension
+	case extension == nil:
+		return base
+	}
+	return &particula{clase: claseSecuencia, min: 1, max: 1, hijos: []*particula{base, extension}}
+}
+
+// verificarReferencias comprueba que toda referencia a elementos y tipos esté declarada
+func (e *Esquema) verificarReferencias() error {
+	verificarTipo := func(tipo xml.Name) error {
+		if tipo.Space == EspacioXSD {
+			return nil
+		}
+		if _, ok := e.complejos[tipo]; ok {
+			return nil
+		}
+		if _, ok := e.simples[tipo]; ok {
+			return nil
+		}
+		return fmt.Errorf("tipo no declarado {%s}%s", tipo.Space, tipo.Local)
+	}
+
+	var verificarSimple func(ts *tipoSimple) error
+	verificarSimple = func(ts *tipoSimple) error {
+		if ts == nil {
+			return nil
+		}
+		if ts.baseSimple != nil {
+			if err := verificarSimple(ts.baseSimple); err != nil {
+				return err
+			}
+		} else if ts.variedad != variedadUnion {
+			if err := verificarTipo(ts.base); err != nil {
+				return err
+			}
+		}
+		for _, miembro := range ts.miembros {
+			if err := verificarTipo(miembro); err != nil {
+				return err
+			}
+		}
+		for _, anonimo := range ts.anonimos {
+			if err := verificarSimple(anonimo); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var verificarParticula func(p *particula) error
+	verificarParticula = func(p *particula) error {
+		if p == nil {
+			return nil
+		}
+		if p.clase == claseElemento {
+			if p.elemento == nil {
+				if _, ok := e.elementos[p.ref]; !ok {
+					return fmt.Errorf("elemento no declarado {%s}%s", p.ref.Space, p.ref.Local)
+				}
+			} else if p.elemento.tipo.Local != "" {
+				if err := verificarTipo(p.elemento.tipo); err != nil {
+					return err
+				}
+			} else if err := verificarSimple(p.elemento.simple); err != nil {
+				return err
+			}
+		}
+		for _, hijo := range p.hijos {
+			if err := verificarParticula(hijo); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, el := range e.elementos {
+		if el.tipo.Local != "" {
+			if err := verificarTipo(el.tipo); err != nil {
+				return err
+			}
+		}
+		if err := verificarSimple(el.simple); err != nil {
+			return err
+		}
+	}
+	for _, tc := range e.tipos {
+		if err := verificarParticula(tc.contenido); err != nil {
+			return err
+		}
+		if tc.simple {
+			if err := verificarTipo(tc.texto); err != nil {
+				return err
+			}
+		}
+		for _, attr := range tc.atributos {
+			if attr.simple != nil {
+				if err := verificarSimple(attr.simple); err != nil {
+					return err
+				}
+			} else if err := verificarTipo(attr.tipo); err != nil {
+				return err
+			}
+		}
+	}
+	for _, ts := range e.simples {
+		if err := verificarSimple(ts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
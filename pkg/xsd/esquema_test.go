@@ -0,0 +1,323 @@
+package xsd
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// esquemasPrueba reproduce la organización de UBL en miniatura: un documento en
+// maindoc que importa módulos de common con rutas relativas
+var esquemasPrueba = fstest.MapFS{
+	"maindoc/Documento.xsd": {Data: []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<xsd:schema xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:doc="urn:prueba:doc"
+	xmlns:cac="urn:prueba:cac" xmlns:cbc="urn:prueba:cbc"
+	xmlns:ext="urn:oasis:names:specification:ubl:schema:xsd:CommonExtensionComponents-2"
+	targetNamespace="urn:prueba:doc" elementFormDefault="qualified">
+	<xsd:import namespace="urn:prueba:cac" schemaLocation="../common/agregados.xsd"/>
+	<xsd:import namespace="urn:prueba:cbc" schemaLocation="../common/basicos.xsd"/>
+	<xsd:import namespace="urn:oasis:names:specification:ubl:schema:xsd:CommonExtensionComponents-2" schemaLocation="../common/extensiones.xsd"/>
+	<xsd:import namespace="http://www.w3.org/XML/1998/namespace" schemaLocation="http://www.w3.org/2001/xml.xsd"/>
+	<xsd:element name="Documento" type="doc:DocumentoType"/>
+	<xsd:complexType name="DocumentoType">
+		<xsd:sequence>
+			<xsd:element ref="ext:UBLExtensions" minOccurs="0"/>
+			<xsd:element ref="cbc:ID"/>
+			<xsd:element ref="cbc:IssueDate"/>
+			<xsd:element ref="cbc:Note" minOccurs="0" maxOccurs="unbounded"/>
+			<xsd:element ref="cac:Party"/>
+			<xsd:element ref="cac:Datos" minOccurs="0"/>
+			<xsd:element ref="cac:Line" maxOccurs="unbounded"/>
+		</xsd:sequence>
+		<xsd:attribute ref="xml:lang"/>
+	</xsd:complexType>
+</xsd:schema>`)},
+	"common/extensiones.xsd": {Data: []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<xsd:schema xmlns:xsd="http://www.w3.org/2001/XMLSchema"
+	xmlns:ext="urn:oasis:names:specification:ubl:schema:xsd:CommonExtensionComponents-2"
+	targetNamespace="urn:oasis:names:specification:ubl:schema:xsd:CommonExtensionComponents-2" elementFormDefault="qualified">
+	<xsd:element name="UBLExtensions" type="ext:UBLExtensionsType"/>
+	<xsd:element name="ExtensionContent" type="ext:ExtensionContentType"/>
+	<xsd:complexType name="UBLExtensionsType">
+		<xsd:sequence>
+			<xsd:element ref="ext:ExtensionContent"/>
+		</xsd:sequence>
+	</xsd:complexType>
+	<xsd:complexType name="ExtensionContentType">
+		<xsd:sequence>
+			<xsd:any namespace="##other" processContents="skip"/>
+		</xsd:sequence>
+	</xsd:complexType>
+</xsd:schema>`)},
+	"common/agregados.xsd": {Data: []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<xsd:schema xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:cac="urn:prueba:cac" xmlns:cbc="urn:prueba:cbc"
+	targetNamespace="urn:prueba:cac" elementFormDefault="qualified">
+	<xsd:import namespace="urn:prueba:cbc" schemaLocation="basicos.xsd"/>
+	<xsd:element name="Party" type="cac:PartyType"/>
+	<xsd:element name="Line" type="cac:LineType"/>
+	<xsd:element name="Datos" type="cac:DatosType"/>
+	<xsd:group name="Identificacion">
+		<xsd:sequence>
+			<xsd:element ref="cbc:ID"/>
+		</xsd:sequence>
+	</xsd:group>
+	<xsd:complexType name="PartyType">
+		<xsd:sequence>
+			<xsd:group ref="cac:Identificacion"/>
+			<xsd:element ref="cbc:Note" minOccurs="0"/>
+		</xsd:sequence>
+		<xsd:anyAttribute namespace="##other" processContents="lax"/>
+	</xsd:complexType>
+	<xsd:complexType name="LineType">
+		<xsd:complexContent>
+			<xsd:extension base="cac:PartyType">
+				<xsd:sequence>
+					<xsd:element ref="cbc:Cantidad"/>
+					<xsd:element ref="cbc:Monto"/>
+				</xsd:sequence>
+			</xsd:extension>
+		</xsd:complexContent>
+	</xsd:complexType>
+	<xsd:complexType name="DatosType">
+		<xsd:all>
+			<xsd:element ref="cbc:Codigos" minOccurs="0"/>
+			<xsd:element ref="cbc:Vencimiento"/>
+		</xsd:all>
+	</xsd:complexType>
+</xsd:schema>`)},
+	// El espacio de nombres se declara con una entidad, como hace el esquema xmldsig
+	"common/basicos.xsd": {Data: []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xsd:schema [
+	<!ENTITY cbc "urn:prueba:cbc">
+]>
+<xsd:schema xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:cbc="&cbc;"
+	targetNamespace="&cbc;" elementFormDefault="qualified">
+	<xsd:include schemaLocation="montos.xsd"/>
+	<xsd:element name="ID" type="xsd:normalizedString"/>
+	<xsd:element name="IssueDate" type="xsd:date"/>
+	<xsd:element name="Note" type="xsd:string"/>
+	<xsd:element name="Codigos" type="cbc:CodigosType"/>
+	<xsd:element name="Vencimiento" type="cbc:VencimientoType"/>
+	<xsd:simpleType name="CodigosType">
+		<xsd:list itemType="xsd:integer"/>
+	</xsd:simpleType>
+	<xsd:simpleType name="VencimientoType">
+		<xsd:union memberTypes="xsd:date">
+			<xsd:simpleType>
+				<xsd:restriction base="xsd:string">
+					<xsd:enumeration value="PENDIENTE"/>
+				</xsd:restriction>
+			</xsd:simpleType>
+		</xsd:union>
+	</xsd:simpleType>
+</xsd:schema>`)},
+	"common/montos.xsd": {Data: []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<xsd:schema xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:cbc="urn:prueba:cbc"
+	targetNamespace="urn:prueba:cbc" elementFormDefault="qualified">
+	<xsd:element name="Cantidad" type="cbc:CantidadType"/>
+	<xsd:element name="Monto" type="cbc:MontoType"/>
+	<xsd:attribute name="moneda">
+		<xsd:simpleType>
+			<xsd:restriction base="xsd:string">
+				<xsd:enumeration value="PEN"/>
+				<xsd:enumeration value="USD"/>
+			</xsd:restriction>
+		</xsd:simpleType>
+	</xsd:attribute>
+	<xsd:attributeGroup name="Unidad">
+		<xsd:attribute name="unitCode" type="xsd:token" use="required"/>
+	</xsd:attributeGroup>
+	<xsd:complexType name="CantidadType">
+		<xsd:simpleContent>
+			<xsd:extension base="xsd:decimal">
+				<xsd:attributeGroup ref="cbc:Unidad"/>
+			</xsd:extension>
+		</xsd:simpleContent>
+	</xsd:complexType>
+	<xsd:complexType name="MontoType">
+		<xsd:simpleContent>
+			<xsd:extension base="xsd:decimal">
+				<xsd:attribute ref="cbc:moneda" use="required"/>
+			</xsd:extension>
+		</xsd:simpleContent>
+	</xsd:complexType>
+</xsd:schema>`)},
+}
+
+const documentoPrueba = `<?xml version="1.0" encoding="UTF-8"?>
+<doc:Documento xmlns:doc="urn:prueba:doc" xmlns:cac="urn:prueba:cac" xmlns:cbc="urn:prueba:cbc"
+	xmlns:ext="urn:oasis:names:specification:ubl:schema:xsd:CommonExtensionComponents-2" xml:lang="es">
+	<ext:UBLExtensions><ext:ExtensionContent></ext:ExtensionContent></ext:UBLExtensions>
+	<cbc:ID>F001-1</cbc:ID>
+	<cbc:IssueDate>2024-06-20</cbc:IssueDate>
+	<cac:Party xmlns:otro="urn:otro" otro:marca="x"><cbc:ID>20123456789</cbc:ID></cac:Party>
+	<cac:Datos><cbc:Vencimiento>PENDIENTE</cbc:Vencimiento><cbc:Codigos>1 2 3</cbc:Codigos></cac:Datos>
+	<cac:Line><cbc:ID>1</cbc:ID><cbc:Cantidad unitCode="NIU">2</cbc:Cantidad><cbc:Monto cbc:moneda="PEN">100.00</cbc:Monto></cac:Line>
+</doc:Documento>`
+
+func TestValidar(t *testing.T) {
+	esquema, err := CargarDocumentos(esquemasPrueba, "maindoc/Documento.xsd")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		reemplazo []string // pares original, reemplazo sobre documentoPrueba
+		firmado   bool
+		ruta      string
+		mensaje   string
+	}{
+		{name: "documento válido"},
+		{
+			name:      "elemento fuera de orden",
+			reemplazo: []string{"<cbc:ID>F001-1</cbc:ID>\n\t<cbc:IssueDate>2024-06-20</cbc:IssueDate>", "<cbc:IssueDate>2024-06-20</cbc:IssueDate>\n\t<cbc:ID>F001-1</cbc:ID>"},
+			ruta:      "/doc:Documento/cbc:ID",
+			mensaje:   "cbc:ID está fuera de orden: no puede ir después de cbc:IssueDate",
+		},
+		{
+			name:      "elemento desconocido",
+			reemplazo: []string{"<cac:Party ", "<cbc:Desconocido/><cac:Party "},
+			ruta:      "/doc:Documento/cbc:Desconocido",
+			mensaje:   "cbc:Desconocido no está permitido en doc:Documento",
+		},
+		{
+			name:      "falta elemento obligatorio",
+			reemplazo: []string{"<cbc:IssueDate>2024-06-20</cbc:IssueDate>", ""},
+			ruta:      "/doc:Documento",
+			mensaje:   "falta el elemento obligatorio cbc:IssueDate",
+		},
+		{
+			name:      "fecha inexistente",
+			reemplazo: []string{"2024-06-20", "2024-02-30"},
+			ruta:      "/doc:Documento/cbc:IssueDate",
+			mensaje:   "no es una fecha válida",
+		},
+		{
+			name:      "fecha con otro formato",
+			reemplazo: []string{"2024-06-20", "20/06/2024"},
+			ruta:      "/doc:Documento/cbc:IssueDate",
+			mensaje:   "no es una fecha válida (AAAA-MM-DD)",
+		},
+		{
+			name:      "decimal con coma",
+			reemplazo: []string{"100.00", "100,00"},
+			ruta:      "/doc:Documento/cac:Line/cbc:Monto",
+			mensaje:   "no es un decimal válido",
+		},
+		{
+			name:      "falta atributo obligatorio de un grupo de atributos",
+			reemplazo: []string{` unitCode="NIU"`, ""},
+			ruta:      "/doc:Documento/cac:Line/cbc:Cantidad",
+			mensaje:   "falta el atributo obligatorio unitCode",
+		},
+		{
+			name:      "atributo global fuera de la enumeración",
+			reemplazo: []string{`cbc:moneda="PEN"`, `cbc:moneda="EUR"`},
+			ruta:      "/doc:Documento/cac:Line/cbc:Monto/@cbc:moneda",
+			mensaje:   "no está entre los permitidos",
+		},
+		{
+			name:      "atributo no declarado",
+			reemplazo: []string{"<cbc:ID>F001-1</cbc:ID>", `<cbc:ID extra="1">F001-1</cbc:ID>`},
+			ruta:      "/doc:Documento/cbc:ID/@extra",
+			mensaje:   "atributo extra no permitido en cbc:ID",
+		},
+		{
+			name:      "elemento heredado por complexContent",
+			reemplazo: []string{"<cac:Line><cbc:ID>1</cbc:ID>", "<cac:Line>"},
+			ruta:      "/doc:Documento/cac:Line",
+			mensaje:   "falta el elemento obligatorio cbc:ID",
+		},
+		{
+			name:      "falta elemento obligatorio de xsd:all",
+			reemplazo: []string{"<cbc:Vencimiento>PENDIENTE</cbc:Vencimiento>", ""},
+			ruta:      "/doc:Documento/cac:Datos",
+			mensaje:   "falta el elemento obligatorio cbc:Vencimiento",
+		},
+		{
+			name:      "valor fuera de la unión",
+			reemplazo: []string{"PENDIENTE", "MAÑANA"},
+			ruta:      "/doc:Documento/cac:Datos/cbc:Vencimiento",
+			mensaje:   "no corresponde a ningún tipo de la unión",
+		},
+		{
+			name:      "elemento de lista inválido",
+			reemplazo: []string{"1 2 3", "1 dos 3"},
+			ruta:      "/doc:Documento/cac:Datos/cbc:Codigos",
+			mensaje:   "no es un entero válido",
+		},
+		{
+			name:    "documento firmado sin firma",
+			firmado: true,
+			ruta:    "/doc:Documento/ext:UBLExtensions/ext:ExtensionContent",
+			mensaje: "falta el elemento obligatorio cualquier elemento (##other)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			documento := documentoPrueba
+			if len(tt.reemplazo) == 2 {
+				require.Contains(t, documento, tt.reemplazo[0])
+				documento = strings.Replace(documento, tt.reemplazo[0], tt.reemplazo[1], 1)
+			}
+
+			var errores []Error
+			if tt.firmado {
+				errores = esquema.Validar([]byte(documento))
+			} else {
+				errores = esquema.ValidarSinFirmar([]byte(documento))
+			}
+
+			if tt.mensaje == "" {
+				assert.Empty(t, errores)
+				return
+			}
+			require.NotEmpty(t, errores)
+			assert.Equal(t, tt.ruta, errores[0].Ruta, errores)
+			assert.Contains(t, errores[0].Mensaje, tt.mensaje)
+		})
+	}
+}
+
+func TestCargarDocumentosErrores(t *testing.T) {
+	esquema := func(cuerpo string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(`<xsd:schema xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:p="urn:p" targetNamespace="urn:p">` + cuerpo + `</xsd:schema>`)}
+	}
+
+	tests := []struct {
+		name    string
+		cuerpo  string
+		mensaje string
+	}{
+		{"referencia a elemento no declarado", `<xsd:complexType name="T"><xsd:sequence><xsd:element ref="p:X"/></xsd:sequence></xsd:complexType>`, "elemento no declarado {urn:p}X"},
+		{"tipo no declarado", `<xsd:element name="E" type="p:NoExiste"/>`, "tipo no declarado {urn:p}NoExiste"},
+		{"grupo no declarado", `<xsd:complexType name="T"><xsd:sequence><xsd:group ref="p:G"/></xsd:sequence></xsd:complexType>`, "grupo no declarado"},
+		{"redefine", `<xsd:redefine schemaLocation="otro.xsd"/>`, "xsd:redefine no está soportado"},
+		{"importación inexistente", `<xsd:import namespace="urn:q" schemaLocation="q.xsd"/>`, "error leyendo esquema q.xsd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CargarDocumentos(fstest.MapFS{"p.xsd": esquema(tt.cuerpo)}, "p.xsd")
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.mensaje)
+		})
+	}
+}
+
+func TestCargarUBL21SinEsquemas(t *testing.T) {
+	_, err := cargarUBL21(fstest.MapFS{"esquemas/LEEME.md": {Data: []byte("# Esquemas")}})
+	assert.ErrorIs(t, err, ErrEsquemasNoInstalados)
+
+	// Los documentos OASIS sin las extensiones SUNAT tampoco son suficientes
+	sinSUNAT := fstest.MapFS{}
+	for _, documento := range documentosUBL {
+		sinSUNAT[documento] = &fstest.MapFile{Data: []byte(`<xsd:schema xmlns:xsd="http://www.w3.org/2001/XMLSchema"/>`)}
+	}
+	_, err = cargarUBL21(sinSUNAT)
+	require.ErrorIs(t, err, ErrEsquemasNoInstalados)
+	assert.Contains(t, err.Error(), "UBLPE")
+}
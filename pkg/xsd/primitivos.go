@@ -0,0 +1,86 @@
+package xsd
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	lexicoDecimal   = regexp.MustCompile(`^[+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)$`)
+	lexicoEntero    = regexp.MustCompile(`^[+-]?[0-9]+$`)
+	lexicoFecha     = regexp.MustCompile(`^(-?[0-9]{4,}-[0-9]{2}-[0-9]{2})(Z|[+-][0-9]{2}:[0-9]{2})?$`)
+	lexicoHora      = regexp.MustCompile(`^([0-9]{2}:[0-9]{2}:[0-9]{2})(\.[0-9]+)?(Z|[+-][0-9]{2}:[0-9]{2})?$`)
+	lexicoFechaHora = regexp.MustCompile(`^(-?[0-9]{4,}-[0-9]{2}-[0-9]{2})T([0-9]{2}:[0-9]{2}:[0-9]{2})(\.[0-9]+)?(Z|[+-][0-9]{2}:[0-9]{2})?$`)
+	lexicoBase64    = regexp.MustCompile(`^[A-Za-z0-9+/=\s]*$`)
+)
+
+// validarPrimitivo verifica la forma léxica de un tipo predefinido de XML Schema
+func validarPrimitivo(tipo, valor string) error {
+	if tipo != "string" {
+		valor = strings.TrimSpace(valor)
+	}
+
+	switch tipo {
+	case "decimal":
+		if !lexicoDecimal.MatchString(valor) {
+			return fmt.Errorf("el valor '%s' no es un decimal válido", valor)
+		}
+	case "integer", "int", "long", "short":
+		if !lexicoEntero.MatchString(valor) {
+			return fmt.Errorf("el valor '%s' no es un entero válido", valor)
+		}
+	case "nonNegativeInteger", "positiveInteger":
+		n, err := strconv.ParseInt(valor, 10, 64)
+		if err != nil || !lexicoEntero.MatchString(valor) || n < 0 || (tipo == "positiveInteger" && n == 0) {
+			return fmt.Errorf("el valor '%s' no es un %s válido", valor, tipo)
+		}
+	case "double", "float":
+		if valor != "INF" && valor != "-INF" && valor != "NaN" {
+			if _, err := strconv.ParseFloat(valor, 64); err != nil {
+				return fmt.Errorf("el valor '%s' no es un número válido", valor)
+			}
+		}
+	case "boolean":
+		switch valor {
+		case "true", "false", "1", "0":
+		default:
+			return fmt.Errorf("el valor '%s' no es un booleano válido (true o false)", valor)
+		}
+	case "date":
+		partes := lexicoFecha.FindStringSubmatch(valor)
+		if partes == nil {
+			return fmt.Errorf("el valor '%s' no es una fecha válida (AAAA-MM-DD)", valor)
+		}
+		if _, err := time.Parse("2006-01-02", partes[1]); err != nil {
+			return fmt.Errorf("el valor '%s' no es una fecha válida", valor)
+		}
+	case "time":
+		partes := lexicoHora.FindStringSubmatch(valor)
+		if partes == nil {
+			return fmt.Errorf("el valor '%s' no es una hora válida (hh:mm:ss)", valor)
+		}
+		if _, err := time.Parse("15:04:05", partes[1]); err != nil {
+			return fmt.Errorf("el valor '%s' no es una hora válida", valor)
+		}
+	case "dateTime":
+		partes := lexicoFechaHora.FindStringSubmatch(valor)
+		if partes == nil {
+			return fmt.Errorf("el valor '%s' no es una fecha y hora válida", valor)
+		}
+		if _, err := time.Parse("2006-01-02T15:04:05", partes[1]+"T"+partes[2]); err != nil {
+			return fmt.Errorf("el valor '%s' no es una fecha y hora válida", valor)
+		}
+	case "base64Binary":
+		if !lexicoBase64.MatchString(valor) {
+			return fmt.Errorf("el valor no es base64 válido")
+		}
+	case "normalizedString", "token":
+		if strings.ContainsAny(valor, "\r\n\t") {
+			return fmt.Errorf("el valor '%s' no admite saltos de línea ni tabulaciones", valor)
+		}
+	}
+	return nil
+}
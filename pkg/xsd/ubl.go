@@ -0,0 +1,75 @@
+package xsd
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+)
+
+// esquemasUBL contiene los esquemas oficiales OASIS UBL 2.1 (maindoc y common)
+// y las extensiones SUNAT, copiados sin modificar según esquemas/LEEME.md
+//
+//go:embed esquemas
+var esquemasUBL embed.FS
+
+// ErrEsquemasNoInstalados indica que el binario se compiló sin los esquemas
+// oficiales: la validación XSD no se puede realizar
+var ErrEsquemasNoInstalados = errors.New("los esquemas oficiales UBL 2.1 no están instalados en pkg/xsd/esquemas")
+
+// documentosUBL son los esquemas de los documentos que valida el servicio;
+// los módulos common se cargan siguiendo sus xsd:import
+var documentosUBL = []string{
+	"esquemas/maindoc/UBL-Invoice-2.1.xsd",
+	"esquemas/maindoc/UBL-CreditNote-2.1.xsd",
+	"esquemas/maindoc/UBL-DebitNote-2.1.xsd",
+}
+
+var (
+	ublUnaVez  sync.Once
+	ublEsquema *Esquema
+	ublError   error
+)
+
+// UBL21 retorna los esquemas UBL 2.1 de Invoice, CreditNote y DebitNote con
+// las extensiones SUNAT, compilados una sola vez por proceso. Retorna
+// ErrEsquemasNoInstalados si faltan los archivos oficiales.
+func UBL21() (*Esquema, error) {
+	ublUnaVez.Do(func() {
+		ublEsquema, ublError = cargarUBL21(esquemasUBL)
+	})
+	return ublEsquema, ublError
+}
+
+func cargarUBL21(fsys fs.FS) (*Esquema, error) {
+	raices := make([]string, 0, len(documentosUBL)+1)
+	for _, documento := range documentosUBL {
+		if _, err := fs.Stat(fsys, documento); err != nil {
+			return nil, fmt.Errorf("%w: falta %s", ErrEsquemasNoInstalados, path.Base(documento))
+		}
+		raices = append(raices, documento)
+	}
+
+	// Las extensiones SUNAT (UBLPE-*.xsd) no las importa ningún documento UBL
+	sunat := 0
+	err := fs.WalkDir(fsys, ".", func(ruta string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasPrefix(d.Name(), "UBLPE-") && strings.HasSuffix(d.Name(), ".xsd") {
+			raices = append(raices, ruta)
+			sunat++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error recorriendo los esquemas: %v", err)
+	}
+	if sunat == 0 {
+		return nil, fmt.Errorf("%w: faltan las extensiones SUNAT UBLPE-*.xsd", ErrEsquemasNoInstalados)
+	}
+	return CargarDocumentos(fsys, raices...)
+}
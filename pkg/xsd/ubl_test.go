@@ -0,0 +1,70 @@
+package xsd
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ublPrueba carga los esquemas oficiales u omite la prueba si el árbol no los incluye
+func ublPrueba(t *testing.T) *Esquema {
+	t.Helper()
+	esquema, err := UBL21()
+	if errors.Is(err, ErrEsquemasNoInstalados) {
+		t.Skipf("%v (ver esquemas/LEEME.md)", err)
+	}
+	require.NoError(t, err)
+	return esquema
+}
+
+func TestUBL21Documentos(t *testing.T) {
+	esquema := ublPrueba(t)
+
+	for _, archivo := range []string{"factura.xml", "nota_credito.xml", "nota_debito.xml"} {
+		t.Run(archivo, func(t *testing.T) {
+			data, err := os.ReadFile("testdata/" + archivo)
+			require.NoError(t, err)
+			assert.Empty(t, esquema.ValidarSinFirmar(data))
+		})
+	}
+}
+
+func TestUBL21Errores(t *testing.T) {
+	esquema := ublPrueba(t)
+	factura, err := os.ReadFile("testdata/factura.xml")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name              string
+		original, cambiar string
+		ruta, mensaje     string
+	}{
+		{"fuera de orden", "<cbc:ID>F001-00000001</cbc:ID>\n\t<cbc:IssueDate>2024-06-20</cbc:IssueDate>", "<cbc:IssueDate>2024-06-20</cbc:IssueDate>\n\t<cbc:ID>F001-00000001</cbc:ID>",
+			"/Invoice/cbc:ID", "fuera de orden"},
+		{"elemento desconocido", "<cbc:DocumentCurrencyCode>", "<cbc:Moneda>PEN</cbc:Moneda><cbc:DocumentCurrencyCode>",
+			"/Invoice/cbc:Moneda", "no está permitido"},
+		{"falta elemento obligatorio", "<cbc:IssueDate>2024-06-20</cbc:IssueDate>", "",
+			"/Invoice", "falta el elemento obligatorio cbc:IssueDate"},
+		{"fecha inválida", "<cbc:IssueDate>2024-06-20</cbc:IssueDate>", "<cbc:IssueDate>2024-06-31</cbc:IssueDate>",
+			"/Invoice/cbc:IssueDate", "no es una fecha válida"},
+		{"decimal inválido", `<cbc:PayableAmount currencyID="PEN">201.78</cbc:PayableAmount>`, `<cbc:PayableAmount currencyID="PEN">201,78</cbc:PayableAmount>`,
+			"/Invoice/cac:LegalMonetaryTotal/cbc:PayableAmount", "no es un decimal válido"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			documento := string(factura)
+			require.Contains(t, documento, tt.original)
+			documento = strings.Replace(documento, tt.original, tt.cambiar, 1)
+
+			errores := esquema.ValidarSinFirmar([]byte(documento))
+			require.NotEmpty(t, errores)
+			assert.Equal(t, tt.ruta, errores[0].Ruta, errores)
+			assert.Contains(t, errores[0].Mensaje, tt.mensaje)
+		})
+	}
+}
@@ -0,0 +1,540 @@
+package xsd
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// espacioXSI es el espacio de nombres de los atributos xsi:* de una instancia
+const espacioXSI = "http://www.w3.org/2001/XMLSchema-instance"
+
+// contenidoExtension es ext:ExtensionContent, que recibe la firma digital
+var contenidoExtension = xml.Name{
+	Space: "urn:oasis:names:specification:ubl:schema:xsd:CommonExtensionComponents-2",
+	Local: "ExtensionContent",
+}
+
+// Error es un incumplimiento del esquema ubicado mediante una expresión XPath
+type Error struct {
+	Ruta    string `json:"ruta"`
+	Mensaje string `json:"mensaje"`
+}
+
+func (e Error) Error() string {
+	return e.Ruta + ": " + e.Mensaje
+}
+
+// nodo es un elemento del documento instancia
+type nodo struct {
+	nombre    xml.Name
+	atributos []xml.Attr
+	hijos     []*nodo
+	texto     strings.Builder
+}
+
+// Validar verifica el documento contra el esquema: orden y cardinalidad de los
+// elementos, atributos obligatorios y tipos de datos. Retorna todos los
+// incumplimientos encontrados; un documento válido retorna una lista vacía.
+func (e *Esquema) Validar(data []byte) []Error {
+	return e.validar(data, false)
+}
+
+// ValidarSinFirmar valida un comprobante antes de firmarlo: admite vacío el
+// ext:ExtensionContent donde irá la firma, que el esquema exige con contenido.
+func (e *Esquema) ValidarSinFirmar(data []byte) []Error {
+	return e.validar(data, true)
+}
+
+func (e *Esquema) validar(data []byte, sinFirmar bool) []Error {
+	raiz, err := leerDocumento(data)
+	if err != nil {
+		return []Error{{Ruta: "/", Mensaje: fmt.Sprintf("XML mal formado: %v", err)}}
+	}
+
+	v := &validacion{esquema: e, sinFirmar: sinFirmar}
+	ruta := "/" + e.nombreCalificado(raiz.nombre)
+	decl, ok := e.elementos[raiz.nombre]
+	if !ok {
+		v.agregar(ruta, "el elemento raíz %s no está declarado en los esquemas", e.nombreCalificado(raiz.nombre))
+		return v.errores
+	}
+	v.validarElemento(decl, raiz, ruta)
+	return v.errores
+}
+
+func leerDocumento(data []byte) (*nodo, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var pila []*nodo
+	var raiz *nodo
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			n := &nodo{nombre: t.Name, atributos: t.Attr}
+			if len(pila) > 0 {
+				padre := pila[len(pila)-1]
+				padre.hijos = append(padre.hijos, n)
+			} else if raiz == nil {
+				raiz = n
+			}
+			pila = append(pila, n)
+		case xml.EndElement:
+			pila = pila[:len(pila)-1]
+		case xml.CharData:
+			if len(pila) > 0 {
+				pila[len(pila)-1].texto.Write(t)
+			}
+		}
+	}
+	if raiz == nil {
+		return nil, fmt.Errorf("el documento no tiene elemento raíz")
+	}
+	return raiz, nil
+}
+
+type validacion struct {
+	esquema   *Esquema
+	sinFirmar bool
+	errores   []Error
+}
+
+func (v *validacion) agregar(ruta, formato string, args ...interface{}) {
+	v.errores = append(v.errores, Error{Ruta: ruta, Mensaje: fmt.Sprintf(formato, args...)})
+}
+
+// nombreCalificado muestra el nombre con el prefijo que usan los esquemas (cac, cbc, ext...)
+func (e *Esquema) nombreCalificado(nombre xml.Name) string {
+	if prefijo, ok := e.prefijos[nombre.Space]; ok && prefijo != "" {
+		return prefijo + ":" + nombre.Local
+	}
+	return nombre.Local
+}
+
+func (v *validacion) validarElemento(decl *elemento, n *nodo, ruta string) {
+	tc := decl.complejo
+	ts := decl.simple
+	if tc == nil && ts == nil {
+		tc = v.esquema.complejos[decl.tipo]
+		ts = v.esquema.simples[decl.tipo]
+	}
+	if tc != nil && !tc.resuelto {
+		if err := v.esquema.resolverComplejo(tc, 0); err != nil {
+			v.agregar(ruta, "%v", err)
+			return
+		}
+	}
+
+	if tc == nil {
+		tipo := decl.tipo
+		if ts != nil {
+			tipo = ts.nombre
+		}
+		if tipo.Space == EspacioXSD && tipo.Local == "anyType" {
+			return
+		}
+		v.validarAtributos(nil, n, ruta)
+		if len(n.hijos) > 0 {
+			v.agregar(ruta, "%s no admite elementos hijos", v.esquema.nombreCalificado(n.nombre))
+			return
+		}
+		if err := v.validarValor(tipo, ts, n.texto.String()); err != nil {
+			v.agregar(ruta, "%v", err)
+		}
+		return
+	}
+
+	v.validarAtributos(tc, n, ruta)
+	if tc.simple {
+		if len(n.hijos) > 0 {
+			v.agregar(ruta, "%s no admite elementos hijos", v.esquema.nombreCalificado(n.nombre))
+			return
+		}
+		if err := v.validarValor(tc.texto, nil, n.texto.String()); err != nil {
+			v.agregar(ruta, "%v", err)
+		}
+		return
+	}
+
+	if !tc.mixto && strings.TrimSpace(n.texto.String()) != "" {
+		v.agregar(ruta, "%s no admite contenido de texto", v.esquema.nombreCalificado(n.nombre))
+	}
+	v.validarContenido(tc.contenido, n, ruta)
+}
+
+func (v *validacion) validarAtributos(tc *tipoComplejo, n *nodo, ruta string) {
+	presentes := make(map[xml.Name]bool, len(n.atributos))
+	for _, attr := range n.atributos {
+		if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") || attr.Name.Space == espacioXSI {
+			continue
+		}
+		nombre := v.esquema.nombreCalificado(attr.Name)
+		rutaAtributo := ruta + "/@" + nombre
+		var decl *atributo
+		if tc != nil {
+			decl = tc.atributos[attr.Name]
+		}
+		if decl == nil && tc != nil && tc.cualquierAtributo {
+			// xsd:anyAttribute: se valida solo si el atributo está declarado globalmente
+			decl = v.esquema.atributos[attr.Name]
+			if decl == nil {
+				continue
+			}
+		}
+		if decl == nil {
+			v.agregar(rutaAtributo, "atributo %s no permitido en %s", nombre, v.esquema.nombreCalificado(n.nombre))
+			continue
+		}
+		presentes[attr.Name] = true
+		if err := v.validarValor(decl.tipo, decl.simple, attr.Value); err != nil {
+			v.agregar(rutaAtributo, "%v", err)
+		}
+	}
+	if tc == nil {
+		return
+	}
+	for nombre, decl := range tc.atributos {
+		if decl.requerido && !presentes[nombre] {
+			v.agregar(ruta, "falta el atributo obligatorio %s", v.esquema.nombreCalificado(nombre))
+		}
+	}
+}
+
+func (v *validacion) validarValor(tipo xml.Name, ts *tipoSimple, valor string) error {
+	if ts == nil {
+		ts = v.esquema.simples[tipo]
+	}
+	if ts == nil {
+		if tipo.Space != EspacioXSD {
+			return fmt.Errorf("tipo %s no declarado", tipo.Local)
+		}
+		return validarPrimitivo(tipo.Local, valor)
+	}
+
+	switch ts.variedad {
+	case variedadLista:
+		for _, item := range strings.Fields(valor) {
+			if err := v.validarValor(ts.base, ts.baseSimple, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case variedadUnion:
+		for _, miembro := range ts.miembros {
+			if v.validarValor(miembro, nil, valor) == nil {
+				return nil
+			}
+		}
+		for _, anonimo := range ts.anonimos {
+			if v.validarValor(anonimo.nombre, anonimo, valor) == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("el valor '%s' no corresponde a ningún tipo de la unión %s", valor, ts.nombre.Local)
+	}
+
+	if err := v.validarValor(ts.base, ts.baseSimple, valor); err != nil {
+		return err
+	}
+	if ts.baseSimple != nil || ts.base.Space != EspacioXSD || ts.base.Local != "string" {
+		valor = strings.TrimSpace(valor)
+	}
+	longitud := len([]rune(valor))
+	if ts.longitud != nil && longitud != *ts.longitud {
+		return fmt.Errorf("el valor '%s' debe tener %d caracteres", valor, *ts.longitud)
+	}
+	if ts.minLongitud != nil && longitud < *ts.minLongitud {
+		return fmt.Errorf("el valor '%s' debe tener al menos %d caracteres", valor, *ts.minLongitud)
+	}
+	if ts.maxLongitud != nil && longitud > *ts.maxLongitud {
+		return fmt.Errorf("el valor '%s' excede los %d caracteres permitidos", valor, *ts.maxLongitud)
+	}
+	if len(ts.enumeracion) > 0 {
+		permitido := false
+		for _, opcion := range ts.enumeracion {
+			if valor == opcion {
+				permitido = true
+				break
+			}
+		}
+		if !permitido {
+			return fmt.Errorf("el valor '%s' no está entre los permitidos (%s)", valor, strings.Join(ts.enumeracion, ", "))
+		}
+	}
+	for _, patron := range ts.patrones {
+		if !patron.MatchString(valor) {
+			return fmt.Errorf("el valor '%s' no cumple el patrón de %s", valor, ts.nombre.Local)
+		}
+	}
+	return nil
+}
+
+// emparejador recorre los hijos de un elemento contra su modelo de contenido.
+// UBL declara secuencias de elementos con nombres distintos, por lo que un
+// recorrido voraz con retroceso por ocurrencia es suficiente.
+type emparejador struct {
+	hijos        []*nodo
+	asignaciones []*particula
+	faltantes    []xml.Name
+}
+
+func (m *emparejador) emparejar(p *particula, pos int) int {
+	switch p.clase {
+	case claseElemento:
+		nombre := p.ref
+		cuenta := 0
+		for (p.max == ilimitado || cuenta < p.max) && pos < len(m.hijos) && m.hijos[pos].nombre == nombre {
+			m.asignaciones[pos] = p
+			pos++
+			cuenta++
+		}
+		if cuenta < p.min {
+			m.faltantes = append(m.faltantes, nombre)
+		}
+		return pos
+
+	case claseTodos:
+		// xsd:all: cada elemento a lo sumo una vez y en cualquier orden
+		usados := make(map[*particula]bool, len(p.hijos))
+		for pos < len(m.hijos) {
+			var siguiente *particula
+			for _, hijo := range p.hijos {
+				if !usados[hijo] && hijo.ref == m.hijos[pos].nombre {
+					siguiente = hijo
+					break
+				}
+			}
+			if siguiente == nil {
+				break
+			}
+			usados[siguiente] = true
+			m.asignaciones[pos] = siguiente
+			pos++
+		}
+		if len(usados) > 0 || p.min > 0 {
+			for _, hijo := range p.hijos {
+				if !usados[hijo] && hijo.min > 0 {
+					m.faltantes = append(m.faltantes, hijo.ref)
+				}
+			}
+		}
+		return pos
+
+	case claseAny:
+		cuenta := 0
+		for (p.max == ilimitado || cuenta < p.max) && pos < len(m.hijos) && p.admiteEspacio(m.hijos[pos].nombre.Space) {
+			m.asignaciones[pos] = p
+			pos++
+			cuenta++
+		}
+		if cuenta < p.min {
+			m.faltantes = append(m.faltantes, xml.Name{Local: "cualquier elemento (" + p.espacios + ")"})
+		}
+		return pos
+
+	default:
+		cuenta := 0
+		for p.max == ilimitado || cuenta < p.max {
+			inicio := pos
+			faltantes := len(m.faltantes)
+			pos = m.ocurrencia(p, pos)
+			completa := len(m.faltantes) == faltantes
+			if !completa && cuenta >= p.min {
+				m.revertir(inicio, pos, faltantes)
+				pos = inicio
+				break
+			}
+			cuenta++
+			if pos == inicio || !completa {
+				break
+			}
+		}
+		return pos
+	}
+}
+
+// ocurrencia empareja una sola repetición de una secuencia o elección
+func (m *emparejador) ocurrencia(p *particula, pos int) int {
+	if p.clase == claseSecuencia {
+		for _, hijo := range p.hijos {
+			pos = m.emparejar(hijo, pos)
+		}
+		return pos
+	}
+
+	faltantes := len(m.faltantes)
+	for _, alternativa := range p.hijos {
+		siguiente := m.emparejar(alternativa, pos)
+		if siguiente > pos && len(m.faltantes) == faltantes {
+			return siguiente
+		}
+		m.revertir(pos, siguiente, faltantes)
+	}
+	for _, alternativa := range p.hijos {
+		if alternativa.min == 0 {
+			return pos
+		}
+	}
+	m.faltantes = append(m.faltantes, p.nombres()...)
+	return pos
+}
+
+func (m *emparejador) revertir(desde, hasta, faltantes int) {
+	for i := desde; i < hasta; i++ {
+		m.asignaciones[i] = nil
+	}
+	m.faltantes = m.faltantes[:faltantes]
+}
+
+func (p *particula) admiteEspacio(espacio string) bool {
+	switch p.espacios {
+	case "##any":
+		return true
+	case "##other":
+		return espacio != p.destino && espacio != ""
+	case "##local":
+		return espacio == ""
+	case "##targetNamespace":
+		return espacio == p.destino
+	}
+	for _, permitido := range strings.Fields(p.espacios) {
+		if permitido == espacio {
+			return true
+		}
+	}
+	return false
+}
+
+// nombres lista los elementos que puede contener una partícula
+func (p *particula) nombres() []xml.Name {
+	if p.clase == claseElemento {
+		return []xml.Name{p.ref}
+	}
+	var nombres []xml.Name
+	for _, hijo := range p.hijos {
+		nombres = append(nombres, hijo.nombres()...)
+	}
+	return nombres
+}
+
+func (v *validacion) validarContenido(contenido *particula, n *nodo, ruta string) {
+	e := v.esquema
+	padre := e.nombreCalificado(n.nombre)
+	rutas := rutasHijos(e, n, ruta)
+
+	if v.sinFirmar && n.nombre == contenidoExtension && len(n.hijos) == 0 {
+		return
+	}
+	if contenido == nil {
+		for i, hijo := range n.hijos {
+			v.agregar(rutas[i], "%s no está permitido: %s no admite elementos hijos", e.nombreCalificado(hijo.nombre), padre)
+		}
+		return
+	}
+
+	m := &emparejador{hijos: n.hijos, asignaciones: make([]*particula, len(n.hijos))}
+	pos := m.emparejar(contenido, 0)
+
+	declarados := make(map[xml.Name]bool)
+	for _, nombre := range contenido.nombres() {
+		declarados[nombre] = true
+	}
+
+	sobrantes := make(map[xml.Name]bool)
+	if pos < len(n.hijos) {
+		hijo := n.hijos[pos]
+		nombre := e.nombreCalificado(hijo.nombre)
+		switch {
+		case declarados[hijo.nombre] && pos > 0:
+			v.agregar(rutas[pos], "%s está fuera de orden: no puede ir después de %s", nombre, e.nombreCalificado(n.hijos[pos-1].nombre))
+		case declarados[hijo.nombre]:
+			v.agregar(rutas[pos], "%s está fuera de orden o excede la cantidad permitida en %s", nombre, padre)
+		default:
+			v.agregar(rutas[pos], "%s no está permitido en %s", nombre, padre)
+		}
+		for _, sobrante := range n.hijos[pos:] {
+			sobrantes[sobrante.nombre] = true
+		}
+	}
+
+	reportados := make(map[xml.Name]bool)
+	for _, faltante := range m.faltantes {
+		if sobrantes[faltante] || reportados[faltante] {
+			continue
+		}
+		reportados[faltante] = true
+		v.agregar(ruta, "falta el elemento obligatorio %s", e.nombreCalificado(faltante))
+	}
+
+	for i, hijo := range n.hijos {
+		p := m.asignaciones[i]
+		if p == nil {
+			// Los elementos que quedaron fuera del modelo se validan con su declaración para reportar también sus errores internos
+			if decl := buscarDeclaracion(e, contenido, hijo.nombre); decl != nil {
+				v.validarElemento(decl, hijo, rutas[i])
+			}
+			continue
+		}
+		if p.clase == claseAny {
+			if p.proceso == "skip" {
+				continue
+			}
+			decl, ok := e.elementos[hijo.nombre]
+			if !ok {
+				if p.proceso == "strict" {
+					v.agregar(rutas[i], "%s no está declarado en los esquemas", e.nombreCalificado(hijo.nombre))
+				}
+				continue
+			}
+			v.validarElemento(decl, hijo, rutas[i])
+			continue
+		}
+		decl := p.elemento
+		if decl == nil {
+			decl = e.elementos[p.ref]
+		}
+		v.validarElemento(decl, hijo, rutas[i])
+	}
+}
+
+func buscarDeclaracion(e *Esquema, p *particula, nombre xml.Name) *elemento {
+	if p.clase == claseElemento && p.ref == nombre {
+		if p.elemento != nil {
+			return p.elemento
+		}
+		return e.elementos[p.ref]
+	}
+	for _, hijo := range p.hijos {
+		if decl := buscarDeclaracion(e, hijo, nombre); decl != nil {
+			return decl
+		}
+	}
+	return nil
+}
+
+// rutasHijos construye la expresión XPath de cada hijo, con posición cuando el nombre se repite
+func rutasHijos(e *Esquema, n *nodo, ruta string) []string {
+	total := make(map[xml.Name]int)
+	for _, hijo := range n.hijos {
+		total[hijo.nombre]++
+	}
+	vistos := make(map[xml.Name]int)
+	rutas := make([]string, len(n.hijos))
+	for i, hijo := range n.hijos {
+		vistos[hijo.nombre]++
+		rutas[i] = ruta + "/" + e.nombreCalificado(hijo.nombre)
+		if total[hijo.nombre] > 1 {
+			rutas[i] += fmt.Sprintf("[%d]", vistos[hijo.nombre])
+		}
+	}
+	return rutas
+}
@@ -1,3 +1,5 @@
+//go:build ignore
+
 package main
 
 import (
@@ -50,7 +52,7 @@ func main() {
 				"cantidad": 5,
 				"valor_unitario": 200.00,
 				"precio_unitario": 0.00,
-				"tipo_afectacion": 30, // Gratuito - Operación Gratuita
+				"tipo_afectacion": 14, // Gravado - Retiro por publicidad
 				"valor_venta": 1000.00,
 				"valor_total": 0.00,
 				"impuesto_item": []map[string]interface{}{
@@ -72,7 +74,7 @@ func main() {
 				"cantidad": 10,
 				"valor_unitario": 50.00,
 				"precio_unitario": 0.00,
-				"tipo_afectacion": 30, // Gratuito - Operación Gratuita
+				"tipo_afectacion": 12, // Gravado - Retiro por donación
 				"valor_venta": 500.00,
 				"valor_total": 0.00,
 				"impuesto_item": []map[string]interface{}{
@@ -87,9 +89,9 @@ func main() {
 			},
 		},
 		"totales": map[string]interface{}{
-			"total_valor_venta": 1500.00,
+			"total_valor_venta": 0.00,
 			"total_venta_gratuita": 1500.00,
-			"total_impuestos": 270.00,
+			"total_impuestos": 0.00,
 			"total_precio_venta": 0.00,
 			"importe_total": 0.00,
 		},
@@ -1,3 +1,5 @@
+//go:build ignore
+
 package main
 
 import (
@@ -72,7 +74,7 @@ func main() {
 				"cantidad": 2,
 				"valor_unitario": 50.00,
 				"precio_unitario": 0.00,
-				"tipo_afectacion": 30, // Gratuito - Operación Gratuita
+				"tipo_afectacion": 15, // Gravado - Bonificaciones
 				"valor_venta": 100.00,
 				"valor_total": 0.00,
 				"impuesto_item": []map[string]interface{}{
@@ -90,7 +92,7 @@ func main() {
 			"total_valor_venta": 1100.00,
 			"total_venta_gravada": 1000.00,
 			"total_venta_gratuita": 100.00,
-			"total_impuestos": 198.00,
+			"total_impuestos": 180.00,
 			"total_precio_venta": 1180.00,
 			"importe_total": 1180.00,
 		},
@@ -1,3 +1,5 @@
+//go:build ignore
+
 package main
 
 import (
@@ -21,6 +23,7 @@ func main() {
 		"numero": "00000008",
 		"fecha_emision": "2024-01-15T10:30:00Z",
 		"tipo_moneda": "PEN",
+		"tipo_operacion": "2001", // Operación sujeta a percepción
 		"emisor": map[string]interface{}{
 			"ruc": "20103129061",
 			"razon_social": "EMPRESA DEMO S.A.C.",
@@ -72,6 +75,7 @@ func main() {
 			"importe_total": 11800.00,
 		},
 		"percepcion": map[string]interface{}{
+			"codigo_regimen": "51", // Percepción venta interna
 			"base_imponible": 11800.00,
 			"porcentaje": 2.0,
 			"monto": 236.00,